@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+var groups model.GroupSlice
+var groupMutex sync.RWMutex
+
+// FindGroupsWithCache キャッシュかストアからグループを取得する
+func FindGroupsWithCache(ctx context.Context, cli *firestore.Client) (model.GroupSlice, error) {
+	g := GetGroups()
+	if g != nil {
+		return g, nil
+	}
+
+	temp, err := store.FindGroups(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+
+	SetGroups(temp)
+	return temp, nil
+}
+
+// GetGroups キャッシュからグループを取得する
+func GetGroups() model.GroupSlice {
+	groupMutex.RLock()
+	defer groupMutex.RUnlock()
+
+	return groups
+}
+
+// SetGroups グループをキャッシュする
+func SetGroups(g model.GroupSlice) {
+	groupMutex.Lock()
+	defer groupMutex.Unlock()
+
+	groups = g
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+var organization *model.Organization
+var organizationMutex sync.RWMutex
+
+// FindOrganizationWithCache キャッシュかストアから組織の情報を取得する
+// 登録されていない場合は空の組織を返す
+func FindOrganizationWithCache(ctx context.Context, cli *firestore.Client) (model.Organization, error) {
+	o := GetOrganization()
+	if o != nil {
+		return *o, nil
+	}
+
+	temp, err := store.FindOrganization(ctx, cli)
+	if err != nil && err != common.ErrNotFound {
+		return model.Organization{}, err
+	}
+
+	// 登録されていない場合も毎回ストアを読まないように空の組織をキャッシュする
+	SetOrganization(temp)
+	return temp, nil
+}
+
+// GetOrganization キャッシュから組織の情報を取得する
+func GetOrganization() *model.Organization {
+	organizationMutex.RLock()
+	defer organizationMutex.RUnlock()
+
+	return organization
+}
+
+// SetOrganization 組織の情報をキャッシュする
+func SetOrganization(o model.Organization) {
+	organizationMutex.Lock()
+	defer organizationMutex.Unlock()
+
+	organization = &o
+}
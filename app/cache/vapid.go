@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/notify"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+var vapidKey *model.VAPIDKey
+var vapidKeyMutex sync.RWMutex
+
+// FindVAPIDKeyWithCache キャッシュかストアからVAPIDの鍵を取得する
+// 保存されていない場合は作成する
+// 鍵は変更されないので一度取得したら常にキャッシュを使用する
+func FindVAPIDKeyWithCache(ctx context.Context, cli *firestore.Client) (model.VAPIDKey, error) {
+	vapidKeyMutex.RLock()
+	k := vapidKey
+	vapidKeyMutex.RUnlock()
+	if k != nil {
+		return *k, nil
+	}
+
+	temp, err := store.FindOrCreateVAPIDKey(ctx, cli, notify.GenerateVAPIDKey)
+	if err != nil {
+		return model.VAPIDKey{}, err
+	}
+
+	vapidKeyMutex.Lock()
+	defer vapidKeyMutex.Unlock()
+	vapidKey = &temp
+	return temp, nil
+}
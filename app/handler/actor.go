@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/app/cache"
+	"github.com/yaegaki/dotlive-schedule-server/app/service"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// actorVideoDefaultLimit 1ページあたりのデフォルトの動画数
+	actorVideoDefaultLimit = 20
+	// actorVideoMaxLimit 1ページあたりの最大の動画数
+	actorVideoMaxLimit = 100
+)
+
+// RouteActor 配信者関連のルーティングを設定する
+func RouteActor(e *echo.Echo) {
+	e.GET("/api/actors/:id/videos", actorVideosHandler)
+	e.GET("/api/actors/:id/upcoming", actorUpcomingHandler)
+}
+
+func actorVideosHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	client := store.GetClient()
+
+	actors, err := cache.FindActorsWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	actor, err := actors.FindActor(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "not found")
+	}
+
+	query := c.Request().URL.Query()
+	loc, err := parseLocationQuery(query)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	limit := actorVideoDefaultLimit
+	if l := query.Get("limit"); l != "" {
+		temp, err := strconv.Atoi(l)
+		if err != nil || temp <= 0 {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		limit = temp
+		if limit > actorVideoMaxLimit {
+			limit = actorVideoMaxLimit
+		}
+	}
+
+	var cursor *service.VideoCursor
+	if s := query.Get("cursor"); s != "" {
+		temp, err := parseVideoCursor(s)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		cursor = &temp
+	}
+
+	// sinceが指定されていない場合は全期間
+	var since jst.Time
+	if s := query.Get("since"); s != "" {
+		temp, err := parseYearMonthDayQueryInLocation(s, loc)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		since = temp
+	} else {
+		since = jst.From(time.Unix(0, 0))
+	}
+
+	page, err := service.FindActorVideos(ctx, client, actor, since, cursor, limit)
+	if err != nil {
+		log.Printf("can not find actor videos: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	res := ActorVideosResponse{
+		Videos: ActorVideoSlice{},
+	}
+	for _, v := range page.Videos {
+		res.Videos = append(res.Videos, ActorVideo{
+			ID:         v.ID,
+			URL:        v.URL,
+			Source:     v.Source,
+			StartAt:    v.StartAt.In(loc),
+			IsLive:     v.IsLive,
+			MemberOnly: v.MemberOnly,
+			Text:       v.Text,
+			OwnerName:  v.OwnerName,
+			Collabo:    v.ActorID != actor.ID,
+		})
+	}
+	if page.Next != nil {
+		res.Cursor = formatVideoCursor(*page.Next)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func actorUpcomingHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	client := store.GetClient()
+
+	actors, err := cache.FindActorsWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	org, err := cache.FindOrganizationWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	actor, err := actors.FindActor(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "not found")
+	}
+
+	loc, err := parseLocationQuery(c.Request().URL.Query())
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	entries, err := service.CreateUpcomingSchedule(ctx, client, actor, jst.Now(), actors, org)
+	if err != nil {
+		log.Printf("can not create upcoming schedule: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	for i := range entries {
+		entries[i].StartAt = entries[i].StartAt.In(loc)
+	}
+
+	return c.JSON(http.StatusOK, ActorUpcomingResponse{
+		Entries: entries,
+	})
+}
+
+// formatVideoCursor カーソルを'開始時刻(unix秒)_動画ID'形式の文字列にする
+func formatVideoCursor(cursor service.VideoCursor) string {
+	return fmt.Sprintf("%v_%v", cursor.StartAt.Time().Unix(), cursor.VideoID)
+}
+
+// parseVideoCursor '開始時刻(unix秒)_動画ID'形式の文字列をパースする
+func parseVideoCursor(s string) (service.VideoCursor, error) {
+	xs := strings.SplitN(s, "_", 2)
+	if len(xs) == 2 && xs[1] != "" {
+		sec, err := strconv.ParseInt(xs[0], 10, 64)
+		if err == nil {
+			return service.VideoCursor{
+				StartAt: jst.From(time.Unix(sec, 0)),
+				VideoID: xs[1],
+			}, nil
+		}
+	}
+
+	return service.VideoCursor{}, xerrors.Errorf("Can not parse cursor: %v", s)
+}
+
+// ActorVideosResponse 配信者の動画一覧APIのレスポンス
+type ActorVideosResponse struct {
+	// Videos 動画
+	Videos ActorVideoSlice `json:"videos"`
+	// Cursor 次のページを取得するためのカーソル
+	// 次のページが存在しない場合は空文字
+	Cursor string `json:"cursor"`
+}
+
+// ActorVideo 配信者の動画
+type ActorVideo struct {
+	// ID 動画ID
+	ID string `json:"id"`
+	// URL 動画のURL
+	URL string `json:"url"`
+	// Source 配信サイト
+	Source string `json:"source"`
+	// StartAt 配信開始時刻
+	StartAt jst.Time `json:"startAt"`
+	// IsLive 生放送かどうか
+	IsLive bool `json:"isLive"`
+	// MemberOnly メンバー限定かどうか
+	MemberOnly bool `json:"memberOnly"`
+	// Text 説明
+	Text string `json:"text"`
+	// OwnerName 動画配信者の名前
+	OwnerName string `json:"ownerName"`
+	// Collabo 他の配信者の枠でのコラボかどうか
+	Collabo bool `json:"collabo"`
+}
+
+// ActorVideoSlice ActorVideoのスライス
+type ActorVideoSlice []ActorVideo
+
+// ActorUpcomingResponse 配信者の配信予定APIのレスポンス
+type ActorUpcomingResponse struct {
+	// Entries 配信予定
+	Entries []model.ScheduleEntry `json:"entries"`
+}
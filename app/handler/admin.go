@@ -0,0 +1,319 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/app/cache"
+	"github.com/yaegaki/dotlive-schedule-server/app/internal"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// adminPathPrefix 管理用APIのパス
+const adminPathPrefix = "/api/admin"
+
+// RouteAdmin 管理用APIのルーティングを設定する
+func RouteAdmin(e *echo.Echo) {
+	g := e.Group(adminPathPrefix, adminAuthMiddleware)
+	g.GET("/organization", adminGetOrganizationHandler)
+	g.PUT("/organization", adminPutOrganizationHandler)
+	g.GET("/actors", adminGetActorsHandler)
+	g.POST("/actors", adminPostActorHandler)
+	g.GET("/actors/:id", adminGetActorHandler)
+	g.PUT("/actors/:id", adminPutActorHandler)
+	g.DELETE("/actors/:id", adminDeleteActorHandler)
+	g.PUT("/actors/:id/attributes", adminPutActorAttributesHandler)
+	g.GET("/groups", adminGetGroupsHandler)
+	g.PUT("/groups/:id", adminPutGroupHandler)
+	g.GET("/notifications", adminGetNotificationsHandler)
+	g.GET("/webhooks", adminGetWebhooksHandler)
+	g.POST("/webhooks", adminPostWebhookHandler)
+	g.GET("/webhooks/:id", adminGetWebhookHandler)
+	g.PUT("/webhooks/:id", adminPutWebhookHandler)
+	g.DELETE("/webhooks/:id", adminDeleteWebhookHandler)
+}
+
+// groupIDPattern グループIDに使用できる文字
+// グループIDはトピック名に使用するのでFCMのトピック名に使用できる文字だけにする
+var groupIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_.~-]+$`)
+
+// adminAuthMiddleware Authorizationヘッダのトークンを検証する
+// ADMIN_TOKENが設定されていない場合は全てのリクエストを拒否する
+func adminAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := internal.AdminToken
+		auth := c.Request().Header.Get(echo.HeaderAuthorization)
+		if token == "" || subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+			return c.String(http.StatusUnauthorized, "unauthorized")
+		}
+
+		return next(c)
+	}
+}
+
+// AdminOrganization 管理用APIの組織の情報
+type AdminOrganization struct {
+	// Name 組織名
+	Name string `json:"name"`
+	// FallbackIcon 配信者が分からない配信で使用するアイコンURL
+	FallbackIcon string `json:"fallbackIcon"`
+	// TwitterScreenName 計画ツイートを投稿する公式アカウントのスクリーンネーム
+	TwitterScreenName string `json:"twitterScreenName"`
+	// YoutubeChannelID 公式のYoutubeチャンネルID
+	YoutubeChannelID string `json:"youtubeChannelId"`
+	// YoutubeChannelName 公式のYoutubeチャンネル名
+	YoutubeChannelName string `json:"youtubeChannelName"`
+}
+
+// AdminActorAttributes 管理用APIの配信者の属性
+type AdminActorAttributes struct {
+	// UploadsArePlanned 生放送ではない動画を常に計画された配信として扱うかどうか
+	UploadsArePlanned bool `json:"uploadsArePlanned"`
+	// Groups 所属するグループのID
+	Groups []string `json:"groups"`
+	// Status 活動状況
+	// 空文字の場合は活動中とする
+	Status string `json:"status"`
+	// ActiveFrom 活動開始日('2020-4-29'形式)
+	// 分からない場合は空文字
+	ActiveFrom string `json:"activeFrom"`
+	// ActiveUntil 活動終了日('2020-4-29'形式)
+	// 活動中の場合は空文字
+	ActiveUntil string `json:"activeUntil"`
+}
+
+// parseAdminDate '2020-4-29'形式の日付をパースする
+// 空文字の場合はゼロ値
+func parseAdminDate(s string) (jst.Time, error) {
+	if s == "" {
+		return jst.Time{}, nil
+	}
+
+	return parseYearMonthDayQuery(s)
+}
+
+// formatAdminDate parseAdminDateでパースできる形式にする
+func formatAdminDate(t jst.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return fmt.Sprintf("%v-%v-%v", t.Year(), int(t.Month()), t.Day())
+}
+
+// AdminGroup 管理用APIのグループ
+type AdminGroup struct {
+	// ID グループID
+	ID string `json:"id"`
+	// Name 名前
+	Name string `json:"name"`
+	// Topic プッシュ通知のトピック名
+	Topic string `json:"topic"`
+}
+
+func newAdminGroup(g model.Group) AdminGroup {
+	return AdminGroup{
+		ID:    g.ID,
+		Name:  g.Name,
+		Topic: g.Topic(),
+	}
+}
+
+func newAdminOrganization(o model.Organization) AdminOrganization {
+	return AdminOrganization{
+		Name:               o.Name,
+		FallbackIcon:       o.FallbackIcon,
+		TwitterScreenName:  o.TwitterScreenName,
+		YoutubeChannelID:   o.YoutubeChannelID,
+		YoutubeChannelName: o.YoutubeChannelName,
+	}
+}
+
+// validate 組織の情報が正しいかどうか
+// 計画ツイートの取得に必要なので公式アカウントは必須
+func (o AdminOrganization) validate() bool {
+	if o.Name == "" || o.TwitterScreenName == "" {
+		return false
+	}
+
+	// チャンネル名は公式の動画かどうかの判定に使用するのでIDとセットで必要
+	if (o.YoutubeChannelID == "") != (o.YoutubeChannelName == "") {
+		return false
+	}
+
+	return true
+}
+
+func adminGetOrganizationHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	o, err := store.FindOrganization(ctx, store.GetClient())
+	if err != nil && err != common.ErrNotFound {
+		log.Printf("can not get organization: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	return c.JSON(http.StatusOK, newAdminOrganization(o))
+}
+
+func adminPutOrganizationHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req AdminOrganization
+	err := c.Bind(&req)
+	if err != nil || !req.validate() {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	o := model.Organization{
+		Name:               req.Name,
+		FallbackIcon:       req.FallbackIcon,
+		TwitterScreenName:  req.TwitterScreenName,
+		YoutubeChannelID:   req.YoutubeChannelID,
+		YoutubeChannelName: req.YoutubeChannelName,
+	}
+	err = store.SaveOrganization(ctx, store.GetClient(), o)
+	if err != nil {
+		log.Printf("can not save organization: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	cache.SetOrganization(o)
+	return c.JSON(http.StatusOK, newAdminOrganization(o))
+}
+
+func adminPutActorAttributesHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req AdminActorAttributes
+	err := c.Bind(&req)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	if req.Status != "" && req.Status != model.ActorStatusActive && req.Status != model.ActorStatusGraduated {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	activeFrom, err := parseAdminDate(req.ActiveFrom)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	activeUntil, err := parseAdminDate(req.ActiveUntil)
+	if err != nil || (!activeFrom.IsZero() && !activeUntil.IsZero() && !activeFrom.Before(activeUntil)) {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	client := store.GetClient()
+	groups, err := store.FindGroups(ctx, client)
+	if err != nil {
+		log.Printf("can not get groups: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	groupIDs := []string{}
+	for _, id := range req.Groups {
+		if _, err := groups.FindGroup(id); err != nil {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		groupIDs = append(groupIDs, id)
+	}
+
+	// キャッシュは古い可能性があるので直接取得する
+	actors, err := store.FindActors(ctx, client)
+	if err != nil {
+		log.Printf("can not get actors: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	actor, err := actors.FindActor(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "not found")
+	}
+
+	actor.UploadsArePlanned = req.UploadsArePlanned
+	actor.Groups = groupIDs
+	actor.Status = req.Status
+	actor.ActiveFrom = activeFrom
+	actor.ActiveUntil = activeUntil
+	err = store.SaveActor(ctx, client, actor)
+	if err != nil {
+		log.Printf("can not save actor: %v", err)
+		return c.String(http.StatusInternalServerError, "error4")
+	}
+
+	for i := range actors {
+		if actors[i].ID == actor.ID {
+			actors[i] = actor
+		}
+	}
+	cache.SetActors(actors)
+
+	return c.JSON(http.StatusOK, AdminActorAttributes{
+		UploadsArePlanned: actor.UploadsArePlanned,
+		Groups:            actor.Groups,
+		Status:            actor.Status,
+		ActiveFrom:        formatAdminDate(actor.ActiveFrom),
+		ActiveUntil:       formatAdminDate(actor.ActiveUntil),
+	})
+}
+
+func adminGetGroupsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	groups, err := store.FindGroups(ctx, store.GetClient())
+	if err != nil {
+		log.Printf("can not get groups: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	res := []AdminGroup{}
+	for _, g := range groups {
+		res = append(res, newAdminGroup(g))
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func adminPutGroupHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req AdminGroup
+	err := c.Bind(&req)
+	if err != nil || req.Name == "" {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	id := c.Param("id")
+	if !groupIDPattern.MatchString(id) {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	g := model.Group{
+		ID:   id,
+		Name: req.Name,
+	}
+	client := store.GetClient()
+	err = store.SaveGroup(ctx, client, g)
+	if err != nil {
+		log.Printf("can not save group: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	groups, err := store.FindGroups(ctx, client)
+	if err != nil {
+		log.Printf("can not get groups: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+	cache.SetGroups(groups)
+
+	return c.JSON(http.StatusOK, newAdminGroup(g))
+}
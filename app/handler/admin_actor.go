@@ -0,0 +1,473 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/ChimeraCoder/anaconda"
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/app/cache"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/search"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+	"github.com/yaegaki/dotlive-schedule-server/tweet"
+	"github.com/yaegaki/dotlive-schedule-server/youtube"
+)
+
+var (
+	// twitterScreenNamePattern Twitterのスクリーンネームに使用できる文字
+	twitterScreenNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_]{1,15}$`)
+	// youtubeChannelIDPattern YoutubeのチャンネルIDの形式
+	youtubeChannelIDPattern = regexp.MustCompile(`^UC[a-zA-Z0-9_-]{22}$`)
+	// numericIDPattern BilibiliとMildomのユーザーIDの形式
+	numericIDPattern = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// AdminActor 管理用APIの配信者
+// 属性は/actors/:id/attributesで変更する
+type AdminActor struct {
+	// ID 配信者ID
+	// 作成時は指定しない
+	ID string `json:"id"`
+	// Name 名前
+	Name string `json:"name"`
+	// Icon アイコンURL
+	// 空文字の場合はTwitterのアイコンを使用する
+	Icon string `json:"icon"`
+	// Hashtag ハッシュタグ
+	Hashtag string `json:"hashtag"`
+	// SubHashtags メインのハッシュタグ以外に計画ツイートで使用されるハッシュタグ
+	SubHashtags []string `json:"subHashtags"`
+	// Aliases 計画ツイートでハッシュタグなしで書かれる場合の別名
+	Aliases []string `json:"aliases"`
+	// Emoji 推しアイコン
+	Emoji string `json:"emoji"`
+	// TwitterScreenName Twitterのスクリーンネーム
+	TwitterScreenName string `json:"twitterScreenName"`
+	// SubTwitterScreenNames メインのアカウント以外のTwitterのスクリーンネーム
+	SubTwitterScreenNames []string `json:"subTwitterScreenNames"`
+	// YoutubeChannelID YoutubeのチャンネルID
+	YoutubeChannelID string `json:"youtubeChannelId"`
+	// YoutubeChannelName Youtubeのチャンネル名
+	// チャンネルIDから取得するので指定しても無視する
+	YoutubeChannelName string `json:"youtubeChannelName"`
+	// BilibiliID BilibiliのユーザーID
+	BilibiliID string `json:"bilibiliId"`
+	// MildomID MildomのユーザーID
+	MildomID string `json:"mildomId"`
+	// SubChannels メインのチャンネル以外のチャンネル
+	SubChannels []AdminChannel `json:"subChannels"`
+}
+
+// AdminChannel 管理用APIのチャンネル
+type AdminChannel struct {
+	// Source 動画サイト(Youtube, Bilibili, Mildom)
+	Source string `json:"source"`
+	// ID チャンネルID
+	ID string `json:"id"`
+	// Name チャンネル名
+	// Youtubeの場合はチャンネルIDから取得する
+	Name string `json:"name"`
+}
+
+func newAdminActor(a model.Actor) AdminActor {
+	screenNames := []string{}
+	for _, account := range a.SubTwitterAccounts {
+		screenNames = append(screenNames, account.ScreenName)
+	}
+
+	channels := []AdminChannel{}
+	for _, c := range a.SubChannels {
+		channels = append(channels, AdminChannel{
+			Source: c.Source,
+			ID:     c.ID,
+			Name:   c.Name,
+		})
+	}
+
+	return AdminActor{
+		ID:                    a.ID,
+		Name:                  a.Name,
+		Icon:                  a.Icon,
+		Hashtag:               a.Hashtag,
+		SubHashtags:           append([]string{}, a.SubHashtags...),
+		Aliases:               append([]string{}, a.Aliases...),
+		Emoji:                 a.Emoji,
+		TwitterScreenName:     a.TwitterScreenName,
+		SubTwitterScreenNames: screenNames,
+		YoutubeChannelID:      a.YoutubeChannelID,
+		YoutubeChannelName:    a.YoutubeChannelName,
+		BilibiliID:            a.BilibiliID,
+		MildomID:              a.MildomID,
+		SubChannels:           channels,
+	}
+}
+
+// validate 配信者の情報の形式が正しいかどうか
+// Twitterのアカウントやチャンネルが存在するかどうかは確認しない
+func (a AdminActor) validate() bool {
+	if strings.TrimSpace(a.Name) == "" || a.TwitterScreenName == "" {
+		return false
+	}
+
+	hashtags := append([]string{a.Hashtag}, a.SubHashtags...)
+	for _, h := range hashtags {
+		n := search.Normalize(h)
+		if !strings.HasPrefix(n, "#") || len(n) == 1 || strings.ContainsAny(n, " \t\n") {
+			return false
+		}
+	}
+
+	for _, alias := range a.Aliases {
+		if strings.TrimSpace(alias) == "" {
+			return false
+		}
+	}
+
+	screenNames := append([]string{a.TwitterScreenName}, a.SubTwitterScreenNames...)
+	for _, s := range screenNames {
+		if !twitterScreenNamePattern.MatchString(s) {
+			return false
+		}
+	}
+
+	if a.YoutubeChannelID != "" && !youtubeChannelIDPattern.MatchString(a.YoutubeChannelID) {
+		return false
+	}
+
+	if a.BilibiliID != "" && !numericIDPattern.MatchString(a.BilibiliID) {
+		return false
+	}
+
+	if a.MildomID != "" && !numericIDPattern.MatchString(a.MildomID) {
+		return false
+	}
+
+	for _, c := range a.SubChannels {
+		switch c.Source {
+		case model.VideoSourceYoutube:
+			if !youtubeChannelIDPattern.MatchString(c.ID) {
+				return false
+			}
+		case model.VideoSourceBilibili, model.VideoSourceMildom:
+			if !numericIDPattern.MatchString(c.ID) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// findAdminActorConflict 他の配信者と重複しているハッシュタグやアカウント、チャンネルを探す
+// 同じ配信者の中で重複している場合も対象にする
+// 重複している場合は指定した配信者の方の値、重複していない場合は空文字
+func findAdminActorConflict(a model.Actor, actors model.ActorSlice) string {
+	// 正規化した値から元の値
+	values := map[string]string{}
+	sources := []string{model.VideoSourceYoutube, model.VideoSourceBilibili, model.VideoSourceMildom}
+	collect := func(actor model.Actor) ([]string, []string) {
+		var keys, originals []string
+		for _, h := range actor.Hashtags() {
+			keys = append(keys, "hashtag:"+search.Normalize(h))
+			originals = append(originals, h)
+		}
+		for _, account := range actor.TwitterAccounts() {
+			keys = append(keys, "twitter:"+strings.ToLower(account.ScreenName))
+			originals = append(originals, account.ScreenName)
+		}
+		for _, source := range sources {
+			for _, c := range actor.Channels(source) {
+				keys = append(keys, "channel:"+source+":"+c.ID)
+				originals = append(originals, c.ID)
+			}
+		}
+
+		return keys, originals
+	}
+
+	ks, originals := collect(a)
+	for i, k := range ks {
+		if _, ok := values[k]; ok {
+			return originals[i]
+		}
+		values[k] = originals[i]
+	}
+
+	for _, actor := range actors {
+		if actor.ID == a.ID {
+			continue
+		}
+
+		ks, _ := collect(actor)
+		for _, k := range ks {
+			if v, ok := values[k]; ok {
+				return v
+			}
+		}
+	}
+
+	return ""
+}
+
+// toActor 配信者に変換する
+// 既存の配信者の属性やLastTweetIDは引き継ぐ
+func (a AdminActor) toActor(old model.Actor) model.Actor {
+	lastTweetIDs := map[string]string{}
+	for _, account := range old.TwitterAccounts() {
+		lastTweetIDs[strings.ToLower(account.ScreenName)] = account.LastTweetID
+	}
+
+	actor := old
+	actor.Name = strings.TrimSpace(a.Name)
+	actor.Hashtag = a.Hashtag
+	actor.SubHashtags = append([]string{}, a.SubHashtags...)
+	actor.Aliases = append([]string{}, a.Aliases...)
+	actor.Emoji = a.Emoji
+	actor.TwitterScreenName = a.TwitterScreenName
+	actor.LastTweetID = lastTweetIDs[strings.ToLower(a.TwitterScreenName)]
+	actor.YoutubeChannelID = a.YoutubeChannelID
+	actor.BilibiliID = a.BilibiliID
+	actor.MildomID = a.MildomID
+	if a.Icon != "" {
+		actor.Icon = a.Icon
+	}
+
+	actor.SubTwitterAccounts = nil
+	for _, s := range a.SubTwitterScreenNames {
+		actor.SubTwitterAccounts = append(actor.SubTwitterAccounts, model.TwitterAccount{
+			ScreenName:  s,
+			LastTweetID: lastTweetIDs[strings.ToLower(s)],
+		})
+	}
+
+	actor.SubChannels = nil
+	for _, c := range a.SubChannels {
+		actor.SubChannels = append(actor.SubChannels, model.Channel{
+			Source: c.Source,
+			ID:     c.ID,
+			Name:   c.Name,
+		})
+	}
+
+	return actor
+}
+
+// resolveAdminActor Twitterのアカウントとチャンネルが存在するか確認してチャンネル名とアイコンを設定する
+// 存在しない場合はcommon.ErrNotFound
+func resolveAdminActor(ctx context.Context, actor model.Actor) (model.Actor, error) {
+	api := anaconda.NewTwitterApi("", "")
+	for _, account := range actor.TwitterAccounts() {
+		icon, err := tweet.FindProfileImageURL(api, account.ScreenName)
+		if err != nil {
+			log.Printf("can not find twitter user '%v': %v", account.ScreenName, err)
+			return model.Actor{}, err
+		}
+
+		if actor.Icon == "" && account.ScreenName == actor.TwitterScreenName {
+			actor.Icon = icon
+		}
+	}
+
+	youtubeChannels := actor.Channels(model.VideoSourceYoutube)
+	if len(youtubeChannels) == 0 {
+		actor.YoutubeChannelName = ""
+		return actor, nil
+	}
+
+	s, err := youtube.NewService(ctx)
+	if err != nil {
+		return model.Actor{}, err
+	}
+
+	if actor.YoutubeChannelID != "" {
+		c, err := youtube.FindChannel(s, actor.YoutubeChannelID)
+		if err != nil {
+			return model.Actor{}, err
+		}
+		actor.YoutubeChannelName = c.Name
+	} else {
+		actor.YoutubeChannelName = ""
+	}
+
+	for i, sub := range actor.SubChannels {
+		if sub.Source != model.VideoSourceYoutube {
+			continue
+		}
+
+		c, err := youtube.FindChannel(s, sub.ID)
+		if err != nil {
+			return model.Actor{}, err
+		}
+		actor.SubChannels[i].Name = c.Name
+	}
+
+	return actor, nil
+}
+
+func adminGetActorsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	actors, err := store.FindActors(ctx, store.GetClient())
+	if err != nil {
+		log.Printf("can not get actors: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	res := []AdminActor{}
+	for _, a := range actors {
+		res = append(res, newAdminActor(a))
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func adminGetActorHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	actors, err := store.FindActors(ctx, store.GetClient())
+	if err != nil {
+		log.Printf("can not get actors: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	actor, err := actors.FindActor(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "not found")
+	}
+
+	return c.JSON(http.StatusOK, newAdminActor(actor))
+}
+
+func adminPostActorHandler(c echo.Context) error {
+	return adminSaveActor(c, "")
+}
+
+func adminPutActorHandler(c echo.Context) error {
+	return adminSaveActor(c, c.Param("id"))
+}
+
+// adminSaveActor 配信者を作成または更新する
+// actorIDが空文字の場合は作成する
+func adminSaveActor(c echo.Context, actorID string) error {
+	ctx := c.Request().Context()
+
+	var req AdminActor
+	err := c.Bind(&req)
+	if err != nil || !req.validate() {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	client := store.GetClient()
+	// キャッシュは古い可能性があるので直接取得する
+	actors, err := store.FindActors(ctx, client)
+	if err != nil {
+		log.Printf("can not get actors: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	var old model.Actor
+	if actorID != "" {
+		old, err = actors.FindActor(actorID)
+		if err != nil {
+			return c.String(http.StatusNotFound, "not found")
+		}
+	}
+
+	actor := req.toActor(old)
+	if conflict := findAdminActorConflict(actor, actors); conflict != "" {
+		return c.String(http.StatusConflict, "conflict: "+conflict)
+	}
+
+	actor, err = resolveAdminActor(ctx, actor)
+	if err == common.ErrNotFound {
+		return c.String(http.StatusBadRequest, "unknown account or channel")
+	} else if err != nil {
+		log.Printf("can not resolve actor: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	if actorID == "" {
+		actor.ID, err = store.CreateActor(ctx, client, actor)
+	} else {
+		err = store.SaveActor(ctx, client, actor)
+	}
+	if err != nil {
+		log.Printf("can not save actor: %v", err)
+		return c.String(http.StatusInternalServerError, "error4")
+	}
+
+	err = refreshActorsCache(ctx)
+	if err != nil {
+		log.Printf("can not get actors: %v", err)
+		return c.String(http.StatusInternalServerError, "error5")
+	}
+
+	status := http.StatusOK
+	if actorID == "" {
+		status = http.StatusCreated
+	}
+	return c.JSON(status, newAdminActor(actor))
+}
+
+// adminDeleteActorHandler 配信者を卒業済みにする
+// 過去の動画や計画から参照されているので配信者自体は削除しない
+func adminDeleteActorHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	client := store.GetClient()
+	actors, err := store.FindActors(ctx, client)
+	if err != nil {
+		log.Printf("can not get actors: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	actor, err := actors.FindActor(c.Param("id"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "not found")
+	}
+
+	actor = graduateActor(actor, jst.Now())
+	err = store.SaveActor(ctx, client, actor)
+	if err != nil {
+		log.Printf("can not save actor: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	err = refreshActorsCache(ctx)
+	if err != nil {
+		log.Printf("can not get actors: %v", err)
+		return c.String(http.StatusInternalServerError, "error4")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// graduateActor 配信者を卒業済みにする
+// 活動終了日が設定されていないか未来の場合はnowの日付にする
+func graduateActor(actor model.Actor, now jst.Time) model.Actor {
+	actor.Status = model.ActorStatusGraduated
+	today := now.FloorToDay()
+	if actor.ActiveUntil.IsZero() || actor.ActiveUntil.After(today) {
+		actor.ActiveUntil = today
+	}
+	return actor
+}
+
+// refreshActorsCache 保存した配信者をすぐに反映するためにキャッシュを更新する
+func refreshActorsCache(ctx context.Context) error {
+	actors, err := store.FindActors(ctx, store.GetClient())
+	if err != nil {
+		return err
+	}
+
+	cache.SetActors(actors)
+	return nil
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// AdminNotification 管理用APIのアウトボックスのプッシュ通知
+type AdminNotification struct {
+	// ID 冪等性キーとメッセージの内容から作成したID
+	ID string `json:"id"`
+	// Status 送信状況
+	Status string `json:"status"`
+	// Message FCMのメッセージ
+	Message json.RawMessage `json:"message"`
+	// CreatedAt 保存した時刻
+	CreatedAt jst.Time `json:"createdAt"`
+	// NextAttemptAt 次に送信を試みる時刻
+	NextAttemptAt jst.Time `json:"nextAttemptAt"`
+	// Attempts 送信を試みた記録
+	Attempts []AdminNotificationAttempt `json:"attempts"`
+}
+
+// AdminNotificationAttempt 管理用APIのプッシュ通知の送信を試みた記録
+type AdminNotificationAttempt struct {
+	// AttemptedAt 送信を試みた時刻
+	AttemptedAt jst.Time `json:"attemptedAt"`
+	// MessageID 送信に成功した場合のFCMのメッセージID
+	MessageID string `json:"messageId"`
+	// Error 送信に失敗した場合のエラー
+	Error string `json:"error"`
+}
+
+func newAdminNotification(n model.Notification) AdminNotification {
+	attempts := []AdminNotificationAttempt{}
+	for _, a := range n.Attempts {
+		attempts = append(attempts, AdminNotificationAttempt{
+			AttemptedAt: a.AttemptedAt,
+			MessageID:   a.MessageID,
+			Error:       a.Error,
+		})
+	}
+
+	message := json.RawMessage(n.Payload)
+	if !json.Valid(message) {
+		// 送信できずに失敗したものも確認できるように文字列として返す
+		message, _ = json.Marshal(n.Payload)
+	}
+
+	return AdminNotification{
+		ID:            n.ID,
+		Status:        n.Status,
+		Message:       message,
+		CreatedAt:     n.CreatedAt,
+		NextAttemptAt: n.NextAttemptAt,
+		Attempts:      attempts,
+	}
+}
+
+// isAdminNotificationStatus 管理用APIで指定できる送信状況かどうか
+func isAdminNotificationStatus(status string) bool {
+	switch status {
+	case model.NotificationStatusPending, model.NotificationStatusSent, model.NotificationStatusFailed:
+		return true
+	}
+
+	return false
+}
+
+// adminGetNotificationsHandler アウトボックスのプッシュ通知を取得する
+// statusを指定しない場合は送信に失敗したものを返す
+func adminGetNotificationsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	status := c.QueryParam("status")
+	if status == "" {
+		status = model.NotificationStatusFailed
+	}
+	if !isAdminNotificationStatus(status) {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	notifications, err := store.FindNotificationsByStatus(ctx, store.GetClient(), status)
+	if err != nil {
+		log.Printf("can not get notifications: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	res := []AdminNotification{}
+	for _, n := range notifications {
+		res = append(res, newAdminNotification(n))
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
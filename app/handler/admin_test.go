@@ -0,0 +1,381 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/app/internal"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestAdminAuth(t *testing.T) {
+	old := internal.AdminToken
+	defer func() {
+		internal.AdminToken = old
+	}()
+
+	e := echo.New()
+	RouteAdmin(e)
+
+	tests := []struct {
+		name       string
+		adminToken string
+		auth       string
+		status     int
+	}{
+		{"no token", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"wrong scheme", "secret", "secret", http.StatusUnauthorized},
+		// ADMIN_TOKENが設定されていない場合は常に拒否する
+		{"disabled", "", "Bearer ", http.StatusUnauthorized},
+		// 認証に成功した場合は不正なリクエストになる
+		{"ok", "secret", "Bearer secret", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			internal.AdminToken = tt.adminToken
+
+			req := httptest.NewRequest(http.MethodPut, "/api/admin/organization", strings.NewReader("{}"))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if tt.auth != "" {
+				req.Header.Set(echo.HeaderAuthorization, tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status, got: %v expect: %v", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestAdminBadRequest(t *testing.T) {
+	old := internal.AdminToken
+	defer func() {
+		internal.AdminToken = old
+	}()
+	internal.AdminToken = "secret"
+
+	e := echo.New()
+	RouteAdmin(e)
+
+	// Firestoreにアクセスする前にエラーになるリクエストだけを対象にする
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/api/admin/organization", `{`},
+		{"/api/admin/organization", `{"name":"どっとライブ"}`},
+		{"/api/admin/organization", `{"name":"どっとライブ","twitterScreenName":"dotLIVEyoutuber","youtubeChannelId":"xxx"}`},
+		{"/api/admin/actors/siro/attributes", `{"uploadsArePlanned":"yes"}`},
+		{"/api/admin/actors/siro/attributes", `{"groups":"idol"}`},
+		{"/api/admin/actors/siro/attributes", `{"status":"retired"}`},
+		{"/api/admin/actors/siro/attributes", `{"status":"graduated","activeUntil":"2021/3/31"}`},
+		{"/api/admin/actors/siro/attributes", `{"activeFrom":"2021-4-1","activeUntil":"2021-3-31"}`},
+		{"/api/admin/groups/idol", `{}`},
+		{"/api/admin/groups/" + url.PathEscape("アイドル部"), `{"name":"アイドル部"}`},
+		{"/api/admin/groups/idol:1", `{"name":"アイドル部"}`},
+		{"/api/admin/actors/siro", `{"name":"電脳少女シロ"}`},
+		{"/api/admin/actors/siro", `{"name":"電脳少女シロ","hashtag":"シロ生放送","twitterScreenName":"SIROyoutuber"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer secret")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status, got: %v expect: %v", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestAdminOrganizationValidate(t *testing.T) {
+	tests := []struct {
+		o        AdminOrganization
+		expected bool
+	}{
+		{AdminOrganization{Name: "a", TwitterScreenName: "b"}, true},
+		{AdminOrganization{Name: "a", TwitterScreenName: "b", YoutubeChannelID: "c", YoutubeChannelName: "d"}, true},
+		{AdminOrganization{TwitterScreenName: "b"}, false},
+		{AdminOrganization{Name: "a"}, false},
+		{AdminOrganization{Name: "a", TwitterScreenName: "b", YoutubeChannelName: "d"}, false},
+	}
+
+	for _, tt := range tests {
+		if tt.o.validate() != tt.expected {
+			t.Errorf("%+v, got: %v expect: %v", tt.o, !tt.expected, tt.expected)
+		}
+	}
+}
+
+func TestAdminActorValidate(t *testing.T) {
+	valid := AdminActor{
+		Name:              "電脳少女シロ",
+		Hashtag:           "#シロ生放送",
+		TwitterScreenName: "SIROyoutuber",
+		YoutubeChannelID:  "UCLhUvJ_wO9hOvv_yYENu4fQ",
+	}
+	if !valid.validate() {
+		t.Fatalf("must be valid: %+v", valid)
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(a *AdminActor)
+		expected bool
+	}{
+		{"full-width hash", func(a *AdminActor) { a.Hashtag = "＃シロ生放送" }, true},
+		{"sub", func(a *AdminActor) {
+			a.SubHashtags = []string{"#シロ"}
+			a.Aliases = []string{"シロちゃん"}
+			a.SubTwitterScreenNames = []string{"SIRO_sub"}
+			a.BilibiliID = "12345"
+			a.SubChannels = []AdminChannel{
+				{Source: model.VideoSourceYoutube, ID: "UCqjTqdVlvIipZXIKeCkHKUA"},
+				{Source: model.VideoSourceMildom, ID: "10596535"},
+			}
+		}, true},
+		{"no name", func(a *AdminActor) { a.Name = " " }, false},
+		{"no hash", func(a *AdminActor) { a.Hashtag = "シロ生放送" }, false},
+		{"only hash", func(a *AdminActor) { a.Hashtag = "#" }, false},
+		{"space in hashtag", func(a *AdminActor) { a.SubHashtags = []string{"#シロ 生放送"} }, false},
+		{"empty alias", func(a *AdminActor) { a.Aliases = []string{""} }, false},
+		{"no twitter", func(a *AdminActor) { a.TwitterScreenName = "" }, false},
+		{"invalid twitter", func(a *AdminActor) { a.SubTwitterScreenNames = []string{"@siro"} }, false},
+		{"invalid youtube", func(a *AdminActor) { a.YoutubeChannelID = "siro" }, false},
+		{"invalid bilibili", func(a *AdminActor) { a.BilibiliID = "siro" }, false},
+		{"invalid sub channel", func(a *AdminActor) {
+			a.SubChannels = []AdminChannel{{Source: model.VideoSourceBilibili, ID: "UCqjTqdVlvIipZXIKeCkHKUA"}}
+		}, false},
+		{"unknown source", func(a *AdminActor) {
+			a.SubChannels = []AdminChannel{{Source: "Twitch", ID: "12345"}}
+		}, false},
+	}
+
+	for _, tt := range tests {
+		a := valid
+		tt.modify(&a)
+		if a.validate() != tt.expected {
+			t.Errorf("%v, got: %v expect: %v", tt.name, !tt.expected, tt.expected)
+		}
+	}
+}
+
+func TestFindAdminActorConflict(t *testing.T) {
+	siro := model.Actor{
+		ID:                "siro",
+		Hashtag:           "#シロ生放送",
+		TwitterScreenName: "SIROyoutuber",
+		YoutubeChannelID:  "siro-channel",
+	}
+	pino := model.Actor{
+		ID:                "pino",
+		Hashtag:           "#カルロピノ",
+		SubHashtags:       []string{"#ピノ"},
+		TwitterScreenName: "carlo_pino",
+		SubChannels: []model.Channel{
+			{Source: model.VideoSourceYoutube, ID: "pino-sub"},
+		},
+	}
+	actors := model.ActorSlice{siro, pino}
+
+	tests := []struct {
+		name     string
+		actor    model.Actor
+		expected string
+	}{
+		{"update self", siro, ""},
+		{"new", model.Actor{Hashtag: "#神楽すず", TwitterScreenName: "kagura_suzu"}, ""},
+		{"hashtag", model.Actor{Hashtag: "＃カルロピノ"}, "＃カルロピノ"},
+		{"sub hashtag", model.Actor{Hashtag: "#神楽すず", SubHashtags: []string{"#ピノ"}}, "#ピノ"},
+		{"twitter", model.Actor{Hashtag: "#神楽すず", TwitterScreenName: "Carlo_Pino"}, "Carlo_Pino"},
+		{"channel", model.Actor{Hashtag: "#神楽すず", YoutubeChannelID: "pino-sub"}, "pino-sub"},
+		{"same source only", model.Actor{Hashtag: "#神楽すず", MildomID: "pino-sub"}, ""},
+		{"self", model.Actor{Hashtag: "#神楽すず", SubHashtags: []string{"#神楽すず"}}, "#神楽すず"},
+	}
+
+	for _, tt := range tests {
+		conflict := findAdminActorConflict(tt.actor, actors)
+		if conflict != tt.expected {
+			t.Errorf("%v, got: %v expect: %v", tt.name, conflict, tt.expected)
+		}
+	}
+}
+
+func TestAdminActorToActor(t *testing.T) {
+	old := model.Actor{
+		ID:                "siro",
+		Icon:              "https://example.com/siro.jpg",
+		TwitterScreenName: "SIROyoutuber",
+		LastTweetID:       "1",
+		SubTwitterAccounts: []model.TwitterAccount{
+			{ScreenName: "siro_sub", LastTweetID: "2"},
+		},
+		UploadsArePlanned: true,
+		Groups:            []string{"idol"},
+	}
+
+	// メインとサブのアカウントを入れ替える
+	a := AdminActor{
+		Name:                  "電脳少女シロ",
+		TwitterScreenName:     "SIRO_SUB",
+		SubTwitterScreenNames: []string{"SIROyoutuber", "siro_new"},
+	}.toActor(old)
+
+	if a.ID != old.ID || a.Icon != old.Icon || !a.UploadsArePlanned || len(a.Groups) != 1 {
+		t.Errorf("attributes must be kept: %+v", a)
+	}
+
+	if a.LastTweetID != "2" {
+		t.Errorf("main LastTweetID, got: %v expect: 2", a.LastTweetID)
+	}
+
+	if len(a.SubTwitterAccounts) != 2 || a.SubTwitterAccounts[0].LastTweetID != "1" || a.SubTwitterAccounts[1].LastTweetID != "" {
+		t.Errorf("invalid sub accounts: %+v", a.SubTwitterAccounts)
+	}
+}
+
+func TestGraduateActor(t *testing.T) {
+	now := jst.Date(2020, 4, 29, 20, 0)
+	tests := []struct {
+		name        string
+		activeUntil jst.Time
+		expect      jst.Time
+	}{
+		{"active", jst.Time{}, jst.ShortDate(2020, 4, 29)},
+		{"future", jst.ShortDate(2020, 5, 31), jst.ShortDate(2020, 4, 29)},
+		{"past", jst.ShortDate(2020, 3, 31), jst.ShortDate(2020, 3, 31)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := graduateActor(model.Actor{ID: "siro", ActiveUntil: tt.activeUntil}, now)
+			if a.ID != "siro" || a.Status != model.ActorStatusGraduated {
+				t.Errorf("actor must be graduated: %+v", a)
+			}
+
+			if !a.ActiveUntil.Equal(tt.expect) {
+				t.Errorf("activeUntil, got: %v expect: %v", a.ActiveUntil, tt.expect)
+			}
+		})
+	}
+}
+
+func TestNewAdminNotification(t *testing.T) {
+	tests := []struct {
+		payload  string
+		expected string
+	}{
+		{`{"topic":"plan"}`, `{"topic":"plan"}`},
+		// JSONとして不正な場合は文字列として返す
+		{`{"topic":`, `"{\"topic\":"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.payload, func(t *testing.T) {
+			n := newAdminNotification(model.Notification{
+				ID:      "id",
+				Payload: tt.payload,
+				Status:  model.NotificationStatusFailed,
+			})
+
+			if string(n.Message) != tt.expected {
+				t.Errorf("message, got: %s expect: %v", n.Message, tt.expected)
+			}
+
+			if n.Attempts == nil {
+				t.Errorf("attempts must not be nil")
+			}
+		})
+	}
+
+	if isAdminNotificationStatus("unknown") {
+		t.Errorf("unknown status must be invalid")
+	}
+}
+
+func TestAdminWebhookValidate(t *testing.T) {
+	actors := model.ActorSlice{{ID: "siro"}, {ID: "iori"}}
+	valid := AdminWebhook{
+		URL:    "https://example.com/webhook",
+		Events: []string{model.WebhookEventPlanCreated, model.WebhookEventVideoStarted},
+	}
+	if !valid.validate(actors) {
+		t.Fatalf("must be valid: %+v", valid)
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(w *AdminWebhook)
+		expected bool
+	}{
+		{"actors", func(w *AdminWebhook) { w.Actors = []string{"siro", "iori"} }, true},
+		{"http", func(w *AdminWebhook) { w.URL = "http://example.com/webhook" }, false},
+		{"no host", func(w *AdminWebhook) { w.URL = "https:///webhook" }, false},
+		{"invalid url", func(w *AdminWebhook) { w.URL = "https://exa mple.com/%zz" }, false},
+		{"no events", func(w *AdminWebhook) { w.Events = nil }, false},
+		{"unknown event", func(w *AdminWebhook) { w.Events = []string{"video.deleted"} }, false},
+		{"unknown actor", func(w *AdminWebhook) { w.Actors = []string{"suzu"} }, false},
+	}
+
+	for _, tt := range tests {
+		w := valid
+		tt.modify(&w)
+		if w.validate(actors) != tt.expected {
+			t.Errorf("%v, got: %v expect: %v", tt.name, !tt.expected, tt.expected)
+		}
+	}
+}
+
+func TestAdminWebhookToWebhookSubscription(t *testing.T) {
+	old := model.WebhookSubscription{
+		ID:                  "a",
+		URL:                 "https://example.com/old",
+		Secret:              "secret",
+		Events:              []string{model.WebhookEventPlanCreated},
+		Disabled:            true,
+		ConsecutiveFailures: 10,
+	}
+
+	w := AdminWebhook{
+		URL:    "https://example.com/new",
+		Secret: "overwrite",
+		Events: []string{model.WebhookEventVideoStarted},
+		Actors: []string{"siro"},
+		// 指定しても無視する
+		ConsecutiveFailures: 3,
+	}
+
+	s := w.toWebhookSubscription(old)
+	if s.ID != "a" || s.Secret != "secret" {
+		t.Errorf("id and secret must be kept: %+v", s)
+	}
+
+	if s.URL != w.URL || len(s.Events) != 1 || s.Events[0] != model.WebhookEventVideoStarted || len(s.Actors) != 1 {
+		t.Errorf("invalid subscription: %+v", s)
+	}
+
+	// 有効にした場合は失敗した回数を数え直す
+	if s.Disabled || s.ConsecutiveFailures != 0 {
+		t.Errorf("subscription must be enabled: %+v", s)
+	}
+
+	old.Disabled = false
+	old.ConsecutiveFailures = 3
+	s = w.toWebhookSubscription(old)
+	if s.ConsecutiveFailures != 3 {
+		t.Errorf("consecutive failures must be kept, got: %v", s.ConsecutiveFailures)
+	}
+}
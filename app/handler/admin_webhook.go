@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/app/cache"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// webhookSecretSize Webhookの署名に使用する秘密鍵のバイト数
+const webhookSecretSize = 32
+
+// AdminWebhook 管理用APIのWebhookの購読
+type AdminWebhook struct {
+	// ID 購読ID
+	// 作成時は指定しない
+	ID string `json:"id"`
+	// URL 送信先のURL
+	// httpsのみ
+	URL string `json:"url"`
+	// Secret 署名に使用する秘密鍵
+	// 作成時にだけ返す
+	Secret string `json:"secret,omitempty"`
+	// Events 購読するイベントの種類
+	Events []string `json:"events"`
+	// Actors 対象の配信者ID
+	// 空の場合は全ての配信者
+	Actors []string `json:"actors"`
+	// Disabled 無効かどうか
+	// 無効になった購読はfalseにすると再度有効になる
+	Disabled bool `json:"disabled"`
+	// ConsecutiveFailures 連続で送信に失敗した回数
+	// 指定しても無視する
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	// CreatedAt 作成した時刻
+	// 指定しても無視する
+	CreatedAt jst.Time `json:"createdAt"`
+}
+
+func newAdminWebhook(s model.WebhookSubscription) AdminWebhook {
+	return AdminWebhook{
+		ID:                  s.ID,
+		URL:                 s.URL,
+		Events:              append([]string{}, s.Events...),
+		Actors:              append([]string{}, s.Actors...),
+		Disabled:            s.Disabled,
+		ConsecutiveFailures: s.ConsecutiveFailures,
+		CreatedAt:           s.CreatedAt,
+	}
+}
+
+// validate 購読の形式が正しいかどうか
+func (w AdminWebhook) validate(actors model.ActorSlice) bool {
+	u, err := url.Parse(w.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return false
+	}
+
+	if len(w.Events) == 0 {
+		return false
+	}
+
+	for _, e := range w.Events {
+		if !containsWebhookEvent(e) {
+			return false
+		}
+	}
+
+	for _, id := range w.Actors {
+		if _, err := actors.FindActor(id); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsWebhookEvent(eventType string) bool {
+	for _, e := range model.WebhookEvents {
+		if e == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// toWebhookSubscription 購読に変換する
+// 秘密鍵と作成時刻は既存の購読から引き継ぐ
+func (w AdminWebhook) toWebhookSubscription(old model.WebhookSubscription) model.WebhookSubscription {
+	s := old
+	s.URL = w.URL
+	s.Events = append([]string{}, w.Events...)
+	s.Actors = append([]string{}, w.Actors...)
+	// 無効になった購読を有効にした場合は失敗した回数を数え直す
+	if s.Disabled && !w.Disabled {
+		s.ConsecutiveFailures = 0
+	}
+	s.Disabled = w.Disabled
+
+	return s
+}
+
+// newWebhookSecret ランダムな秘密鍵を作成する
+func newWebhookSecret() (string, error) {
+	b := make([]byte, webhookSecretSize)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func adminGetWebhooksHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	subscriptions, err := store.FindWebhookSubscriptions(ctx, store.GetClient())
+	if err != nil {
+		log.Printf("can not get webhook subscriptions: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	res := []AdminWebhook{}
+	for _, s := range subscriptions {
+		res = append(res, newAdminWebhook(s))
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func adminGetWebhookHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	s, err := store.FindWebhookSubscription(ctx, store.GetClient(), c.Param("id"))
+	if err == common.ErrNotFound {
+		return c.String(http.StatusNotFound, "not found")
+	} else if err != nil {
+		log.Printf("can not get webhook subscription: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	return c.JSON(http.StatusOK, newAdminWebhook(s))
+}
+
+func adminPostWebhookHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	client := store.GetClient()
+	actors, err := cache.FindActorsWithCache(ctx, client)
+	if err != nil {
+		log.Printf("can not get actors: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	var req AdminWebhook
+	err = c.Bind(&req)
+	if err != nil || !req.validate(actors) {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		log.Printf("can not create webhook secret: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	s := req.toWebhookSubscription(model.WebhookSubscription{
+		Secret:    secret,
+		CreatedAt: jst.Now(),
+	})
+	s.ID, err = store.CreateWebhookSubscription(ctx, client, s)
+	if err != nil {
+		log.Printf("can not create webhook subscription: %v", err)
+		return c.String(http.StatusInternalServerError, "error4")
+	}
+
+	// 秘密鍵は作成時にしか取得できない
+	res := newAdminWebhook(s)
+	res.Secret = s.Secret
+	return c.JSON(http.StatusCreated, res)
+}
+
+func adminPutWebhookHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	client := store.GetClient()
+	actors, err := cache.FindActorsWithCache(ctx, client)
+	if err != nil {
+		log.Printf("can not get actors: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	var req AdminWebhook
+	err = c.Bind(&req)
+	if err != nil || !req.validate(actors) {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	old, err := store.FindWebhookSubscription(ctx, client, c.Param("id"))
+	if err == common.ErrNotFound {
+		return c.String(http.StatusNotFound, "not found")
+	} else if err != nil {
+		log.Printf("can not get webhook subscription: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	s := req.toWebhookSubscription(old)
+	err = store.SaveWebhookSubscription(ctx, client, s)
+	if err != nil {
+		log.Printf("can not save webhook subscription: %v", err)
+		return c.String(http.StatusInternalServerError, "error4")
+	}
+
+	return c.JSON(http.StatusOK, newAdminWebhook(s))
+}
+
+func adminDeleteWebhookHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	client := store.GetClient()
+	s, err := store.FindWebhookSubscription(ctx, client, c.Param("id"))
+	if err == common.ErrNotFound {
+		return c.String(http.StatusNotFound, "not found")
+	} else if err != nil {
+		log.Printf("can not get webhook subscription: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	// 送信待ちのWebhookは送信時に購読が見つからないので失敗として扱われる
+	err = store.DeleteWebhookSubscription(ctx, client, s.ID)
+	if err != nil {
+		log.Printf("can not delete webhook subscription: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
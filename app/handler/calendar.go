@@ -20,11 +20,17 @@ func calendarHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	query := c.Request().URL.Query()
+	loc, err := parseLocationQuery(query)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
 	now := jst.Now()
-	baseDate := jst.ShortDate(now.Year(), now.Month(), 1)
+	localNow := now.In(loc)
+	baseDate := jst.ShortDateIn(localNow.Year(), localNow.Month(), 1, loc)
 	q := query.Get("q")
 	if q != "" {
-		temp, err := parseYearMonthDayQuery(q)
+		temp, err := parseYearMonthDayQueryInLocation(q, loc)
 		if err == nil {
 			baseDate = temp
 		}
@@ -38,6 +44,16 @@ func calendarHandler(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "error2")
 	}
 
+	org, err := cache.FindOrganizationWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	groupID, err := parseGroupQuery(ctx, client, query)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
 	res := CalendarResponse{}
 	for _, a := range actors {
 		res.Actors = append(res.Actors, CalendarActor{
@@ -56,11 +72,14 @@ func calendarHandler(c echo.Context) error {
 		return c.JSON(http.StatusOK, res)
 	}
 
-	calendar, err := service.CreateCalendar(ctx, client, baseDate, now, actors)
+	calendar, err := service.CreateCalendarInLocation(ctx, client, baseDate, now, actors, org, loc)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, "error3")
 	}
 
+	if groupID != "" {
+		calendar = service.FilterCalendarByGroup(calendar, actors, groupID)
+	}
 	res.Calendar = calendar
 
 	return c.JSON(http.StatusOK, res)
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/app/service"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+const (
+	// changesDefaultLimit 1回で取得するデフォルトの変更履歴の数
+	changesDefaultLimit = 100
+	// changesMaxLimit 1回で取得する最大の変更履歴の数
+	changesMaxLimit = 500
+)
+
+// RouteChanges 差分同期関連のルーティングを設定する
+func RouteChanges(e *echo.Echo) {
+	e.GET("/api/changes", changesHandler)
+}
+
+func changesHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	client := store.GetClient()
+
+	query := c.Request().URL.Query()
+	var since int64
+	if s := query.Get("since"); s != "" {
+		temp, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || temp < 0 {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		since = temp
+	}
+
+	limit := changesDefaultLimit
+	if l := query.Get("limit"); l != "" {
+		temp, err := strconv.Atoi(l)
+		if err != nil || temp <= 0 {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		limit = temp
+		if limit > changesMaxLimit {
+			limit = changesMaxLimit
+		}
+	}
+
+	cs, err := service.FindChangeSet(ctx, client, since, limit)
+	if err != nil {
+		log.Printf("can not get changes: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	return c.JSON(http.StatusOK, newChangesResponse(cs))
+}
+
+// ChangesResponse 差分同期APIのレスポンス
+type ChangesResponse struct {
+	// Cursor 次回のsinceに指定するカーソル
+	Cursor string `json:"cursor"`
+	// Reset 変更履歴が削除されているので全て取得し直す必要があるかどうか
+	// trueの場合は他のAPIで全て取得し直した後にCursorから差分同期を続ける
+	Reset bool `json:"reset"`
+	// HasMore まだ取得していない変更があるかどうか
+	HasMore bool `json:"hasMore"`
+	// Changes 変更されたもの
+	Changes []ChangeEntry `json:"changes"`
+}
+
+// ChangeEntry 変更されたもの
+type ChangeEntry struct {
+	// Kind 変更されたものの種類
+	// plan, video, actorのいずれか
+	Kind string `json:"kind"`
+	// ID 変更されたもののID
+	// 計画の場合は日付(YYYY-M-D)
+	ID string `json:"id"`
+	// Deleted 削除されたかどうか
+	Deleted bool `json:"deleted"`
+	// Plan Kindがplanの場合の計画
+	Plan *ChangedPlan `json:"plan,omitempty"`
+	// Video Kindがvideoの場合の動画
+	Video *SearchVideo `json:"video,omitempty"`
+	// Actor Kindがactorの場合の配信者
+	Actor *V2Actor `json:"actor,omitempty"`
+}
+
+// ChangedPlan 変更された計画
+type ChangedPlan struct {
+	// Date 計画の日付
+	Date jst.Time `json:"date"`
+	// TweetID 計画ツイートのID
+	TweetID string `json:"tweetId"`
+	// Entries 計画のエントリ
+	Entries []ChangedPlanEntry `json:"entries"`
+}
+
+// ChangedPlanEntry 変更された計画のエントリ
+type ChangedPlanEntry struct {
+	// ActorID 配信者ID
+	ActorID string `json:"actorId"`
+	// HashTag コラボハッシュタグ
+	HashTag string `json:"hashTag"`
+	// StartAt 開始時間
+	StartAt jst.Time `json:"startAt"`
+	// Source 配信サイト
+	Source string `json:"source"`
+	// MemberOnly メンバー限定かどうか
+	MemberOnly bool `json:"memberOnly"`
+	// CollaboID コラボID
+	CollaboID int `json:"collaboId"`
+}
+
+func newChangesResponse(cs model.ChangeSet) ChangesResponse {
+	res := ChangesResponse{
+		Cursor:  strconv.FormatInt(cs.Cursor, 10),
+		Reset:   cs.Reset,
+		HasMore: cs.HasMore,
+		Changes: []ChangeEntry{},
+	}
+
+	for _, e := range cs.Entries {
+		entry := ChangeEntry{
+			Kind:    e.Kind,
+			ID:      e.EntityID,
+			Deleted: e.Deleted,
+		}
+
+		if e.Plan != nil {
+			p := ChangedPlan{
+				Date:    e.Plan.Date,
+				TweetID: e.Plan.SourceID,
+				Entries: []ChangedPlanEntry{},
+			}
+			for _, pe := range e.Plan.Entries {
+				p.Entries = append(p.Entries, ChangedPlanEntry{
+					ActorID:    pe.ActorID,
+					HashTag:    pe.HashTag,
+					StartAt:    pe.StartAt,
+					Source:     pe.Source,
+					MemberOnly: pe.MemberOnly,
+					CollaboID:  pe.CollaboID,
+				})
+			}
+			entry.Plan = &p
+		}
+
+		if v := e.Video; v != nil {
+			entry.Video = &SearchVideo{
+				ID:         v.ID,
+				ActorID:    v.ActorID,
+				URL:        v.URL,
+				Source:     v.Source,
+				StartAt:    v.StartAt,
+				IsLive:     v.IsLive,
+				MemberOnly: v.MemberOnly,
+				Title:      v.Title,
+				Text:       v.Text,
+				OwnerName:  v.OwnerName,
+				HashTags:   v.HashTags,
+			}
+		}
+
+		if e.Actor != nil {
+			a := newV2ActorsResponse(model.ActorSlice{*e.Actor}).Actors[0]
+			entry.Actor = &a
+		}
+
+		res.Changes = append(res.Changes, entry)
+	}
+
+	return res
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/app/cache"
+	"github.com/yaegaki/dotlive-schedule-server/app/service"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// collaboDefaultDays 期間が指定されていない場合の日数
+const collaboDefaultDays = 90
+
+// RouteCollabo コラボ関連のルーティングを設定する
+func RouteCollabo(e *echo.Echo) {
+	e.GET("/api/collabs", collaboHandler)
+}
+
+func collaboHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	client := store.GetClient()
+
+	now := jst.Now()
+	r, err := parseDateRangeQuery(c.Request().URL.Query(), jst.Range{
+		Begin: now.FloorToDay().AddDay(-collaboDefaultDays),
+		End:   now,
+	})
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	actors, err := cache.FindActorsWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	org, err := cache.FindOrganizationWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	graph, err := service.CreateCollaboGraph(ctx, client, r, actors, org)
+	if err != nil {
+		log.Printf("can not create collabo graph: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	return c.JSON(http.StatusOK, graph)
+}
@@ -1,16 +1,25 @@
 package handler
 
 import (
+	"context"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/app/cache"
 	"github.com/yaegaki/dotlive-schedule-server/jst"
 	"golang.org/x/xerrors"
 )
 
 // parseYearMonthDayQuery '2022-2-22'形式の文字列をパースする
 func parseYearMonthDayQuery(s string) (jst.Time, error) {
+	return parseYearMonthDayQueryInLocation(s, jst.Location())
+}
+
+// parseYearMonthDayQueryInLocation '2022-2-22'形式の文字列を指定したタイムゾーンの日付としてパースする
+func parseYearMonthDayQueryInLocation(s string, loc *time.Location) (jst.Time, error) {
 	if s != "" {
 		xs := strings.Split(s, "-")
 		if len(xs) == 3 {
@@ -18,10 +27,87 @@ func parseYearMonthDayQuery(s string) (jst.Time, error) {
 			month, err2 := strconv.Atoi(xs[1])
 			day, err3 := strconv.Atoi(xs[2])
 			if err1 == nil && err2 == nil && err3 == nil {
-				return jst.ShortDate(year, time.Month(month), day), nil
+				return jst.ShortDateIn(year, time.Month(month), day, loc), nil
 			}
 		}
 	}
 
 	return jst.Time{}, xerrors.Errorf("Can not parse: %v", s)
 }
+
+// parseYearMonthQuery '2022-2'形式の文字列をパースしてその月の初めの日を返す
+func parseYearMonthQuery(s string) (jst.Time, error) {
+	xs := strings.Split(s, "-")
+	if len(xs) == 2 {
+		year, err1 := strconv.Atoi(xs[0])
+		month, err2 := strconv.Atoi(xs[1])
+		if err1 == nil && err2 == nil && month >= 1 && month <= 12 {
+			return jst.ShortDate(year, time.Month(month), 1), nil
+		}
+	}
+
+	return jst.Time{}, xerrors.Errorf("Can not parse: %v", s)
+}
+
+// dateRangeMaxDays from/toクエリで指定できる最大の日数
+const dateRangeMaxDays = 366
+
+// parseDateRangeQuery from/toクエリから期間を取得する
+// toに指定された日はその日の終わりまでを対象にする
+// 指定されていない場合はデフォルトの期間を使用する
+// 期間がdateRangeMaxDaysを超える場合はエラー
+func parseDateRangeQuery(query url.Values, defaultRange jst.Range) (jst.Range, error) {
+	r := defaultRange
+	if from := query.Get("from"); from != "" {
+		temp, err := parseYearMonthDayQuery(from)
+		if err != nil {
+			return jst.Range{}, err
+		}
+		r.Begin = temp
+	}
+
+	if to := query.Get("to"); to != "" {
+		temp, err := parseYearMonthDayQuery(to)
+		if err != nil {
+			return jst.Range{}, err
+		}
+		r.End = temp.AddOneDay().Add(-1 * time.Second)
+	}
+
+	if r.End.Before(r.Begin) {
+		return jst.Range{}, xerrors.Errorf("Invalid range: %v - %v", r.Begin, r.End)
+	}
+
+	if !r.End.Before(r.Begin.AddDay(dateRangeMaxDays)) {
+		return jst.Range{}, xerrors.Errorf("Range too long: %v - %v", r.Begin, r.End)
+	}
+
+	return r, nil
+}
+
+// parseLocationQuery tzクエリからタイムゾーンを取得する
+// 指定されていない場合はJST
+func parseLocationQuery(query url.Values) (*time.Location, error) {
+	return jst.LoadLocation(query.Get("tz"))
+}
+
+// parseGroupQuery groupクエリのグループIDを取得する
+// 指定されていない場合は空文字、存在しないグループの場合はエラー
+func parseGroupQuery(ctx context.Context, client *firestore.Client, query url.Values) (string, error) {
+	groupID := query.Get("group")
+	if groupID == "" {
+		return "", nil
+	}
+
+	groups, err := cache.FindGroupsWithCache(ctx, client)
+	if err != nil {
+		return "", err
+	}
+
+	g, err := groups.FindGroup(groupID)
+	if err != nil {
+		return "", xerrors.Errorf("Unknown group: %v", groupID)
+	}
+
+	return g.ID, nil
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+)
+
+func TestParseDateRangeQuery(t *testing.T) {
+	defaultRange := jst.Range{
+		Begin: jst.ShortDate(2022, 1, 1),
+		End:   jst.ShortDate(2022, 2, 1),
+	}
+
+	tests := []struct {
+		from     string
+		to       string
+		expected jst.Range
+		err      bool
+	}{
+		{"", "", defaultRange, false},
+		{"2021-12-1", "", jst.Range{Begin: jst.ShortDate(2021, 12, 1), End: defaultRange.End}, false},
+		{"2021-1-1", "2021-12-31", jst.Range{Begin: jst.ShortDate(2021, 1, 1), End: jst.ShortDate(2021, 12, 31).AddOneDay().Add(-time.Second)}, false},
+		{"2020-1-1", "2020-12-31", jst.Range{Begin: jst.ShortDate(2020, 1, 1), End: jst.ShortDate(2020, 12, 31).AddOneDay().Add(-time.Second)}, false},
+		{"2021-1-1", "2022-1-1", jst.Range{Begin: jst.ShortDate(2021, 1, 1), End: jst.ShortDate(2022, 1, 1).AddOneDay().Add(-time.Second)}, false},
+		{"2021-1-1", "2022-1-2", jst.Range{}, true},
+		{"2000-1-1", "", jst.Range{}, true},
+		{"2022-1-2", "2022-1-1", jst.Range{}, true},
+		{"2022-1", "", jst.Range{}, true},
+	}
+
+	for _, tt := range tests {
+		query := url.Values{}
+		if tt.from != "" {
+			query.Set("from", tt.from)
+		}
+		if tt.to != "" {
+			query.Set("to", tt.to)
+		}
+
+		r, err := parseDateRangeQuery(query, defaultRange)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%v-%v: must be error", tt.from, tt.to)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v-%v: error: %v", tt.from, tt.to, err)
+			continue
+		}
+
+		if !r.Begin.Equal(tt.expected.Begin) || !r.End.Equal(tt.expected.End) {
+			t.Errorf("%v-%v: got: %v expect: %v", tt.from, tt.to, r, tt.expected)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/ChimeraCoder/anaconda"
@@ -12,19 +13,103 @@ import (
 	"github.com/yaegaki/dotlive-schedule-server/app/cache"
 	"github.com/yaegaki/dotlive-schedule-server/app/internal"
 	"github.com/yaegaki/dotlive-schedule-server/app/service"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/event"
 	"github.com/yaegaki/dotlive-schedule-server/jst"
 	"github.com/yaegaki/dotlive-schedule-server/model"
 	"github.com/yaegaki/dotlive-schedule-server/store"
 	"github.com/yaegaki/dotlive-schedule-server/tweet"
 	"github.com/yaegaki/dotlive-schedule-server/youtube"
+	"golang.org/x/xerrors"
 )
 
 // appEngineCronHeader
 const appEngineCronHeader = "X-Appengine-Cron"
 
+// changeRetentionDays 変更履歴を保持する日数
+const changeRetentionDays = 30
+
+// eventRetentionDays イベントストリームのイベントを保持する日数
+// 再接続時に再開するためだけに使うので短くていい
+const eventRetentionDays = 1
+
+// videoUnavailableThreshold 配信前の動画を続けてこの回数だけ取得できなかった場合に中止として扱う
+const videoUnavailableThreshold = 3
+
+const (
+	// actualStartTimeout 予定の開始時刻からこの時間が過ぎても始まっていない配信は実際の開始時刻を取得しない
+	actualStartTimeout = 6 * time.Hour
+	// actualEndTimeout 実際の開始時刻からこの時間が過ぎても終わっていない配信は実際の終了時刻を取得しない
+	actualEndTimeout = 24 * time.Hour
+	// actualTimeMaxCalls 1回のジョブで実際の開始時間と終了時間を取得する動画の最大数
+	// YoutubeのAPIの割り当てを使いすぎないように制限する
+	actualTimeMaxCalls = 20
+)
+
 // RouteJob ジョブ関連のルーティングを設定する
 func RouteJob(e *echo.Echo) {
 	e.GET("/_task/job", jobHandler)
+	e.GET("/_task/compact", compactHandler)
+}
+
+// compactHandler 古い変更履歴を削除する定期実行ジョブ
+func compactHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if !internal.IsDevelop && c.Request().Header.Get(appEngineCronHeader) != "true" {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	client := store.GetClient()
+	count, err := store.CompactChanges(ctx, client, jst.Now().AddDay(-changeRetentionDays))
+	if err != nil {
+		log.Printf("Can not compact changes: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	log.Printf("Compact changes: %v", count)
+
+	// アウトボックスのプッシュ通知も同じ期間だけ保持する
+	count, err = store.CompactNotifications(ctx, client, jst.Now().AddDay(-changeRetentionDays))
+	if err != nil {
+		log.Printf("Can not compact notifications: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	log.Printf("Compact notifications: %v", count)
+
+	count, err = store.CompactWebhookDeliveries(ctx, client, jst.Now().AddDay(-changeRetentionDays))
+	if err != nil {
+		log.Printf("Can not compact webhook deliveries: %v", err)
+		return c.String(http.StatusInternalServerError, "error4")
+	}
+
+	log.Printf("Compact webhook deliveries: %v", count)
+
+	count, err = store.CompactWebPushDeliveries(ctx, client, jst.Now().AddDay(-changeRetentionDays))
+	if err != nil {
+		log.Printf("Can not compact web push deliveries: %v", err)
+		return c.String(http.StatusInternalServerError, "error5")
+	}
+
+	log.Printf("Compact web push deliveries: %v", count)
+
+	count, err = store.CompactEvents(ctx, client, jst.Now().AddDay(-eventRetentionDays))
+	if err != nil {
+		log.Printf("Can not compact events: %v", err)
+		return c.String(http.StatusInternalServerError, "error6")
+	}
+
+	log.Printf("Compact events: %v", count)
+
+	count, err = store.CompactDiscordPosts(ctx, client, jst.Now().AddDay(-changeRetentionDays))
+	if err != nil {
+		log.Printf("Can not compact discord posts: %v", err)
+		return c.String(http.StatusInternalServerError, "error7")
+	}
+
+	log.Printf("Compact discord posts: %v", count)
+	return c.String(http.StatusOK, "done.")
 }
 
 // jobHandler 定期実行ジョブ
@@ -37,17 +122,26 @@ func jobHandler(c echo.Context) error {
 
 	client := store.GetClient()
 
-	videoResolver, err := service.NewVideoResolver(ctx, client)
+	// 組織が登録されていない場合は公式チャンネルがないものとして続ける
+	org, err := store.FindOrganization(ctx, client)
+	if err != nil && err != common.ErrNotFound {
+		log.Printf("Can not get organization: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	videoResolver, err := service.NewVideoResolver(ctx, client, org)
 	if err != nil {
 		log.Printf("Can not create VideoResolver: %v", err)
-		return c.String(http.StatusInternalServerError, "error2")
+		return c.String(http.StatusInternalServerError, "error3")
 	}
 
 	actors, err := store.FindActors(ctx, client)
 	if err != nil {
 		log.Printf("Can not get actors: %v", err)
-		return c.String(http.StatusInternalServerError, "error3")
+		return c.String(http.StatusInternalServerError, "error4")
 	}
+	// 卒業した配信者は過去のスケジュールのために残しておくが新しい情報は取得しない
+	activeActors := actors.FilterActive(jst.Now())
 
 	api := anaconda.NewTwitterApi("", "")
 
@@ -55,14 +149,14 @@ func jobHandler(c echo.Context) error {
 	updateAwaiSenseiSchedule(ctx, api, client)
 
 	// プロフィール画像更新
-	for _, a := range actors {
+	for _, a := range activeActors {
 		updateProfileImage(ctx, api, client, &a)
 	}
 
-	userDotlive, err := store.FindTwitterUser(ctx, client, tweet.ScreenNameDotlive)
+	userDotlive, err := store.FindTwitterUser(ctx, client, org.TwitterScreenName)
 	if err != nil {
 		log.Printf("Can not get dotlive twitteruser: %v", err)
-		return c.String(http.StatusInternalServerError, "error4")
+		return c.String(http.StatusInternalServerError, "error5")
 	}
 
 	// ツイートから計画を取得する
@@ -82,14 +176,20 @@ func jobHandler(c echo.Context) error {
 				continue
 			}
 
-			err := store.SavePlan(ctx, client, p)
+			saved, created, err := store.SavePlan(ctx, client, p)
 			if err != nil {
 				if err == store.ErrFixedPlan {
 					log.Printf("Plan is Fixed: %v", p.Date)
 				} else {
 					log.Printf("Can not save plan %v: %v", p.Date, err)
-					return c.String(http.StatusInternalServerError, "error5")
+					return c.String(http.StatusInternalServerError, "error6")
 				}
+			} else {
+				event.Publish(event.TypePlanSaved, event.PlanSaved{
+					Date:    p.Date,
+					TweetID: p.SourceID,
+				})
+				service.PublishWebhookPlan(ctx, client, saved, created)
 			}
 		}
 
@@ -99,22 +199,33 @@ func jobHandler(c echo.Context) error {
 			err = store.SaveTwitterUser(ctx, client, userDotlive)
 			if err != nil {
 				log.Printf("Can not save dotlive twitteruser: %v", err)
-				return c.String(http.StatusInternalServerError, "error6")
+				return c.String(http.StatusInternalServerError, "error7")
 			}
 		}
 	}
 
 	// ツイートから動画情報を取得する
-	tweet.ResolveVideos(api, actors, videoResolver)
+	tweet.ResolveVideos(api, activeActors, videoResolver)
 
 	// 配信者情報をキャッシュ
 	cache.SetActors(actors)
+	cache.SetOrganization(org)
 
 	// 開始時間の更新
-	updateVideoStartAt(ctx, client, videoResolver, actors)
+	changes := updateVideoStartAt(ctx, client, videoResolver, actors)
+	service.PushNotifyVideoScheduleChanges(ctx, client, changes, actors, org)
+
+	// 実際の開始時間と終了時間の更新
+	updateVideoActualTime(ctx, client, videoResolver, actors)
+
+	// 計画と実際の開始時間のずれを記録
+	service.RecordPlanAdherences(ctx, client, jst.Now())
 
 	// プッシュ通知
-	service.PushNotify(ctx, client, actors)
+	service.PushNotify(ctx, client, actors, org)
+
+	// Webhookの送信
+	service.DeliverWebhooks(ctx, client)
 
 	return c.String(http.StatusOK, "done.")
 }
@@ -269,46 +380,188 @@ func isAwaiSenseiScheduleTweet(t tweet.Tweet) bool {
 }
 
 // updateVideoStartAt 開始予定時間より早く始まっている場合に開始時間を修正する
-func updateVideoStartAt(ctx context.Context, c *firestore.Client, vr *service.VideoResolver, actors model.ActorSlice) {
+// 開始時間が変わった動画と削除されたか非公開になった動画を返す
+func updateVideoStartAt(ctx context.Context, c *firestore.Client, vr *service.VideoResolver, actors model.ActorSlice) []service.VideoScheduleChange {
 	videos, err := store.FindNotNotifiedVideos(ctx, c)
 	if err != nil {
 		log.Printf("Can not get videos: %v", err)
-		return
+		return nil
 	}
 
 	now := jst.Now()
+	var changes []service.VideoScheduleChange
 
 	for _, v := range videos {
+		// 取得できなくなった動画も再度公開されることがあるので取得し続ける
 		if v.StartAt.Before(now) {
 			continue
 		}
 
-		var relatedActorID string
-		if v.IsUnknownActor() {
-			relatedActorID = v.RelatedActorID
-		} else {
-			relatedActorID = v.ActorID
-		}
-		actor, err := actors.FindActor(relatedActorID)
+		actor, err := findVideoRelatedActor(v, actors)
 		if err != nil {
-			log.Printf("Can not get actor %v", relatedActorID)
 			continue
 		}
 
-		newVideo, err := youtube.FindVideo(ctx, vr.YoutubeService(), v.URL, actor, now)
+		newVideo, err := youtube.FindVideo(ctx, vr.YoutubeService(), v.URL, actor, vr.Organization(), now)
+		if xerrors.Is(err, common.ErrVideoUnavailable) {
+			if v.Unavailable {
+				continue
+			}
+
+			missing, unavailable := recordVideoMissing(v)
+			_, _, err = store.SaveVideo(ctx, c, missing, nil)
+			if err != nil {
+				log.Printf("Can not save video %v: %v", v.ID, err)
+				continue
+			}
+
+			log.Printf("Video is missing %v: %v", v.ID, missing.UnavailableCount)
+			if unavailable {
+				log.Printf("Video is unavailable %v", v.ID)
+				changes = append(changes, service.VideoScheduleChange{
+					Video:    missing,
+					OldVideo: v,
+				})
+			}
+			continue
+		}
 		if err != nil {
 			log.Printf("Can not get video info %v: %v", v.ID, err)
 			continue
 		}
 
-		if v.StartAt.Equal(newVideo.StartAt) {
+		recovered := v.Unavailable || v.UnavailableCount > 0
+		if !recovered && v.StartAt.Equal(newVideo.StartAt) && v.Title == newVideo.Title && v.Thumbnail == newVideo.Thumbnail {
 			continue
 		}
+		if v.Unavailable {
+			log.Printf("Video is available again %v", v.ID)
+		}
+		oldVideo := v
+		v.Unavailable = false
+		v.UnavailableCount = 0
+		oldStartAt := v.StartAt
 		v.StartAt = newVideo.StartAt
+		// 配信前にタイトルが変更されることがあるので検索用に更新しておく
+		v.Title = newVideo.Title
+		// サムネイルも配信前に差し替えられることがあるので配信開始の通知用に更新しておく
+		v.Thumbnail = newVideo.Thumbnail
+
+		_, _, err = store.SaveVideo(ctx, c, v, nil)
+		if err != nil {
+			log.Printf("Can not save video %v: %v", v.ID, err)
+			continue
+		}
+
+		if !oldStartAt.Equal(v.StartAt) {
+			event.Publish(event.TypeVideoRescheduled, event.VideoRescheduled{
+				VideoID:    v.ID,
+				OldStartAt: oldStartAt,
+				NewStartAt: v.StartAt,
+			})
+			service.PublishWebhookVideoRescheduled(ctx, c, v, oldStartAt)
+			changes = append(changes, service.VideoScheduleChange{
+				Video:    v,
+				OldVideo: oldVideo,
+			})
+		}
+	}
+
+	return changes
+}
+
+// recordVideoMissing 配信前の動画を取得できなかったことを記録する
+// 一時的に取得できないこともあるので別々のジョブで続けてvideoUnavailableThreshold回取得できなかった場合だけUnavailableにしてtrueを返す
+func recordVideoMissing(v model.Video) (model.Video, bool) {
+	v.UnavailableCount++
+	if v.UnavailableCount < videoUnavailableThreshold {
+		return v, false
+	}
+
+	v.Unavailable = true
+	return v, true
+}
+
+// updateVideoActualTime 開始した配信の実際の開始時間と終了時間を取得する
+// 統計で配信時間や計画とのずれを計算するために使用する
+func updateVideoActualTime(ctx context.Context, c *firestore.Client, vr *service.VideoResolver, actors model.ActorSlice) {
+	now := jst.Now()
+	videos, err := store.FindVideos(ctx, c, jst.Range{
+		Begin: now.AddDay(-2),
+		End:   now,
+	})
+	if err != nil {
+		log.Printf("Can not get videos: %v", err)
+		return
+	}
+
+	calls := 0
+	for _, v := range videos {
+		if !needsActualTime(v, now) {
+			continue
+		}
+
+		if calls >= actualTimeMaxCalls {
+			log.Printf("Too many videos to get actual time")
+			break
+		}
+
+		actor, err := findVideoRelatedActor(v, actors)
+		if err != nil {
+			continue
+		}
 
-		err = store.SaveVideo(ctx, c, v, nil)
+		calls++
+		newVideo, err := youtube.FindVideo(ctx, vr.YoutubeService(), v.URL, actor, vr.Organization(), now)
+		if err != nil {
+			log.Printf("Can not get video info %v: %v", v.ID, err)
+			continue
+		}
+
+		if v.ActualStartAt.Equal(newVideo.ActualStartAt) && v.EndAt.Equal(newVideo.EndAt) {
+			continue
+		}
+		v.ActualStartAt = newVideo.ActualStartAt
+		v.EndAt = newVideo.EndAt
+
+		_, _, err = store.SaveVideo(ctx, c, v, nil)
 		if err != nil {
 			log.Printf("Can not save video %v: %v", v.ID, err)
 		}
 	}
 }
+
+// needsActualTime 実際の開始時間と終了時間を取得する必要があるかどうか
+// 中止された配信や終わらない配信を取得し続けないように一定時間が過ぎたら諦める
+func needsActualTime(v model.Video, now jst.Time) bool {
+	if v.Source != model.VideoSourceYoutube || !v.IsLive || v.Unavailable {
+		return false
+	}
+
+	if v.ActualStartAt.IsZero() {
+		return now.Before(v.StartAt.Add(actualStartTimeout))
+	}
+
+	if v.EndAt.IsZero() {
+		return now.Before(v.ActualStartAt.Add(actualEndTimeout))
+	}
+
+	return false
+}
+
+// findVideoRelatedActor 動画情報の取得に使用する配信者を取得する
+func findVideoRelatedActor(v model.Video, actors model.ActorSlice) (model.Actor, error) {
+	var relatedActorID string
+	if v.IsUnknownActor() {
+		relatedActorID = v.RelatedActorID
+	} else {
+		relatedActorID = v.ActorID
+	}
+	actor, err := actors.FindActor(relatedActorID)
+	if err != nil {
+		log.Printf("Can not get actor %v", relatedActorID)
+		return model.Actor{}, err
+	}
+
+	return actor, nil
+}
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"firebase.google.com/go/messaging"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
 )
 
 type notifyVideoTestClient struct {
@@ -54,3 +56,58 @@ func TestIsDotLiveScheduleText(t *testing.T) {
 		})
 	}
 }
+
+func TestRecordVideoMissing(t *testing.T) {
+	v := model.Video{ID: "video"}
+	for i := 1; i < videoUnavailableThreshold; i++ {
+		var unavailable bool
+		v, unavailable = recordVideoMissing(v)
+		if unavailable || v.Unavailable {
+			t.Fatalf("must not be unavailable at %v", i)
+		}
+	}
+
+	v, unavailable := recordVideoMissing(v)
+	if !unavailable || !v.Unavailable || v.UnavailableCount != videoUnavailableThreshold {
+		t.Errorf("must be unavailable: %+v", v)
+	}
+}
+
+func TestNeedsActualTime(t *testing.T) {
+	now := jst.Date(2020, 4, 29, 20, 0)
+	base := model.Video{
+		Source:  model.VideoSourceYoutube,
+		IsLive:  true,
+		StartAt: jst.Date(2020, 4, 29, 19, 0),
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(v *model.Video)
+		expected bool
+	}{
+		{"not started", func(v *model.Video) {}, true},
+		{"started", func(v *model.Video) { v.ActualStartAt = jst.Date(2020, 4, 29, 19, 5) }, true},
+		{"ended", func(v *model.Video) {
+			v.ActualStartAt = jst.Date(2020, 4, 29, 19, 5)
+			v.EndAt = jst.Date(2020, 4, 29, 19, 50)
+		}, false},
+		{"not live", func(v *model.Video) { v.IsLive = false }, false},
+		{"other source", func(v *model.Video) { v.Source = model.VideoSourceBilibili }, false},
+		{"unavailable", func(v *model.Video) { v.Unavailable = true }, false},
+		// 予定の開始時刻から時間が経っても始まっていない配信は諦める
+		{"never started", func(v *model.Video) { v.StartAt = jst.Date(2020, 4, 29, 13, 0) }, false},
+		{"never ended", func(v *model.Video) {
+			v.StartAt = jst.Date(2020, 4, 28, 19, 0)
+			v.ActualStartAt = jst.Date(2020, 4, 28, 19, 0)
+		}, false},
+	}
+
+	for _, tt := range tests {
+		v := base
+		tt.modify(&v)
+		if got := needsActualTime(v, now); got != tt.expected {
+			t.Errorf("%v, got: %v expect: %v", tt.name, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/app/cache"
+	"github.com/yaegaki/dotlive-schedule-server/app/service"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// RouteReport レポート関連のルーティングを設定する
+func RouteReport(e *echo.Echo) {
+	e.GET("/api/report/adherence", adherenceReportHandler)
+}
+
+func adherenceReportHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	client := store.GetClient()
+
+	// 指定されていない場合は今月
+	now := jst.Now()
+	r, err := parseDateRangeQuery(c.Request().URL.Query(), jst.Range{
+		Begin: jst.ShortDate(now.Year(), now.Month(), 1),
+		End:   now,
+	})
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	actors, err := cache.FindActorsWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	report, err := service.CreateAdherenceReport(ctx, client, r, now, actors)
+	if err != nil {
+		log.Printf("can not create adherence report: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
@@ -21,10 +21,16 @@ func scheduleHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 	client := store.GetClient()
 
-	now := jst.Now()
-	q := c.Request().URL.Query().Get("q")
+	query := c.Request().URL.Query()
+	loc, err := parseLocationQuery(query)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	now := jst.Now().In(loc)
+	q := query.Get("q")
 	if q != "" {
-		temp, err := parseYearMonthDayQuery(q)
+		temp, err := parseYearMonthDayQueryInLocation(q, loc)
 		if err == nil {
 			now = temp
 		}
@@ -35,11 +41,25 @@ func scheduleHandler(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "error2")
 	}
 
-	s, err := service.CreateSchedule(ctx, client, now, actors)
+	org, err := cache.FindOrganizationWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	groupID, err := parseGroupQuery(ctx, client, query)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	s, err := service.CreateScheduleInLocation(ctx, client, now, actors, org, loc)
 	if err != nil {
 		log.Printf("can not create schedule: %v", err)
 		return c.String(http.StatusInternalServerError, "error3")
 	}
+
+	if groupID != "" {
+		s = service.FilterScheduleByGroup(s, actors, groupID)
+	}
 	bytes, _ := json.Marshal(s)
 	return c.JSONBlob(http.StatusOK, bytes)
 }
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/app/cache"
+	"github.com/yaegaki/dotlive-schedule-server/app/service"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/search"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+const (
+	// searchDefaultLimit 1ページあたりのデフォルトの動画数
+	searchDefaultLimit = 20
+	// searchMaxLimit 1ページあたりの最大の動画数
+	searchMaxLimit = 50
+	// searchDefaultDays 期間が指定されていない場合の日数
+	searchDefaultDays = 365
+)
+
+// RouteSearch 検索関連のルーティングを設定する
+func RouteSearch(e *echo.Echo) {
+	e.GET("/api/search", searchHandler)
+}
+
+func searchHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	client := store.GetClient()
+
+	query := c.Request().URL.Query()
+	q := search.ParseQuery(query.Get("q"))
+	if q.IsEmpty() {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	actors, err := cache.FindActorsWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	var actorID string
+	if id := query.Get("actor"); id != "" {
+		actor, err := actors.FindActor(id)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		actorID = actor.ID
+	}
+
+	// 指定されていない場合は直近1年
+	now := jst.Now()
+	r, err := parseDateRangeQuery(query, jst.Range{
+		Begin: now.FloorToDay().AddDay(-searchDefaultDays),
+		End:   now,
+	})
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	limit := searchDefaultLimit
+	if l := query.Get("limit"); l != "" {
+		temp, err := strconv.Atoi(l)
+		if err != nil || temp <= 0 {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		limit = temp
+		if limit > searchMaxLimit {
+			limit = searchMaxLimit
+		}
+	}
+
+	var cursor *service.VideoCursor
+	if s := query.Get("cursor"); s != "" {
+		temp, err := parseVideoCursor(s)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		cursor = &temp
+	}
+
+	page, err := service.SearchVideos(ctx, client, q, actorID, r, cursor, limit)
+	if err != nil {
+		log.Printf("can not search videos: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	res := SearchResponse{
+		Videos: []SearchVideo{},
+	}
+	for _, v := range page.Videos {
+		res.Videos = append(res.Videos, SearchVideo{
+			ID:         v.ID,
+			ActorID:    v.ActorID,
+			URL:        v.URL,
+			Source:     v.Source,
+			StartAt:    v.StartAt,
+			IsLive:     v.IsLive,
+			MemberOnly: v.MemberOnly,
+			Title:      v.Title,
+			Text:       v.Text,
+			OwnerName:  v.OwnerName,
+			HashTags:   v.HashTags,
+		})
+	}
+	if page.Next != nil {
+		res.Cursor = formatVideoCursor(*page.Next)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// SearchResponse 検索APIのレスポンス
+type SearchResponse struct {
+	// Videos 動画
+	Videos []SearchVideo `json:"videos"`
+	// Cursor 次のページを取得するためのカーソル
+	// 次のページが存在しない場合は空文字
+	Cursor string `json:"cursor"`
+}
+
+// SearchVideo 検索にマッチした動画
+type SearchVideo struct {
+	// ID 動画ID
+	ID string `json:"id"`
+	// ActorID 配信者ID
+	ActorID string `json:"actorId"`
+	// URL 動画のURL
+	URL string `json:"url"`
+	// Source 配信サイト
+	Source string `json:"source"`
+	// StartAt 配信開始時刻
+	StartAt jst.Time `json:"startAt"`
+	// IsLive 生放送かどうか
+	IsLive bool `json:"isLive"`
+	// MemberOnly メンバー限定かどうか
+	MemberOnly bool `json:"memberOnly"`
+	// Title 動画サイトでのタイトル
+	Title string `json:"title"`
+	// Text 説明
+	Text string `json:"text"`
+	// OwnerName 動画配信者の名前
+	OwnerName string `json:"ownerName"`
+	// HashTags ハッシュタグ
+	HashTags []string `json:"hashTags"`
+}
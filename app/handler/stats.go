@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/app/cache"
+	"github.com/yaegaki/dotlive-schedule-server/app/service"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// RouteStats 統計関連のルーティングを設定する
+func RouteStats(e *echo.Echo) {
+	e.GET("/api/stats", statsHandler)
+}
+
+func statsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	client := store.GetClient()
+
+	now := jst.Now()
+	baseDate := jst.ShortDate(now.Year(), now.Month(), 1)
+	month := c.Request().URL.Query().Get("month")
+	if month != "" {
+		temp, err := parseYearMonthQuery(month)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		baseDate = temp
+	}
+
+	actors, err := cache.FindActorsWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	org, err := cache.FindOrganizationWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	stats, err := service.CreateMonthlyStats(ctx, client, baseDate, now, actors, org)
+	if err != nil {
+		log.Printf("can not create monthly stats: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
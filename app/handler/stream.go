@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/event"
+)
+
+const (
+	// streamHeartbeatInterval 接続を維持するためにコメントを送る間隔
+	streamHeartbeatInterval = 30 * time.Second
+	// streamRetry 切断されたときにクライアントが再接続するまでの時間(ミリ秒)
+	streamRetry = 10000
+)
+
+// RouteStream イベントストリーム関連のルーティングを設定する
+func RouteStream(e *echo.Echo) {
+	e.GET("/api/stream", streamHandler)
+}
+
+// streamHandler Server-Sent Eventsでスケジュールの変更を通知する
+func streamHandler(c echo.Context) error {
+	lastEventID := c.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		// EventSourceはヘッダを指定できないのでクエリでも受け付ける
+		lastEventID = c.QueryParam("lastEventId")
+	}
+
+	s := event.GetBroker().Subscribe(lastEventID)
+	defer s.Close()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	// プロキシでバッファリングされないようにする
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(res, "retry: %v\n\n", streamRetry)
+	if s.Reset {
+		writeStreamEvent(res, event.Event{
+			Type: event.TypeReset,
+			Data: []byte("{}"),
+		})
+	}
+	for _, e := range s.Missed {
+		writeStreamEvent(res, e)
+	}
+	res.Flush()
+
+	ticker := time.NewTicker(streamHeartbeatInterval)
+	defer ticker.Stop()
+
+	ctx := c.Request().Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-s.Events:
+			// 受信が追いつかずに切断された
+			if !ok {
+				return nil
+			}
+			writeStreamEvent(res, e)
+			res.Flush()
+		case <-ticker.C:
+			fmt.Fprint(res, ": heartbeat\n\n")
+			res.Flush()
+		}
+	}
+}
+
+// writeStreamEvent イベントをServer-Sent Eventsの形式で書き込む
+func writeStreamEvent(w io.Writer, e event.Event) {
+	if e.ID != "" {
+		fmt.Fprintf(w, "id: %v\n", e.ID)
+	}
+	fmt.Fprintf(w, "event: %v\n", e.Type)
+	for _, line := range strings.Split(string(e.Data), "\n") {
+		fmt.Fprintf(w, "data: %v\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/event"
+)
+
+// readStreamEvent 空行までを1つのイベントとして読む
+func readStreamEvent(t *testing.T, r *bufio.Reader) map[string]string {
+	fields := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			return fields
+		}
+
+		xs := strings.SplitN(line, ": ", 2)
+		if len(xs) == 2 {
+			fields[xs[0]] = xs[1]
+		}
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	old := event.GetBroker()
+	defer event.SetBroker(old)
+	b := event.NewLocalBroker(10)
+	event.SetBroker(b)
+
+	e := echo.New()
+	RouteStream(e)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	s := b.Subscribe("")
+	b.Publish(event.TypePlanSaved, event.PlanSaved{TweetID: "1"})
+	first := <-s.Events
+	s.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/stream", nil)
+	req.Header.Set("Last-Event-ID", first.ID)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if ct := res.Header.Get(echo.HeaderContentType); ct != "text/event-stream" {
+		t.Errorf("content-type, got: %v", ct)
+	}
+
+	r := bufio.NewReader(res.Body)
+	if fields := readStreamEvent(t, r); fields["retry"] == "" {
+		t.Errorf("retry, got: %v", fields)
+	}
+
+	// 接続が確立してから発行する
+	go func() {
+		<-time.After(100 * time.Millisecond)
+		b.Publish(event.TypeVideoSaved, event.VideoSaved{VideoID: "v"})
+	}()
+
+	fields := readStreamEvent(t, r)
+	if fields["event"] != event.TypeVideoSaved || !strings.Contains(fields["data"], `"videoId":"v"`) || fields["id"] == "" {
+		t.Errorf("event, got: %v", fields)
+	}
+
+	// 保持しているイベントより古いIDの場合はリセットを送る
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/api/stream?lastEventId=unknown-1", nil)
+	res2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res2.Body.Close()
+
+	r = bufio.NewReader(res2.Body)
+	readStreamEvent(t, r)
+	if fields := readStreamEvent(t, r); fields["event"] != event.TypeReset {
+		t.Errorf("event, got: %v expect: %v", fields, event.TypeReset)
+	}
+}
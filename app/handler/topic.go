@@ -1,18 +1,24 @@
 package handler
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"github.com/yaegaki/dotlive-schedule-server/app/cache"
+	"github.com/yaegaki/dotlive-schedule-server/app/service"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
 	"github.com/yaegaki/dotlive-schedule-server/model"
 	"github.com/yaegaki/dotlive-schedule-server/notify"
 	"github.com/yaegaki/dotlive-schedule-server/store"
+	"golang.org/x/xerrors"
 )
 
 // RouteTopic プッシュ通知のトピック関連のルーティングを設定する
 func RouteTopic(e *echo.Echo) {
 	e.POST("/api/topic", topicHandler)
+	e.POST("/api/subscriptions", subscribeHandler)
+	e.DELETE("/api/subscriptions", unsubscribeHandler)
 	/*
 		e.GET("/debug/topic", func(c echo.Context) error {
 			return c.HTML(http.StatusOK, `<html><body>
@@ -35,18 +41,101 @@ func topicHandler(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "error2")
 	}
 
+	groups, err := cache.FindGroupsWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
 	req.ParseForm()
 	token := req.Form.Get("t")
 	if token == "" {
 		return c.String(http.StatusBadRequest, "bad request")
 	}
 
-	subscribedTopics, err := notify.GetTopics(token)
+	// FCMからは購読しているトピックを取得できないのでサーバーの記録を使用する
+	s, err := service.FindTopicSubscription(ctx, client, token)
 	if err != nil {
-		// どのような理由で失敗してもbad request
-		return c.String(http.StatusBadRequest, "bad request...")
+		log.Printf("Can not get topic subscription: %v", err)
+		return c.String(http.StatusInternalServerError, "error4")
 	}
 
+	return c.JSON(http.StatusOK, createTopics(actors, groups, s))
+}
+
+// SubscriptionRequest トピックの購読のリクエスト
+type SubscriptionRequest struct {
+	// Token クライアントのFCMのトークン
+	Token string `json:"token" form:"t"`
+	// Topics 購読または解除するトピック
+	Topics []string `json:"topics" form:"topic"`
+}
+
+func subscribeHandler(c echo.Context) error {
+	return updateSubscription(c, true)
+}
+
+func unsubscribeHandler(c echo.Context) error {
+	return updateSubscription(c, false)
+}
+
+// updateSubscription トピックを購読または解除して購読できるトピックの一覧を返す
+// 解除の場合はトピックを指定しないと全てのトピックの購読を解除する
+func updateSubscription(c echo.Context, subscribe bool) error {
+	ctx := c.Request().Context()
+	client := store.GetClient()
+
+	actors, err := cache.FindActorsWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	groups, err := cache.FindGroupsWithCache(ctx, client)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	var req SubscriptionRequest
+	err = c.Bind(&req)
+	if err != nil || req.Token == "" || (subscribe && len(req.Topics) == 0) {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	// 購読できないトピックは指定できない
+	// 解除の場合は以前購読できたトピックも指定できるように確認しない
+	if subscribe {
+		topics := createTopics(actors, groups, model.TopicSubscription{})
+		for _, t := range req.Topics {
+			if !containsTopic(topics, t) {
+				return c.String(http.StatusBadRequest, "bad request")
+			}
+		}
+	}
+
+	cli, err := notify.NewTopicClient(ctx)
+	if err != nil {
+		log.Printf("Can not create firebase messaging client: %v", err)
+		return c.String(http.StatusInternalServerError, "error4")
+	}
+
+	var s model.TopicSubscription
+	if subscribe {
+		s, err = service.SubscribeTopics(ctx, client, cli, req.Token, req.Topics)
+	} else {
+		s, err = service.UnsubscribeTopics(ctx, client, cli, req.Token, req.Topics)
+	}
+	if xerrors.Is(err, notify.ErrInvalidToken) {
+		// クライアントはトークンを更新してから再度購読する
+		return c.String(http.StatusGone, "invalid token")
+	} else if err != nil {
+		log.Printf("Can not update topic subscription: %v", err)
+		return c.String(http.StatusInternalServerError, "error5")
+	}
+
+	return c.JSON(http.StatusOK, createTopics(actors, groups, s))
+}
+
+// createTopics 購読できるトピックの一覧を作成する
+func createTopics(actors model.ActorSlice, groups model.GroupSlice, s model.TopicSubscription) []model.Topic {
 	result := []model.Topic{
 		model.Topic{
 			Name:        "plan",
@@ -54,7 +143,8 @@ func topicHandler(c echo.Context) error {
 		},
 	}
 
-	for _, a := range actors {
+	// 卒業した配信者の配信は通知されないので購読できないようにする
+	for _, a := range actors.FilterActive(jst.Now()) {
 		result = append(result, model.Topic{
 			// Twitterのスクリーンネームをトピック名に使用する
 			Name:        a.TwitterScreenName,
@@ -62,16 +152,34 @@ func topicHandler(c echo.Context) error {
 		})
 	}
 
-	for _, t := range subscribedTopics {
-		for i := range result {
-			temp := result[i]
-			if temp.Name == t {
-				temp.Subscribed = true
-				result[i] = temp
-				break
-			}
+	// 配信開始前のリマインダーは配信者ごとに別のトピックで購読する
+	for _, a := range actors.FilterActive(jst.Now()) {
+		result = append(result, model.Topic{
+			Name:        model.RemindTopicName(a.TwitterScreenName),
+			DisplayName: a.Name + "(リマインダー)",
+		})
+	}
+
+	for _, g := range groups {
+		result = append(result, model.Topic{
+			Name:        g.Topic(),
+			DisplayName: g.Name,
+		})
+	}
+
+	for i := range result {
+		result[i].Subscribed = s.IsSubscribed(result[i].Name)
+	}
+
+	return result
+}
+
+func containsTopic(topics []model.Topic, name string) bool {
+	for _, t := range topics {
+		if t.Name == name {
+			return true
 		}
 	}
 
-	return c.JSON(http.StatusOK, result)
+	return false
 }
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"testing"
+
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestCreateTopics(t *testing.T) {
+	groups := model.GroupSlice{{ID: "idol", Name: "アイドル部"}}
+	s := model.TopicSubscription{Topics: []string{"plan", Siro.TwitterScreenName, "unknown"}}
+
+	topics := createTopics(model.ActorSlice{Siro}, groups, s)
+	expected := []model.Topic{
+		{Name: "plan", DisplayName: "計画", Subscribed: true},
+		{Name: Siro.TwitterScreenName, DisplayName: Siro.Name, Subscribed: true},
+		{Name: model.RemindTopicName(Siro.TwitterScreenName), DisplayName: Siro.Name + "(リマインダー)"},
+		{Name: model.GroupTopicName("idol"), DisplayName: "アイドル部"},
+	}
+
+	if len(topics) != len(expected) {
+		t.Fatalf("got: %v expect: %v", topics, expected)
+	}
+
+	for i := range expected {
+		if topics[i] != expected[i] {
+			t.Errorf("got: %+v expect: %+v", topics[i], expected[i])
+		}
+	}
+
+	if !containsTopic(topics, "plan") || containsTopic(topics, "unknown") {
+		t.Errorf("invalid containsTopic")
+	}
+}
@@ -0,0 +1,517 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/yaegaki/dotlive-schedule-server/app/cache"
+	"github.com/yaegaki/dotlive-schedule-server/app/service"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+const v2PathPrefix = "/api/v2"
+
+const (
+	// v2ErrorCodeBadRequest リクエストのパラメータが不正
+	v2ErrorCodeBadRequest = "bad_request"
+	// v2ErrorCodeNotFound 対象が存在しない
+	v2ErrorCodeNotFound = "not_found"
+	// v2ErrorCodeInternal サーバー内部のエラー
+	v2ErrorCodeInternal = "internal"
+)
+
+const (
+	// v2SourceYoutube Youtube
+	v2SourceYoutube = "youtube"
+	// v2SourceBilibili Bilibili
+	v2SourceBilibili = "bilibili"
+	// v2SourceMildom Mildom
+	v2SourceMildom = "mildom"
+	// v2SourceUnknown 配信サイトが分からない
+	v2SourceUnknown = "unknown"
+	// v2ChannelUnknown メインチャンネルかサブチャンネルか分からない
+	v2ChannelUnknown = "unknown"
+)
+
+// v2Operation v2のAPIの定義
+// ルーティングとOpenAPIのドキュメントの両方をこの定義から作成する
+type v2Operation struct {
+	// path v2PathPrefixからのパス(echoの形式)
+	path string
+	// summary 概要
+	summary string
+	// params パラメータ
+	params []v2Parameter
+	// response 成功時のレスポンスの型のゼロ値
+	response interface{}
+	// errorStatuses 返す可能性があるエラーのステータスコード
+	errorStatuses []int
+	handler       echo.HandlerFunc
+}
+
+// v2Parameter v2のAPIのパラメータ
+type v2Parameter struct {
+	name        string
+	in          string
+	description string
+	required    bool
+}
+
+// v2Operations v2のAPIの一覧
+func v2Operations() []v2Operation {
+	tzParam := v2Parameter{
+		name:        "tz",
+		in:          "query",
+		description: "IANAのタイムゾーン名(例: America/Los_Angeles)、省略時はAsia/Tokyo",
+	}
+
+	return []v2Operation{
+		{
+			path:    "/schedule",
+			summary: "1日の配信スケジュールを取得する",
+			params: []v2Parameter{
+				{name: "date", in: "query", description: "日付(2020-4-29形式)、省略時は今日"},
+				tzParam,
+			},
+			response:      V2ScheduleResponse{},
+			errorStatuses: []int{http.StatusBadRequest, http.StatusInternalServerError},
+			handler:       v2ScheduleHandler,
+		},
+		{
+			path:    "/calendar",
+			summary: "1ヶ月の配信カレンダーを取得する",
+			params: []v2Parameter{
+				{name: "month", in: "query", description: "月(2020-4形式)、省略時は今月"},
+				tzParam,
+			},
+			response:      V2CalendarResponse{},
+			errorStatuses: []int{http.StatusBadRequest, http.StatusInternalServerError},
+			handler:       v2CalendarHandler,
+		},
+		{
+			path:          "/actors",
+			summary:       "配信者の一覧を取得する",
+			response:      V2ActorsResponse{},
+			errorStatuses: []int{http.StatusInternalServerError},
+			handler:       v2ActorsHandler,
+		},
+		{
+			path:    "/actors/:id/upcoming",
+			summary: "配信者のこれからの配信予定を取得する",
+			params: []v2Parameter{
+				{name: "id", in: "path", description: "配信者ID", required: true},
+				tzParam,
+			},
+			response:      V2UpcomingResponse{},
+			errorStatuses: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+			handler:       v2UpcomingHandler,
+		},
+	}
+}
+
+// RouteV2 v2のAPIのルーティングを設定する
+func RouteV2(e *echo.Echo) {
+	g := e.Group(v2PathPrefix, middleware.RequestID())
+	for _, op := range v2Operations() {
+		g.GET(op.path, op.handler)
+	}
+	g.GET("/openapi.json", v2OpenAPIHandler)
+
+	// 存在しないAPIもエラーの形式を揃える
+	g.Any("/*", func(c echo.Context) error {
+		return v2Error(c, http.StatusNotFound, v2ErrorCodeNotFound, "api not found")
+	})
+}
+
+// V2ErrorResponse v2のAPIのエラーレスポンス
+type V2ErrorResponse struct {
+	Error V2Error `json:"error"`
+}
+
+// V2Error v2のAPIのエラー
+type V2Error struct {
+	// Code エラーの種類
+	Code string `json:"code" enum:"bad_request,not_found,internal"`
+	// Message エラーの詳細
+	Message string `json:"message"`
+	// RequestID リクエストID
+	RequestID string `json:"requestId"`
+}
+
+func v2Error(c echo.Context, status int, code string, message string) error {
+	return c.JSON(status, V2ErrorResponse{
+		Error: V2Error{
+			Code:      code,
+			Message:   message,
+			RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+		},
+	})
+}
+
+// V2ScheduleResponse v2のスケジュールAPIのレスポンス
+type V2ScheduleResponse struct {
+	// Date 配信日
+	Date jst.Time `json:"date"`
+	// TweetID 元ツイートのID
+	// 計画が存在しない場合は空文字
+	TweetID string `json:"tweetId"`
+	// Entries エントリ
+	Entries []V2ScheduleEntry `json:"entries"`
+}
+
+// V2ScheduleEntry v2のスケジュールのエントリ
+type V2ScheduleEntry struct {
+	// StartAt 配信予定/開始時刻
+	StartAt jst.Time `json:"startAt"`
+	// OriginalStartAt 開始時刻が変更された場合の最初の開始時刻、変更されていない場合はnull
+	OriginalStartAt *jst.Time `json:"originalStartAt"`
+	// Participants 配信に参加する配信者のID
+	Participants []string `json:"participants"`
+	// Label 参加者の名前以外で表示する名前、必要ない場合は空文字
+	// コラボのハッシュタグや外部のチャンネル名など
+	Label string `json:"label"`
+	// Source 配信サイト
+	Source string `json:"source" enum:"youtube,bilibili,mildom,unknown"`
+	// Flags 配信の属性
+	Flags V2EntryFlags `json:"flags"`
+	// CollaboID 計画でのコラボID、コラボでない場合は0
+	CollaboID int `json:"collaboId"`
+	// Video 動画、計画だけで動画が見つかっていない場合はnull
+	Video *V2EntryVideo `json:"video"`
+}
+
+// V2EntryFlags エントリの属性
+type V2EntryFlags struct {
+	// Planned 計画された配信かどうか
+	Planned bool `json:"planned"`
+	// Live 生放送かどうか
+	Live bool `json:"live"`
+	// MemberOnly メンバー限定かどうか
+	MemberOnly bool `json:"memberOnly"`
+	// Collabo コラボかどうか
+	Collabo bool `json:"collabo"`
+}
+
+// V2EntryVideo エントリの動画
+type V2EntryVideo struct {
+	// ID 動画ID
+	ID string `json:"id"`
+	// URL 動画のURL
+	URL string `json:"url"`
+	// Text 説明
+	Text string `json:"text"`
+	// Channel 配信者のメインチャンネルかサブチャンネルか
+	Channel string `json:"channel" enum:"main,sub,unknown"`
+}
+
+// V2CalendarResponse v2のカレンダーAPIのレスポンス
+type V2CalendarResponse struct {
+	// BaseDate 月の初めの日
+	BaseDate jst.Time `json:"baseDate"`
+	// FixedDay この日以前の情報は変更されることがない
+	FixedDay int `json:"fixedDay"`
+	// Days 配信がある日
+	Days []V2CalendarDay `json:"days"`
+}
+
+// V2CalendarDay カレンダーの1日
+type V2CalendarDay struct {
+	// Day 何日か
+	Day int `json:"day"`
+	// ActorIDs 配信した配信者のID
+	ActorIDs []string `json:"actorIds"`
+}
+
+// V2ActorsResponse v2の配信者一覧APIのレスポンス
+type V2ActorsResponse struct {
+	Actors []V2Actor `json:"actors"`
+}
+
+// V2Actor 配信者
+type V2Actor struct {
+	// ID 配信者ID
+	ID string `json:"id"`
+	// Name 名前
+	Name string `json:"name"`
+	// Icon アイコンURL
+	Icon string `json:"icon"`
+	// Emoji 推しアイコン
+	Emoji string `json:"emoji"`
+	// HashTag ハッシュタグ
+	HashTag string `json:"hashTag"`
+	// TwitterScreenName Twitterのスクリーンネーム
+	TwitterScreenName string `json:"twitterScreenName"`
+	// YoutubeChannelID YoutubeのチャンネルID
+	YoutubeChannelID string `json:"youtubeChannelId"`
+	// Status 活動状況
+	Status string `json:"status" enum:"active,graduated"`
+	// ActiveFrom 活動開始日
+	ActiveFrom *jst.Time `json:"activeFrom"`
+	// ActiveUntil 活動終了日
+	ActiveUntil *jst.Time `json:"activeUntil"`
+}
+
+// V2UpcomingResponse v2の配信予定APIのレスポンス
+type V2UpcomingResponse struct {
+	Entries []V2ScheduleEntry `json:"entries"`
+}
+
+func v2ScheduleHandler(c echo.Context) error {
+	query := c.Request().URL.Query()
+	loc, err := parseLocationQuery(query)
+	if err != nil {
+		return v2Error(c, http.StatusBadRequest, v2ErrorCodeBadRequest, "invalid tz")
+	}
+
+	date := jst.Now().In(loc)
+	if s := query.Get("date"); s != "" {
+		date, err = parseYearMonthDayQueryInLocation(s, loc)
+		if err != nil {
+			return v2Error(c, http.StatusBadRequest, v2ErrorCodeBadRequest, "invalid date")
+		}
+	}
+
+	ctx := c.Request().Context()
+	client := store.GetClient()
+	actors, err := cache.FindActorsWithCache(ctx, client)
+	if err != nil {
+		log.Printf("can not get actors: %v", err)
+		return v2Error(c, http.StatusInternalServerError, v2ErrorCodeInternal, "can not get actors")
+	}
+
+	org, err := cache.FindOrganizationWithCache(ctx, client)
+	if err != nil {
+		log.Printf("can not get organization: %v", err)
+		return v2Error(c, http.StatusInternalServerError, v2ErrorCodeInternal, "can not get organization")
+	}
+
+	s, err := service.CreateScheduleInLocation(ctx, client, date, actors, org, loc)
+	if err != nil {
+		log.Printf("can not create schedule: %v", err)
+		return v2Error(c, http.StatusInternalServerError, v2ErrorCodeInternal, "can not create schedule")
+	}
+
+	return c.JSON(http.StatusOK, newV2ScheduleResponse(s, actors))
+}
+
+func v2CalendarHandler(c echo.Context) error {
+	query := c.Request().URL.Query()
+	loc, err := parseLocationQuery(query)
+	if err != nil {
+		return v2Error(c, http.StatusBadRequest, v2ErrorCodeBadRequest, "invalid tz")
+	}
+
+	now := jst.Now()
+	localNow := now.In(loc)
+	baseDate := jst.ShortDateIn(localNow.Year(), localNow.Month(), 1, loc)
+	if s := query.Get("month"); s != "" {
+		temp, err := parseYearMonthQuery(s)
+		if err != nil {
+			return v2Error(c, http.StatusBadRequest, v2ErrorCodeBadRequest, "invalid month")
+		}
+		baseDate = jst.ShortDateIn(temp.Year(), temp.Month(), 1, loc)
+	}
+
+	ctx := c.Request().Context()
+	client := store.GetClient()
+	actors, err := cache.FindActorsWithCache(ctx, client)
+	if err != nil {
+		log.Printf("can not get actors: %v", err)
+		return v2Error(c, http.StatusInternalServerError, v2ErrorCodeInternal, "can not get actors")
+	}
+
+	org, err := cache.FindOrganizationWithCache(ctx, client)
+	if err != nil {
+		log.Printf("can not get organization: %v", err)
+		return v2Error(c, http.StatusInternalServerError, v2ErrorCodeInternal, "can not get organization")
+	}
+
+	calendar, err := service.CreateCalendarInLocation(ctx, client, baseDate, now, actors, org, loc)
+	if err != nil {
+		log.Printf("can not create calendar: %v", err)
+		return v2Error(c, http.StatusInternalServerError, v2ErrorCodeInternal, "can not create calendar")
+	}
+
+	return c.JSON(http.StatusOK, newV2CalendarResponse(calendar))
+}
+
+func v2ActorsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	actors, err := cache.FindActorsWithCache(ctx, store.GetClient())
+	if err != nil {
+		log.Printf("can not get actors: %v", err)
+		return v2Error(c, http.StatusInternalServerError, v2ErrorCodeInternal, "can not get actors")
+	}
+
+	return c.JSON(http.StatusOK, newV2ActorsResponse(actors))
+}
+
+func v2UpcomingHandler(c echo.Context) error {
+	loc, err := parseLocationQuery(c.Request().URL.Query())
+	if err != nil {
+		return v2Error(c, http.StatusBadRequest, v2ErrorCodeBadRequest, "invalid tz")
+	}
+
+	ctx := c.Request().Context()
+	client := store.GetClient()
+	actors, err := cache.FindActorsWithCache(ctx, client)
+	if err != nil {
+		log.Printf("can not get actors: %v", err)
+		return v2Error(c, http.StatusInternalServerError, v2ErrorCodeInternal, "can not get actors")
+	}
+
+	org, err := cache.FindOrganizationWithCache(ctx, client)
+	if err != nil {
+		log.Printf("can not get organization: %v", err)
+		return v2Error(c, http.StatusInternalServerError, v2ErrorCodeInternal, "can not get organization")
+	}
+
+	actor, err := actors.FindActor(c.Param("id"))
+	if err != nil {
+		return v2Error(c, http.StatusNotFound, v2ErrorCodeNotFound, "actor not found")
+	}
+
+	entries, err := service.CreateUpcomingSchedule(ctx, client, actor, jst.Now(), actors, org)
+	if err != nil {
+		log.Printf("can not create upcoming schedule: %v", err)
+		return v2Error(c, http.StatusInternalServerError, v2ErrorCodeInternal, "can not create upcoming schedule")
+	}
+
+	res := V2UpcomingResponse{
+		Entries: []V2ScheduleEntry{},
+	}
+	for _, e := range entries {
+		e.StartAt = e.StartAt.In(loc)
+		res.Entries = append(res.Entries, newV2ScheduleEntry(e, actors))
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func newV2ScheduleResponse(s model.Schedule, actors model.ActorSlice) V2ScheduleResponse {
+	res := V2ScheduleResponse{
+		Date:    s.Date,
+		TweetID: s.TweetID,
+		Entries: []V2ScheduleEntry{},
+	}
+	for _, e := range s.Entries {
+		res.Entries = append(res.Entries, newV2ScheduleEntry(e, actors))
+	}
+
+	return res
+}
+
+func newV2ScheduleEntry(e model.ScheduleEntry, actors model.ActorSlice) V2ScheduleEntry {
+	participants := append([]string{}, e.ActorIDs...)
+
+	entry := V2ScheduleEntry{
+		StartAt:      e.StartAt,
+		Participants: participants,
+		Source:       toV2Source(e.Source),
+		Flags: V2EntryFlags{
+			Planned:    e.Planned,
+			Live:       e.IsLive,
+			MemberOnly: e.MemberOnly,
+			Collabo:    e.CollaboID > 0 || len(participants) > 1,
+		},
+		CollaboID: e.CollaboID,
+	}
+
+	if !e.OriginalStartAt.IsZero() {
+		originalStartAt := e.OriginalStartAt
+		entry.OriginalStartAt = &originalStartAt
+	}
+
+	// コラボのハッシュタグや外部のチャンネルの場合は参加者の名前以外が表示名になっている
+	entry.Label = e.ActorName
+	for _, id := range participants {
+		if a, err := actors.FindActor(id); err == nil && a.Name == e.ActorName {
+			entry.Label = ""
+			break
+		}
+	}
+
+	if e.VideoID != "" {
+		entry.Video = &V2EntryVideo{
+			ID:      e.VideoID,
+			URL:     e.URL,
+			Text:    e.Text,
+			Channel: toV2Channel(e.Channel),
+		}
+	}
+
+	return entry
+}
+
+func toV2Channel(channel string) string {
+	if channel == "" {
+		return v2ChannelUnknown
+	}
+
+	return channel
+}
+
+func toV2Source(source string) string {
+	switch source {
+	case model.VideoSourceYoutube:
+		return v2SourceYoutube
+	case model.VideoSourceBilibili:
+		return v2SourceBilibili
+	case model.VideoSourceMildom:
+		return v2SourceMildom
+	}
+
+	return v2SourceUnknown
+}
+
+func newV2CalendarResponse(calendar model.Calendar) V2CalendarResponse {
+	res := V2CalendarResponse{
+		BaseDate: calendar.BaseDate,
+		FixedDay: calendar.FixedDay,
+		Days:     []V2CalendarDay{},
+	}
+	for _, d := range calendar.Days {
+		res.Days = append(res.Days, V2CalendarDay{
+			Day:      d.Day,
+			ActorIDs: append([]string{}, d.ActorIDs...),
+		})
+	}
+
+	return res
+}
+
+func newV2ActorsResponse(actors model.ActorSlice) V2ActorsResponse {
+	res := V2ActorsResponse{
+		Actors: []V2Actor{},
+	}
+	for _, a := range actors {
+		temp := V2Actor{
+			ID:                a.ID,
+			Name:              a.Name,
+			Icon:              a.Icon,
+			Emoji:             a.Emoji,
+			HashTag:           a.Hashtag,
+			TwitterScreenName: a.TwitterScreenName,
+			YoutubeChannelID:  a.YoutubeChannelID,
+			Status:            model.ActorStatusActive,
+		}
+		if a.Status == model.ActorStatusGraduated {
+			temp.Status = model.ActorStatusGraduated
+		}
+		if !a.ActiveFrom.IsZero() {
+			activeFrom := a.ActiveFrom
+			temp.ActiveFrom = &activeFrom
+		}
+		if !a.ActiveUntil.IsZero() {
+			activeUntil := a.ActiveUntil
+			temp.ActiveUntil = &activeUntil
+		}
+		res.Actors = append(res.Actors, temp)
+	}
+
+	return res
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+)
+
+const v2APIVersion = "2.0.0"
+
+var jstTimeType = reflect.TypeOf(jst.Time{})
+
+func v2OpenAPIHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, createV2OpenAPI(v2Operations()))
+}
+
+// createV2OpenAPI APIの定義からOpenAPIのドキュメントを作成する
+// レスポンスのスキーマは型のjsonタグから作成する
+func createV2OpenAPI(ops []v2Operation) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	errorRef := createSchemaRef(reflect.TypeOf(V2ErrorResponse{}), schemas)
+
+	paths := map[string]interface{}{}
+	for _, op := range ops {
+		var params []interface{}
+		for _, p := range op.params {
+			params = append(params, map[string]interface{}{
+				"name":        p.name,
+				"in":          p.in,
+				"description": p.description,
+				"required":    p.required,
+				"schema":      map[string]interface{}{"type": "string"},
+			})
+		}
+
+		responses := map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "OK",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": createSchemaRef(reflect.TypeOf(op.response), schemas),
+					},
+				},
+			},
+		}
+		for _, status := range op.errorStatuses {
+			responses[strconv.Itoa(status)] = map[string]interface{}{
+				"description": http.StatusText(status),
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": errorRef,
+					},
+				},
+			}
+		}
+
+		operation := map[string]interface{}{
+			"summary":   op.summary,
+			"responses": responses,
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		paths[toOpenAPIPath(op.path)] = map[string]interface{}{
+			"get": operation,
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "dotlive-schedule-server",
+			"version": v2APIVersion,
+		},
+		"servers": []interface{}{
+			map[string]interface{}{"url": v2PathPrefix},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}
+}
+
+// toOpenAPIPath echoのパスをOpenAPIのパスにする
+// '/actors/:id'を'/actors/{id}'にする
+func toOpenAPIPath(path string) string {
+	xs := strings.Split(path, "/")
+	for i, x := range xs {
+		if strings.HasPrefix(x, ":") {
+			xs[i] = "{" + x[1:] + "}"
+		}
+	}
+
+	return strings.Join(xs, "/")
+}
+
+// createSchemaRef 型のスキーマを作成する
+// 構造体の場合はcomponentsに登録して参照を返す
+func createSchemaRef(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t == jstTimeType {
+		return map[string]interface{}{
+			"type":   "string",
+			"format": "date-time",
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		// 3.0では$refと同じ階層にnullableを書けないのでallOfを使う
+		return map[string]interface{}{
+			"allOf":    []interface{}{createSchemaRef(t.Elem(), schemas)},
+			"nullable": true,
+		}
+	case reflect.Slice:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": createSchemaRef(t.Elem(), schemas),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": createSchemaRef(t.Elem(), schemas),
+		}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Struct:
+		if _, ok := schemas[t.Name()]; !ok {
+			// 再帰的な型に備えて先に登録しておく
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = createStructSchema(t, schemas)
+		}
+
+		return map[string]interface{}{
+			"$ref": "#/components/schemas/" + t.Name(),
+		}
+	}
+
+	panic("unsupported type: " + t.String())
+}
+
+func createStructSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || f.PkgPath != "" {
+			continue
+		}
+
+		xs := strings.Split(tag, ",")
+		name := xs[0]
+		if name == "" {
+			name = f.Name
+		}
+
+		schema := createSchemaRef(f.Type, schemas)
+		if enum := f.Tag.Get("enum"); enum != "" {
+			var values []interface{}
+			for _, v := range strings.Split(enum, ",") {
+				values = append(values, v)
+			}
+			schema["enum"] = values
+		}
+		properties[name] = schema
+
+		omitEmpty := false
+		for _, opt := range xs[1:] {
+			if opt == "omitempty" {
+				omitEmpty = true
+			}
+		}
+		if !omitEmpty {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
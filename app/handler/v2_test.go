@@ -0,0 +1,366 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+// loadV2OpenAPI OpenAPIのドキュメントをJSONとして読み込み直す
+func loadV2OpenAPI(t *testing.T) map[string]interface{} {
+	bytes, err := json.Marshal(createV2OpenAPI(v2Operations()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]interface{}
+	err = json.Unmarshal(bytes, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+// findResponseSchema パスとステータスコードからレスポンスのスキーマを探す
+func findResponseSchema(t *testing.T, doc map[string]interface{}, path string, status int) interface{} {
+	op, ok := doc["paths"].(map[string]interface{})[path].(map[string]interface{})["get"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("operation not found: %v", path)
+	}
+
+	res, ok := op["responses"].(map[string]interface{})[fmt.Sprint(status)].(map[string]interface{})
+	if !ok {
+		t.Fatalf("response not found: %v %v", path, status)
+	}
+
+	return res["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"]
+}
+
+// validateSchema ドキュメントで使用しているJSON Schemaの機能だけで値を検証する
+func validateSchema(doc map[string]interface{}, schema interface{}, v interface{}, path string) error {
+	s := schema.(map[string]interface{})
+	if ref, ok := s["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		temp, ok := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})[name]
+		if !ok {
+			return fmt.Errorf("%v: schema not found: %v", path, ref)
+		}
+		return validateSchema(doc, temp, v, path)
+	}
+
+	if v == nil {
+		if s["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%v: null is not allowed", path)
+	}
+
+	if allOf, ok := s["allOf"].([]interface{}); ok {
+		for _, temp := range allOf {
+			if err := validateSchema(doc, temp, v, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch s["type"] {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%v: not object", path)
+		}
+
+		props, _ := s["properties"].(map[string]interface{})
+		required, _ := s["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				return fmt.Errorf("%v: required property not found: %v", path, name)
+			}
+		}
+
+		for name, value := range obj {
+			temp, ok := props[name]
+			if !ok {
+				additional, ok := s["additionalProperties"]
+				if !ok {
+					return fmt.Errorf("%v: unknown property: %v", path, name)
+				}
+				temp = additional
+			}
+
+			if err := validateSchema(doc, temp, value, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		xs, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%v: not array", path)
+		}
+
+		for i, x := range xs {
+			if err := validateSchema(doc, s["items"], x, fmt.Sprintf("%v[%v]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%v: not string", path)
+		}
+
+		if enum, ok := s["enum"].([]interface{}); ok {
+			found := false
+			for _, e := range enum {
+				if e == str {
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("%v: %v is not in enum %v", path, str, enum)
+			}
+		}
+	case "integer":
+		f, ok := v.(float64)
+		if !ok || f != float64(int64(f)) {
+			return fmt.Errorf("%v: not integer", path)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%v: not boolean", path)
+		}
+	default:
+		return fmt.Errorf("%v: unknown type: %v", path, s["type"])
+	}
+
+	return nil
+}
+
+func validateJSON(t *testing.T, doc map[string]interface{}, schema interface{}, bytes []byte) {
+	var v interface{}
+	err := json.Unmarshal(bytes, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = validateSchema(doc, schema, v, "$")
+	if err != nil {
+		t.Errorf("%v\n%v", err, string(bytes))
+	}
+}
+
+func TestV2OpenAPIRoutes(t *testing.T) {
+	doc := loadV2OpenAPI(t)
+	paths := doc["paths"].(map[string]interface{})
+
+	e := echo.New()
+	RouteV2(e)
+
+	routed := map[string]bool{}
+	for _, r := range e.Routes() {
+		if r.Method != http.MethodGet || !strings.HasPrefix(r.Path, v2PathPrefix) {
+			continue
+		}
+
+		path := strings.TrimPrefix(r.Path, v2PathPrefix)
+		// グループのミドルウェアのためにechoが登録するルートも除く
+		if path == "" || path == "/openapi.json" || path == "/*" {
+			continue
+		}
+
+		routed[toOpenAPIPath(path)] = true
+		if _, ok := paths[toOpenAPIPath(path)]; !ok {
+			t.Errorf("route is not documented: %v", r.Path)
+		}
+	}
+
+	for path := range paths {
+		if !routed[path] {
+			t.Errorf("documented path is not routed: %v", path)
+		}
+	}
+
+	// 全ての参照が解決できる
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	var checkRefs func(v interface{})
+	checkRefs = func(v interface{}) {
+		switch temp := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := temp["$ref"].(string); ok {
+				if _, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+					t.Errorf("schema not found: %v", ref)
+				}
+			}
+			for _, x := range temp {
+				checkRefs(x)
+			}
+		case []interface{}:
+			for _, x := range temp {
+				checkRefs(x)
+			}
+		}
+	}
+	checkRefs(doc)
+}
+
+func TestV2OpenAPIHandler(t *testing.T) {
+	e := echo.New()
+	RouteV2(e)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status, got: %v expect: %v", rec.Code, http.StatusOK)
+	}
+
+	var doc map[string]interface{}
+	err := json.Unmarshal(rec.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc["openapi"] != "3.0.3" {
+		t.Errorf("openapi, got: %v", doc["openapi"])
+	}
+}
+
+func TestV2ErrorResponse(t *testing.T) {
+	doc := loadV2OpenAPI(t)
+
+	e := echo.New()
+	RouteV2(e)
+
+	// Firestoreにアクセスする前にエラーになるリクエストだけを対象にする
+	tests := []struct {
+		url    string
+		path   string
+		status int
+		code   string
+	}{
+		{"/api/v2/schedule?tz=Invalid/Zone", "/schedule", http.StatusBadRequest, v2ErrorCodeBadRequest},
+		{"/api/v2/schedule?date=2020-4", "/schedule", http.StatusBadRequest, v2ErrorCodeBadRequest},
+		{"/api/v2/calendar?month=2020-13", "/calendar", http.StatusBadRequest, v2ErrorCodeBadRequest},
+		{"/api/v2/actors/xxx/upcoming?tz=Invalid/Zone", "/actors/{id}/upcoming", http.StatusBadRequest, v2ErrorCodeBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status, got: %v expect: %v", rec.Code, tt.status)
+			}
+
+			validateJSON(t, doc, findResponseSchema(t, doc, tt.path, tt.status), rec.Body.Bytes())
+
+			var res V2ErrorResponse
+			json.Unmarshal(rec.Body.Bytes(), &res)
+			if res.Error.Code != tt.code {
+				t.Errorf("code, got: %v expect: %v", res.Error.Code, tt.code)
+			}
+			if res.Error.RequestID == "" || res.Error.RequestID != rec.Header().Get(echo.HeaderXRequestID) {
+				t.Errorf("requestId, got: %v header: %v", res.Error.RequestID, rec.Header().Get(echo.HeaderXRequestID))
+			}
+		})
+	}
+
+	// 存在しないAPI
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/unknown", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status, got: %v expect: %v", rec.Code, http.StatusNotFound)
+	}
+	validateJSON(t, doc, findResponseSchema(t, doc, "/actors/{id}/upcoming", http.StatusNotFound), rec.Body.Bytes())
+}
+
+func TestV2Responses(t *testing.T) {
+	doc := loadV2OpenAPI(t)
+
+	s := model.Schedule{
+		Date:    jst.ShortDate(2020, 4, 29),
+		TweetID: "1",
+		Entries: []model.ScheduleEntry{
+			{
+				ActorName: Iori.Name,
+				StartAt:   jst.Date(2020, 4, 29, 20, 0),
+				VideoID:   "iosu",
+				URL:       "https://www.youtube.com/watch?v=iosu",
+				Source:    model.VideoSourceYoutube,
+				Planned:   true,
+				IsLive:    true,
+				CollaboID: 1,
+				ActorIDs:  []string{Iori.ID, Suzu.ID},
+			},
+			{
+				ActorName:  "#どっとライブ",
+				StartAt:    jst.Date(2020, 4, 29, 22, 0),
+				Source:     model.VideoSourceMildom,
+				Planned:    true,
+				MemberOnly: true,
+			},
+			{
+				ActorName:       "外部チャンネル",
+				StartAt:         jst.Date(2020, 4, 29, 23, 0),
+				OriginalStartAt: jst.Date(2020, 4, 29, 22, 0),
+				VideoID:         "external",
+				Source:          "Unknown",
+				ActorIDs:        []string{Pino.ID},
+			},
+		},
+	}
+
+	res := newV2ScheduleResponse(s, All)
+	bytes, _ := json.Marshal(res)
+	validateJSON(t, doc, findResponseSchema(t, doc, "/schedule", http.StatusOK), bytes)
+
+	expect := []struct {
+		participants int
+		label        string
+		source       string
+		hasVideo     bool
+		collabo      bool
+		rescheduled  bool
+	}{
+		{2, "", v2SourceYoutube, true, true, false},
+		{0, "#どっとライブ", v2SourceMildom, false, false, false},
+		{1, "外部チャンネル", v2SourceUnknown, true, false, true},
+	}
+	for i, ex := range expect {
+		e := res.Entries[i]
+		if len(e.Participants) != ex.participants || e.Label != ex.label || e.Source != ex.source || (e.Video != nil) != ex.hasVideo || e.Flags.Collabo != ex.collabo || (e.OriginalStartAt != nil) != ex.rescheduled {
+			t.Errorf("entries[%v], got: %+v", i, e)
+		}
+	}
+
+	bytes, _ = json.Marshal(newV2CalendarResponse(model.Calendar{
+		BaseDate: jst.ShortDate(2020, 4, 1),
+		Days: model.CalendarDaySlice{
+			{Day: 1, ActorIDs: []string{Iori.ID}},
+		},
+		FixedDay: 1,
+	}))
+	validateJSON(t, doc, findResponseSchema(t, doc, "/calendar", http.StatusOK), bytes)
+
+	bytes, _ = json.Marshal(newV2ActorsResponse(All))
+	validateJSON(t, doc, findResponseSchema(t, doc, "/actors", http.StatusOK), bytes)
+
+	bytes, _ = json.Marshal(V2UpcomingResponse{
+		Entries: res.Entries,
+	})
+	validateJSON(t, doc, findResponseSchema(t, doc, "/actors/{id}/upcoming", http.StatusOK), bytes)
+}
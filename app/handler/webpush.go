@@ -0,0 +1,326 @@
+package handler
+
+import (
+	"crypto/elliptic"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/dotlive-schedule-server/app/cache"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+const (
+	// webPushRateLimitWindow 購読の数を制限する期間
+	webPushRateLimitWindow = time.Hour
+	// webPushRateLimitPerClient 期間内に1つのIPアドレスから購読できる数
+	webPushRateLimitPerClient = 10
+	// webPushRateLimitTotal 期間内に全体で購読できる数
+	// IPアドレスを偽装された場合でも購読が際限なく増えないようにする
+	webPushRateLimitTotal = 1000
+)
+
+// webPushServiceHosts 購読できるプッシュサービスのホスト
+// 任意のURLに送信させないように主要なブラウザのプッシュサービスだけを許可する
+var webPushServiceHosts = []string{
+	// Chrome
+	"fcm.googleapis.com",
+	// Firefox
+	"updates.push.services.mozilla.com",
+	// Safari
+	"web.push.apple.com",
+}
+
+// webPushServiceHostSuffixes 購読できるプッシュサービスのホストの接尾辞
+var webPushServiceHostSuffixes = []string{
+	// Edge(wns2-xxx.notify.windows.comのようにホストが複数ある)
+	".notify.windows.com",
+}
+
+// webPushLimiter 購読の数の制限
+// インスタンスごとに数えるので厳密な制限ではない
+var webPushLimiter = newRateLimiter(webPushRateLimitWindow, webPushRateLimitPerClient, webPushRateLimitTotal)
+
+// rateLimiter 一定期間内のリクエストの数を制限する
+// 期間が過ぎたら全ての数をリセットするのでメモリが増え続けることはない
+type rateLimiter struct {
+	mu        sync.Mutex
+	window    time.Duration
+	perClient int
+	total     int
+
+	start  time.Time
+	counts map[string]int
+	count  int
+}
+
+func newRateLimiter(window time.Duration, perClient, total int) *rateLimiter {
+	return &rateLimiter{
+		window:    window,
+		perClient: perClient,
+		total:     total,
+		counts:    map[string]int{},
+	}
+}
+
+// allow リクエストを許可するかどうか
+// 許可する場合はリクエストを数える
+func (l *rateLimiter) allow(client string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.start) >= l.window {
+		l.start = now
+		l.counts = map[string]int{}
+		l.count = 0
+	}
+
+	if l.count >= l.total || l.counts[client] >= l.perClient {
+		return false
+	}
+
+	l.count++
+	l.counts[client]++
+	return true
+}
+
+// isWebPushServiceHost 購読できるプッシュサービスのホストかどうか
+func isWebPushServiceHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range webPushServiceHosts {
+		if host == h {
+			return true
+		}
+	}
+
+	for _, suffix := range webPushServiceHostSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RouteWebPush ブラウザのプッシュ通知関連のルーティングを設定する
+func RouteWebPush(e *echo.Echo) {
+	e.GET("/api/webpush", webPushHandler)
+	e.POST("/api/webpush/subscriptions", webPushSubscribeHandler)
+	e.DELETE("/api/webpush/subscriptions", webPushUnsubscribeHandler)
+}
+
+// WebPushInfo ブラウザのプッシュ通知の購読に必要な情報
+type WebPushInfo struct {
+	// PublicKey VAPIDの公開鍵
+	// PushManager.subscribeのapplicationServerKeyに指定する
+	PublicKey string `json:"publicKey"`
+	// Actors 購読できる配信者
+	Actors []WebPushActor `json:"actors"`
+	// Topics 購読できるトピック
+	Topics []model.Topic `json:"topics"`
+}
+
+// WebPushActor 購読できる配信者
+type WebPushActor struct {
+	// ID 配信者ID
+	ID string `json:"id"`
+	// Name 名前
+	Name string `json:"name"`
+}
+
+// WebPushSubscriptionRequest ブラウザのプッシュ通知の購読のリクエスト
+type WebPushSubscriptionRequest struct {
+	// Subscription PushSubscription.toJSON()の値
+	Subscription struct {
+		Endpoint string `json:"endpoint"`
+		Keys     struct {
+			P256dh string `json:"p256dh"`
+			Auth   string `json:"auth"`
+		} `json:"keys"`
+	} `json:"subscription"`
+	// Actors 配信の通知を受け取る配信者ID
+	Actors []string `json:"actors"`
+	// Topics 購読するトピック
+	Topics []string `json:"topics"`
+}
+
+// validate 購読の形式が正しいかどうか
+// エンドポイントは既知のプッシュサービスだけ、配信者とトピックは購読できるものだけ指定できる
+func (r WebPushSubscriptionRequest) validate(info WebPushInfo) bool {
+	u, err := url.Parse(r.Subscription.Endpoint)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" || !isWebPushServiceHost(u.Hostname()) {
+		return false
+	}
+
+	p256dh, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(r.Subscription.Keys.P256dh, "="))
+	if err != nil {
+		return false
+	}
+	if x, _ := elliptic.Unmarshal(elliptic.P256(), p256dh); x == nil {
+		return false
+	}
+
+	auth, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(r.Subscription.Keys.Auth, "="))
+	if err != nil || len(auth) != 16 {
+		return false
+	}
+
+	if len(r.Actors) == 0 && len(r.Topics) == 0 {
+		return false
+	}
+
+OUTER_ACTOR:
+	for _, id := range r.Actors {
+		for _, a := range info.Actors {
+			if a.ID == id {
+				continue OUTER_ACTOR
+			}
+		}
+		return false
+	}
+
+OUTER_TOPIC:
+	for _, name := range r.Topics {
+		for _, t := range info.Topics {
+			if t.Name == name {
+				continue OUTER_TOPIC
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// newWebPushInfo 購読できる配信者とトピックを作成する
+// 配信者ごとのトピックの代わりに配信者IDで購読する
+func newWebPushInfo(key model.VAPIDKey, actors model.ActorSlice, groups model.GroupSlice) WebPushInfo {
+	info := WebPushInfo{
+		PublicKey: key.PublicKey,
+		Actors:    []WebPushActor{},
+		Topics: []model.Topic{
+			{
+				Name:        "plan",
+				DisplayName: "計画",
+			},
+		},
+	}
+
+	// 卒業した配信者の配信は通知されないので購読できないようにする
+	for _, a := range actors.FilterActive(jst.Now()) {
+		info.Actors = append(info.Actors, WebPushActor{
+			ID:   a.ID,
+			Name: a.Name,
+		})
+	}
+
+	for _, g := range groups {
+		info.Topics = append(info.Topics, model.Topic{
+			Name:        g.Topic(),
+			DisplayName: g.Name,
+		})
+	}
+
+	return info
+}
+
+// findWebPushInfo 購読に必要な情報を取得する
+func findWebPushInfo(c echo.Context) (WebPushInfo, error) {
+	ctx := c.Request().Context()
+	client := store.GetClient()
+
+	key, err := cache.FindVAPIDKeyWithCache(ctx, client)
+	if err != nil {
+		return WebPushInfo{}, err
+	}
+
+	actors, err := cache.FindActorsWithCache(ctx, client)
+	if err != nil {
+		return WebPushInfo{}, err
+	}
+
+	groups, err := cache.FindGroupsWithCache(ctx, client)
+	if err != nil {
+		return WebPushInfo{}, err
+	}
+
+	return newWebPushInfo(key, actors, groups), nil
+}
+
+func webPushHandler(c echo.Context) error {
+	info, err := findWebPushInfo(c)
+	if err != nil {
+		log.Printf("can not get web push info: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	return c.JSON(http.StatusOK, info)
+}
+
+func webPushSubscribeHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req WebPushSubscriptionRequest
+	err := c.Bind(&req)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	info, err := findWebPushInfo(c)
+	if err != nil {
+		log.Printf("can not get web push info: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	if !req.validate(info) {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	if !webPushLimiter.allow(c.RealIP(), time.Now()) {
+		return c.String(http.StatusTooManyRequests, "too many requests")
+	}
+
+	// 同じブラウザから再度購読した場合は購読する配信者とトピックを置き換える
+	err = store.SaveWebPushSubscription(ctx, store.GetClient(), model.WebPushSubscription{
+		ID:        model.WebPushSubscriptionID(req.Subscription.Endpoint),
+		Endpoint:  req.Subscription.Endpoint,
+		P256dh:    req.Subscription.Keys.P256dh,
+		Auth:      req.Subscription.Keys.Auth,
+		Actors:    req.Actors,
+		Topics:    req.Topics,
+		CreatedAt: jst.Now(),
+	})
+	if err != nil {
+		log.Printf("can not save web push subscription: %v", err)
+		return c.String(http.StatusInternalServerError, "error3")
+	}
+
+	return c.NoContent(http.StatusCreated)
+}
+
+func webPushUnsubscribeHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req struct {
+		Endpoint string `json:"endpoint"`
+	}
+	err := c.Bind(&req)
+	if err != nil || req.Endpoint == "" {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	err = store.DeleteWebPushSubscription(ctx, store.GetClient(), model.WebPushSubscriptionID(req.Endpoint))
+	if err != nil {
+		log.Printf("can not delete web push subscription: %v", err)
+		return c.String(http.StatusInternalServerError, "error2")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestWebPushSubscriptionRequestValidate(t *testing.T) {
+	priv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p256dh := base64.RawURLEncoding.EncodeToString(elliptic.Marshal(elliptic.P256(), priv.X, priv.Y))
+	auth := base64.RawURLEncoding.EncodeToString(make([]byte, 16))
+
+	info := newWebPushInfo(model.VAPIDKey{}, model.ActorSlice{{ID: "siro", Name: "電脳少女シロ"}}, model.GroupSlice{{ID: "idol", Name: "アイドル部"}})
+
+	var valid WebPushSubscriptionRequest
+	valid.Subscription.Endpoint = "https://fcm.googleapis.com/fcm/send/abc"
+	valid.Subscription.Keys.P256dh = p256dh
+	valid.Subscription.Keys.Auth = auth
+	valid.Topics = []string{"plan"}
+	if !valid.validate(info) {
+		t.Fatalf("must be valid: %+v", valid)
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(r *WebPushSubscriptionRequest)
+		expected bool
+	}{
+		{"actor and group", func(r *WebPushSubscriptionRequest) {
+			r.Actors = []string{"siro"}
+			r.Topics = []string{model.GroupTopicName("idol")}
+		}, true},
+		// ブラウザによってはパディングが付いている
+		{"padded auth", func(r *WebPushSubscriptionRequest) { r.Subscription.Keys.Auth = auth + "==" }, true},
+		{"http", func(r *WebPushSubscriptionRequest) {
+			r.Subscription.Endpoint = "http://fcm.googleapis.com/fcm/send/abc"
+		}, false},
+		{"edge", func(r *WebPushSubscriptionRequest) {
+			r.Subscription.Endpoint = "https://wns2-pn1p.notify.windows.com/w/?token=abc"
+		}, true},
+		{"unknown host", func(r *WebPushSubscriptionRequest) {
+			r.Subscription.Endpoint = "https://example.com/fcm/send/abc"
+		}, false},
+		{"host suffix", func(r *WebPushSubscriptionRequest) {
+			r.Subscription.Endpoint = "https://fcm.googleapis.com.example.com/fcm/send/abc"
+		}, false},
+		{"port", func(r *WebPushSubscriptionRequest) {
+			r.Subscription.Endpoint = "https://fcm.googleapis.com:8080/fcm/send/abc"
+		}, false},
+		{"invalid p256dh", func(r *WebPushSubscriptionRequest) { r.Subscription.Keys.P256dh = auth }, false},
+		{"invalid auth", func(r *WebPushSubscriptionRequest) { r.Subscription.Keys.Auth = p256dh }, false},
+		{"nothing", func(r *WebPushSubscriptionRequest) { r.Topics = nil }, false},
+		{"unknown actor", func(r *WebPushSubscriptionRequest) { r.Actors = []string{"iori"} }, false},
+		// 配信者のトピックは配信者IDで購読する
+		{"actor topic", func(r *WebPushSubscriptionRequest) { r.Topics = []string{"SIROyoutuber"} }, false},
+	}
+
+	for _, tt := range tests {
+		r := valid
+		tt.modify(&r)
+		if r.validate(info) != tt.expected {
+			t.Errorf("%v, got: %v expect: %v", tt.name, !tt.expected, tt.expected)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(time.Hour, 2, 3)
+	now := time.Date(2020, 4, 29, 20, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		client   string
+		now      time.Time
+		expected bool
+	}{
+		{"a", now, true},
+		{"a", now, true},
+		// 1つのクライアントの上限
+		{"a", now, false},
+		{"b", now, true},
+		// 全体の上限
+		{"c", now, false},
+		// 期間が過ぎたらリセットされる
+		{"a", now.Add(time.Hour), true},
+	}
+
+	for i, tt := range tests {
+		if l.allow(tt.client, tt.now) != tt.expected {
+			t.Errorf("%v: %v, got: %v expect: %v", i, tt.client, !tt.expected, tt.expected)
+		}
+	}
+}
@@ -5,6 +5,23 @@ import "os"
 // IsDevelop 開発環境かどうか
 var IsDevelop bool
 
+// AdminToken 管理用APIのトークン
+// 空文字の場合は管理用APIを使用できない
+var AdminToken string
+
+// DiscordWebhooks 通知を送信するDiscordのWebhookの設定(JSON)
+// 空文字の場合はDiscordに通知しない
+var DiscordWebhooks string
+
+// WebPushSubject ブラウザのプッシュ通知でプッシュサービスに伝える連絡先(mailto:かhttps:のURL)
+var WebPushSubject string
+
 func init() {
 	IsDevelop = os.Getenv("DEVELOP") == "true"
+	AdminToken = os.Getenv("ADMIN_TOKEN")
+	DiscordWebhooks = os.Getenv("DISCORD_WEBHOOKS")
+	WebPushSubject = os.Getenv("WEBPUSH_SUBJECT")
+	if WebPushSubject == "" {
+		WebPushSubject = "https://dotlive-schedule.appspot.com/"
+	}
 }
@@ -10,6 +10,16 @@ func Route(e *echo.Echo) {
 	handler.RouteJob(e)
 	handler.RouteSchedule(e)
 	handler.RouteTopic(e)
+	handler.RouteWebPush(e)
 	handler.RouteCalendar(e)
 	handler.RouteWidget(e)
+	handler.RouteActor(e)
+	handler.RouteStats(e)
+	handler.RouteReport(e)
+	handler.RouteCollabo(e)
+	handler.RouteSearch(e)
+	handler.RouteV2(e)
+	handler.RouteStream(e)
+	handler.RouteChanges(e)
+	handler.RouteAdmin(e)
 }
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// videoCursorMargin 同じ開始時刻の動画がカーソルをまたぐ場合に備えて余分に取得する数
+// コラボの場合は同じ時刻に複数のチャンネルの動画が存在するがこれ以上になることはまずない
+const videoCursorMargin = 10
+
+// upcomingDayLimit 予定を探す最大日数
+const upcomingDayLimit = 30
+
+// VideoCursor 動画一覧のページングに使用するカーソル
+// 開始時刻の降順、同じ開始時刻の場合は動画IDの降順に並べたときの最後の動画を指す
+type VideoCursor struct {
+	// StartAt 最後の動画の開始時刻
+	StartAt jst.Time
+	// VideoID 最後の動画のID
+	VideoID string
+}
+
+// ActorVideoPage 配信者の動画一覧の1ページ
+type ActorVideoPage struct {
+	// Videos 動画
+	Videos []model.Video
+	// Next 次のページのカーソル
+	// 次のページが存在しない場合はnil
+	Next *VideoCursor
+}
+
+// FindActorVideos 配信者の過去の動画をカーソルを使用して取得する
+// cursorがnilの場合は最新の動画から取得する
+func FindActorVideos(ctx context.Context, c *firestore.Client, actor model.Actor, since jst.Time, cursor *VideoCursor, limit int) (ActorVideoPage, error) {
+	r := jst.Range{
+		Begin: since,
+		End:   jst.Now(),
+	}
+	if cursor != nil {
+		r.End = cursor.StartAt
+	}
+
+	videos, err := store.FindVideosByActor(ctx, c, actor.ID, r, limit+videoCursorMargin+1)
+	if err != nil && err != common.ErrNotFound {
+		return ActorVideoPage{}, err
+	}
+
+	return createActorVideoPage(videos, cursor, limit), nil
+}
+
+func createActorVideoPage(videos []model.Video, cursor *VideoCursor, limit int) ActorVideoPage {
+	var filtered []model.Video
+	for _, v := range videos {
+		if cursor != nil && !isVideoAfterCursor(v, *cursor) {
+			continue
+		}
+
+		filtered = append(filtered, v)
+	}
+
+	sortVideosForCursor(filtered)
+
+	page := ActorVideoPage{
+		Videos: []model.Video{},
+	}
+	if len(filtered) > limit {
+		filtered = filtered[:limit]
+		last := filtered[limit-1]
+		page.Next = &VideoCursor{
+			StartAt: last.StartAt,
+			VideoID: last.ID,
+		}
+	}
+	page.Videos = append(page.Videos, filtered...)
+
+	return page
+}
+
+// isVideoAfterCursor 動画がカーソルより後ろに並ぶかどうか
+func isVideoAfterCursor(v model.Video, cursor VideoCursor) bool {
+	if v.StartAt.Equal(cursor.StartAt) {
+		return strings.Compare(v.ID, cursor.VideoID) < 0
+	}
+
+	return v.StartAt.Before(cursor.StartAt)
+}
+
+// sortVideosForCursor カーソルと同じ順番(開始時刻の降順、同じ場合は動画IDの降順)に並べる
+func sortVideosForCursor(videos []model.Video) {
+	sort.Slice(videos, func(i, j int) bool {
+		l := videos[i]
+		r := videos[j]
+		if l.StartAt.Equal(r.StartAt) {
+			return strings.Compare(l.ID, r.ID) > 0
+		}
+
+		return l.StartAt.After(r.StartAt)
+	})
+}
+
+// CreateUpcomingSchedule 配信者のこれからの配信予定を作成する
+// 計画のエントリとまだ開始していない動画が対象になる
+func CreateUpcomingSchedule(ctx context.Context, c *firestore.Client, actor model.Actor, now jst.Time, actors model.ActorSlice, org model.Organization) ([]model.ScheduleEntry, error) {
+	today := now.FloorToDay()
+	r := jst.Range{
+		Begin: today.AddDay(-1),
+		End:   today.AddDay(upcomingDayLimit + 1).Add(time.Hour * 12),
+	}
+
+	plans, err := store.FindPlans(ctx, c, r)
+	if err != nil && err != common.ErrNotFound {
+		return nil, err
+	}
+
+	videos, err := store.FindVideos(ctx, c, r)
+	if err != nil && err != common.ErrNotFound {
+		return nil, err
+	}
+
+	return createUpcomingScheduleInternal(actor, now, plans, videos, actors, org), nil
+}
+
+func createUpcomingScheduleInternal(actor model.Actor, now jst.Time, plans []model.Plan, videos []model.Video, actors model.ActorSlice, org model.Organization) []model.ScheduleEntry {
+	today := now.FloorToDay()
+
+	// 計画か動画が存在する最後の日までを対象にする
+	lastDay := today
+	for _, p := range plans {
+		if p.Date.After(lastDay) {
+			lastDay = p.Date
+		}
+	}
+	for _, v := range videos {
+		if v.StartAt.After(lastDay) {
+			lastDay = v.StartAt.FloorToDay()
+		}
+	}
+	limitDay := today.AddDay(upcomingDayLimit)
+	if lastDay.After(limitDay) {
+		lastDay = limitDay
+	}
+
+	videoMap := map[string]model.Video{}
+	for _, v := range videos {
+		videoMap[v.ID] = v
+	}
+
+	entries := []model.ScheduleEntry{}
+	for d := today; !d.After(lastDay); d = d.AddOneDay() {
+		s := createScheduleInternal(d, plans, videos, actors, org)
+
+	OUTER:
+		for _, e := range s.Entries {
+			if !e.StartAt.After(now) {
+				continue
+			}
+
+			if !isActorScheduleEntry(e, actor, videoMap, actors) {
+				continue
+			}
+
+			// コラボの場合は同じ動画のエントリが複数存在する
+			if e.VideoID != "" {
+				for _, added := range entries {
+					if added.VideoID == e.VideoID {
+						continue OUTER
+					}
+				}
+			}
+
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// isActorScheduleEntry スケジュールのエントリが配信者に関連するものかどうか
+func isActorScheduleEntry(e model.ScheduleEntry, actor model.Actor, videoMap map[string]model.Video, actors model.ActorSlice) bool {
+	// コラボの場合は他の配信者の動画でエントリが上書きされているので名前でも判定する
+	if e.ActorName == actor.Name {
+		return true
+	}
+
+	for _, a := range findActorsByScheduleEntry(e, videoMap, actors) {
+		if a.ID == actor.ID {
+			return true
+		}
+	}
+
+	return false
+}
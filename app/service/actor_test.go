@@ -0,0 +1,89 @@
+package service
+
+import (
+	"testing"
+
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/plan"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestCreateActorVideoPage(t *testing.T) {
+	videos := []model.Video{
+		{ID: "a", StartAt: jst.Date(2020, 4, 19, 20, 0)},
+		{ID: "b", StartAt: jst.Date(2020, 4, 19, 20, 0)},
+		{ID: "c", StartAt: jst.Date(2020, 4, 19, 20, 0)},
+		{ID: "d", StartAt: jst.Date(2020, 4, 20, 20, 0)},
+		{ID: "e", StartAt: jst.Date(2020, 4, 18, 20, 0)},
+	}
+
+	var got []string
+	var cursor *VideoCursor
+	for i := 0; i < 10; i++ {
+		page := createActorVideoPage(videos, cursor, 2)
+		for _, v := range page.Videos {
+			got = append(got, v.ID)
+		}
+
+		if page.Next == nil {
+			break
+		}
+		cursor = page.Next
+	}
+
+	expect := []string{"d", "c", "b", "a", "e"}
+	if len(got) != len(expect) {
+		t.Fatalf("len(videos), got: %v expect: %v", got, expect)
+	}
+
+	for i, id := range expect {
+		if got[i] != id {
+			t.Errorf("videos[%v], got: %v expect: %v", i, got[i], id)
+		}
+	}
+}
+
+func TestCreateUpcomingScheduleInternal(t *testing.T) {
+	d := jst.ShortDate(2020, 4, 29)
+	plans := []model.Plan{
+		CreatePlan(d, []EntryPart{
+			CreateEntryPart(Suzu, 12, 0),
+			CreateEntryPartCollabo(Iori, 20, 0, 1),
+			CreateEntryPartCollabo(Suzu, 20, 0, 1),
+			CreateEntryPart(Pino, 22, 0),
+		}),
+	}
+	videos := []model.Video{
+		{
+			ID:      "suzu-past",
+			ActorID: Suzu.ID,
+			Source:  model.VideoSourceYoutube,
+			StartAt: jst.Date(2020, 4, 29, 12, 0),
+		},
+		{
+			ID:      "collabo",
+			ActorID: Iori.ID,
+			Source:  model.VideoSourceYoutube,
+			StartAt: jst.Date(2020, 4, 29, 20, 0),
+		},
+		{
+			ID:      "suzu-waiting-room",
+			ActorID: Suzu.ID,
+			Source:  model.VideoSourceYoutube,
+			StartAt: jst.Date(2020, 5, 2, 21, 0),
+		},
+	}
+
+	entries := createUpcomingScheduleInternal(Suzu, jst.Date(2020, 4, 29, 15, 0), plans, videos, All, Organization)
+	expect := []string{"collabo", "suzu-waiting-room"}
+	if len(entries) != len(expect) {
+		t.Fatalf("len(entries), got: %v expect: %v", len(entries), len(expect))
+	}
+
+	for i, id := range expect {
+		if entries[i].VideoID != id {
+			t.Errorf("entries[%v], got: %v expect: %v", i, entries[i].VideoID, id)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// onTimeMargin 計画通りとみなす開始時刻のずれ
+const onTimeMargin = 1 * time.Minute
+
+// adherenceBucket 遅れの分布の区間
+type adherenceBucket struct {
+	label string
+	// upper この値未満の遅れが区間に含まれる
+	upper time.Duration
+}
+
+var adherenceBuckets = []adherenceBucket{
+	{"-10分以上前", -10 * time.Minute},
+	{"-10分~-5分", -5 * time.Minute},
+	{"-5分~-1分", -onTimeMargin},
+	{"±1分", onTimeMargin + time.Second},
+	{"1分~5分", 5 * time.Minute},
+	{"5分~10分", 10 * time.Minute},
+	{"10分~30分", 30 * time.Minute},
+	{"30分以上", math.MaxInt64},
+}
+
+// RecordPlanAdherences 直近の計画のエントリと実際の配信の開始時刻のずれを記録する
+func RecordPlanAdherences(ctx context.Context, c *firestore.Client, now jst.Time) {
+	r := jst.Range{
+		Begin: now.AddDay(-2).FloorToDay(),
+		End:   now,
+	}
+
+	plans, err := store.FindPlans(ctx, c, r)
+	if err != nil {
+		if err != common.ErrNotFound {
+			log.Printf("Can not get plans: %v", err)
+		}
+		return
+	}
+
+	videos, err := store.FindVideos(ctx, c, jst.Range{
+		Begin: r.Begin.AddDay(-1),
+		End:   now,
+	})
+	if err != nil {
+		log.Printf("Can not get videos: %v", err)
+		return
+	}
+
+	adherences := createPlanAdherences(plans, videos)
+	if len(adherences) == 0 {
+		return
+	}
+
+	// 25時などのエントリもあるので作成したずれの計画の開始時刻の範囲で取得する
+	saved := jst.Range{
+		Begin: adherences[0].PlannedStartAt,
+		End:   adherences[0].PlannedStartAt,
+	}
+	for _, a := range adherences {
+		if a.PlannedStartAt.Before(saved.Begin) {
+			saved.Begin = a.PlannedStartAt
+		}
+		if a.PlannedStartAt.After(saved.End) {
+			saved.End = a.PlannedStartAt
+		}
+	}
+
+	existing, err := store.FindPlanAdherences(ctx, c, saved)
+	if err != nil {
+		log.Printf("Can not get plan adherences: %v", err)
+		return
+	}
+
+	for _, a := range filterChangedPlanAdherences(adherences, existing) {
+		err := store.SavePlanAdherence(ctx, c, a)
+		if err != nil {
+			log.Printf("Can not save plan adherence %v %v: %v", a.ActorID, a.PlannedStartAt, err)
+		}
+	}
+}
+
+// filterChangedPlanAdherences 保存されていないずれと動画か実際の開始時刻が変わったずれだけを返す
+// 定期実行ジョブで毎回全て書き込まないようにするため
+func filterChangedPlanAdherences(adherences, existing []model.PlanAdherence) []model.PlanAdherence {
+	var result []model.PlanAdherence
+	for _, a := range adherences {
+		changed := true
+		for _, old := range existing {
+			if old.ActorID != a.ActorID || old.HashTag != a.HashTag || old.Source != a.Source || !old.PlannedStartAt.Equal(a.PlannedStartAt) {
+				continue
+			}
+
+			changed = old.VideoID != a.VideoID || !old.ActualStartAt.Equal(a.ActualStartAt)
+			break
+		}
+
+		if changed {
+			result = append(result, a)
+		}
+	}
+
+	return result
+}
+
+// createPlanAdherences 計画のエントリにマッチした動画から開始時刻のずれを作成する
+// 実際の開始時刻が分かる動画のみが対象
+func createPlanAdherences(plans []model.Plan, videos []model.Video) []model.PlanAdherence {
+	var result []model.PlanAdherence
+	for _, p := range plans {
+		matched := map[int]model.Video{}
+		for _, v := range videos {
+			if v.ActualStartAt.IsZero() {
+				continue
+			}
+
+			index := p.GetEntryIndex(v)
+			if index < 0 {
+				continue
+			}
+
+			// 複数の動画がマッチした場合は早く始まった方を使う
+			if old, ok := matched[index]; ok && old.ActualStartAt.Before(v.ActualStartAt) {
+				continue
+			}
+			matched[index] = v
+		}
+
+		for i, e := range p.Entries {
+			v, ok := matched[i]
+			if !ok {
+				continue
+			}
+
+			result = append(result, model.PlanAdherence{
+				PlanDate:       p.Date,
+				ActorID:        e.ActorID,
+				HashTag:        e.HashTag,
+				Source:         e.Source,
+				PlannedStartAt: e.StartAt,
+				VideoID:        v.ID,
+				ActualStartAt:  v.ActualStartAt,
+				Delay:          int64(v.ActualStartAt.Time().Sub(e.StartAt.Time()) / time.Second),
+			})
+		}
+	}
+
+	return result
+}
+
+// CreateAdherenceReport 計画と実際の配信のずれのレポートを作成する
+func CreateAdherenceReport(ctx context.Context, c *firestore.Client, r jst.Range, now jst.Time, actors model.ActorSlice) (model.AdherenceReport, error) {
+	adherences, err := store.FindPlanAdherences(ctx, c, r)
+	if err != nil {
+		return model.AdherenceReport{}, err
+	}
+
+	// スケジュールを作成するためには前日の情報、翌日の12時までの情報が必要
+	dataRange := jst.Range{
+		Begin: r.Begin.FloorToDay().AddDay(-1),
+		End:   r.End.FloorToDay().AddOneDay().Add(time.Hour * 12),
+	}
+
+	plans, err := store.FindPlans(ctx, c, dataRange)
+	if err != nil && err != common.ErrNotFound {
+		return model.AdherenceReport{}, err
+	}
+
+	videos, err := store.FindVideos(ctx, c, dataRange)
+	if err != nil && err != common.ErrNotFound {
+		return model.AdherenceReport{}, err
+	}
+
+	return createAdherenceReportInternal(r, now, adherences, plans, videos, actors), nil
+}
+
+func createAdherenceReportInternal(r jst.Range, now jst.Time, adherences []model.PlanAdherence, plans []model.Plan, videos []model.Video, actors model.ActorSlice) model.AdherenceReport {
+	report := model.AdherenceReport{
+		Begin:         r.Begin,
+		End:           r.End,
+		Actors:        []model.ActorAdherence{},
+		MissedEntries: []model.MissedPlanEntry{},
+	}
+
+	delays := map[string][]time.Duration{}
+	for _, a := range adherences {
+		// コラボハッシュタグのエントリは配信者が分からないので対象外
+		if a.ActorID == model.ActorIDUnknown {
+			continue
+		}
+
+		delays[a.ActorID] = append(delays[a.ActorID], time.Duration(a.Delay)*time.Second)
+	}
+
+	for _, actor := range actors {
+		ds, ok := delays[actor.ID]
+		if !ok {
+			continue
+		}
+
+		aa := model.ActorAdherence{
+			ActorID: actor.ID,
+			Count:   len(ds),
+		}
+		for _, b := range adherenceBuckets {
+			aa.Distribution = append(aa.Distribution, model.AdherenceBucket{
+				Label: b.label,
+			})
+		}
+
+		var total time.Duration
+		for i, d := range ds {
+			total += d
+			sec := int64(d / time.Second)
+			if i == 0 || sec < aa.MinDelay {
+				aa.MinDelay = sec
+			}
+			if i == 0 || sec > aa.MaxDelay {
+				aa.MaxDelay = sec
+			}
+
+			if d < -onTimeMargin {
+				aa.EarlyCount++
+			} else if d > onTimeMargin {
+				aa.LateCount++
+			} else {
+				aa.OnTimeCount++
+			}
+
+			for j, b := range adherenceBuckets {
+				if d < b.upper {
+					aa.Distribution[j].Count++
+					break
+				}
+			}
+		}
+		aa.AverageDelay = int64(total/time.Duration(len(ds))) / int64(time.Second)
+
+		report.Actors = append(report.Actors, aa)
+	}
+
+	// 動画が見つからなかった計画のエントリ
+	for _, p := range plans {
+		matched := map[int]bool{}
+		matchedCollaboIDs := map[int]bool{}
+		for _, v := range videos {
+			index := p.GetEntryIndex(v)
+			if index < 0 {
+				continue
+			}
+
+			matched[index] = true
+			if collaboID := p.Entries[index].CollaboID; collaboID > 0 {
+				matchedCollaboIDs[collaboID] = true
+			}
+		}
+
+		for i, e := range p.Entries {
+			// まだ始まっていない
+			if e.StartAt.After(now) || !r.In(e.StartAt) {
+				continue
+			}
+
+			// コラボの場合は誰かの動画が見つかっていればいい
+			if matched[i] || (e.CollaboID > 0 && matchedCollaboIDs[e.CollaboID]) {
+				continue
+			}
+
+			report.MissedEntries = append(report.MissedEntries, model.MissedPlanEntry{
+				ActorID: e.ActorID,
+				HashTag: e.HashTag,
+				StartAt: e.StartAt,
+				Source:  e.Source,
+			})
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"testing"
+
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/plan"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestPlanAdherence(t *testing.T) {
+	d := jst.ShortDate(2020, 4, 29)
+	plans := []model.Plan{
+		CreatePlan(d, []EntryPart{
+			CreateEntryPart(Suzu, 12, 0),
+			CreateEntryPartCollabo(Iori, 20, 0, 1),
+			CreateEntryPartCollabo(Pino, 20, 0, 1),
+			CreateEntryPart(Suzu, 22, 0),
+			CreateEntryPart(Natori, 23, 0),
+		}),
+	}
+	videos := []model.Video{
+		{
+			ID:            "suzu-1",
+			ActorID:       Suzu.ID,
+			Source:        model.VideoSourceYoutube,
+			StartAt:       jst.Date(2020, 4, 29, 12, 0),
+			ActualStartAt: jst.Date(2020, 4, 29, 12, 7),
+		},
+		{
+			ID:            "collabo",
+			ActorID:       Iori.ID,
+			Source:        model.VideoSourceYoutube,
+			StartAt:       jst.Date(2020, 4, 29, 19, 58),
+			ActualStartAt: jst.Date(2020, 4, 29, 19, 58),
+		},
+		{
+			ID:      "suzu-2",
+			ActorID: Suzu.ID,
+			Source:  model.VideoSourceYoutube,
+			StartAt: jst.Date(2020, 4, 29, 22, 0),
+		},
+	}
+
+	adherences := createPlanAdherences(plans, videos)
+	if len(adherences) != 2 {
+		t.Fatalf("len(adherences), got: %v", len(adherences))
+	}
+
+	if adherences[0].VideoID != "suzu-1" || adherences[0].Delay != 7*60 {
+		t.Errorf("adherences[0], got: %+v", adherences[0])
+	}
+
+	if adherences[1].VideoID != "collabo" || adherences[1].Delay != -2*60 {
+		t.Errorf("adherences[1], got: %+v", adherences[1])
+	}
+
+	r := jst.Range{
+		Begin: d,
+		End:   d.AddOneDay(),
+	}
+	report := createAdherenceReportInternal(r, jst.Date(2020, 4, 29, 23, 30), adherences, plans, videos, All)
+
+	if len(report.Actors) != 2 {
+		t.Fatalf("len(report.Actors), got: %v", len(report.Actors))
+	}
+
+	for _, a := range report.Actors {
+		switch a.ActorID {
+		case Suzu.ID:
+			if a.LateCount != 1 || a.AverageDelay != 7*60 {
+				t.Errorf("suzu, got: %+v", a)
+			}
+		case Iori.ID:
+			if a.EarlyCount != 1 || a.MinDelay != -2*60 {
+				t.Errorf("iori, got: %+v", a)
+			}
+		default:
+			t.Errorf("unexpected actor: %v", a.ActorID)
+		}
+	}
+
+	// ピノはコラボ相手の動画があるので対象外
+	if len(report.MissedEntries) != 1 || report.MissedEntries[0].ActorID != Natori.ID {
+		t.Errorf("missed entries, got: %+v", report.MissedEntries)
+	}
+}
+
+func TestFilterChangedPlanAdherences(t *testing.T) {
+	startAt := jst.Date(2020, 4, 29, 20, 0)
+	saved := model.PlanAdherence{
+		ActorID:        Siro.ID,
+		Source:         model.VideoSourceYoutube,
+		PlannedStartAt: startAt,
+		VideoID:        "siro",
+		ActualStartAt:  jst.Date(2020, 4, 29, 20, 3),
+	}
+
+	moved := saved
+	moved.ActualStartAt = jst.Date(2020, 4, 29, 20, 5)
+	other := saved
+	other.ActorID = Iori.ID
+
+	tests := []struct {
+		name       string
+		adherence  model.PlanAdherence
+		shouldSave bool
+	}{
+		{"same", saved, false},
+		{"actualStartAt changed", moved, true},
+		{"not saved", other, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filterChangedPlanAdherences([]model.PlanAdherence{tt.adherence}, []model.PlanAdherence{saved})
+			if (len(got) == 1) != tt.shouldSave {
+				t.Errorf("got: %v expect: %v", got, tt.shouldSave)
+			}
+		})
+	}
+}
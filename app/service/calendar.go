@@ -13,7 +13,7 @@ import (
 )
 
 // CreateCalendar カレンダーを作成する
-func CreateCalendar(ctx context.Context, client *firestore.Client, baseDate jst.Time, now jst.Time, actors model.ActorSlice) (model.Calendar, error) {
+func CreateCalendar(ctx context.Context, client *firestore.Client, baseDate jst.Time, now jst.Time, actors model.ActorSlice, org model.Organization) (model.Calendar, error) {
 	// 次の月の初めの日
 	var end jst.Time
 	if baseDate.Month() == 12 {
@@ -59,7 +59,7 @@ func CreateCalendar(ctx context.Context, client *firestore.Client, baseDate jst.
 			calendar.FixedDay = d.Day()
 		}
 
-		s := createScheduleInternal(d, plans, videos, actors)
+		s := createScheduleInternal(d, plans, videos, actors, org)
 		actorIDs := []string{}
 		for _, e := range s.Entries {
 			relatedActors := findActorsByScheduleEntry(e, videoMap, actors)
@@ -89,6 +89,111 @@ func CreateCalendar(ctx context.Context, client *firestore.Client, baseDate jst.
 	return calendar, nil
 }
 
+// CreateCalendarInLocation 指定したタイムゾーンのカレンダーを作成する
+// 配信は開始時刻の指定したタイムゾーンでの日付に振り分ける
+func CreateCalendarInLocation(ctx context.Context, client *firestore.Client, baseDate jst.Time, now jst.Time, actors model.ActorSlice, org model.Organization, loc *time.Location) (model.Calendar, error) {
+	if jst.IsJST(loc) {
+		return CreateCalendar(ctx, client, baseDate.JST(), now, actors, org)
+	}
+
+	monthRange := createMonthRangeInLocation(baseDate, loc)
+	jstBegin := monthRange.Begin.JST().FloorToDay().AddDay(-1)
+	jstEnd := monthRange.End.JST().FloorToDay()
+
+	r := jst.Range{
+		Begin: jstBegin.AddDay(-1),
+		End:   jstEnd.AddOneDay().Add(time.Hour * 12),
+	}
+
+	plans, err := store.FindPlans(ctx, client, r)
+	if err != nil && err != common.ErrNotFound {
+		return model.Calendar{}, err
+	}
+
+	videos, err := store.FindVideos(ctx, client, r)
+	if err != nil && err != common.ErrNotFound {
+		return model.Calendar{}, err
+	}
+
+	return createCalendarInLocationInternal(baseDate, now, loc, plans, videos, actors, org), nil
+}
+
+// createMonthRangeInLocation 指定したタイムゾーンでの1ヶ月の範囲を作成する
+func createMonthRangeInLocation(baseDate jst.Time, loc *time.Location) jst.Range {
+	d := baseDate.In(loc)
+	return jst.Range{
+		Begin: jst.ShortDateIn(d.Year(), d.Month(), 1, loc),
+		End:   jst.ShortDateIn(d.Year(), d.Month()+1, 1, loc).Add(-1 * time.Second),
+	}
+}
+
+func createCalendarInLocationInternal(baseDate jst.Time, now jst.Time, loc *time.Location, plans []model.Plan, videos []model.Video, actors model.ActorSlice, org model.Organization) model.Calendar {
+	monthRange := createMonthRangeInLocation(baseDate, loc)
+	calendar := model.Calendar{
+		BaseDate: monthRange.Begin,
+		Days:     []model.CalendarDay{},
+	}
+
+	videoMap := map[string]model.Video{}
+	for _, v := range videos {
+		videoMap[v.ID] = v
+	}
+
+	// 2日以上前は確実にFixされている
+	// 1日の終わりまでFixされている日のみを対象にする
+	fixedDayLimit := now.AddDay(-2)
+	begin := monthRange.Begin
+	for day := 1; jst.ShortDateIn(begin.Year(), begin.Month(), day, loc).Month() == begin.Month(); day++ {
+		next := jst.ShortDateIn(begin.Year(), begin.Month(), day+1, loc)
+		if next.After(fixedDayLimit) {
+			break
+		}
+		calendar.FixedDay = day
+	}
+
+	dayActorIDs := map[int][]string{}
+	jstBegin := monthRange.Begin.JST().FloorToDay().AddDay(-1)
+	jstEnd := monthRange.End.JST().FloorToDay()
+	for d := jstBegin; !d.After(jstEnd); d = d.AddOneDay() {
+		s := createScheduleInternal(d, plans, videos, actors, org)
+		for _, e := range s.Entries {
+			if !monthRange.In(e.StartAt) {
+				continue
+			}
+
+			day := e.StartAt.In(loc).Day()
+			actorIDs := dayActorIDs[day]
+			relatedActors := findActorsByScheduleEntry(e, videoMap, actors)
+
+		OUTER:
+			for _, relatedActor := range relatedActors {
+				for _, id := range actorIDs {
+					if relatedActor.ID == id {
+						continue OUTER
+					}
+				}
+
+				actorIDs = append(actorIDs, relatedActor.ID)
+			}
+			dayActorIDs[day] = actorIDs
+		}
+	}
+
+	for day := 1; day <= 31; day++ {
+		actorIDs, ok := dayActorIDs[day]
+		if !ok || len(actorIDs) == 0 {
+			continue
+		}
+
+		calendar.Days = append(calendar.Days, model.CalendarDay{
+			Day:      day,
+			ActorIDs: actorIDs,
+		})
+	}
+
+	return calendar
+}
+
 func findActorsByScheduleEntry(se model.ScheduleEntry, videoMap map[string]model.Video, actors model.ActorSlice) model.ActorSlice {
 	if se.VideoID != "" {
 		return findActorsByVideoID(se.VideoID, videoMap, actors)
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// FindChangeSet 指定したカーソルより後の変更を取得する
+// 変更されたものは最新の状態を取得し、存在しないものは削除されたものとして扱う
+func FindChangeSet(ctx context.Context, c *firestore.Client, since int64, limit int) (model.ChangeSet, error) {
+	// 続きがあるかを判定するために1つ多く取得する
+	changes, compactedCursor, err := store.FindChanges(ctx, c, since, limit+1)
+	if err != nil {
+		return model.ChangeSet{}, err
+	}
+
+	cs := createChangeSetInternal(changes, compactedCursor, since, limit)
+	if cs.Reset || len(cs.Entries) == 0 {
+		return cs, nil
+	}
+
+	var actors model.ActorSlice
+	for i := range cs.Entries {
+		e := &cs.Entries[i]
+		switch e.Kind {
+		case model.ChangeKindPlan:
+			date, err := model.ParsePlanEntityID(e.EntityID)
+			if err != nil {
+				e.Deleted = true
+				continue
+			}
+			p, err := store.FindPlan(ctx, c, date)
+			if err == common.ErrNotFound {
+				e.Deleted = true
+				continue
+			} else if err != nil {
+				return model.ChangeSet{}, err
+			}
+			e.Plan = &p
+		case model.ChangeKindVideo:
+			v, err := store.FindVideo(ctx, c, e.EntityID)
+			if err == common.ErrNotFound {
+				e.Deleted = true
+				continue
+			} else if err != nil {
+				return model.ChangeSet{}, err
+			}
+			e.Video = &v
+		case model.ChangeKindActor:
+			// キャッシュは古い可能性があるので直接取得する
+			if actors == nil {
+				actors, err = store.FindActors(ctx, c)
+				if err != nil {
+					return model.ChangeSet{}, err
+				}
+			}
+			a, err := actors.FindActor(e.EntityID)
+			if err != nil {
+				e.Deleted = true
+				continue
+			}
+			e.Actor = &a
+		default:
+			e.Deleted = true
+		}
+	}
+
+	return cs, nil
+}
+
+// createChangeSetInternal 変更履歴から変更されたものの一覧を作成する
+// 同じものが複数回変更されている場合は最後の変更だけにまとめる
+// 変更されたものの内容は設定しない
+func createChangeSetInternal(changes []model.Change, compactedCursor int64, since int64, limit int) model.ChangeSet {
+	// 取得したい変更履歴が既に削除されている
+	if since < compactedCursor {
+		return model.ChangeSet{
+			Cursor: compactedCursor,
+			Reset:  true,
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Cursor < changes[j].Cursor
+	})
+
+	hasMore := false
+	if len(changes) > limit {
+		// カーソルは変更された時刻なので同じカーソルの変更が複数ある場合がある
+		// 途中で分けると次回に残りを取得できないので、同じカーソルの変更は次回にまとめて返す
+		next := changes[limit].Cursor
+		end := limit
+		for end > 0 && changes[end-1].Cursor == next {
+			end--
+		}
+		// 全て同じカーソルの場合は分けるしかない
+		if end == 0 {
+			end = limit
+		}
+		changes = changes[:end]
+		hasMore = true
+	}
+
+	cs := model.ChangeSet{
+		Cursor:  since,
+		HasMore: hasMore,
+		Entries: []model.ChangeEntry{},
+	}
+	if len(changes) > 0 {
+		cs.Cursor = changes[len(changes)-1].Cursor
+	}
+
+	for i, c := range changes {
+		latest := true
+		for _, other := range changes[i+1:] {
+			if c.Kind == other.Kind && c.EntityID == other.EntityID {
+				latest = false
+				break
+			}
+		}
+		if !latest {
+			continue
+		}
+
+		cs.Entries = append(cs.Entries, model.ChangeEntry{
+			Cursor:   c.Cursor,
+			Kind:     c.Kind,
+			EntityID: c.EntityID,
+		})
+	}
+
+	return cs
+}
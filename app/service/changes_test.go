@@ -0,0 +1,70 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestCreateChangeSetInternal(t *testing.T) {
+	changes := []model.Change{
+		{Cursor: 3, Kind: model.ChangeKindVideo, EntityID: "v1"},
+		{Cursor: 4, Kind: model.ChangeKindPlan, EntityID: "2020-4-29"},
+		{Cursor: 5, Kind: model.ChangeKindVideo, EntityID: "v1"},
+		{Cursor: 6, Kind: model.ChangeKindActor, EntityID: "v1"},
+		{Cursor: 7, Kind: model.ChangeKindVideo, EntityID: "v2"},
+	}
+
+	tests := []struct {
+		name            string
+		compactedCursor int64
+		since           int64
+		limit           int
+		cursor          int64
+		reset           bool
+		hasMore         bool
+		entries         []int64
+	}{
+		{"all", 0, 2, 10, 7, false, false, []int64{4, 5, 6, 7}},
+		{"limit", 0, 2, 3, 5, false, true, []int64{4, 5}},
+		{"compacted", 2, 2, 10, 7, false, false, []int64{4, 5, 6, 7}},
+		{"reset", 3, 2, 10, 3, true, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			temp := make([]model.Change, len(changes))
+			copy(temp, changes)
+			cs := createChangeSetInternal(temp, tt.compactedCursor, tt.since, tt.limit)
+			if cs.Cursor != tt.cursor || cs.Reset != tt.reset || cs.HasMore != tt.hasMore {
+				t.Errorf("got: %v %v %v expect: %v %v %v", cs.Cursor, cs.Reset, cs.HasMore, tt.cursor, tt.reset, tt.hasMore)
+			}
+
+			if len(cs.Entries) != len(tt.entries) {
+				t.Fatalf("len(entries), got: %v expect: %v", len(cs.Entries), len(tt.entries))
+			}
+			for i, e := range cs.Entries {
+				if e.Cursor != tt.entries[i] {
+					t.Errorf("entries[%v], got: %v expect: %v", i, e.Cursor, tt.entries[i])
+				}
+			}
+		})
+	}
+
+	// 同じカーソルの変更は分けずに次回にまとめて返す
+	tied := []model.Change{
+		{Cursor: 3, Kind: model.ChangeKindVideo, EntityID: "v1"},
+		{Cursor: 4, Kind: model.ChangeKindVideo, EntityID: "v2"},
+		{Cursor: 4, Kind: model.ChangeKindVideo, EntityID: "v3"},
+	}
+	cs := createChangeSetInternal(tied, 0, 2, 2)
+	if cs.Cursor != 3 || !cs.HasMore || len(cs.Entries) != 1 || cs.Entries[0].EntityID != "v1" {
+		t.Errorf("tied, got: %+v", cs)
+	}
+
+	// 変更がない場合はカーソルが変わらない
+	cs = createChangeSetInternal(nil, 0, 7, 10)
+	if cs.Cursor != 7 || cs.HasMore || len(cs.Entries) != 0 {
+		t.Errorf("empty, got: %+v", cs)
+	}
+}
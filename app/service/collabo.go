@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// CreateCollaboGraph 期間を指定してコラボのグラフを作成する
+func CreateCollaboGraph(ctx context.Context, c *firestore.Client, r jst.Range, actors model.ActorSlice, org model.Organization) (model.CollaboGraph, error) {
+	// スケジュールを作成するためには前日の情報、翌日の12時までの情報が必要
+	dataRange := jst.Range{
+		Begin: r.Begin.FloorToDay().AddDay(-1),
+		End:   r.End.FloorToDay().AddOneDay().Add(time.Hour * 12),
+	}
+
+	plans, err := store.FindPlans(ctx, c, dataRange)
+	if err != nil && err != common.ErrNotFound {
+		return model.CollaboGraph{}, err
+	}
+
+	videos, err := store.FindVideos(ctx, c, dataRange)
+	if err != nil && err != common.ErrNotFound {
+		return model.CollaboGraph{}, err
+	}
+
+	return createCollaboGraphInternal(r, plans, videos, actors, org), nil
+}
+
+// collaboStream 1つの配信とその参加者
+type collaboStream struct {
+	stream model.CollaboStream
+	nodes  []model.CollaboNode
+}
+
+func (s *collaboStream) addNode(n model.CollaboNode) {
+	for _, temp := range s.nodes {
+		if temp.ID == n.ID {
+			return
+		}
+	}
+
+	s.nodes = append(s.nodes, n)
+}
+
+func createCollaboGraphInternal(r jst.Range, plans []model.Plan, videos []model.Video, actors model.ActorSlice, org model.Organization) model.CollaboGraph {
+	graph := model.CollaboGraph{
+		Begin: r.Begin,
+		End:   r.End,
+		Nodes: []model.CollaboNode{},
+		Edges: []model.CollaboEdge{},
+	}
+
+	videoMap := map[string]model.Video{}
+	for _, v := range videos {
+		videoMap[v.ID] = v
+	}
+
+	streamMap := map[string]*collaboStream{}
+	var streams []*collaboStream
+
+	for d := r.Begin.FloorToDay(); !d.After(r.End); d = d.AddOneDay() {
+		s := createScheduleInternal(d, plans, videos, actors, org)
+		for _, e := range s.Entries {
+			if !r.In(e.StartAt) {
+				continue
+			}
+
+			// 動画がない場合は計画のコラボIDで同じ配信かどうかを判断する
+			key := e.VideoID
+			if key == "" {
+				if e.CollaboID <= 0 {
+					continue
+				}
+				key = fmt.Sprintf("%v-%v-%v-%v", d.Year(), int(d.Month()), d.Day(), e.CollaboID)
+			}
+
+			cs, ok := streamMap[key]
+			if !ok {
+				cs = &collaboStream{
+					stream: model.CollaboStream{
+						VideoID: e.VideoID,
+						URL:     e.URL,
+						Source:  e.Source,
+						StartAt: e.StartAt,
+						Text:    e.Text,
+					},
+				}
+				streamMap[key] = cs
+				streams = append(streams, cs)
+			}
+
+			for _, a := range findActorsByScheduleEntry(e, videoMap, actors) {
+				if a.ID == "" {
+					continue
+				}
+				cs.addNode(model.CollaboNode{
+					ID:   a.ID,
+					Name: a.Name,
+				})
+			}
+
+			// コラボの場合は他の配信者の動画でエントリが上書きされているので名前からも探す
+			if a, err := actors.FindActorByName(e.ActorName); err == nil {
+				cs.addNode(model.CollaboNode{
+					ID:   a.ID,
+					Name: a.Name,
+				})
+			}
+
+			// 外部の配信者の枠の場合
+			v, ok := videoMap[e.VideoID]
+			if ok && v.IsUnknownActor() && v.OwnerName != "" && !org.IsOfficialVideo(v) {
+				cs.addNode(model.CollaboNode{
+					ID:       model.CollaboNodeIDExternalPrefix + v.OwnerName,
+					Name:     v.OwnerName,
+					External: true,
+				})
+			}
+		}
+	}
+
+	nodeMap := map[string]*model.CollaboNode{}
+	var nodeIDs []string
+	edgeMap := map[string]*model.CollaboEdge{}
+	var edgeKeys []string
+
+	for _, cs := range streams {
+		if len(cs.nodes) < 2 {
+			continue
+		}
+
+		for _, n := range cs.nodes {
+			temp, ok := nodeMap[n.ID]
+			if !ok {
+				copy := n
+				temp = &copy
+				nodeMap[n.ID] = temp
+				nodeIDs = append(nodeIDs, n.ID)
+			}
+			temp.StreamCount++
+		}
+
+		for i := 0; i < len(cs.nodes); i++ {
+			for j := i + 1; j < len(cs.nodes); j++ {
+				source := cs.nodes[i].ID
+				target := cs.nodes[j].ID
+				if strings.Compare(source, target) > 0 {
+					source, target = target, source
+				}
+
+				key := source + "\n" + target
+				edge, ok := edgeMap[key]
+				if !ok {
+					edge = &model.CollaboEdge{
+						Source: source,
+						Target: target,
+					}
+					edgeMap[key] = edge
+					edgeKeys = append(edgeKeys, key)
+				}
+
+				edge.Weight++
+				edge.Streams = append(edge.Streams, cs.stream)
+			}
+		}
+	}
+
+	for _, id := range nodeIDs {
+		graph.Nodes = append(graph.Nodes, *nodeMap[id])
+	}
+
+	for _, key := range edgeKeys {
+		graph.Edges = append(graph.Edges, *edgeMap[key])
+	}
+
+	sort.SliceStable(graph.Edges, func(i, j int) bool {
+		return graph.Edges[i].Weight > graph.Edges[j].Weight
+	})
+
+	return graph
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"testing"
+
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/plan"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestCreateCollaboGraphInternal(t *testing.T) {
+	d := jst.ShortDate(2020, 4, 29)
+	plans := []model.Plan{
+		CreatePlan(d, []EntryPart{
+			CreateEntryPart(Suzu, 12, 0),
+			CreateEntryPartCollabo(Iori, 20, 0, 1),
+			CreateEntryPartCollabo(Suzu, 20, 0, 1),
+		}),
+	}
+	videos := []model.Video{
+		{
+			ID:      "suzu",
+			ActorID: Suzu.ID,
+			Source:  model.VideoSourceYoutube,
+			StartAt: jst.Date(2020, 4, 29, 12, 0),
+		},
+		{
+			ID:      "collabo",
+			ActorID: Iori.ID,
+			Source:  model.VideoSourceYoutube,
+			StartAt: jst.Date(2020, 4, 29, 20, 0),
+		},
+		{
+			ID:             "external",
+			ActorID:        model.ActorIDUnknown,
+			RelatedActorID: Pino.ID,
+			OwnerName:      "外部チャンネル",
+			Source:         model.VideoSourceYoutube,
+			StartAt:        jst.Date(2020, 4, 29, 23, 0),
+		},
+	}
+
+	r := jst.Range{
+		Begin: d,
+		End:   d.AddOneDay().Add(-1),
+	}
+	graph := createCollaboGraphInternal(r, plans, videos, All, Organization)
+
+	if len(graph.Nodes) != 4 {
+		t.Fatalf("len(nodes), got: %v expect: %v", len(graph.Nodes), 4)
+	}
+
+	if len(graph.Edges) != 2 {
+		t.Fatalf("len(edges), got: %v expect: %v", len(graph.Edges), 2)
+	}
+
+	edgeMap := map[string]model.CollaboEdge{}
+	for _, e := range graph.Edges {
+		edgeMap[e.Source+"/"+e.Target] = e
+	}
+
+	check := func(source, target, videoID string) {
+		if source > target {
+			source, target = target, source
+		}
+
+		e, ok := edgeMap[source+"/"+target]
+		if !ok {
+			t.Errorf("edge not found: %v-%v", source, target)
+			return
+		}
+
+		if e.Weight != 1 || len(e.Streams) != 1 || e.Streams[0].VideoID != videoID {
+			t.Errorf("edge %v-%v, got: %v expect: %v", source, target, e, videoID)
+		}
+	}
+	check(Iori.ID, Suzu.ID, "collabo")
+	check(Pino.ID, model.CollaboNodeIDExternalPrefix+"外部チャンネル", "external")
+}
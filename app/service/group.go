@@ -0,0 +1,51 @@
+package service
+
+import (
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+// FilterScheduleByGroup グループの配信者が参加するエントリだけのスケジュールにする
+func FilterScheduleByGroup(s model.Schedule, actors model.ActorSlice, groupID string) model.Schedule {
+	members := actors.FilterByGroup(groupID)
+
+	entries := []model.ScheduleEntry{}
+	for _, e := range s.Entries {
+		for _, id := range e.ActorIDs {
+			if _, err := members.FindActor(id); err == nil {
+				entries = append(entries, e)
+				break
+			}
+		}
+	}
+
+	s.Entries = entries
+	return s
+}
+
+// FilterCalendarByGroup グループの配信者だけのカレンダーにする
+// グループの配信者の配信がない日は除く
+func FilterCalendarByGroup(c model.Calendar, actors model.ActorSlice, groupID string) model.Calendar {
+	members := actors.FilterByGroup(groupID)
+
+	days := model.CalendarDaySlice{}
+	for _, d := range c.Days {
+		actorIDs := []string{}
+		for _, id := range d.ActorIDs {
+			if _, err := members.FindActor(id); err == nil {
+				actorIDs = append(actorIDs, id)
+			}
+		}
+
+		if len(actorIDs) == 0 {
+			continue
+		}
+
+		days = append(days, model.CalendarDay{
+			Day:      d.Day,
+			ActorIDs: actorIDs,
+		})
+	}
+
+	c.Days = days
+	return c
+}
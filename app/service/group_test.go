@@ -0,0 +1,86 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func createGroupTestActors() model.ActorSlice {
+	iori := Iori
+	iori.Groups = []string{"idol"}
+	suzu := Suzu
+	suzu.Groups = []string{"idol", "appare"}
+	pino := Pino
+	pino.Groups = []string{"appare"}
+	return model.ActorSlice{iori, suzu, pino, Siro}
+}
+
+func TestFilterScheduleByGroup(t *testing.T) {
+	actors := createGroupTestActors()
+	s := model.Schedule{
+		Date: jst.ShortDate(2020, 4, 29),
+		Entries: []model.ScheduleEntry{
+			{ActorName: Iori.Name, ActorIDs: []string{Iori.ID}},
+			{ActorName: Pino.Name, ActorIDs: []string{Pino.ID}},
+			// コラボは参加者の誰かがグループに所属していれば対象
+			{ActorName: Siro.Name, ActorIDs: []string{Siro.ID, Suzu.ID}},
+			{ActorName: "#どっとライブ"},
+		},
+	}
+
+	tests := []struct {
+		groupID string
+		expect  []string
+	}{
+		{"idol", []string{Iori.Name, Siro.Name}},
+		{"appare", []string{Pino.Name, Siro.Name}},
+		{"unknown", []string{}},
+	}
+
+	for _, tt := range tests {
+		temp := FilterScheduleByGroup(s, actors, tt.groupID)
+		names := []string{}
+		for _, e := range temp.Entries {
+			names = append(names, e.ActorName)
+		}
+
+		if strings.Join(names, ",") != strings.Join(tt.expect, ",") {
+			t.Errorf("%v, got: %v expect: %v", tt.groupID, names, tt.expect)
+		}
+	}
+
+	// 元のスケジュールは変更しない
+	if len(s.Entries) != 4 {
+		t.Errorf("original schedule is modified")
+	}
+}
+
+func TestFilterCalendarByGroup(t *testing.T) {
+	actors := createGroupTestActors()
+	c := model.Calendar{
+		BaseDate: jst.ShortDate(2020, 4, 1),
+		Days: model.CalendarDaySlice{
+			{Day: 1, ActorIDs: []string{Iori.ID, Pino.ID}},
+			{Day: 2, ActorIDs: []string{Siro.ID}},
+			{Day: 3, ActorIDs: []string{Suzu.ID, Siro.ID}},
+		},
+		FixedDay: 2,
+	}
+
+	temp := FilterCalendarByGroup(c, actors, "idol")
+	if len(temp.Days) != 2 || temp.FixedDay != 2 {
+		t.Fatalf("got: %+v", temp)
+	}
+
+	if temp.Days[0].Day != 1 || strings.Join(temp.Days[0].ActorIDs, ",") != Iori.ID {
+		t.Errorf("days[0], got: %+v", temp.Days[0])
+	}
+
+	if temp.Days[1].Day != 3 || strings.Join(temp.Days[1].ActorIDs, ",") != Suzu.ID {
+		t.Errorf("days[1], got: %+v", temp.Days[1])
+	}
+}
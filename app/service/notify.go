@@ -2,41 +2,102 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net/http"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/app/internal"
+	"github.com/yaegaki/dotlive-schedule-server/event"
 	"github.com/yaegaki/dotlive-schedule-server/jst"
 	"github.com/yaegaki/dotlive-schedule-server/model"
 	"github.com/yaegaki/dotlive-schedule-server/notify"
 	"github.com/yaegaki/dotlive-schedule-server/store"
-	"github.com/yaegaki/dotlive-schedule-server/youtube"
+)
+
+const (
+	// discordTimeout DiscordのWebhookのタイムアウト
+	discordTimeout = 10 * time.Second
 )
 
 // PushNotify プッシュ通知を実行する
-func PushNotify(ctx context.Context, c *firestore.Client, actors model.ActorSlice) {
+func PushNotify(ctx context.Context, c *firestore.Client, actors model.ActorSlice, org model.Organization) {
 	msgCli, err := notify.NewClient(ctx, true)
 	if err != nil {
 		log.Printf("Can not create firebase messaging client: %v", err)
 		return
 	}
 
-	pushNotifyLatestPlan(ctx, c, msgCli, actors)
-	pushNotifyVideo(ctx, c, msgCli, actors)
+	notifier := newNotifier(ctx, c)
+	pushNotifyLatestPlan(ctx, c, notifier, actors)
+	pushNotifyVideo(ctx, c, notifier, actors, org)
+	pushNotifyRemind(ctx, c, notifier, actors, org)
+
+	DeliverNotifications(ctx, c, msgCli)
+	DeliverWebPushes(ctx, c)
+}
+
+// newNotifier 設定されている全ての送信先に通知するNotifierを作成する
+func newNotifier(ctx context.Context, c *firestore.Client) notify.Notifier {
+	notifiers := notify.MultiNotifier{
+		// 送信に失敗しても再送できるように一度アウトボックスに保存してから送信する
+		notify.NewFCMNotifier(newOutboxClient(c)),
+		// 配信の開始はWebhookでも送信する
+		&webhookNotifier{c: c},
+	}
+
+	routes, err := notify.ParseDiscordRoutes(internal.DiscordWebhooks)
+	if err != nil {
+		log.Printf("Can not parse discord webhooks: %v", err)
+	} else if len(routes) > 0 {
+		notifiers = append(notifiers, notify.NewDiscordNotifier(routes, &http.Client{
+			Timeout: discordTimeout,
+		}, &discordPostStore{c: c}))
+	}
+
+	// ブラウザのプッシュ通知も保存してからDeliverWebPushesで送信する
+	notifiers = append(notifiers, notify.NewWebPushNotifier(func(ctx context.Context, d model.WebPushDelivery) error {
+		_, err := store.EnqueueWebPushDelivery(ctx, c, d)
+		return err
+	}))
+
+	return notifiers
 }
 
-func pushNotifyLatestPlan(ctx context.Context, c *firestore.Client, msgCli notify.Client, actors model.ActorSlice) {
+// discordPostStore Firestoreに投稿済みのDiscordの通知を記録する
+type discordPostStore struct {
+	c *firestore.Client
+}
+
+// IsPosted impl notify.DiscordPostStore
+func (s *discordPostStore) IsPosted(ctx context.Context, id string) (bool, error) {
+	return store.IsDiscordPosted(ctx, s.c, id)
+}
+
+// MarkAsPosted impl notify.DiscordPostStore
+func (s *discordPostStore) MarkAsPosted(ctx context.Context, id string) error {
+	return store.MarkDiscordAsPosted(ctx, s.c, id, jst.Now())
+}
+
+func pushNotifyLatestPlan(ctx context.Context, c *firestore.Client, notifier notify.Notifier, actors model.ActorSlice) {
 	plan, err := store.FindLatestPlan(ctx, c)
 	if err != nil {
 		log.Printf("Can not get latest plan: %v", err)
 		return
 	}
 
+	now := jst.Now()
 	if plan.Notified {
+		pushNotifyPlanUpdatedInternal(ctx, notifier, plan, actors, now, func(ctx context.Context, p model.Plan) (model.Plan, bool, error) {
+			return store.UpdatePlanNotifiedEntries(ctx, c, p, now)
+		}, func(ctx context.Context, p model.Plan, notifiedAt jst.Time) error {
+			return store.RestorePlanNotifiedEntries(ctx, c, p, notifiedAt)
+		})
 		return
 	}
 
-	_, updated, err := store.MarkPlanAsNotified(ctx, c, plan)
+	plan, updated, err := store.MarkPlanAsNotified(ctx, c, plan, now)
 	if err != nil {
 		log.Printf("Can not mark plan as notified: %v", err)
 		return
@@ -48,16 +109,70 @@ func pushNotifyLatestPlan(ctx context.Context, c *firestore.Client, msgCli notif
 	}
 
 	log.Printf("push notify plan: %v", plan.Date)
-	err = notify.PushNotifyPlan(ctx, msgCli, plan, actors)
+	err = notifier.Notify(ctx, notify.NewPlanPublishedEvent(plan, actors))
 	if err != nil {
 		log.Printf("Can not send push notification: %v", err)
+		// アウトボックスに保存できなかった場合は次回に再度通知する
+		err = store.UnmarkPlanAsNotified(ctx, c, plan)
+		if err != nil {
+			log.Printf("Can not unmark plan as notified: %v", err)
+		}
 		return
 	}
+
+	event.Publish(event.TypeNotificationSent, event.NotificationSent{
+		Kind: "plan",
+		Date: &plan.Date,
+	})
+}
+
+type updatePlanNotifiedEntriesFunc func(ctx context.Context, p model.Plan) (model.Plan, bool, error)
+type restorePlanNotifiedEntriesFunc func(ctx context.Context, p model.Plan, notifiedAt jst.Time) error
+
+// pushNotifyPlanUpdatedInternal 通知済みの計画が修正されていたら変更されたエントリだけを通知する
+// 通知済みのエントリを記録する前に通知した計画は記録だけして通知しない
+// 主な送信先に通知できなかった場合は通知済みのエントリを元に戻して次回に再度通知する
+func pushNotifyPlanUpdatedInternal(ctx context.Context, notifier notify.Notifier, plan model.Plan, actors model.ActorSlice, now jst.Time, updateNotifiedEntries updatePlanNotifiedEntriesFunc, restoreNotifiedEntries restorePlanNotifiedEntriesFunc) {
+	var changes []model.PlanEntryChange
+	if !plan.NotifiedAt.IsZero() {
+		changes = plan.NotifiedChanges()
+		if len(changes) == 0 {
+			return
+		}
+	}
+
+	// 先に記録することで同時実行されても二重に通知しないようにする
+	updatedPlan, updated, err := updateNotifiedEntries(ctx, plan)
+	if err != nil {
+		log.Printf("Can not update plan notified entries: %v", err)
+		return
+	}
+
+	if !updated || len(changes) == 0 {
+		return
+	}
+
+	log.Printf("push notify plan updated: %v, changes:%v", plan.Date, len(changes))
+	err = notifier.Notify(ctx, notify.NewPlanUpdatedEvent(plan, changes, actors))
+	if err != nil {
+		log.Printf("Can not send push notification: %v", err)
+		err = restoreNotifiedEntries(ctx, plan, updatedPlan.NotifiedAt)
+		if err != nil {
+			log.Printf("Can not restore plan notified entries: %v", err)
+		}
+		return
+	}
+
+	event.Publish(event.TypeNotificationSent, event.NotificationSent{
+		Kind: "planUpdated",
+		Date: &plan.Date,
+	})
 }
 
 type markVideoAsNotifiedFunc func(ctx context.Context, video model.Video) (model.Video, bool, error)
+type unmarkVideoAsNotifiedFunc func(ctx context.Context, video model.Video) error
 
-func pushNotifyVideo(ctx context.Context, c *firestore.Client, msgCli notify.Client, actors model.ActorSlice) {
+func pushNotifyVideo(ctx context.Context, c *firestore.Client, notifier notify.Notifier, actors model.ActorSlice, org model.Organization) {
 	now := jst.Now()
 	r := jst.Range{
 		Begin: now.AddDay(-2),
@@ -77,12 +192,16 @@ func pushNotifyVideo(ctx context.Context, c *firestore.Client, msgCli notify.Cli
 		return
 	}
 
-	pushNotifyVideoInternal(ctx, msgCli, plans, videos, actors, now, func(ctx context.Context, v model.Video) (model.Video, bool, error) {
+	pushNotifyVideoInternal(ctx, notifier, plans, videos, actors, org, now, func(ctx context.Context, v model.Video) (model.Video, bool, error) {
 		return store.MarkVideoAsNotified(ctx, c, v)
+	}, func(ctx context.Context, v model.Video) error {
+		return store.UnmarkVideoAsNotified(ctx, c, v)
 	})
 }
 
-func pushNotifyVideoInternal(ctx context.Context, msgCli notify.Client, plans []model.Plan, videos []model.Video, actors model.ActorSlice, now jst.Time, markAsNotified markVideoAsNotifiedFunc) {
+// pushNotifyVideoInternal 開始した動画を通知する
+// 同時実行されても二重に通知しないように先に通知済みとして、主な送信先に通知できなかった場合は元に戻す
+func pushNotifyVideoInternal(ctx context.Context, notifier notify.Notifier, plans []model.Plan, videos []model.Video, actors model.ActorSlice, org model.Organization, now jst.Time, markAsNotified markVideoAsNotifiedFunc, unmarkAsNotified unmarkVideoAsNotifiedFunc) {
 	// 現在時間より2時間前の場合は古いので通知しない
 	notifyLimit := now.Add(-2 * time.Hour)
 
@@ -134,20 +253,23 @@ func pushNotifyVideoInternal(ctx context.Context, msgCli notify.Client, plans []
 			continue
 		}
 
+		if v.Unavailable {
+			log.Printf("Skip notify video because unavailable. video:%v", v.ID)
+			continue
+		}
+
 		if v.Source != model.VideoSourceYoutube && !isPlanned {
 			log.Printf("Skip notify video because not planned. video:%v startAt:%v now:%v source:%v", v.ID, startAt, now, v.Source)
 			continue
 		}
 
-		if v.OwnerName == youtube.ChannelNameDotLive {
-			// どっとライブの動画は誰が出演しているか取得できないので通知できない
-			log.Printf("Skip notify video because dotlive's video")
+		if org.IsOfficialVideo(v) {
+			// 公式チャンネルの動画は誰が出演しているか取得できないので通知できない
+			log.Printf("Skip notify video because official channel's video")
 			continue
 		}
 
-		// シロちゃんの動画は常に計画されているとする
-		const siroID = "lLhToxu1Kyxuwwygh0FK"
-		if v.ActorID == siroID && !v.IsLive {
+		if actors.IsPlannedUpload(v) {
 			isPlanned = true
 		}
 
@@ -166,43 +288,11 @@ func pushNotifyVideoInternal(ctx context.Context, msgCli notify.Client, plans []
 				relatedActors = append(relatedActors, actor)
 			}
 		} else {
-			var actorID string
-			if v.IsUnknownActor() {
-				actorID = v.RelatedActorID
-			} else {
-				actorID = v.ActorID
-			}
-			actor, err := actors.FindActor(actorID)
+			relatedActors, err = findVideoActors(v, actors)
 			if err != nil {
-				log.Printf("notify: Unknown actor %v", actorID)
+				log.Printf("notify: %v", err)
 				continue
 			}
-
-			relatedActors = append(relatedActors, actor)
-
-			// relatedActorIDsが存在する場合は追加する
-			// ただし既に追加されている場合は無視
-			for _, relatedActorID := range v.RelatedActorIDs {
-				found := false
-				for _, temp := range relatedActors {
-					if temp.ID == relatedActorID {
-						found = true
-						break
-					}
-				}
-
-				if found {
-					continue
-				}
-
-				actor, err := actors.FindActor(relatedActorID)
-				if err != nil {
-					log.Printf("Unknown relatedActor %v", relatedActorID)
-					continue
-				}
-
-				relatedActors = append(relatedActors, actor)
-			}
 		}
 
 		log.Printf("push notify video: %v, %v, isPlanned:%v, isLive:%v isCollabo:%v", v.ID, v.Text, isPlanned, v.IsLive, collaboID > 0)
@@ -212,10 +302,63 @@ func pushNotifyVideoInternal(ctx context.Context, msgCli notify.Client, plans []
 		} else {
 			baseDate = v.StartAt
 		}
-		err = notify.PushNotifyVideo(ctx, msgCli, baseDate, v, relatedActors)
+		err = notifier.Notify(ctx, notify.NewStreamStartedEvent(baseDate, v, relatedActors))
 		if err != nil {
 			log.Printf("Can not send push notification: %v", err)
-			return
+			// アウトボックスに保存できなかった場合は次回に再度通知する
+			err = unmarkAsNotified(ctx, v)
+			if err != nil {
+				log.Printf("Can not unmark video as notified: %v", err)
+			}
+			continue
 		}
+
+		event.Publish(event.TypeNotificationSent, event.NotificationSent{
+			Kind:    "video",
+			VideoID: v.ID,
+		})
+	}
+}
+
+// findVideoActors 動画の通知対象の配信者を取得する
+// 配信者が不明な動画の場合は関連する配信者を対象にする
+func findVideoActors(v model.Video, actors model.ActorSlice) ([]model.Actor, error) {
+	var actorID string
+	if v.IsUnknownActor() {
+		actorID = v.RelatedActorID
+	} else {
+		actorID = v.ActorID
+	}
+	actor, err := actors.FindActor(actorID)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown actor %v", actorID)
+	}
+
+	relatedActors := []model.Actor{actor}
+
+	// relatedActorIDsが存在する場合は追加する
+	// ただし既に追加されている場合は無視
+	for _, relatedActorID := range v.RelatedActorIDs {
+		found := false
+		for _, temp := range relatedActors {
+			if temp.ID == relatedActorID {
+				found = true
+				break
+			}
+		}
+
+		if found {
+			continue
+		}
+
+		actor, err := actors.FindActor(relatedActorID)
+		if err != nil {
+			log.Printf("Unknown relatedActor %v", relatedActorID)
+			continue
+		}
+
+		relatedActors = append(relatedActors, actor)
 	}
+
+	return relatedActors, nil
 }
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"firebase.google.com/go/messaging"
@@ -10,12 +11,19 @@ import (
 	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/plan"
 	"github.com/yaegaki/dotlive-schedule-server/jst"
 	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/notify"
 )
 
 type notifyVideoTestClient struct {
 	m *messaging.Message
 }
 
+type failNotifier struct{}
+
+func (failNotifier) Notify(ctx context.Context, e notify.Event) error {
+	return errors.New("failed")
+}
+
 func TestPushNotifyVideoInternal(t *testing.T) {
 	tests := []struct {
 		d      jst.Time
@@ -84,8 +92,11 @@ func TestPushNotifyVideoInternal(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.title, func(t *testing.T) {
 			cli := &TestNotifyClient{}
-			pushNotifyVideoInternal(ctx, cli, plans, tt.videos, All, tt.d, func(ctx context.Context, v model.Video) (model.Video, bool, error) {
+			pushNotifyVideoInternal(ctx, notify.NewFCMNotifier(cli), plans, tt.videos, All, Organization, tt.d, func(ctx context.Context, v model.Video) (model.Video, bool, error) {
 				return v, true, nil
+			}, func(ctx context.Context, v model.Video) error {
+				t.Errorf("video must not be unmarked: %v", v.ID)
+				return nil
 			})
 
 			if len(cli.Messages) != 1 {
@@ -104,3 +115,206 @@ func TestPushNotifyVideoInternal(t *testing.T) {
 		})
 	}
 }
+
+func TestPushNotifyVideoInternalOrganization(t *testing.T) {
+	d := jst.Date(2020, 4, 29, 21, 0)
+	videos := []model.Video{
+		{
+			ID:        "official",
+			ActorID:   model.ActorIDUnknown,
+			OwnerName: Organization.YoutubeChannelName,
+			StartAt:   d,
+			Text:      "official",
+			URL:       "https://official",
+			Source:    model.VideoSourceYoutube,
+		},
+		{
+			ID:      "siro",
+			ActorID: Siro.ID,
+			StartAt: d,
+			Text:    "upload",
+			URL:     "https://siro",
+			Source:  model.VideoSourceYoutube,
+		},
+	}
+
+	cli := &TestNotifyClient{}
+	pushNotifyVideoInternal(context.Background(), notify.NewFCMNotifier(cli), nil, videos, All, Organization, d, func(ctx context.Context, v model.Video) (model.Video, bool, error) {
+		return v, true, nil
+	}, func(ctx context.Context, v model.Video) error {
+		t.Errorf("video must not be unmarked: %v", v.ID)
+		return nil
+	})
+
+	// 公式チャンネルの動画は出演者が分からないので通知しない
+	if len(cli.Messages) != 1 {
+		t.Fatalf("len(messages), got: %v", len(cli.Messages))
+	}
+
+	if cli.Messages[0].Notification.Body != "upload" {
+		t.Errorf("body, got: %v", cli.Messages[0].Notification.Body)
+	}
+}
+
+func TestPushNotifyVideoInternalFailure(t *testing.T) {
+	d := jst.Date(2020, 4, 29, 21, 0)
+	videos := []model.Video{
+		{
+			ID:      "siro",
+			ActorID: Siro.ID,
+			StartAt: d,
+			Text:    "siro",
+			URL:     "https://siro",
+			Source:  model.VideoSourceYoutube,
+		},
+		{
+			ID:      "iori",
+			ActorID: Iori.ID,
+			StartAt: d,
+			Text:    "iori",
+			URL:     "https://iori",
+			Source:  model.VideoSourceYoutube,
+		},
+	}
+
+	cli := &TestNotifyClient{}
+	notifier := notify.MultiNotifier{
+		notify.NewFCMNotifier(cli),
+		failNotifier{},
+	}
+	var marked []string
+	pushNotifyVideoInternal(context.Background(), notifier, nil, videos, All, Organization, d, func(ctx context.Context, v model.Video) (model.Video, bool, error) {
+		marked = append(marked, v.ID)
+		return v, true, nil
+	}, func(ctx context.Context, v model.Video) error {
+		t.Errorf("video must not be unmarked: %v", v.ID)
+		return nil
+	})
+
+	// 主な送信先以外が失敗しても後続の動画は通知する
+	if len(cli.Messages) != 2 {
+		t.Fatalf("len(messages), got: %v", len(cli.Messages))
+	}
+
+	if len(marked) != 2 {
+		t.Errorf("marked, got: %v", marked)
+	}
+
+	// 主な送信先に通知できなかった場合は次回に通知するために元に戻す
+	var unmarked []string
+	pushNotifyVideoInternal(context.Background(), notify.MultiNotifier{failNotifier{}}, nil, videos, All, Organization, d, func(ctx context.Context, v model.Video) (model.Video, bool, error) {
+		return v, true, nil
+	}, func(ctx context.Context, v model.Video) error {
+		unmarked = append(unmarked, v.ID)
+		return nil
+	})
+
+	if len(unmarked) != 2 || unmarked[0] != "siro" || unmarked[1] != "iori" {
+		t.Errorf("unmarked, got: %v", unmarked)
+	}
+}
+
+func TestPushNotifyPlanUpdatedInternal(t *testing.T) {
+	d := jst.ShortDate(2020, 4, 29)
+	notified := CreatePlan(d, []EntryPart{
+		CreateEntryPart(Siro, 20, 0),
+	}).Entries
+	changed := CreatePlan(d, []EntryPart{
+		CreateEntryPart(Siro, 20, 0),
+		CreateEntryPart(Pino, 22, 0),
+	})
+
+	tests := []struct {
+		name       string
+		notifiedAt jst.Time
+		entries    []model.PlanEntry
+		updated    bool
+		update     bool
+		titles     []string
+	}{
+		{"not changed", jst.Date(2020, 4, 29, 9, 0), notified, true, false, nil},
+		{"changed", jst.Date(2020, 4, 29, 9, 0), changed.Entries, true, true, []string{"スケジュール更新4月29日(🐜)"}},
+		{"updated by other", jst.Date(2020, 4, 29, 9, 0), changed.Entries, false, true, nil},
+		{"notified before snapshot", jst.Time{}, changed.Entries, true, true, nil},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := model.Plan{
+				Date:            d,
+				Entries:         tt.entries,
+				Notified:        true,
+				NotifiedAt:      tt.notifiedAt,
+				NotifiedEntries: notified,
+			}
+
+			cli := &TestNotifyClient{}
+			update := false
+			pushNotifyPlanUpdatedInternal(ctx, notify.NewFCMNotifier(cli), p, All, jst.Date(2020, 4, 29, 12, 0), func(ctx context.Context, p model.Plan) (model.Plan, bool, error) {
+				update = true
+				return p, tt.updated, nil
+			}, func(ctx context.Context, p model.Plan, notifiedAt jst.Time) error {
+				t.Errorf("notified entries must not be restored")
+				return nil
+			})
+
+			if update != tt.update {
+				t.Errorf("update, got: %v expect: %v", update, tt.update)
+			}
+
+			if len(cli.Messages) != len(tt.titles) {
+				t.Fatalf("len(messages), got: %v expect: %v", len(cli.Messages), len(tt.titles))
+			}
+
+			for i, m := range cli.Messages {
+				if m.Notification.Title != tt.titles[i] {
+					t.Errorf("title, got: %v expect: %v", m.Notification.Title, tt.titles[i])
+				}
+
+				if m.Notification.Body != "追加 22:00~ カルロピノ" {
+					t.Errorf("body, got: %v", m.Notification.Body)
+				}
+
+				if m.Topic != "plan" {
+					t.Errorf("topic, got: %v", m.Topic)
+				}
+			}
+		})
+	}
+}
+
+func TestPushNotifyPlanUpdatedInternalFailure(t *testing.T) {
+	d := jst.ShortDate(2020, 4, 29)
+	notifiedAt := jst.Date(2020, 4, 29, 9, 0)
+	now := jst.Date(2020, 4, 29, 12, 0)
+	p := model.Plan{
+		Date: d,
+		Entries: CreatePlan(d, []EntryPart{
+			CreateEntryPart(Siro, 20, 0),
+			CreateEntryPart(Pino, 22, 0),
+		}).Entries,
+		Notified:   true,
+		NotifiedAt: notifiedAt,
+		NotifiedEntries: CreatePlan(d, []EntryPart{
+			CreateEntryPart(Siro, 20, 0),
+		}).Entries,
+	}
+
+	var restored []jst.Time
+	pushNotifyPlanUpdatedInternal(context.Background(), notify.MultiNotifier{failNotifier{}}, p, All, now, func(ctx context.Context, p model.Plan) (model.Plan, bool, error) {
+		p.NotifiedAt = now
+		return p, true, nil
+	}, func(ctx context.Context, old model.Plan, t jst.Time) error {
+		if !old.NotifiedAt.Equal(notifiedAt) || len(old.NotifiedEntries) != 1 {
+			return errors.New("invalid plan")
+		}
+		restored = append(restored, t)
+		return nil
+	})
+
+	// 主な送信先に通知できなかった場合は次回に通知するために元に戻す
+	if len(restored) != 1 || !restored[0].Equal(now) {
+		t.Errorf("restored, got: %v", restored)
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/messaging"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/notify"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+const (
+	// retryBackoff 最初の再送までの時間
+	// 再送するたびに倍になる
+	retryBackoff = 5 * time.Minute
+	// retryMaxBackoff 再送までの最大の時間
+	retryMaxBackoff = time.Hour
+	// notificationMaxAttempts 送信を試みる最大回数
+	notificationMaxAttempts = 5
+	// notificationExpiration 保存してからこの時間を過ぎたものは古いので送信しない
+	notificationExpiration = 2 * time.Hour
+)
+
+// errNotificationExpired 古くなったので送信しなかった
+var errNotificationExpired = errors.New("notification expired")
+
+// outboxClient メッセージを直接送信せずにアウトボックスに保存するnotify.Client
+// 保存したメッセージはDeliverNotificationsで送信する
+type outboxClient struct {
+	c *firestore.Client
+}
+
+func newOutboxClient(c *firestore.Client) notify.Client {
+	return &outboxClient{c: c}
+}
+
+// Send メッセージをアウトボックスに保存してIDを返す
+// 既に同じメッセージが保存されている場合は保存せずに同じIDを返す
+func (o *outboxClient) Send(ctx context.Context, message *messaging.Message) (string, error) {
+	n, err := newNotification(notify.IdempotencyKey(ctx), message, jst.Now())
+	if err != nil {
+		return "", err
+	}
+
+	created, err := store.EnqueueNotification(ctx, o.c, n)
+	if err != nil {
+		return "", err
+	}
+
+	if !created {
+		log.Printf("Notification is already enqueued: %v", n.ID)
+	}
+
+	return n.ID, nil
+}
+
+// newNotification アウトボックスに保存するプッシュ通知を作成する
+// IDは冪等性キーとメッセージの内容から作成するので、同じ冪等性キーでも条件を分けて送信したメッセージは別のものになる
+func newNotification(key string, message *messaging.Message, now jst.Time) (model.Notification, error) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return model.Notification{}, err
+	}
+
+	id := fmt.Sprintf("%x", sha1.Sum([]byte(key+"\n"+string(payload))))
+	return model.Notification{
+		ID:            id,
+		Payload:       string(payload),
+		Status:        model.NotificationStatusPending,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}, nil
+}
+
+// DeliverNotifications アウトボックスの送信待ちのプッシュ通知を送信する
+func DeliverNotifications(ctx context.Context, c *firestore.Client, msgCli notify.Client) {
+	notifications, err := store.FindNotificationsByStatus(ctx, c, model.NotificationStatusPending)
+	if err != nil {
+		log.Printf("Can not get pending notifications: %v", err)
+		return
+	}
+
+	deliverNotificationsInternal(ctx, msgCli, notifications, jst.Now(), func(ctx context.Context, n model.Notification) error {
+		return store.SaveNotification(ctx, c, n)
+	})
+}
+
+type saveNotificationFunc func(ctx context.Context, n model.Notification) error
+
+func deliverNotificationsInternal(ctx context.Context, msgCli notify.Client, notifications []model.Notification, now jst.Time, save saveNotificationFunc) {
+	for _, n := range notifications {
+		if n.Status != model.NotificationStatusPending || n.NextAttemptAt.After(now) {
+			continue
+		}
+
+		n, err := deliverNotification(ctx, msgCli, n, now)
+		if saveErr := save(ctx, n); saveErr != nil {
+			// 保存できなかった場合は次回に再送されるので重複して通知される可能性がある
+			log.Printf("Can not save notification %v: %v", n.ID, saveErr)
+		}
+
+		if err == nil {
+			continue
+		}
+
+		log.Printf("Can not send notification %v: %v", n.ID, err)
+
+		// サーバーエラーの場合は他のメッセージも送信できないので次回に回す
+		if notify.IsServerError(err) {
+			return
+		}
+	}
+}
+
+// deliverNotification プッシュ通知を送信して送信状況を更新する
+func deliverNotification(ctx context.Context, msgCli notify.Client, n model.Notification, now jst.Time) (model.Notification, error) {
+	if now.After(n.CreatedAt.Add(notificationExpiration)) {
+		n.Status = model.NotificationStatusFailed
+		n.Attempts = append(n.Attempts, model.NotificationAttempt{
+			AttemptedAt: now,
+			Error:       errNotificationExpired.Error(),
+		})
+		return n, errNotificationExpired
+	}
+
+	var message messaging.Message
+	err := json.Unmarshal([]byte(n.Payload), &message)
+	if err != nil {
+		// 何度送信しても失敗するので諦める
+		n.Status = model.NotificationStatusFailed
+		n.Attempts = append(n.Attempts, model.NotificationAttempt{
+			AttemptedAt: now,
+			Error:       err.Error(),
+		})
+		return n, err
+	}
+
+	messageID, err := msgCli.Send(ctx, &message)
+	attempt := model.NotificationAttempt{
+		AttemptedAt: now,
+		MessageID:   messageID,
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	n.Attempts = append(n.Attempts, attempt)
+
+	if err == nil {
+		n.Status = model.NotificationStatusSent
+		return n, nil
+	}
+
+	if len(n.Attempts) >= notificationMaxAttempts {
+		n.Status = model.NotificationStatusFailed
+	} else {
+		n.NextAttemptAt = now.Add(retryDelay(len(n.Attempts)))
+	}
+
+	return n, err
+}
+
+// retryDelay 送信を試みた回数から次に送信するまでの時間を計算する
+func retryDelay(attempts int) time.Duration {
+	delay := retryBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMaxBackoff {
+			return retryMaxBackoff
+		}
+	}
+
+	return delay
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/messaging"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/notify"
+	"golang.org/x/xerrors"
+)
+
+// outboxTestClient 指定したエラーを順番に返すクライアント
+type outboxTestClient struct {
+	errs     []error
+	messages []*messaging.Message
+}
+
+func (c *outboxTestClient) Send(ctx context.Context, message *messaging.Message) (string, error) {
+	c.messages = append(c.messages, message)
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "projects/test/messages/1", nil
+}
+
+func TestNewNotification(t *testing.T) {
+	now := jst.Date(2020, 4, 29, 20, 0)
+	m1 := &messaging.Message{Topic: "plan", Notification: &messaging.Notification{Title: "title"}}
+	m2 := &messaging.Message{Topic: "plan", Notification: &messaging.Notification{Title: "title2"}}
+
+	n1, err := newNotification("plan/1", m1, now)
+	if err != nil {
+		t.Fatalf("Can not create notification: %v", err)
+	}
+
+	n2, _ := newNotification("plan/1", m1, now.Add(time.Minute))
+	n3, _ := newNotification("plan/2", m1, now)
+	n4, _ := newNotification("plan/1", m2, now)
+
+	if n1.ID != n2.ID {
+		t.Errorf("same key and message must have same id")
+	}
+
+	if n1.ID == n3.ID || n1.ID == n4.ID {
+		t.Errorf("different key or message must have different id")
+	}
+
+	if n1.Status != model.NotificationStatusPending || !n1.NextAttemptAt.Equal(now) {
+		t.Errorf("invalid notification: %v", n1)
+	}
+}
+
+func TestDeliverNotificationsInternal(t *testing.T) {
+	now := jst.Date(2020, 4, 29, 20, 0)
+	newTestNotification := func(title string, attempts int) model.Notification {
+		n, _ := newNotification(title, &messaging.Message{Topic: "plan", Notification: &messaging.Notification{Title: title}}, now.Add(-time.Minute))
+		for i := 0; i < attempts; i++ {
+			n.Attempts = append(n.Attempts, model.NotificationAttempt{Error: "error"})
+		}
+		return n
+	}
+	serverErr := xerrors.Errorf("%v: %w", "503", notify.ErrServerError)
+
+	tests := []struct {
+		name          string
+		errs          []error
+		notifications []model.Notification
+		statuses      []string
+		sendCount     int
+	}{
+		{
+			"success",
+			nil,
+			[]model.Notification{newTestNotification("a", 0), newTestNotification("b", 0)},
+			[]string{model.NotificationStatusSent, model.NotificationStatusSent},
+			2,
+		},
+		{
+			"retry",
+			[]error{errors.New("invalid"), nil},
+			[]model.Notification{newTestNotification("a", 0), newTestNotification("b", 0)},
+			[]string{model.NotificationStatusPending, model.NotificationStatusSent},
+			2,
+		},
+		{
+			"max attempts",
+			[]error{errors.New("invalid")},
+			[]model.Notification{newTestNotification("a", notificationMaxAttempts-1)},
+			[]string{model.NotificationStatusFailed},
+			1,
+		},
+		{
+			// サーバーエラーの場合は残りを送信しない
+			"server error",
+			[]error{serverErr},
+			[]model.Notification{newTestNotification("a", 0), newTestNotification("b", 0)},
+			[]string{model.NotificationStatusPending},
+			1,
+		},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := &outboxTestClient{errs: tt.errs}
+			var saved []model.Notification
+			deliverNotificationsInternal(ctx, cli, tt.notifications, now, func(ctx context.Context, n model.Notification) error {
+				saved = append(saved, n)
+				return nil
+			})
+
+			if len(cli.messages) != tt.sendCount {
+				t.Errorf("send count, got: %v expect: %v", len(cli.messages), tt.sendCount)
+			}
+
+			if len(saved) != len(tt.statuses) {
+				t.Fatalf("len(saved), got: %v expect: %v", len(saved), len(tt.statuses))
+			}
+
+			for i, n := range saved {
+				if n.Status != tt.statuses[i] {
+					t.Errorf("status[%v], got: %v expect: %v", i, n.Status, tt.statuses[i])
+				}
+
+				last := n.Attempts[len(n.Attempts)-1]
+				switch n.Status {
+				case model.NotificationStatusSent:
+					if last.MessageID == "" || last.Error != "" {
+						t.Errorf("invalid attempt: %v", last)
+					}
+				case model.NotificationStatusPending:
+					if last.Error == "" || !n.NextAttemptAt.Equal(now.Add(retryDelay(len(n.Attempts)))) {
+						t.Errorf("invalid retry: %v %v", last, n.NextAttemptAt)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDeliverNotificationsInternalSkip(t *testing.T) {
+	now := jst.Date(2020, 4, 29, 20, 0)
+	message := &messaging.Message{Topic: "plan"}
+	waiting, _ := newNotification("waiting", message, now)
+	waiting.NextAttemptAt = now.Add(time.Minute)
+	expired, _ := newNotification("expired", message, now.Add(-notificationExpiration-time.Minute))
+
+	cli := &outboxTestClient{}
+	var saved []model.Notification
+	deliverNotificationsInternal(context.Background(), cli, []model.Notification{waiting, expired}, now, func(ctx context.Context, n model.Notification) error {
+		saved = append(saved, n)
+		return nil
+	})
+
+	if len(cli.messages) != 0 {
+		t.Errorf("send count, got: %v", len(cli.messages))
+	}
+
+	// 古いものは送信せずに失敗にする
+	if len(saved) != 1 || saved[0].ID != expired.ID || saved[0].Status != model.NotificationStatusFailed {
+		t.Errorf("invalid saved: %v", saved)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 5 * time.Minute},
+		{2, 10 * time.Minute},
+		{3, 20 * time.Minute},
+		{4, 40 * time.Minute},
+		{5, time.Hour},
+		{10, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.expected {
+			t.Errorf("attempts: %v, got: %v expect: %v", tt.attempts, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/event"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/notify"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// remindBefore 配信開始の何分前にリマインダーを送信するか
+const remindBefore = 15 * time.Minute
+
+type markPlanEntriesAsRemindedFunc func(ctx context.Context, p model.Plan, entries []model.PlanEntry) (bool, error)
+type markVideoAsRemindedFunc func(ctx context.Context, v model.Video) (model.Video, bool, error)
+type unmarkPlanEntriesAsRemindedFunc func(ctx context.Context, p model.Plan, entries []model.PlanEntry) error
+type unmarkVideoAsRemindedFunc func(ctx context.Context, v model.Video) error
+
+func pushNotifyRemind(ctx context.Context, c *firestore.Client, notifier notify.Notifier, actors model.ActorSlice, org model.Organization) {
+	now := jst.Now()
+
+	// 25時などの計画もあるので前日の計画も対象にする
+	plans, err := store.FindPlans(ctx, c, jst.Range{
+		Begin: now.AddDay(-1).FloorToDay(),
+		End:   now.AddOneDay(),
+	})
+	if err != nil {
+		log.Printf("Can not get plans: %v", err)
+		return
+	}
+
+	videos, err := store.FindVideos(ctx, c, jst.Range{
+		Begin: now.AddDay(-1),
+		End:   now.Add(remindBefore),
+	})
+	if err != nil {
+		log.Printf("Can not get videos: %v", err)
+		return
+	}
+
+	pushNotifyRemindInternal(ctx, notifier, plans, videos, actors, org, now, func(ctx context.Context, p model.Plan, entries []model.PlanEntry) (bool, error) {
+		return store.MarkPlanEntriesAsReminded(ctx, c, p, entries)
+	}, func(ctx context.Context, v model.Video) (model.Video, bool, error) {
+		return store.MarkVideoAsReminded(ctx, c, v)
+	}, func(ctx context.Context, p model.Plan, entries []model.PlanEntry) error {
+		return store.UnmarkPlanEntriesAsReminded(ctx, c, p, entries)
+	}, func(ctx context.Context, v model.Video) error {
+		return store.UnmarkVideoAsReminded(ctx, c, v)
+	})
+}
+
+// pushNotifyRemindInternal 開始時刻のremindBefore前になった配信のリマインダーを送信する
+// 計画された配信は計画のエントリ、計画されていない配信の予約枠は動画で送信済みかを管理する
+// 送信済みの状態は送信したときの開始時刻で管理しているので、開始時刻が変わった場合は新しい開始時刻で再度送信される
+// 主な送信先に通知できなかった場合は未送信に戻して次回に再度送信する
+func pushNotifyRemindInternal(ctx context.Context, notifier notify.Notifier, plans []model.Plan, videos []model.Video, actors model.ActorSlice, org model.Organization, now jst.Time, markEntries markPlanEntriesAsRemindedFunc, markVideo markVideoAsRemindedFunc, unmarkEntries unmarkPlanEntriesAsRemindedFunc, unmarkVideo unmarkVideoAsRemindedFunc) {
+	remindRange := jst.Range{
+		Begin: now,
+		End:   now.Add(remindBefore),
+	}
+	// 開始時刻ちょうどの場合は配信の通知と重なるので送信しない
+	shouldRemind := func(startAt jst.Time) bool {
+		return remindRange.In(startAt) && startAt.After(now)
+	}
+
+	for _, p := range plans {
+		remindedCollaboIDs := map[int]bool{}
+		for i, e := range p.Entries {
+			// ハッシュタグだけのエントリは通知先のトピックが分からない
+			if e.IsUnknownActor() || e.IsReminded() || !shouldRemind(e.StartAt) {
+				continue
+			}
+
+			if e.CollaboID > 0 {
+				if remindedCollaboIDs[e.CollaboID] {
+					continue
+				}
+				remindedCollaboIDs[e.CollaboID] = true
+			}
+
+			v, found := findPlanEntryVideo(p, i, videos)
+			// 既に配信が始まっている場合は送信しない
+			if found && (v.Notified || !v.ActualStartAt.IsZero()) {
+				continue
+			}
+
+			var entries []model.PlanEntry
+			var relatedActors []model.Actor
+			for _, temp := range p.Entries {
+				if temp.IsUnknownActor() || !temp.StartAt.Equal(e.StartAt) {
+					continue
+				}
+				if e.CollaboID > 0 && temp.CollaboID != e.CollaboID {
+					continue
+				}
+				if e.CollaboID == 0 && temp.ActorID != e.ActorID {
+					continue
+				}
+
+				actor, err := actors.FindActor(temp.ActorID)
+				if err != nil {
+					log.Printf("Unknown actor %v", temp.ActorID)
+					continue
+				}
+
+				entries = append(entries, temp)
+				relatedActors = append(relatedActors, actor)
+			}
+
+			if len(entries) == 0 {
+				continue
+			}
+
+			updated, err := markEntries(ctx, p, entries)
+			if err != nil {
+				log.Printf("Can not mark plan entries as reminded: %v", err)
+				continue
+			}
+
+			if !updated {
+				continue
+			}
+
+			log.Printf("push notify remind plan: %v, %v, isCollabo:%v", p.Date, e.StartAt, e.CollaboID > 0)
+			// 動画が見つからない場合はvが空になる
+			err = notifier.Notify(ctx, notify.NewStreamUpcomingEvent(p.Date, e.StartAt, v, relatedActors))
+			if err != nil {
+				log.Printf("Can not send push notification: %v", err)
+				err = unmarkEntries(ctx, p, entries)
+				if err != nil {
+					log.Printf("Can not unmark plan entries as reminded: %v", err)
+				}
+				continue
+			}
+
+			event.Publish(event.TypeNotificationSent, event.NotificationSent{
+				Kind: "remind",
+				Date: &p.Date,
+			})
+		}
+	}
+
+	for _, v := range videos {
+		// 開始時刻が分かるのはYoutubeの予約枠だけ
+		if v.Source != model.VideoSourceYoutube || !v.IsLive || v.Notified || v.Unavailable || !v.ActualStartAt.IsZero() {
+			continue
+		}
+
+		if v.IsReminded() || !shouldRemind(v.StartAt) {
+			continue
+		}
+
+		// 計画された配信は計画のエントリで送信する
+		planned := false
+		for _, p := range plans {
+			if p.IsPlanned(v) {
+				planned = true
+				break
+			}
+		}
+		if planned {
+			continue
+		}
+
+		if org.IsOfficialVideo(v) {
+			continue
+		}
+
+		relatedActors, err := findVideoActors(v, actors)
+		if err != nil {
+			log.Printf("remind: %v", err)
+			continue
+		}
+
+		v, updated, err := markVideo(ctx, v)
+		if err != nil {
+			log.Printf("Can not mark video as reminded: %v", err)
+			continue
+		}
+
+		if !updated {
+			continue
+		}
+
+		log.Printf("push notify remind video: %v, %v", v.ID, v.StartAt)
+		err = notifier.Notify(ctx, notify.NewStreamUpcomingEvent(v.StartAt, v.StartAt, v, relatedActors))
+		if err != nil {
+			log.Printf("Can not send push notification: %v", err)
+			err = unmarkVideo(ctx, v)
+			if err != nil {
+				log.Printf("Can not unmark video as reminded: %v", err)
+			}
+			continue
+		}
+
+		event.Publish(event.TypeNotificationSent, event.NotificationSent{
+			Kind:    "remind",
+			VideoID: v.ID,
+		})
+	}
+}
+
+// findPlanEntryVideo 計画のエントリに対応する動画を探す
+// 削除されたか非公開になった動画は対象にしない
+func findPlanEntryVideo(p model.Plan, index int, videos []model.Video) (model.Video, bool) {
+	for _, v := range videos {
+		if !v.Unavailable && p.GetEntryIndex(v) == index {
+			return v, true
+		}
+	}
+
+	return model.Video{}, false
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/notify"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/plan"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/notify"
+)
+
+func TestPushNotifyRemindInternal(t *testing.T) {
+	baseDate := jst.ShortDate(2020, 4, 29)
+	plans := []model.Plan{
+		CreatePlan(baseDate, []EntryPart{
+			CreateEntryPartCollabo(Iori, 20, 0, 1),
+			CreateEntryPartCollabo(Suzu, 20, 0, 1),
+			CreateEntryPart(Pino, 22, 0),
+		}),
+	}
+
+	videos := []model.Video{
+		{
+			ID:      "video-id-1",
+			ActorID: Iori.ID,
+			StartAt: jst.Date(2020, 4, 29, 20, 0),
+			Text:    "collabo",
+			URL:     "https://1",
+			Source:  model.VideoSourceYoutube,
+			IsLive:  true,
+		},
+		{
+			ID:      "video-id-2",
+			ActorID: Siro.ID,
+			StartAt: jst.Date(2020, 4, 29, 20, 10),
+			Text:    "unplanned",
+			URL:     "https://2",
+			Source:  model.VideoSourceYoutube,
+			IsLive:  true,
+		},
+	}
+
+	tests := []struct {
+		name   string
+		now    jst.Time
+		titles []string
+		bodies []string
+	}{
+		{
+			"before",
+			jst.Date(2020, 4, 29, 19, 40),
+			nil,
+			nil,
+		},
+		{
+			"collabo",
+			jst.Date(2020, 4, 29, 19, 50),
+			[]string{"まもなくコラボ配信:🍄🍋"},
+			[]string{"20:00~ collabo"},
+		},
+		{
+			"collabo and unplanned",
+			jst.Date(2020, 4, 29, 19, 55),
+			[]string{"まもなくコラボ配信:🍄🍋", "まもなく配信:電脳少女シロ"},
+			[]string{"20:00~ collabo", "20:10~ unplanned"},
+		},
+		{
+			"started",
+			jst.Date(2020, 4, 29, 20, 0),
+			[]string{"まもなく配信:電脳少女シロ"},
+			[]string{"20:10~ unplanned"},
+		},
+		{
+			"solo",
+			jst.Date(2020, 4, 29, 21, 50),
+			[]string{"まもなく配信:カルロピノ"},
+			[]string{"22:00~"},
+		},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := &TestNotifyClient{}
+			pushNotifyRemindInternal(ctx, notify.NewFCMNotifier(cli), plans, videos, All, Organization, tt.now, func(ctx context.Context, p model.Plan, entries []model.PlanEntry) (bool, error) {
+				return true, nil
+			}, func(ctx context.Context, v model.Video) (model.Video, bool, error) {
+				return v, true, nil
+			}, func(ctx context.Context, p model.Plan, entries []model.PlanEntry) error {
+				t.Errorf("entries must not be unmarked")
+				return nil
+			}, func(ctx context.Context, v model.Video) error {
+				t.Errorf("video must not be unmarked: %v", v.ID)
+				return nil
+			})
+
+			if len(cli.Messages) != len(tt.titles) {
+				t.Fatalf("len(messages), got: %v expect: %v", len(cli.Messages), len(tt.titles))
+			}
+
+			for i, m := range cli.Messages {
+				if m.Notification.Title != tt.titles[i] {
+					t.Errorf("title, got: %v expect: %v", m.Notification.Title, tt.titles[i])
+				}
+
+				if m.Notification.Body != tt.bodies[i] {
+					t.Errorf("body, got: %v expect: %v", m.Notification.Body, tt.bodies[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPushNotifyRemindInternalReminded(t *testing.T) {
+	d := jst.Date(2020, 4, 29, 20, 0)
+	videos := []model.Video{
+		{
+			ID:              "reminded",
+			ActorID:         Siro.ID,
+			StartAt:         d,
+			RemindedStartAt: d,
+			Source:          model.VideoSourceYoutube,
+			IsLive:          true,
+		},
+		{
+			ID:              "rescheduled",
+			ActorID:         Pino.ID,
+			StartAt:         d,
+			RemindedStartAt: jst.Date(2020, 4, 29, 19, 0),
+			Source:          model.VideoSourceYoutube,
+			IsLive:          true,
+		},
+	}
+
+	cli := &TestNotifyClient{}
+	pushNotifyRemindInternal(context.Background(), notify.NewFCMNotifier(cli), nil, videos, All, Organization, jst.Date(2020, 4, 29, 19, 50), nil, func(ctx context.Context, v model.Video) (model.Video, bool, error) {
+		return v, true, nil
+	}, nil, func(ctx context.Context, v model.Video) error {
+		t.Errorf("video must not be unmarked: %v", v.ID)
+		return nil
+	})
+
+	// 開始時刻が変わった場合は再度送信する
+	if len(cli.Messages) != 1 {
+		t.Fatalf("len(messages), got: %v", len(cli.Messages))
+	}
+
+	if cli.Messages[0].Notification.Title != "まもなく配信:カルロピノ" {
+		t.Errorf("title, got: %v", cli.Messages[0].Notification.Title)
+	}
+}
+
+func TestPushNotifyRemindInternalFailure(t *testing.T) {
+	d := jst.ShortDate(2020, 4, 29)
+	plans := []model.Plan{
+		CreatePlan(d, []EntryPart{
+			CreateEntryPart(Siro, 20, 0),
+		}),
+	}
+	videos := []model.Video{
+		{
+			ID:      "pino",
+			ActorID: Pino.ID,
+			StartAt: jst.Date(2020, 4, 29, 20, 0),
+			Source:  model.VideoSourceYoutube,
+			IsLive:  true,
+		},
+	}
+
+	var unmarkedEntries []string
+	var unmarkedVideos []string
+	pushNotifyRemindInternal(context.Background(), notify.MultiNotifier{failNotifier{}}, plans, videos, All, Organization, jst.Date(2020, 4, 29, 19, 50), func(ctx context.Context, p model.Plan, entries []model.PlanEntry) (bool, error) {
+		return true, nil
+	}, func(ctx context.Context, v model.Video) (model.Video, bool, error) {
+		return v, true, nil
+	}, func(ctx context.Context, p model.Plan, entries []model.PlanEntry) error {
+		for _, e := range entries {
+			unmarkedEntries = append(unmarkedEntries, e.ActorID)
+		}
+		return nil
+	}, func(ctx context.Context, v model.Video) error {
+		unmarkedVideos = append(unmarkedVideos, v.ID)
+		return nil
+	})
+
+	// 主な送信先に通知できなかった場合は次回に送信するために未送信に戻す
+	if len(unmarkedEntries) != 1 || unmarkedEntries[0] != Siro.ID {
+		t.Errorf("unmarked entries, got: %v", unmarkedEntries)
+	}
+
+	if len(unmarkedVideos) != 1 || unmarkedVideos[0] != "pino" {
+		t.Errorf("unmarked videos, got: %v", unmarkedVideos)
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/event"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/notify"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// rescheduleThreshold 開始時刻の変更を通知する変更幅
+// 予約枠の開始時刻は数分だけずらされることも多いので小さい変更は通知しない
+const rescheduleThreshold = 30 * time.Minute
+
+// VideoScheduleChange 配信前の動画の予定の変更
+type VideoScheduleChange struct {
+	// Video 変更後の動画
+	// 削除されたか非公開になった場合はVideo.Unavailableがtrue
+	Video model.Video
+	// OldVideo 変更前に保存されていた動画
+	// 通知できなかった場合は次回に再度変更を検出できるようにこの状態に戻す
+	OldVideo model.Video
+}
+
+// PushNotifyVideoScheduleChanges 配信前の動画の大きな予定の変更をプッシュ通知する
+// 送信はアウトボックスを経由するのでPushNotifyより前に呼び出す
+func PushNotifyVideoScheduleChanges(ctx context.Context, c *firestore.Client, changes []VideoScheduleChange, actors model.ActorSlice, org model.Organization) {
+	if len(changes) == 0 {
+		return
+	}
+
+	pushNotifyVideoScheduleChangesInternal(ctx, newNotifier(ctx, c), changes, actors, org, func(ctx context.Context, v model.Video) error {
+		_, _, err := store.SaveVideo(ctx, c, v, nil)
+		return err
+	})
+}
+
+type restoreVideoFunc func(ctx context.Context, v model.Video) error
+
+// pushNotifyVideoScheduleChangesInternal 予定の変更を通知する
+// 主な送信先に通知できなかった場合は変更前の動画に戻して次回に再度通知する
+func pushNotifyVideoScheduleChangesInternal(ctx context.Context, notifier notify.Notifier, changes []VideoScheduleChange, actors model.ActorSlice, org model.Organization, restoreVideo restoreVideoFunc) {
+	for _, change := range changes {
+		v := change.Video
+		oldStartAt := change.OldVideo.StartAt
+		if !v.Unavailable && !isSignificantReschedule(oldStartAt, v.StartAt) {
+			continue
+		}
+
+		if org.IsOfficialVideo(v) {
+			// 公式チャンネルの動画は誰が出演しているか取得できないので通知できない
+			continue
+		}
+
+		relatedActors, err := findVideoActors(v, actors)
+		if err != nil {
+			log.Printf("notify schedule change: %v", err)
+			continue
+		}
+
+		var e notify.Event
+		var kind string
+		if v.Unavailable {
+			e = notify.NewStreamCanceledEvent(v.StartAt, v, relatedActors)
+			kind = "canceled"
+		} else {
+			e = notify.NewStreamRescheduledEvent(v.StartAt, v, oldStartAt, relatedActors)
+			kind = "rescheduled"
+		}
+
+		log.Printf("push notify video %v: %v, %v -> %v", kind, v.ID, oldStartAt, v.StartAt)
+		err = notifier.Notify(ctx, e)
+		if err != nil {
+			log.Printf("Can not send push notification: %v", err)
+			err = restoreVideo(ctx, change.OldVideo)
+			if err != nil {
+				log.Printf("Can not restore video %v: %v", v.ID, err)
+			}
+			continue
+		}
+
+		event.Publish(event.TypeNotificationSent, event.NotificationSent{
+			Kind:    kind,
+			VideoID: v.ID,
+		})
+	}
+}
+
+// isSignificantReschedule 通知するほどの開始時刻の変更かどうか
+// 日付が変わる場合は変更幅に関係なく通知する
+func isSignificantReschedule(oldStartAt, newStartAt jst.Time) bool {
+	if oldStartAt.IsZero() || oldStartAt.Equal(newStartAt) {
+		return false
+	}
+
+	if !oldStartAt.FloorToDay().Equal(newStartAt.FloorToDay()) {
+		return true
+	}
+
+	d := newStartAt.Time().Sub(oldStartAt.Time())
+	if d < 0 {
+		d = -d
+	}
+
+	return d >= rescheduleThreshold
+}
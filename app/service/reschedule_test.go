@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/notify"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/notify"
+)
+
+func TestIsSignificantReschedule(t *testing.T) {
+	d := jst.Date(2020, 4, 29, 20, 0)
+	tests := []struct {
+		name       string
+		newStartAt jst.Time
+		expected   bool
+	}{
+		{"same", d, false},
+		{"small", jst.Date(2020, 4, 29, 20, 10), false},
+		{"later", jst.Date(2020, 4, 29, 20, 30), true},
+		{"earlier", jst.Date(2020, 4, 29, 19, 0), true},
+		{"next day", jst.Date(2020, 4, 29, 24, 10), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSignificantReschedule(d, tt.newStartAt); got != tt.expected {
+				t.Errorf("got: %v expect: %v", got, tt.expected)
+			}
+		})
+	}
+
+	if isSignificantReschedule(jst.Time{}, d) {
+		t.Errorf("zero old startAt must not be significant")
+	}
+
+	// 変更幅が小さくても日付が変わる場合は通知する
+	if !isSignificantReschedule(jst.Date(2020, 4, 29, 23, 50), jst.Date(2020, 4, 30, 0, 5)) {
+		t.Errorf("day boundary must be significant")
+	}
+}
+
+func TestPushNotifyVideoScheduleChangesInternal(t *testing.T) {
+	changes := []VideoScheduleChange{
+		{
+			Video: model.Video{
+				ID:      "small",
+				ActorID: Siro.ID,
+				StartAt: jst.Date(2020, 4, 29, 20, 10),
+				Text:    "small",
+				Source:  model.VideoSourceYoutube,
+			},
+			OldVideo: model.Video{StartAt: jst.Date(2020, 4, 29, 20, 0)},
+		},
+		{
+			Video: model.Video{
+				ID:      "later",
+				ActorID: Iori.ID,
+				StartAt: jst.Date(2020, 4, 29, 22, 0),
+				Text:    "later",
+				Source:  model.VideoSourceYoutube,
+			},
+			OldVideo: model.Video{StartAt: jst.Date(2020, 4, 29, 21, 0)},
+		},
+		{
+			Video: model.Video{
+				ID:          "unavailable",
+				ActorID:     Pino.ID,
+				StartAt:     jst.Date(2020, 4, 29, 23, 0),
+				Text:        "unavailable",
+				Source:      model.VideoSourceYoutube,
+				Unavailable: true,
+			},
+			OldVideo: model.Video{StartAt: jst.Date(2020, 4, 29, 23, 0)},
+		},
+	}
+
+	cli := &TestNotifyClient{}
+	pushNotifyVideoScheduleChangesInternal(context.Background(), notify.NewFCMNotifier(cli), changes, All, Organization, func(ctx context.Context, v model.Video) error {
+		t.Errorf("video must not be restored: %v", v.ID)
+		return nil
+	})
+
+	expects := []struct {
+		title string
+		body  string
+	}{
+		{"時間変更:配信:ヤマトイオリ", "21:00~ → 22:00~ later"},
+		{"中止:配信:カルロピノ", "23:00~ unavailable"},
+	}
+	if len(cli.Messages) != len(expects) {
+		t.Fatalf("len(messages), got: %v expect: %v", len(cli.Messages), len(expects))
+	}
+
+	for i, m := range cli.Messages {
+		if m.Notification.Title != expects[i].title {
+			t.Errorf("title, got: %v expect: %v", m.Notification.Title, expects[i].title)
+		}
+
+		if m.Notification.Body != expects[i].body {
+			t.Errorf("body, got: %v expect: %v", m.Notification.Body, expects[i].body)
+		}
+	}
+}
+
+func TestPushNotifyVideoScheduleChangesInternalFailure(t *testing.T) {
+	changes := []VideoScheduleChange{
+		{
+			Video: model.Video{
+				ID:      "later",
+				ActorID: Iori.ID,
+				StartAt: jst.Date(2020, 4, 29, 22, 0),
+				Source:  model.VideoSourceYoutube,
+			},
+			OldVideo: model.Video{
+				ID:      "later",
+				ActorID: Iori.ID,
+				StartAt: jst.Date(2020, 4, 29, 21, 0),
+				Source:  model.VideoSourceYoutube,
+			},
+		},
+	}
+
+	var restored []model.Video
+	pushNotifyVideoScheduleChangesInternal(context.Background(), notify.MultiNotifier{failNotifier{}}, changes, All, Organization, func(ctx context.Context, v model.Video) error {
+		restored = append(restored, v)
+		return nil
+	})
+
+	// 主な送信先に通知できなかった場合は次回に変更を検出できるように変更前の動画に戻す
+	if len(restored) != 1 || !restored[0].StartAt.Equal(jst.Date(2020, 4, 29, 21, 0)) {
+		t.Errorf("restored, got: %+v", restored)
+	}
+}
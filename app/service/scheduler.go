@@ -14,7 +14,7 @@ import (
 )
 
 // CreateSchedule スケジュールを作成する
-func CreateSchedule(ctx context.Context, c *firestore.Client, date jst.Time, actors []model.Actor) (model.Schedule, error) {
+func CreateSchedule(ctx context.Context, c *firestore.Client, date jst.Time, actors []model.Actor, org model.Organization) (model.Schedule, error) {
 	date = date.FloorToDay()
 
 	// スケジュールを作成するためには前日の情報、翌日の12時までの情報が必要
@@ -33,10 +33,93 @@ func CreateSchedule(ctx context.Context, c *firestore.Client, date jst.Time, act
 		return model.Schedule{}, err
 	}
 
-	s := createScheduleInternal(date.FloorToDay(), plans, videos, actors)
+	s := createScheduleInternal(date.FloorToDay(), plans, videos, actors, org)
 	return s, nil
 }
 
+// CreateScheduleInLocation 指定したタイムゾーンの1日のスケジュールを作成する
+// 計画はJSTの日付で定義されているのでJSTの複数日のスケジュールから対象の日のエントリを集める
+func CreateScheduleInLocation(ctx context.Context, c *firestore.Client, date jst.Time, actors []model.Actor, org model.Organization, loc *time.Location) (model.Schedule, error) {
+	if jst.IsJST(loc) {
+		return CreateSchedule(ctx, c, date.JST(), actors, org)
+	}
+
+	dayRange := createDayRangeInLocation(date, loc)
+	jstBegin := dayRange.Begin.JST().FloorToDay().AddDay(-1)
+	jstEnd := dayRange.End.JST().FloorToDay()
+
+	r := jst.Range{
+		Begin: jstBegin.AddDay(-1),
+		End:   jstEnd.AddOneDay().Add(time.Hour * 12),
+	}
+
+	plans, err := store.FindPlans(ctx, c, r)
+	if err != nil && err != common.ErrNotFound {
+		return model.Schedule{}, err
+	}
+
+	videos, err := store.FindVideos(ctx, c, r)
+	if err != nil && err != common.ErrNotFound {
+		return model.Schedule{}, err
+	}
+
+	return createScheduleInLocationInternal(date, loc, plans, videos, actors, org), nil
+}
+
+// createDayRangeInLocation 指定したタイムゾーンでの1日の範囲を作成する
+func createDayRangeInLocation(date jst.Time, loc *time.Location) jst.Range {
+	d := date.In(loc)
+	return jst.Range{
+		Begin: jst.ShortDateIn(d.Year(), d.Month(), d.Day(), loc),
+		End:   jst.ShortDateIn(d.Year(), d.Month(), d.Day()+1, loc).Add(-1 * time.Second),
+	}
+}
+
+func createScheduleInLocationInternal(date jst.Time, loc *time.Location, plans []model.Plan, videos []model.Video, actors []model.Actor, org model.Organization) model.Schedule {
+	dayRange := createDayRangeInLocation(date, loc)
+
+	s := model.Schedule{
+		Date:    dayRange.Begin,
+		Entries: []model.ScheduleEntry{},
+	}
+
+	// 25時などの指定があるため前日のJSTのスケジュールも対象にする
+	jstBegin := dayRange.Begin.JST().FloorToDay().AddDay(-1)
+	jstEnd := dayRange.End.JST().FloorToDay()
+	for d := jstBegin; !d.After(jstEnd); d = d.AddOneDay() {
+		temp := createScheduleInternal(d, plans, videos, actors, org)
+		// 元ツイートは同じ日付のJSTの計画のものにする
+		if d.Year() == dayRange.Begin.Year() && d.Month() == dayRange.Begin.Month() && d.Day() == dayRange.Begin.Day() {
+			s.TweetID = temp.TweetID
+		}
+
+	OUTER:
+		for _, e := range temp.Entries {
+			if !dayRange.In(e.StartAt) {
+				continue
+			}
+
+			// 25時などで延長されたスケジュールの範囲は翌日のスケジュールと重なる
+			if e.VideoID != "" {
+				for _, added := range s.Entries {
+					if added.VideoID == e.VideoID && added.ActorName == e.ActorName {
+						continue OUTER
+					}
+				}
+			}
+
+			e.StartAt = e.StartAt.In(loc)
+			s.Entries = append(s.Entries, e)
+		}
+	}
+
+	sort.SliceStable(s.Entries, func(i, j int) bool {
+		return s.Entries[i].StartAt.Before(s.Entries[j].StartAt)
+	})
+
+	return s
+}
+
 func createEmptySchedule(date jst.Time) model.Schedule {
 	return model.Schedule{
 		Date:    date.FloorToDay(),
@@ -89,7 +172,7 @@ func createMultiPlan(date jst.Time, plans []model.Plan) multiPlan {
 	return result
 }
 
-func createScheduleInternal(date jst.Time, plans []model.Plan, videos []model.Video, actors []model.Actor) model.Schedule {
+func createScheduleInternal(date jst.Time, plans []model.Plan, videos []model.Video, actors []model.Actor, org model.Organization) model.Schedule {
 	plan := createMultiPlan(date, plans)
 
 	scheduleRange := jst.Range{
@@ -107,18 +190,19 @@ func createScheduleInternal(date jst.Time, plans []model.Plan, videos []model.Vi
 	entries := []model.ScheduleEntry{}
 	var addedPlanEntries []int
 
-	const dotliveIcon = "https://pbs.twimg.com/profile_images/953977243251822593/tglswtot.jpg"
 	addScheduleEntry := func(index int, v model.Video) {
 		var actorName string
 		var icon string
 		var startAt jst.Time
 		var collaboID int
 		var isPlanned bool
+		var actorIDs []string
+		var channel string
 
 		if index < 0 {
 			if v.IsUnknownActor() {
 				actorName = v.OwnerName
-				icon = dotliveIcon
+				icon = org.FallbackIcon
 			} else {
 				actor, err := findActorByID(actors, v.ActorID)
 				if err != nil {
@@ -127,14 +211,14 @@ func createScheduleInternal(date jst.Time, plans []model.Plan, videos []model.Vi
 				}
 				actorName = actor.Name
 				icon = actor.Icon
+				channel = videoChannelKind(actor, v)
 			}
 			startAt = v.StartAt
 			collaboID = 0
 			isPlanned = false
+			actorIDs = mergeActorIDs(videoActorIDs(v))
 
-			// シロちゃんの動画は常に計画されているとする
-			const siroID = "lLhToxu1Kyxuwwygh0FK"
-			if v.ActorID == siroID && !v.IsLive {
+			if model.ActorSlice(actors).IsPlannedUpload(v) {
 				isPlanned = true
 			}
 		} else {
@@ -157,7 +241,7 @@ func createScheduleInternal(date jst.Time, plans []model.Plan, videos []model.Vi
 
 			if pe.IsUnknownActor() {
 				actorName = pe.HashTag
-				icon = dotliveIcon
+				icon = org.FallbackIcon
 			} else if v.IsUnknownActor() {
 				relatedActor, err := findActorByID(actors, v.RelatedActorID)
 				if err != nil {
@@ -175,9 +259,11 @@ func createScheduleInternal(date jst.Time, plans []model.Plan, videos []model.Vi
 				}
 				actorName = actor.Name
 				icon = actor.Icon
+				channel = videoChannelKind(actor, v)
 			}
 			collaboID = pe.CollaboID
 			isPlanned = true
+			actorIDs = mergeActorIDs([]string{pe.ActorID}, videoActorIDs(v))
 		}
 
 		se := model.ScheduleEntry{
@@ -191,8 +277,14 @@ func createScheduleInternal(date jst.Time, plans []model.Plan, videos []model.Vi
 			URL:        v.URL,
 			VideoID:    v.ID,
 			Source:     v.Source,
+			Channel:    channel,
 			MemberOnly: v.MemberOnly,
 			CollaboID:  collaboID,
+			ActorIDs:   actorIDs,
+		}
+		// 計画の時間で表示している場合は最初の開始時刻と同じになることがある
+		if !v.OriginalStartAt.IsZero() && !v.OriginalStartAt.Equal(startAt) {
+			se.OriginalStartAt = v.OriginalStartAt
 		}
 		entries = append(entries, se)
 	}
@@ -204,6 +296,12 @@ func createScheduleInternal(date jst.Time, plans []model.Plan, videos []model.Vi
 	})
 
 	for _, v := range videos {
+		// 削除されたか非公開になった動画は表示しない
+		// 計画された配信の場合は計画のエントリだけが表示される
+		if v.Unavailable {
+			continue
+		}
+
 		// 前日に予定された配信かどうか
 		if plan.isPrevPlanned(v) {
 			continue
@@ -242,7 +340,7 @@ LOOP_ENTRIES:
 		var icon string
 		if e.IsUnknownActor() {
 			actorName = e.HashTag
-			icon = dotliveIcon
+			icon = org.FallbackIcon
 		} else {
 			actor, err := findActorByID(actors, e.ActorID)
 			if err != nil {
@@ -262,6 +360,7 @@ LOOP_ENTRIES:
 			Source:    e.Source,
 			Note:      createNote(true, e.MemberOnly, e.Source),
 			CollaboID: e.CollaboID,
+			ActorIDs:  mergeActorIDs([]string{e.ActorID}),
 		}
 
 		entries = append(entries, se)
@@ -287,10 +386,24 @@ LOOP_ENTRIES:
 			temp := collaboEntry
 			temp.ActorName = target.ActorName
 			temp.Icon = target.Icon
+			temp.ActorIDs = mergeActorIDs(target.ActorIDs, collaboEntry.ActorIDs)
 			entries[i] = temp
 		}
 	}
 
+	// コラボの参加者はチャンネル主の動画からは分からないので同じコラボのエントリの参加者をまとめる
+	collaboActorIDs := map[int][]string{}
+	for _, e := range entries {
+		if e.CollaboID > 0 {
+			collaboActorIDs[e.CollaboID] = mergeActorIDs(collaboActorIDs[e.CollaboID], e.ActorIDs)
+		}
+	}
+	for i, e := range entries {
+		if e.CollaboID > 0 {
+			entries[i].ActorIDs = collaboActorIDs[e.CollaboID]
+		}
+	}
+
 	sort.Slice(entries, func(i, j int) bool {
 		return entries[i].StartAt.Before(entries[j].StartAt)
 	})
@@ -312,6 +425,36 @@ func findActorByID(actors []model.Actor, id string) (model.Actor, error) {
 	return model.Actor{}, common.ErrNotFound
 }
 
+// videoActorIDs 動画に関連する配信者のID
+func videoActorIDs(v model.Video) []string {
+	ids := []string{v.ActorID, v.RelatedActorID}
+	return append(ids, v.RelatedActorIDs...)
+}
+
+// mergeActorIDs 配信者IDをまとめる
+// 重複と配信者が分からないIDは取り除く
+func mergeActorIDs(idsList ...[]string) []string {
+	result := []string{}
+	for _, ids := range idsList {
+	OUTER:
+		for _, id := range ids {
+			if id == "" || id == model.ActorIDUnknown {
+				continue
+			}
+
+			for _, added := range result {
+				if added == id {
+					continue OUTER
+				}
+			}
+
+			result = append(result, id)
+		}
+	}
+
+	return result
+}
+
 func createNote(isPlanned bool, memberOnly bool, source string) string {
 	if source == model.VideoSourceYoutube {
 		if memberOnly {
@@ -329,3 +472,13 @@ func createNote(isPlanned bool, memberOnly bool, source string) string {
 
 	return " (" + source + ")"
 }
+
+// videoChannelKind 動画が配信者のメインチャンネルのものかサブチャンネルのものかを取得する
+// チャンネルIDが保存される前の動画はメインチャンネルしか対象にしていなかったのでメインとする
+func videoChannelKind(actor model.Actor, v model.Video) string {
+	if v.ChannelID == "" {
+		return model.ChannelKindMain
+	}
+
+	return actor.ChannelKind(v.Source, v.ChannelID)
+}
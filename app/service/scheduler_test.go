@@ -4,6 +4,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
 	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/plan"
@@ -213,7 +214,7 @@ func TestCreateScheduleInternal(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := createScheduleInternal(tt.schedule.Date, getPlans(tt.planRange), getVideos(tt.videoRange), All)
+			s := createScheduleInternal(tt.schedule.Date, getPlans(tt.planRange), getVideos(tt.videoRange), All, Organization)
 			compareSchedule(t, s, tt.schedule)
 		})
 	}
@@ -252,7 +253,7 @@ func TestCreateScheduleInternal(t *testing.T) {
 				StartAt: jst.Date(2020, 6, 7, 0, 15),
 			},
 		}
-		s := createScheduleInternal(d, []model.Plan{p}, vs, All)
+		s := createScheduleInternal(d, []model.Plan{p}, vs, All, Organization)
 		compareSchedule(t, s, createScheduleForTest(jst.ShortDate(2020, 6, 6), []scheduleEntryPart{
 			createScheduleEntryPart(Suzu.Name, true, "suzu", 21, 0),
 			createScheduleEntryPartMildom(Chieri.Name, true, "chieri", 22, 0),
@@ -263,7 +264,7 @@ func TestCreateScheduleInternal(t *testing.T) {
 			CreateEntryPartMildom(Chieri, 22, 0),
 			CreateEntryPart(Mememe, 24, 15),
 		})
-		s = createScheduleInternal(d, []model.Plan{p}, vs, All)
+		s = createScheduleInternal(d, []model.Plan{p}, vs, All, Organization)
 		compareSchedule(t, s, createScheduleForTest(jst.ShortDate(2020, 6, 6), []scheduleEntryPart{
 			createScheduleEntryPart(Suzu.Name, true, "suzu", 21, 0),
 			createScheduleEntryPartMildom(Chieri.Name, true, "chieri", 22, 0),
@@ -301,7 +302,7 @@ func TestCreateScheduleInternal(t *testing.T) {
 				StartAt: jst.Date(2020, 4, 29, 22, 0),
 			},
 		}
-		s := createScheduleInternal(d, []model.Plan{p}, vs, All)
+		s := createScheduleInternal(d, []model.Plan{p}, vs, All, Organization)
 		// 枠取り直した場合はチャンネル主のエントリだけ作られている
 		// 2つ以上のコラボがあったときに正しく処理されている
 		compareSchedule(t, s, createScheduleForTest(jst.ShortDate(2020, 4, 29), []scheduleEntryPart{
@@ -325,7 +326,7 @@ func TestCreateScheduleInternal(t *testing.T) {
 				StartAt: jst.Date(2020, 7, 28, 23, 0),
 			},
 		}
-		s := createScheduleInternal(d, []model.Plan{p}, vs, All)
+		s := createScheduleInternal(d, []model.Plan{p}, vs, All, Organization)
 		compareSchedule(t, s, createScheduleForTest(jst.ShortDate(2020, 7, 28), []scheduleEntryPart{
 			createScheduleEntryPart(Iori.Name, false, "io", 23, 0),
 		}))
@@ -762,3 +763,304 @@ func createScheduleForTest(d jst.Time, parts []scheduleEntryPart) model.Schedule
 		Entries: entries,
 	}
 }
+
+func TestCreateScheduleInLocationInternal(t *testing.T) {
+	plans := []model.Plan{
+		CreatePlan(jst.ShortDate(2020, 4, 28), []EntryPart{
+			CreateEntryPart(Suzu, 22, 0),
+			CreateEntryPart(Pino, 25, 0),
+		}),
+		CreatePlan(jst.ShortDate(2020, 4, 29), []EntryPart{
+			CreateEntryPart(Iori, 12, 0),
+			CreateEntryPart(Natori, 20, 0),
+		}),
+	}
+	videos := []model.Video{
+		{
+			ID:      "pino",
+			ActorID: Pino.ID,
+			Source:  model.VideoSourceYoutube,
+			StartAt: jst.Date(2020, 4, 29, 1, 0),
+		},
+		{
+			ID:      "futaba",
+			ActorID: Futaba.ID,
+			Source:  model.VideoSourceYoutube,
+			StartAt: jst.Date(2020, 4, 29, 0, 30),
+		},
+	}
+
+	// UTCの4/28は日本時間の4/28 9:00から4/29 8:59まで
+	s := createScheduleInLocationInternal(jst.Date(2020, 4, 28, 12, 0), time.UTC, plans, videos, All, Organization)
+	if s.Date.Location() != time.UTC || s.Date.Day() != 28 || s.Date.Hour() != 0 {
+		t.Errorf("date, got: %v", s.Date)
+	}
+
+	expect := []struct {
+		name string
+		hour int
+	}{
+		{Suzu.Name, 13},
+		{Futaba.Name, 15},
+		{Pino.Name, 16},
+	}
+
+	if len(s.Entries) != len(expect) {
+		t.Fatalf("len(entries), got: %v expect: %v", len(s.Entries), len(expect))
+	}
+
+	for i, e := range expect {
+		got := s.Entries[i]
+		if got.ActorName != e.name {
+			t.Errorf("ActorName, got: %v expect: %v", got.ActorName, e.name)
+		}
+
+		if got.StartAt.Location() != time.UTC || got.StartAt.Hour() != e.hour {
+			t.Errorf("StartAt, got: %v expect hour: %v", got.StartAt, e.hour)
+		}
+	}
+}
+
+func TestCreateScheduleInternalActorIDs(t *testing.T) {
+	d := jst.ShortDate(2020, 4, 29)
+	p := CreatePlan(d, []EntryPart{
+		CreateEntryPart(Natori, 18, 0),
+		CreateEntryPartCollabo(Iori, 20, 0, 1),
+		CreateEntryPartCollabo(Suzu, 20, 0, 1),
+	})
+	vs := []model.Video{
+		{
+			ID:      "iosu",
+			ActorID: Iori.ID,
+			Source:  model.VideoSourceYoutube,
+			StartAt: jst.Date(2020, 4, 29, 20, 0),
+		},
+		{
+			ID:             "external",
+			ActorID:        model.ActorIDUnknown,
+			RelatedActorID: Pino.ID,
+			OwnerName:      "外部チャンネル",
+			Source:         model.VideoSourceYoutube,
+			StartAt:        jst.Date(2020, 4, 29, 23, 0),
+		},
+	}
+	s := createScheduleInternal(d, []model.Plan{p}, vs, All, Organization)
+
+	expect := map[string][]string{
+		Natori.Name: {Natori.ID},
+		Iori.Name:   {Iori.ID, Suzu.ID},
+		Suzu.Name:   {Iori.ID, Suzu.ID},
+		"外部チャンネル":   {Pino.ID},
+	}
+	if len(s.Entries) != len(expect) {
+		t.Fatalf("len(entries), got: %v expect: %v", len(s.Entries), len(expect))
+	}
+
+	for _, e := range s.Entries {
+		ids, ok := expect[e.ActorName]
+		if !ok {
+			t.Errorf("unexpected entry: %v", e.ActorName)
+			continue
+		}
+
+		if strings.Join(e.ActorIDs, ",") != strings.Join(ids, ",") {
+			t.Errorf("%v ActorIDs, got: %v expect: %v", e.ActorName, e.ActorIDs, ids)
+		}
+	}
+}
+
+func TestCreateScheduleInternalRescheduled(t *testing.T) {
+	d := jst.ShortDate(2020, 4, 29)
+	p := CreatePlan(d, []EntryPart{
+		CreateEntryPart(Natori, 18, 0),
+	})
+	vs := []model.Video{
+		{
+			ID:              "natori",
+			ActorID:         Natori.ID,
+			Source:          model.VideoSourceYoutube,
+			StartAt:         jst.Date(2020, 4, 29, 18, 10),
+			OriginalStartAt: jst.Date(2020, 4, 29, 18, 0),
+		},
+		{
+			ID:              "iori",
+			ActorID:         Iori.ID,
+			Source:          model.VideoSourceYoutube,
+			StartAt:         jst.Date(2020, 4, 29, 21, 0),
+			OriginalStartAt: jst.Date(2020, 4, 29, 20, 0),
+		},
+		{
+			ID:          "unavailable",
+			ActorID:     Pino.ID,
+			Source:      model.VideoSourceYoutube,
+			StartAt:     jst.Date(2020, 4, 29, 22, 0),
+			Unavailable: true,
+		},
+	}
+	s := createScheduleInternal(d, []model.Plan{p}, vs, All, Organization)
+
+	expect := []struct {
+		videoID         string
+		originalStartAt jst.Time
+	}{
+		// 計画の時間で表示する場合は最初の開始時刻と同じなので表示しない
+		{"natori", jst.Time{}},
+		{"iori", jst.Date(2020, 4, 29, 20, 0)},
+	}
+	if len(s.Entries) != len(expect) {
+		t.Fatalf("len(entries), got: %v expect: %v", len(s.Entries), len(expect))
+	}
+
+	for i, ex := range expect {
+		e := s.Entries[i]
+		if e.VideoID != ex.videoID || !e.OriginalStartAt.Equal(ex.originalStartAt) {
+			t.Errorf("entries[%v], got: %v %v expect: %v %v", i, e.VideoID, e.OriginalStartAt, ex.videoID, ex.originalStartAt)
+		}
+	}
+}
+
+func TestCreateScheduleInternalOrganization(t *testing.T) {
+	d := jst.ShortDate(2020, 4, 29)
+	p := CreatePlan(d, []EntryPart{
+		CreateEntryPartHashTag("#どっとライブ", 12, 0),
+	})
+	vs := []model.Video{
+		{
+			ID:      "siro-upload",
+			ActorID: Siro.ID,
+			Source:  model.VideoSourceYoutube,
+			StartAt: jst.Date(2020, 4, 29, 18, 0),
+		},
+		{
+			ID:      "siro-live",
+			ActorID: Siro.ID,
+			Source:  model.VideoSourceYoutube,
+			IsLive:  true,
+			StartAt: jst.Date(2020, 4, 29, 19, 0),
+		},
+		{
+			ID:      "pino-upload",
+			ActorID: Pino.ID,
+			Source:  model.VideoSourceYoutube,
+			StartAt: jst.Date(2020, 4, 29, 20, 0),
+		},
+		{
+			ID:        "official",
+			ActorID:   model.ActorIDUnknown,
+			OwnerName: Organization.YoutubeChannelName,
+			Source:    model.VideoSourceYoutube,
+			StartAt:   jst.Date(2020, 4, 29, 21, 0),
+		},
+	}
+	s := createScheduleInternal(d, []model.Plan{p}, vs, All, Organization)
+
+	expect := []struct {
+		name    string
+		icon    string
+		planned bool
+	}{
+		{"#どっとライブ", Organization.FallbackIcon, true},
+		// UploadsArePlannedが設定されている配信者の動画は計画されていなくても計画された配信になる
+		{Siro.Name, Siro.Icon, true},
+		{Siro.Name, Siro.Icon, false},
+		{Pino.Name, Pino.Icon, false},
+		{Organization.YoutubeChannelName, Organization.FallbackIcon, false},
+	}
+	if len(s.Entries) != len(expect) {
+		t.Fatalf("len(entries), got: %v expect: %v", len(s.Entries), len(expect))
+	}
+
+	for i, ex := range expect {
+		e := s.Entries[i]
+		if e.ActorName != ex.name || e.Icon != ex.icon || e.Planned != ex.planned {
+			t.Errorf("entries[%v], got: %v %v %v expect: %v %v %v", i, e.ActorName, e.Icon, e.Planned, ex.name, ex.icon, ex.planned)
+		}
+	}
+}
+
+func TestCreateScheduleInternalSubChannel(t *testing.T) {
+	d := jst.ShortDate(2020, 4, 29)
+	pino := Pino
+	pino.YoutubeChannelID = "pino-main"
+	pino.SubChannels = []model.Channel{
+		{Source: model.VideoSourceYoutube, ID: "pino-sub"},
+	}
+	actors := []model.Actor{pino}
+
+	p := CreatePlan(d, []EntryPart{
+		CreateEntryPart(pino, 20, 0),
+	})
+	vs := []model.Video{
+		{
+			ID:        "main",
+			ActorID:   pino.ID,
+			Source:    model.VideoSourceYoutube,
+			ChannelID: "pino-main",
+			IsLive:    true,
+			StartAt:   jst.Date(2020, 4, 29, 18, 0),
+		},
+		{
+			ID:        "sub",
+			ActorID:   pino.ID,
+			Source:    model.VideoSourceYoutube,
+			ChannelID: "pino-sub",
+			IsLive:    true,
+			StartAt:   jst.Date(2020, 4, 29, 20, 0),
+		},
+		{
+			// チャンネルIDが保存される前の動画
+			ID:      "old",
+			ActorID: pino.ID,
+			Source:  model.VideoSourceYoutube,
+			IsLive:  true,
+			StartAt: jst.Date(2020, 4, 29, 22, 0),
+		},
+	}
+	s := createScheduleInternal(d, []model.Plan{p}, vs, actors, Organization)
+
+	expect := []struct {
+		videoID string
+		channel string
+	}{
+		{"main", model.ChannelKindMain},
+		{"sub", model.ChannelKindSub},
+		{"old", model.ChannelKindMain},
+	}
+	if len(s.Entries) != len(expect) {
+		t.Fatalf("len(entries), got: %v expect: %v", len(s.Entries), len(expect))
+	}
+
+	for i, ex := range expect {
+		e := s.Entries[i]
+		if e.VideoID != ex.videoID || e.Channel != ex.channel {
+			t.Errorf("entries[%v], got: %v %v expect: %v %v", i, e.VideoID, e.Channel, ex.videoID, ex.channel)
+		}
+	}
+}
+
+func TestCreateScheduleInternalGraduatedActor(t *testing.T) {
+	siro := Siro
+	siro.Status = model.ActorStatusGraduated
+	siro.ActiveUntil = jst.ShortDate(2020, 5, 1)
+	actors := []model.Actor{Iori, siro}
+
+	d := jst.ShortDate(2020, 4, 29)
+	p := CreatePlan(d, []EntryPart{
+		CreateEntryPart(siro, 20, 0),
+	})
+	vs := []model.Video{
+		{
+			ID:      "siro",
+			ActorID: siro.ID,
+			Source:  model.VideoSourceYoutube,
+			IsLive:  true,
+			StartAt: jst.Date(2020, 4, 29, 20, 0),
+		},
+	}
+
+	// 卒業した配信者も過去のスケジュールでは解決できる
+	s := createScheduleInternal(d, []model.Plan{p}, vs, actors, Organization)
+	if len(s.Entries) != 1 || s.Entries[0].ActorName != siro.Name || !s.Entries[0].Planned {
+		t.Errorf("got: %+v", s.Entries)
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/search"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+const (
+	// searchBatchSize 1回のクエリで取得する動画の数
+	searchBatchSize = 100
+	// searchMaxQueryCount 1回の検索で実行する最大のクエリ数
+	// トークンだけでは絞り込めない場合に全件を走査しないようにする
+	searchMaxQueryCount = 5
+)
+
+// SearchResultPage 動画の検索結果の1ページ
+type SearchResultPage struct {
+	// Videos 動画
+	Videos []model.Video
+	// Next 次のページのカーソル
+	// 次のページが存在しない場合はnil
+	Next *VideoCursor
+}
+
+// SearchVideos 動画を検索する
+// actorIDが空文字の場合は全ての配信者が対象
+// cursorがnilの場合は最新の動画から検索する
+func SearchVideos(ctx context.Context, c *firestore.Client, q search.Query, actorID string, r jst.Range, cursor *VideoCursor, limit int) (SearchResultPage, error) {
+	token := selectSearchToken(q)
+	if token == "" {
+		return SearchResultPage{Videos: []model.Video{}}, nil
+	}
+
+	end := r.End
+	if cursor != nil && cursor.StartAt.Before(end) {
+		end = cursor.StartAt
+	}
+
+	seen := map[string]bool{}
+	var matched []model.Video
+	// 検索し終わっていない場合に次に検索する位置
+	var next *VideoCursor
+	for i := 0; i < searchMaxQueryCount; i++ {
+		videos, err := store.FindVideosByToken(ctx, c, token, jst.Range{Begin: r.Begin, End: end}, searchBatchSize)
+		if err != nil && err != common.ErrNotFound {
+			return SearchResultPage{}, err
+		}
+		sortVideosForCursor(videos)
+
+		progressed := false
+		for _, v := range videos {
+			if seen[v.ID] {
+				continue
+			}
+			seen[v.ID] = true
+			progressed = true
+
+			if cursor != nil && !isVideoAfterCursor(v, *cursor) {
+				continue
+			}
+
+			if matchSearchVideo(v, q, actorID) {
+				matched = append(matched, v)
+			}
+		}
+
+		if len(videos) < searchBatchSize || len(matched) > limit {
+			next = nil
+			break
+		}
+
+		last := videos[len(videos)-1]
+		next = &VideoCursor{
+			StartAt: last.StartAt,
+			VideoID: last.ID,
+		}
+		end = last.StartAt
+		// 同じ開始時刻の動画だけで埋まってしまった場合は先に進めないので少し戻す
+		if !progressed {
+			end = end.Add(-1 * time.Second)
+		}
+	}
+
+	return createSearchResultPage(matched, next, limit), nil
+}
+
+// selectSearchToken インデックスの検索に使用するトークンを選択する
+// 1文字のトークンはヒットする動画が多いので2文字のトークンを優先する
+func selectSearchToken(q search.Query) string {
+	tokens := q.Tokens()
+	for _, token := range tokens {
+		if len([]rune(token)) >= 2 {
+			return token
+		}
+	}
+
+	if len(tokens) > 0 {
+		return tokens[0]
+	}
+
+	return ""
+}
+
+// matchSearchVideo 動画が検索条件にマッチするかどうか
+func matchSearchVideo(v model.Video, q search.Query, actorID string) bool {
+	if actorID != "" && !isActorVideo(v, actorID) {
+		return false
+	}
+
+	texts := []string{v.Text, v.Title, v.OwnerName}
+	texts = append(texts, v.HashTags...)
+	return q.Match(texts...)
+}
+
+// isActorVideo 配信者に関連する動画かどうか
+func isActorVideo(v model.Video, actorID string) bool {
+	if v.ActorID == actorID || v.RelatedActorID == actorID {
+		return true
+	}
+
+	for _, id := range v.RelatedActorIDs {
+		if id == actorID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// createSearchResultPage 検索結果のページを作成する
+// nextには検索し終わっていない場合に次に検索する位置を指定する
+func createSearchResultPage(videos []model.Video, next *VideoCursor, limit int) SearchResultPage {
+	sortVideosForCursor(videos)
+
+	page := SearchResultPage{
+		Videos: []model.Video{},
+		Next:   next,
+	}
+	if len(videos) > limit {
+		videos = videos[:limit]
+		last := videos[limit-1]
+		page.Next = &VideoCursor{
+			StartAt: last.StartAt,
+			VideoID: last.ID,
+		}
+	}
+	page.Videos = append(page.Videos, videos...)
+
+	return page
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"testing"
+
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/search"
+)
+
+func TestMatchSearchVideo(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       model.Video
+		q       string
+		actorID string
+		expect  bool
+	}{
+		{
+			"title",
+			model.Video{ActorID: Iori.ID, Title: "【Minecraft】マイクラで家を建てる！"},
+			"マイクラ",
+			"",
+			true,
+		},
+		{
+			"hashtag",
+			model.Video{ActorID: Iori.ID, HashTags: []string{"ヤマトイオリ"}},
+			"#ヤマトイオリ",
+			"",
+			true,
+		},
+		{
+			"owner",
+			model.Video{ActorID: model.ActorIDUnknown, RelatedActorID: Pino.ID, OwnerName: "外部チャンネル"},
+			"外部",
+			Pino.ID,
+			true,
+		},
+		{
+			"related actors",
+			model.Video{ActorID: Iori.ID, RelatedActorIDs: []string{Iori.ID, Suzu.ID}, Text: "コラボ配信"},
+			"コラボ",
+			Suzu.ID,
+			true,
+		},
+		{
+			"other actor",
+			model.Video{ActorID: Iori.ID, Text: "コラボ配信"},
+			"コラボ",
+			Suzu.ID,
+			false,
+		},
+		{
+			"not match",
+			model.Video{ActorID: Iori.ID, Text: "マイクラ"},
+			"APEX",
+			"",
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matchSearchVideo(tt.v, search.ParseQuery(tt.q), tt.actorID)
+			if got != tt.expect {
+				t.Errorf("got: %v expect: %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestCreateSearchResultPage(t *testing.T) {
+	videos := []model.Video{
+		{ID: "a", StartAt: jst.Date(2020, 4, 19, 20, 0)},
+		{ID: "b", StartAt: jst.Date(2020, 4, 20, 20, 0)},
+		{ID: "c", StartAt: jst.Date(2020, 4, 18, 20, 0)},
+	}
+
+	page := createSearchResultPage(videos, nil, 2)
+	if len(page.Videos) != 2 || page.Videos[0].ID != "b" || page.Videos[1].ID != "a" {
+		t.Fatalf("videos, got: %v", page.Videos)
+	}
+	if page.Next == nil || page.Next.VideoID != "a" {
+		t.Errorf("next, got: %v expect: a", page.Next)
+	}
+
+	// 検索し終わっていない場合は結果が少なくても次のページがある
+	next := &VideoCursor{StartAt: jst.Date(2020, 4, 1, 0, 0), VideoID: "z"}
+	page = createSearchResultPage(nil, next, 2)
+	if len(page.Videos) != 0 || page.Next != next {
+		t.Errorf("page, got: %v", page)
+	}
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// CreateMonthlyStats 1ヶ月の配信の統計を作成する
+// 変更されることがない月の統計は保存して次回以降はそれを使用する
+func CreateMonthlyStats(ctx context.Context, client *firestore.Client, baseDate jst.Time, now jst.Time, actors model.ActorSlice, org model.Organization) (model.MonthlyStats, error) {
+	baseDate = jst.ShortDate(baseDate.Year(), baseDate.Month(), 1)
+
+	stats, err := store.FindMonthlyStats(ctx, client, baseDate)
+	if err == nil {
+		return stats, nil
+	}
+	if err != common.ErrNotFound {
+		return model.MonthlyStats{}, err
+	}
+
+	// 次の月の初めの日
+	var end jst.Time
+	if baseDate.Month() == 12 {
+		end = jst.ShortDate(baseDate.Year()+1, 1, 1)
+	} else {
+		end = jst.ShortDate(baseDate.Year(), baseDate.Month()+1, 1)
+	}
+
+	// スケジュールを作成するためには開始日の前日の情報、終了日の翌日の12時までの情報が必要
+	r := jst.Range{
+		Begin: baseDate.AddDay(-1),
+		End:   end.AddOneDay().Add(time.Hour * 12),
+	}
+
+	plans, err := store.FindPlans(ctx, client, r)
+	if err != nil && err != common.ErrNotFound {
+		return model.MonthlyStats{}, err
+	}
+
+	videos, err := store.FindVideos(ctx, client, r)
+	if err != nil && err != common.ErrNotFound {
+		return model.MonthlyStats{}, err
+	}
+
+	stats = createMonthlyStatsInternal(baseDate, now, plans, videos, actors, org)
+	if stats.Fixed {
+		err = store.SaveMonthlyStats(ctx, client, stats)
+		if err != nil {
+			// 保存できなくても統計は返せるのでログだけ出しておく
+			log.Printf("Can not save monthly stats %v: %v", baseDate, err)
+		}
+	}
+
+	return stats, nil
+}
+
+func createMonthlyStatsInternal(baseDate jst.Time, now jst.Time, plans []model.Plan, videos []model.Video, actors model.ActorSlice, org model.Organization) model.MonthlyStats {
+	var end jst.Time
+	if baseDate.Month() == 12 {
+		end = jst.ShortDate(baseDate.Year()+1, 1, 1)
+	} else {
+		end = jst.ShortDate(baseDate.Year(), baseDate.Month()+1, 1)
+	}
+
+	stats := model.MonthlyStats{
+		BaseDate: baseDate,
+		// 2日以上前は確実にFixされている
+		Fixed:  end.Before(now.AddDay(-2)),
+		Actors: []model.ActorStats{},
+	}
+
+	videoMap := map[string]model.Video{}
+	for _, v := range videos {
+		videoMap[v.ID] = v
+	}
+
+	statsMap := map[string]*model.ActorStats{}
+	// 配信者ごとに既に集計した動画
+	counted := map[string]bool{}
+
+	for d := baseDate; baseDate.Month() == d.Month(); d = d.AddOneDay() {
+		s := createScheduleInternal(d, plans, videos, actors, org)
+		for _, e := range s.Entries {
+			// 動画が存在しない計画だけのエントリは配信されたか分からないので対象外
+			if e.VideoID == "" {
+				continue
+			}
+
+			v, ok := videoMap[e.VideoID]
+			if !ok {
+				continue
+			}
+
+			relatedActors := findActorsByScheduleEntry(e, videoMap, actors)
+			// コラボの場合は他の配信者の動画でエントリが上書きされているので名前からも探す
+			if actor, err := actors.FindActorByName(e.ActorName); err == nil {
+				relatedActors = append(relatedActors, actor)
+			}
+
+			isCollabo := e.CollaboID > 0 || v.IsUnknownActor() || len(v.RelatedActorIDs) > 1
+
+			for _, actor := range relatedActors {
+				if actor.ID == "" {
+					continue
+				}
+
+				key := actor.ID + "/" + v.ID
+				if counted[key] {
+					continue
+				}
+				counted[key] = true
+
+				as, ok := statsMap[actor.ID]
+				if !ok {
+					as = &model.ActorStats{
+						ActorID: actor.ID,
+						Sources: map[string]int{},
+					}
+					statsMap[actor.ID] = as
+				}
+
+				as.StreamCount++
+				as.Sources[v.Source]++
+				if e.Planned {
+					as.PlannedCount++
+				} else {
+					as.UnplannedCount++
+				}
+				if isCollabo {
+					as.CollaboCount++
+				}
+				if v.MemberOnly {
+					as.MemberOnlyCount++
+				}
+				if !v.EndAt.IsZero() && v.EndAt.After(v.StartAt) {
+					as.TotalDuration += int64(v.EndAt.Time().Sub(v.StartAt.Time()) / time.Second)
+					as.DurationCount++
+				}
+			}
+		}
+	}
+
+	for _, a := range actors {
+		as, ok := statsMap[a.ID]
+		if !ok {
+			continue
+		}
+
+		if as.DurationCount > 0 {
+			as.AverageDuration = as.TotalDuration / int64(as.DurationCount)
+		}
+		stats.Actors = append(stats.Actors, *as)
+	}
+
+	sort.SliceStable(stats.Actors, func(i, j int) bool {
+		return stats.Actors[i].StreamCount > stats.Actors[j].StreamCount
+	})
+
+	return stats
+}
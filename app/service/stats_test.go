@@ -0,0 +1,91 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/plan"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestCreateMonthlyStatsInternal(t *testing.T) {
+	plans := []model.Plan{
+		CreatePlan(jst.ShortDate(2020, 4, 29), []EntryPart{
+			CreateEntryPartCollabo(Iori, 20, 0, 1),
+			CreateEntryPartCollabo(Suzu, 20, 0, 1),
+			CreateEntryPart(Suzu, 22, 0),
+			CreateEntryPartMildom(Pino, 23, 0),
+		}),
+	}
+	videos := []model.Video{
+		{
+			ID:      "collabo",
+			ActorID: Iori.ID,
+			Source:  model.VideoSourceYoutube,
+			IsLive:  true,
+			StartAt: jst.Date(2020, 4, 29, 20, 0),
+			EndAt:   jst.Date(2020, 4, 29, 21, 0),
+		},
+		{
+			ID:         "suzu",
+			ActorID:    Suzu.ID,
+			Source:     model.VideoSourceYoutube,
+			IsLive:     true,
+			MemberOnly: true,
+			StartAt:    jst.Date(2020, 4, 29, 22, 0),
+			EndAt:      jst.Date(2020, 4, 29, 24, 0),
+		},
+		{
+			ID:      "suzu-guerrilla",
+			ActorID: Suzu.ID,
+			Source:  model.VideoSourceYoutube,
+			IsLive:  true,
+			StartAt: jst.Date(2020, 4, 30, 3, 0),
+		},
+		{
+			ID:      "pino",
+			ActorID: Pino.ID,
+			Source:  model.VideoSourceMildom,
+			IsLive:  true,
+			StartAt: jst.Date(2020, 4, 29, 21, 0),
+		},
+	}
+
+	stats := createMonthlyStatsInternal(jst.ShortDate(2020, 4, 1), jst.ShortDate(2020, 5, 10), plans, videos, All, Organization)
+	if !stats.Fixed {
+		t.Errorf("stats must be fixed")
+	}
+
+	find := func(id string) model.ActorStats {
+		for _, a := range stats.Actors {
+			if a.ActorID == id {
+				return a
+			}
+		}
+		t.Fatalf("not found stats: %v", id)
+		return model.ActorStats{}
+	}
+
+	suzu := find(Suzu.ID)
+	if suzu.StreamCount != 3 || suzu.PlannedCount != 2 || suzu.UnplannedCount != 1 {
+		t.Errorf("suzu count, got: %+v", suzu)
+	}
+	if suzu.CollaboCount != 1 || suzu.MemberOnlyCount != 1 {
+		t.Errorf("suzu collabo/memberOnly, got: %+v", suzu)
+	}
+	if suzu.DurationCount != 2 || suzu.TotalDuration != int64(3*time.Hour/time.Second) || suzu.AverageDuration != int64(90*time.Minute/time.Second) {
+		t.Errorf("suzu duration, got: %+v", suzu)
+	}
+
+	iori := find(Iori.ID)
+	if iori.StreamCount != 1 || iori.CollaboCount != 1 {
+		t.Errorf("iori, got: %+v", iori)
+	}
+
+	pino := find(Pino.ID)
+	if pino.StreamCount != 1 || pino.Sources[model.VideoSourceMildom] != 1 || pino.DurationCount != 0 {
+		t.Errorf("pino, got: %+v", pino)
+	}
+}
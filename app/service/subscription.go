@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/notify"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+	"golang.org/x/xerrors"
+)
+
+// topicChanges FCMで購読または解除できたトピック
+type topicChanges struct {
+	subscribed   []string
+	unsubscribed []string
+}
+
+// SubscribeTopics クライアントにトピックを購読させて記録する
+// トークンが無効な場合は記録を削除してnotify.ErrInvalidTokenを返す
+func SubscribeTopics(ctx context.Context, c *firestore.Client, cli notify.TopicClient, token string, topics []string) (model.TopicSubscription, error) {
+	// 以前から購読しているトピックを記録してから追加する
+	_, err := FindTopicSubscription(ctx, c, token)
+	if err != nil {
+		return model.TopicSubscription{}, err
+	}
+
+	changes, err := updateTopicSubscriptionInternal(ctx, cli, token, topics, nil)
+	return saveTopicSubscription(ctx, c, token, changes, err)
+}
+
+// UnsubscribeTopics クライアントのトピックの購読を解除して記録する
+// topicsが空の場合は記録されている全てのトピックの購読を解除する
+// トークンが無効な場合は記録を削除してnotify.ErrInvalidTokenを返す
+func UnsubscribeTopics(ctx context.Context, c *firestore.Client, cli notify.TopicClient, token string, topics []string) (model.TopicSubscription, error) {
+	s, err := FindTopicSubscription(ctx, c, token)
+	if err != nil {
+		return model.TopicSubscription{}, err
+	}
+
+	if len(topics) == 0 {
+		topics = append([]string{}, s.Topics...)
+	}
+
+	changes, err := updateTopicSubscriptionInternal(ctx, cli, token, nil, topics)
+	return saveTopicSubscription(ctx, c, token, changes, err)
+}
+
+// FindTopicSubscription 記録されている購読を取得する
+// 記録されていない場合はサーバーで管理する前に購読したクライアントの可能性があるので、IIDのAPIから取得して記録する
+// 何も購読していない場合も記録して、同じトークンで再度IIDのAPIを呼び出さないようにする
+func FindTopicSubscription(ctx context.Context, c *firestore.Client, token string) (model.TopicSubscription, error) {
+	return findTopicSubscriptionInternal(ctx, token, jst.Now(), func(ctx context.Context, token string) (model.TopicSubscription, error) {
+		return store.FindTopicSubscription(ctx, c, token)
+	}, notify.GetTopics, func(ctx context.Context, s model.TopicSubscription) error {
+		return store.CreateTopicSubscription(ctx, c, s)
+	})
+}
+
+type findTopicSubscriptionFunc func(ctx context.Context, token string) (model.TopicSubscription, error)
+type getLegacyTopicsFunc func(ctx context.Context, token string) ([]string, error)
+type createTopicSubscriptionFunc func(ctx context.Context, s model.TopicSubscription) error
+
+func findTopicSubscriptionInternal(ctx context.Context, token string, now jst.Time, find findTopicSubscriptionFunc, getLegacyTopics getLegacyTopicsFunc, create createTopicSubscriptionFunc) (model.TopicSubscription, error) {
+	s, err := find(ctx, token)
+	if err != common.ErrNotFound {
+		return s, err
+	}
+
+	s = model.TopicSubscription{Token: token}
+	topics, err := getLegacyTopics(ctx, token)
+	if err != nil {
+		// 取得できない場合は何も購読していないものとする
+		// 一時的なエラーの可能性もあるので記録はせずに次回再度取得する
+		log.Printf("Can not get legacy topics: %v", err)
+		return s, nil
+	}
+
+	s.Topics = topics
+	s.UpdatedAt = now
+	err = create(ctx, s)
+	if err != nil {
+		log.Printf("Can not backfill topic subscription: %v", err)
+	}
+
+	return s, nil
+}
+
+// saveTopicSubscription 購読を変更した結果を保存して保存後の記録を返す
+// 途中で失敗した場合も成功したところまでは保存して元のエラーを返す
+func saveTopicSubscription(ctx context.Context, c *firestore.Client, token string, changes topicChanges, err error) (model.TopicSubscription, error) {
+	if xerrors.Is(err, notify.ErrInvalidToken) {
+		// 無効なトークンには通知が届かないので記録を残しておく意味がない
+		delErr := store.DeleteTopicSubscription(ctx, c, token)
+		if delErr != nil {
+			log.Printf("Can not delete topic subscription: %v", delErr)
+		}
+		return model.TopicSubscription{Token: token}, err
+	}
+
+	s, saveErr := store.UpdateTopicSubscription(ctx, c, token, changes.subscribed, changes.unsubscribed, jst.Now())
+	if err != nil {
+		if saveErr != nil {
+			log.Printf("Can not save topic subscription: %v", saveErr)
+		}
+		return s, err
+	}
+
+	return s, saveErr
+}
+
+// updateTopicSubscriptionInternal FCMでトピックを購読または解除する
+// 記録とFCMの状態がずれている可能性もあるので記録に関係なくFCMを呼び出す
+// 失敗した場合はそこで中断して成功したところまでのトピックとエラーを返す
+func updateTopicSubscriptionInternal(ctx context.Context, cli notify.TopicClient, token string, subscribe, unsubscribe []string) (topicChanges, error) {
+	var changes topicChanges
+	for _, topic := range subscribe {
+		err := notify.SubscribeToTopic(ctx, cli, token, topic)
+		if err != nil {
+			return changes, xerrors.Errorf("Can not subscribe to topic '%v': %w", topic, err)
+		}
+		changes.subscribed = append(changes.subscribed, topic)
+	}
+
+	for _, topic := range unsubscribe {
+		err := notify.UnsubscribeFromTopic(ctx, cli, token, topic)
+		if err != nil {
+			return changes, xerrors.Errorf("Can not unsubscribe from topic '%v': %w", topic, err)
+		}
+		changes.unsubscribed = append(changes.unsubscribed, topic)
+	}
+
+	return changes, nil
+}
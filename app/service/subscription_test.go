@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"firebase.google.com/go/messaging"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/notify"
+	"golang.org/x/xerrors"
+)
+
+// topicTestClient 指定したトピックだけ失敗するクライアント
+type topicTestClient struct {
+	failTopic string
+	reason    string
+	calls     []string
+}
+
+func (c *topicTestClient) result(topic string) *messaging.TopicManagementResponse {
+	if topic == c.failTopic {
+		return &messaging.TopicManagementResponse{
+			FailureCount: 1,
+			Errors:       []*messaging.ErrorInfo{{Reason: c.reason}},
+		}
+	}
+	return &messaging.TopicManagementResponse{SuccessCount: 1}
+}
+
+func (c *topicTestClient) SubscribeToTopic(ctx context.Context, tokens []string, topic string) (*messaging.TopicManagementResponse, error) {
+	c.calls = append(c.calls, "+"+topic)
+	return c.result(topic), nil
+}
+
+func (c *topicTestClient) UnsubscribeFromTopic(ctx context.Context, tokens []string, topic string) (*messaging.TopicManagementResponse, error) {
+	c.calls = append(c.calls, "-"+topic)
+	return c.result(topic), nil
+}
+
+func TestUpdateTopicSubscriptionInternal(t *testing.T) {
+	notRegistered := "request contains an invalid argument; code: registration-token-not-registered"
+	tooMany := "client exceeded the number of allowed topics; code: too-many-topics"
+
+	tests := []struct {
+		name         string
+		cli          *topicTestClient
+		subscribe    []string
+		unsubscribe  []string
+		subscribed   []string
+		unsubscribed []string
+		calls        []string
+		err          bool
+		invalid      bool
+	}{
+		{
+			name:       "subscribe",
+			cli:        &topicTestClient{},
+			subscribe:  []string{"plan", "SIROyoutuber"},
+			subscribed: []string{"plan", "SIROyoutuber"},
+			calls:      []string{"+plan", "+SIROyoutuber"},
+		},
+		{
+			name:         "unsubscribe",
+			cli:          &topicTestClient{},
+			unsubscribe:  []string{"plan"},
+			unsubscribed: []string{"plan"},
+			calls:        []string{"-plan"},
+		},
+		{
+			// 失敗したところで中断する
+			name:       "partial",
+			cli:        &topicTestClient{failTopic: "SIROyoutuber", reason: tooMany},
+			subscribe:  []string{"plan", "SIROyoutuber", "group-idol"},
+			subscribed: []string{"plan"},
+			calls:      []string{"+plan", "+SIROyoutuber"},
+			err:        true,
+		},
+		{
+			name:      "invalid token",
+			cli:       &topicTestClient{failTopic: "plan", reason: notRegistered},
+			subscribe: []string{"plan"},
+			calls:     []string{"+plan"},
+			err:       true,
+			invalid:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := updateTopicSubscriptionInternal(context.Background(), tt.cli, "token", tt.subscribe, tt.unsubscribe)
+			if (err != nil) != tt.err {
+				t.Errorf("error, got: %v expect: %v", err, tt.err)
+			}
+
+			if xerrors.Is(err, notify.ErrInvalidToken) != tt.invalid {
+				t.Errorf("invalid token, got: %v expect: %v", err, tt.invalid)
+			}
+
+			if !reflect.DeepEqual(changes.subscribed, tt.subscribed) || !reflect.DeepEqual(changes.unsubscribed, tt.unsubscribed) {
+				t.Errorf("changes, got: %+v", changes)
+			}
+
+			if !reflect.DeepEqual(tt.cli.calls, tt.calls) {
+				t.Errorf("calls, got: %v expect: %v", tt.cli.calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestFindTopicSubscriptionInternal(t *testing.T) {
+	now := jst.Date(2020, 4, 29, 20, 0)
+	recorded := model.TopicSubscription{Token: "recorded", Topics: []string{"plan"}}
+	find := func(ctx context.Context, token string) (model.TopicSubscription, error) {
+		if token == recorded.Token {
+			return recorded, nil
+		}
+		return model.TopicSubscription{}, common.ErrNotFound
+	}
+	getLegacyTopics := func(ctx context.Context, token string) ([]string, error) {
+		switch token {
+		case "legacy":
+			return []string{"plan", "SIROyoutuber"}, nil
+		case "error":
+			return nil, errors.New("failed")
+		}
+		return []string{}, nil
+	}
+
+	tests := []struct {
+		token    string
+		expected []string
+		created  bool
+	}{
+		{"recorded", []string{"plan"}, false},
+		// 記録がない場合はIIDのAPIから取得して記録する
+		{"legacy", []string{"plan", "SIROyoutuber"}, true},
+		// 何も購読していない場合もIIDのAPIを呼び出し直さないように記録する
+		{"new", []string{}, true},
+		// 一時的なエラーの可能性もあるので記録しない
+		{"error", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			var created []model.TopicSubscription
+			s, err := findTopicSubscriptionInternal(context.Background(), tt.token, now, find, getLegacyTopics, func(ctx context.Context, s model.TopicSubscription) error {
+				created = append(created, s)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+
+			if s.Token != tt.token || !reflect.DeepEqual(s.Topics, tt.expected) {
+				t.Errorf("got: %+v expect: %v", s, tt.expected)
+			}
+
+			if (len(created) == 1) != tt.created {
+				t.Errorf("created, got: %v", created)
+			}
+		})
+	}
+}
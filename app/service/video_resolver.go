@@ -6,12 +6,12 @@ import (
 	"cloud.google.com/go/firestore"
 	"github.com/yaegaki/dotlive-schedule-server/bilibili"
 	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/event"
 	"github.com/yaegaki/dotlive-schedule-server/mildom"
 	"github.com/yaegaki/dotlive-schedule-server/model"
 	"github.com/yaegaki/dotlive-schedule-server/store"
 	"github.com/yaegaki/dotlive-schedule-server/tweet"
 	"github.com/yaegaki/dotlive-schedule-server/youtube"
-	"golang.org/x/oauth2/google"
 	"golang.org/x/xerrors"
 	y "google.golang.org/api/youtube/v3"
 )
@@ -21,16 +21,12 @@ type VideoResolver struct {
 	ctx            context.Context
 	c              *firestore.Client
 	youtubeService *y.Service
+	org            model.Organization
 }
 
 // NewVideoResolver videoResolverを作成する
-func NewVideoResolver(ctx context.Context, c *firestore.Client) (*VideoResolver, error) {
-	httpClient, err := google.DefaultClient(ctx, y.YoutubeReadonlyScope)
-	if err != nil {
-		return nil, xerrors.Errorf("Can not create http client: %w", err)
-	}
-
-	youtubeService, err := y.New(httpClient)
+func NewVideoResolver(ctx context.Context, c *firestore.Client, org model.Organization) (*VideoResolver, error) {
+	youtubeService, err := youtube.NewService(ctx)
 	if err != nil {
 		return nil, xerrors.Errorf("Can not create youtube service:%w", err)
 	}
@@ -39,6 +35,7 @@ func NewVideoResolver(ctx context.Context, c *firestore.Client) (*VideoResolver,
 		ctx:            ctx,
 		c:              c,
 		youtubeService: youtubeService,
+		org:            org,
 	}, nil
 }
 
@@ -54,7 +51,7 @@ func (r *VideoResolver) Resolve(tweet tweet.Tweet, url string, actor model.Actor
 	var err error
 
 	if youtube.IsYoutubeURL(url) {
-		v, err = youtube.FindVideo(r.ctx, r.youtubeService, url, actor, tweet.Date)
+		v, err = youtube.FindVideo(r.ctx, r.youtubeService, url, actor, r.org, tweet.Date)
 	} else if bilibili.IsBilibiliURL(url) {
 		v, err = bilibili.FindVideo(url, actor, tweet.Date)
 	} else if mildom.IsMildomURL(url) {
@@ -82,16 +79,37 @@ func (r *VideoResolver) Resolve(tweet tweet.Tweet, url string, actor model.Actor
 }
 
 func (r *VideoResolver) save(v model.Video, tweet tweet.Tweet) error {
-	return store.SaveVideo(r.ctx, r.c, v, func(oldVideo model.Video) bool {
+	saved, created, err := store.SaveVideo(r.ctx, r.c, v, func(oldVideo model.Video) bool {
 		// 過去の動画についてツイートしたときに上書きされると微妙なので
 		// 動画の開始時間から1日後より以前の時間のツイートなら情報を更新する
 		return tweet.Date.Before(oldVideo.StartAt.AddOneDay())
 	})
+	if err != nil {
+		return err
+	}
+
+	// 既存の動画を上書きしなかった場合や内容が同じ場合は何も変わっていないのでイベントを発行しない
+	if !saved {
+		return nil
+	}
+
+	event.Publish(event.TypeVideoSaved, event.VideoSaved{
+		VideoID: v.ID,
+		ActorID: v.ActorID,
+		URL:     v.URL,
+		Source:  v.Source,
+		StartAt: v.StartAt,
+	})
+
+	if created {
+		PublishWebhookVideo(r.ctx, r.c, model.WebhookEventVideoCreated, v)
+	}
+
+	return nil
 }
 
 // Mark impl tweet.VideoResolver
-func (r *VideoResolver) Mark(tweetID string, actor model.Actor) error {
-	actor.LastTweetID = tweetID
+func (r *VideoResolver) Mark(actor model.Actor) error {
 	return store.SaveActor(r.ctx, r.c, actor)
 }
 
@@ -99,3 +117,8 @@ func (r *VideoResolver) Mark(tweetID string, actor model.Actor) error {
 func (r *VideoResolver) YoutubeService() *y.Service {
 	return r.youtubeService
 }
+
+// Organization 組織の情報を取得する
+func (r *VideoResolver) Organization() model.Organization {
+	return r.org
+}
@@ -0,0 +1,419 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/notify"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+const (
+	// webhookMaxAttempts 1つのWebhookの送信を試みる最大回数
+	webhookMaxAttempts = 5
+	// webhookDisableThreshold 連続でこの回数だけ送信に失敗した購読は無効にする
+	webhookDisableThreshold = 10
+	// webhookTimeout Webhookの送信のタイムアウト
+	webhookTimeout = 10 * time.Second
+)
+
+const (
+	// webhookEventHeader イベントの種類のヘッダ
+	webhookEventHeader = "X-Dotlive-Event"
+	// webhookDeliveryHeader WebhookのIDのヘッダ
+	// 再送された場合も同じIDになる
+	webhookDeliveryHeader = "X-Dotlive-Delivery"
+	// webhookTimestampHeader 署名した時刻(UNIX時間)のヘッダ
+	webhookTimestampHeader = "X-Dotlive-Timestamp"
+	// webhookSignatureHeader 署名のヘッダ
+	webhookSignatureHeader = "X-Dotlive-Signature"
+)
+
+var (
+	// errWebhookSubscriptionNotFound 購読が削除されたので送信しなかった
+	errWebhookSubscriptionNotFound = errors.New("subscription not found")
+	// errWebhookSubscriptionDisabled 購読が無効なので送信しなかった
+	errWebhookSubscriptionDisabled = errors.New("subscription disabled")
+)
+
+// WebhookPayload 送信するWebhookの内容
+type WebhookPayload struct {
+	// ID WebhookのID
+	// 再送された場合も同じIDになる
+	ID string `json:"id"`
+	// Type イベントの種類
+	Type string `json:"type"`
+	// CreatedAt イベントが発生した時刻
+	CreatedAt jst.Time `json:"createdAt"`
+	// Data イベントの内容
+	// 計画の場合はWebhookPlan、動画の場合はWebhookVideo
+	Data json.RawMessage `json:"data"`
+}
+
+// WebhookPlan Webhookで送信する計画
+type WebhookPlan struct {
+	// Date 計画の日付
+	Date jst.Time `json:"date"`
+	// TweetID 計画のツイートID
+	TweetID string `json:"tweetId"`
+	// Text 計画のテキスト
+	Text string `json:"text"`
+	// Entries 計画のエントリ
+	Entries []WebhookPlanEntry `json:"entries"`
+}
+
+// WebhookPlanEntry Webhookで送信する計画のエントリ
+type WebhookPlanEntry struct {
+	// ActorID 配信者ID
+	ActorID string `json:"actorId"`
+	// HashTag 配信者が不明な場合のハッシュタグ
+	HashTag string `json:"hashTag,omitempty"`
+	// StartAt 開始時刻
+	StartAt jst.Time `json:"startAt"`
+	// Source 配信サイト
+	Source string `json:"source"`
+	// MemberOnly メンバー限定かどうか
+	MemberOnly bool `json:"memberOnly"`
+	// CollaboID コラボID
+	// コラボではない場合は0
+	CollaboID int `json:"collaboId"`
+}
+
+// WebhookVideo Webhookで送信する動画
+type WebhookVideo struct {
+	// ID 動画ID
+	ID string `json:"id"`
+	// ActorID 配信者ID
+	ActorID string `json:"actorId"`
+	// RelatedActorIDs 関連する配信者ID
+	RelatedActorIDs []string `json:"relatedActorIds"`
+	// URL 動画のURL
+	URL string `json:"url"`
+	// Source 配信サイト
+	Source string `json:"source"`
+	// Title 動画サイトでのタイトル
+	Title string `json:"title"`
+	// Text 動画のツイートのテキスト
+	Text string `json:"text"`
+	// IsLive 生放送かどうか
+	IsLive bool `json:"isLive"`
+	// MemberOnly メンバー限定かどうか
+	MemberOnly bool `json:"memberOnly"`
+	// StartAt 開始時刻
+	StartAt jst.Time `json:"startAt"`
+	// OldStartAt 開始時刻が変更された場合の変更前の開始時刻
+	OldStartAt *jst.Time `json:"oldStartAt,omitempty"`
+}
+
+func newWebhookPlan(p model.Plan) WebhookPlan {
+	entries := []WebhookPlanEntry{}
+	for _, e := range p.Entries {
+		entries = append(entries, WebhookPlanEntry{
+			ActorID:    e.ActorID,
+			HashTag:    e.HashTag,
+			StartAt:    e.StartAt,
+			Source:     e.Source,
+			MemberOnly: e.MemberOnly,
+			CollaboID:  e.CollaboID,
+		})
+	}
+
+	return WebhookPlan{
+		Date:    p.Date,
+		TweetID: p.SourceID,
+		Text:    p.Text(),
+		Entries: entries,
+	}
+}
+
+func newWebhookVideo(v model.Video) WebhookVideo {
+	relatedActorIDs := []string{}
+	if v.RelatedActorID != "" && v.RelatedActorID != model.ActorIDUnknown {
+		relatedActorIDs = append(relatedActorIDs, v.RelatedActorID)
+	}
+	for _, id := range v.RelatedActorIDs {
+		if id != v.RelatedActorID {
+			relatedActorIDs = append(relatedActorIDs, id)
+		}
+	}
+
+	return WebhookVideo{
+		ID:              v.ID,
+		ActorID:         v.ActorID,
+		RelatedActorIDs: relatedActorIDs,
+		URL:             v.URL,
+		Source:          v.Source,
+		Title:           v.Title,
+		Text:            v.Text,
+		IsLive:          v.IsLive,
+		MemberOnly:      v.MemberOnly,
+		StartAt:         v.StartAt,
+	}
+}
+
+// actorIDs 購読の配信者の絞り込みに使用する配信者ID
+func (v WebhookVideo) actorIDs() []string {
+	return append([]string{v.ActorID}, v.RelatedActorIDs...)
+}
+
+// PublishWebhookPlan 計画の作成か更新をWebhookで送信する
+// 送信は後でDeliverWebhooksで行う
+func PublishWebhookPlan(ctx context.Context, c *firestore.Client, p model.Plan, created bool) {
+	eventType := model.WebhookEventPlanUpdated
+	if created {
+		eventType = model.WebhookEventPlanCreated
+	}
+
+	var actorIDs []string
+	for _, e := range p.Entries {
+		actorIDs = append(actorIDs, e.ActorID)
+	}
+
+	publishWebhookEvent(ctx, c, eventType, actorIDs, newWebhookPlan(p))
+}
+
+// PublishWebhookVideo 動画のイベントをWebhookで送信する
+func PublishWebhookVideo(ctx context.Context, c *firestore.Client, eventType string, v model.Video) {
+	data := newWebhookVideo(v)
+	publishWebhookEvent(ctx, c, eventType, data.actorIDs(), data)
+}
+
+// PublishWebhookVideoRescheduled 動画の開始時刻の変更をWebhookで送信する
+func PublishWebhookVideoRescheduled(ctx context.Context, c *firestore.Client, v model.Video, oldStartAt jst.Time) {
+	data := newWebhookVideo(v)
+	data.OldStartAt = &oldStartAt
+	publishWebhookEvent(ctx, c, model.WebhookEventVideoRescheduled, data.actorIDs(), data)
+}
+
+// publishWebhookEvent 対象の購読ごとにWebhookを保存する
+// 失敗しても本来の処理は続けられるのでログだけ出す
+func publishWebhookEvent(ctx context.Context, c *firestore.Client, eventType string, actorIDs []string, data interface{}) {
+	subscriptions, err := store.FindWebhookSubscriptions(ctx, c)
+	if err != nil {
+		log.Printf("Can not get webhook subscriptions: %v", err)
+		return
+	}
+
+	deliveries, err := createWebhookDeliveries(subscriptions, eventType, actorIDs, data, jst.Now())
+	if err != nil {
+		log.Printf("Can not create webhook deliveries: %v", err)
+		return
+	}
+
+	for _, d := range deliveries {
+		_, err := store.EnqueueWebhookDelivery(ctx, c, d)
+		if err != nil {
+			log.Printf("Can not enqueue webhook delivery %v: %v", d.ID, err)
+		}
+	}
+}
+
+// createWebhookDeliveries 対象の購読ごとに送信するWebhookを作成する
+// IDは購読IDとイベントの内容から作成するので、同じイベントを何度発行しても一度しか送信されない
+func createWebhookDeliveries(subscriptions []model.WebhookSubscription, eventType string, actorIDs []string, data interface{}, now jst.Time) ([]model.WebhookDelivery, error) {
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []model.WebhookDelivery
+	for _, s := range subscriptions {
+		if !s.Match(eventType, actorIDs) {
+			continue
+		}
+
+		id := fmt.Sprintf("%x", sha1.Sum([]byte(s.ID+"\n"+eventType+"\n"+string(rawData))))
+		payload, err := json.Marshal(WebhookPayload{
+			ID:        id,
+			Type:      eventType,
+			CreatedAt: now,
+			Data:      rawData,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, model.WebhookDelivery{
+			ID:             id,
+			SubscriptionID: s.ID,
+			Event:          eventType,
+			Payload:        string(payload),
+			Status:         model.NotificationStatusPending,
+			CreatedAt:      now,
+			NextAttemptAt:  now,
+		})
+	}
+
+	return deliveries, nil
+}
+
+// webhookNotifier 配信の開始をWebhookで送信するNotifier
+// プッシュ通知と同じ条件で送信するためにNotifierとして実装する
+type webhookNotifier struct {
+	c *firestore.Client
+}
+
+// Notify 配信の開始の場合だけWebhookを保存する
+func (n *webhookNotifier) Notify(ctx context.Context, e notify.Event) error {
+	if e.Kind != notify.EventKindStreamStarted && e.Kind != notify.EventKindCollaboStarted {
+		return nil
+	}
+
+	PublishWebhookVideo(ctx, n.c, model.WebhookEventVideoStarted, e.Video)
+	return nil
+}
+
+// DeliverWebhooks 送信待ちのWebhookを送信する
+func DeliverWebhooks(ctx context.Context, c *firestore.Client) {
+	deliveries, err := store.FindWebhookDeliveriesByStatus(ctx, c, model.NotificationStatusPending)
+	if err != nil {
+		log.Printf("Can not get pending webhook deliveries: %v", err)
+		return
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	subscriptions, err := store.FindWebhookSubscriptions(ctx, c)
+	if err != nil {
+		log.Printf("Can not get webhook subscriptions: %v", err)
+		return
+	}
+
+	httpClient := &http.Client{
+		Timeout: webhookTimeout,
+	}
+	deliverWebhooksInternal(ctx, httpClient, subscriptions, deliveries, jst.Now(), func(ctx context.Context, d model.WebhookDelivery) error {
+		return store.SaveWebhookDelivery(ctx, c, d)
+	}, func(ctx context.Context, s model.WebhookSubscription) error {
+		return store.SaveWebhookSubscription(ctx, c, s)
+	})
+}
+
+type saveWebhookDeliveryFunc func(ctx context.Context, d model.WebhookDelivery) error
+type saveWebhookSubscriptionFunc func(ctx context.Context, s model.WebhookSubscription) error
+
+func deliverWebhooksInternal(ctx context.Context, httpClient *http.Client, subscriptions []model.WebhookSubscription, deliveries []model.WebhookDelivery, now jst.Time, saveDelivery saveWebhookDeliveryFunc, saveSubscription saveWebhookSubscriptionFunc) {
+	subscriptionMap := map[string]model.WebhookSubscription{}
+	for _, s := range subscriptions {
+		subscriptionMap[s.ID] = s
+	}
+
+	for _, d := range deliveries {
+		if d.Status != model.NotificationStatusPending || d.NextAttemptAt.After(now) {
+			continue
+		}
+
+		s, ok := subscriptionMap[d.SubscriptionID]
+		var err error
+		if !ok {
+			err = errWebhookSubscriptionNotFound
+		} else if s.Disabled {
+			err = errWebhookSubscriptionDisabled
+		}
+
+		// 購読がない場合は再送しても意味がないので諦める
+		if err != nil {
+			d.Status = model.NotificationStatusFailed
+			d.Attempts = append(d.Attempts, model.WebhookAttempt{
+				AttemptedAt: now,
+				Error:       err.Error(),
+			})
+			if err := saveDelivery(ctx, d); err != nil {
+				log.Printf("Can not save webhook delivery %v: %v", d.ID, err)
+			}
+			continue
+		}
+
+		statusCode, err := postWebhook(ctx, httpClient, s, d, now)
+		attempt := model.WebhookAttempt{
+			AttemptedAt: now,
+			StatusCode:  statusCode,
+		}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		d.Attempts = append(d.Attempts, attempt)
+
+		failures := s.ConsecutiveFailures
+		if err == nil {
+			d.Status = model.NotificationStatusSent
+			s.ConsecutiveFailures = 0
+		} else {
+			log.Printf("Can not send webhook %v: %v", d.ID, err)
+			if len(d.Attempts) >= webhookMaxAttempts {
+				d.Status = model.NotificationStatusFailed
+			} else {
+				d.NextAttemptAt = now.Add(retryDelay(len(d.Attempts)))
+			}
+
+			s.ConsecutiveFailures++
+			if s.ConsecutiveFailures >= webhookDisableThreshold {
+				log.Printf("Disable webhook subscription %v", s.ID)
+				s.Disabled = true
+			}
+		}
+
+		if err := saveDelivery(ctx, d); err != nil {
+			log.Printf("Can not save webhook delivery %v: %v", d.ID, err)
+		}
+
+		if failures != s.ConsecutiveFailures {
+			subscriptionMap[s.ID] = s
+			if err := saveSubscription(ctx, s); err != nil {
+				log.Printf("Can not save webhook subscription %v: %v", s.ID, err)
+			}
+		}
+	}
+}
+
+// postWebhook 署名を付けてWebhookを送信する
+// 2xx以外のステータスコードの場合はエラーを返す
+func postWebhook(ctx context.Context, httpClient *http.Client, s model.WebhookSubscription, d model.WebhookDelivery, now jst.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader([]byte(d.Payload)))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(now.Time().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, d.Event)
+	req.Header.Set(webhookDeliveryHeader, d.ID)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(s.Secret, timestamp, d.Payload))
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("webhook: %v", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
+
+// signWebhook 送信時刻とペイロードをつなげたものをHMAC-SHA256で署名する
+// 送信時刻を含めることで受信側はリプレイ攻撃を防げる
+func signWebhook(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestCreateWebhookDeliveries(t *testing.T) {
+	now := jst.Date(2020, 4, 29, 20, 0)
+	subscriptions := []model.WebhookSubscription{
+		{ID: "all", Events: []string{model.WebhookEventVideoStarted}},
+		{ID: "siro", Events: []string{model.WebhookEventVideoStarted}, Actors: []string{"siro"}},
+		{ID: "iori", Events: []string{model.WebhookEventVideoStarted}, Actors: []string{"iori"}},
+		{ID: "plan", Events: []string{model.WebhookEventPlanCreated}},
+		{ID: "disabled", Events: []string{model.WebhookEventVideoStarted}, Disabled: true},
+	}
+
+	v := newWebhookVideo(model.Video{ID: "video", ActorID: "siro", RelatedActorID: model.ActorIDUnknown})
+	deliveries, err := createWebhookDeliveries(subscriptions, model.WebhookEventVideoStarted, v.actorIDs(), v, now)
+	if err != nil {
+		t.Fatalf("Can not create deliveries: %v", err)
+	}
+
+	if len(deliveries) != 2 || deliveries[0].SubscriptionID != "all" || deliveries[1].SubscriptionID != "siro" {
+		t.Fatalf("invalid deliveries: %+v", deliveries)
+	}
+
+	d := deliveries[0]
+	if d.Status != model.NotificationStatusPending || !d.NextAttemptAt.Equal(now) || d.Event != model.WebhookEventVideoStarted {
+		t.Errorf("invalid delivery: %+v", d)
+	}
+
+	var payload WebhookPayload
+	err = json.Unmarshal([]byte(d.Payload), &payload)
+	if err != nil {
+		t.Fatalf("Can not unmarshal payload: %v", err)
+	}
+
+	if payload.ID != d.ID || payload.Type != model.WebhookEventVideoStarted {
+		t.Errorf("invalid payload: %+v", payload)
+	}
+
+	var data WebhookVideo
+	err = json.Unmarshal(payload.Data, &data)
+	if err != nil || data.ID != "video" || len(data.RelatedActorIDs) != 0 || data.OldStartAt != nil {
+		t.Errorf("invalid data: %+v", data)
+	}
+
+	// 同じイベントは同じIDになる
+	again, _ := createWebhookDeliveries(subscriptions, model.WebhookEventVideoStarted, v.actorIDs(), v, now.Add(time.Minute))
+	if again[0].ID != d.ID {
+		t.Errorf("same event must have same id")
+	}
+
+	v.Title = "changed"
+	changed, _ := createWebhookDeliveries(subscriptions, model.WebhookEventVideoStarted, v.actorIDs(), v, now)
+	if changed[0].ID == d.ID {
+		t.Errorf("different event must have different id")
+	}
+}
+
+func TestDeliverWebhooksInternal(t *testing.T) {
+	now := jst.Date(2020, 4, 29, 20, 0)
+
+	var statusCode int
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(statusCode)
+	}))
+	defer server.Close()
+
+	newTestDelivery := func(id, subscriptionID string, attempts int) model.WebhookDelivery {
+		d := model.WebhookDelivery{
+			ID:             id,
+			SubscriptionID: subscriptionID,
+			Event:          model.WebhookEventPlanCreated,
+			Payload:        `{"id":"` + id + `"}`,
+			Status:         model.NotificationStatusPending,
+			CreatedAt:      now.Add(-time.Hour),
+			NextAttemptAt:  now.Add(-time.Minute),
+		}
+		for i := 0; i < attempts; i++ {
+			d.Attempts = append(d.Attempts, model.WebhookAttempt{Error: "error"})
+		}
+		return d
+	}
+
+	tests := []struct {
+		name          string
+		statusCode    int
+		failures      int
+		deliveries    []model.WebhookDelivery
+		statuses      []string
+		requestCount  int
+		finalFailures int
+		disabled      bool
+	}{
+		{
+			name:          "success",
+			statusCode:    http.StatusOK,
+			failures:      3,
+			deliveries:    []model.WebhookDelivery{newTestDelivery("a", "sub", 0)},
+			statuses:      []string{model.NotificationStatusSent},
+			requestCount:  1,
+			finalFailures: 0,
+		},
+		{
+			name:          "retry",
+			statusCode:    http.StatusInternalServerError,
+			deliveries:    []model.WebhookDelivery{newTestDelivery("a", "sub", 0), newTestDelivery("b", "sub", webhookMaxAttempts-1)},
+			statuses:      []string{model.NotificationStatusPending, model.NotificationStatusFailed},
+			requestCount:  2,
+			finalFailures: 2,
+		},
+		{
+			name:          "disable",
+			statusCode:    http.StatusGone,
+			failures:      webhookDisableThreshold - 1,
+			deliveries:    []model.WebhookDelivery{newTestDelivery("a", "sub", 0), newTestDelivery("b", "sub", 0)},
+			statuses:      []string{model.NotificationStatusPending, model.NotificationStatusFailed},
+			requestCount:  1,
+			finalFailures: webhookDisableThreshold,
+			disabled:      true,
+		},
+		{
+			name:         "deleted subscription",
+			statusCode:   http.StatusOK,
+			deliveries:   []model.WebhookDelivery{newTestDelivery("a", "deleted", 0)},
+			statuses:     []string{model.NotificationStatusFailed},
+			requestCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode = tt.statusCode
+			requests = nil
+			bodies = nil
+
+			s := model.WebhookSubscription{
+				ID:                  "sub",
+				URL:                 server.URL,
+				Secret:              "secret",
+				Events:              []string{model.WebhookEventPlanCreated},
+				ConsecutiveFailures: tt.failures,
+			}
+
+			saved := map[string]model.WebhookDelivery{}
+			var savedSubscription *model.WebhookSubscription
+			deliverWebhooksInternal(context.Background(), server.Client(), []model.WebhookSubscription{s}, tt.deliveries, now, func(ctx context.Context, d model.WebhookDelivery) error {
+				saved[d.ID] = d
+				return nil
+			}, func(ctx context.Context, s model.WebhookSubscription) error {
+				savedSubscription = &s
+				return nil
+			})
+
+			if len(requests) != tt.requestCount {
+				t.Errorf("request count, got: %v expect: %v", len(requests), tt.requestCount)
+			}
+
+			for i, d := range tt.deliveries {
+				if saved[d.ID].Status != tt.statuses[i] {
+					t.Errorf("status %v, got: %v expect: %v", d.ID, saved[d.ID].Status, tt.statuses[i])
+				}
+			}
+
+			if tt.requestCount > 0 {
+				if savedSubscription == nil {
+					t.Fatalf("subscription must be saved")
+				}
+
+				if savedSubscription.ConsecutiveFailures != tt.finalFailures || savedSubscription.Disabled != tt.disabled {
+					t.Errorf("invalid subscription: %+v", savedSubscription)
+				}
+			}
+
+			if d, ok := saved["a"]; ok && d.Status == model.NotificationStatusPending && !d.NextAttemptAt.After(now) {
+				t.Errorf("retry must be delayed: %v", d.NextAttemptAt)
+			}
+
+			for i, r := range requests {
+				timestamp := r.Header.Get(webhookTimestampHeader)
+				expected := "sha256=" + signWebhook("secret", timestamp, bodies[i])
+				if r.Header.Get(webhookSignatureHeader) != expected {
+					t.Errorf("invalid signature: %v", r.Header.Get(webhookSignatureHeader))
+				}
+
+				if r.Header.Get(webhookEventHeader) != model.WebhookEventPlanCreated || r.Header.Get(webhookDeliveryHeader) == "" {
+					t.Errorf("invalid headers: %v", r.Header)
+				}
+			}
+		})
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n '1588158000.{}' | openssl dgst -sha256 -hmac secret
+	expected := "0d6f0f112b2be5432ecd0a4264e786624bd1899467e0d8f57abe99a3af8fbb1d"
+	if s := signWebhook("secret", "1588158000", "{}"); s != expected {
+		t.Errorf("got: %v expect: %v", s, expected)
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/app/cache"
+	"github.com/yaegaki/dotlive-schedule-server/app/internal"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/notify"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+const (
+	// webPushTimeout ブラウザのプッシュ通知のタイムアウト
+	webPushTimeout = 10 * time.Second
+	// webPushConcurrency 同時にプッシュサービスに送信する数
+	webPushConcurrency = 8
+	// webPushDeleteThreshold 連続でこの回数だけ送信に失敗した購読は削除する
+	webPushDeleteThreshold = 5
+)
+
+// DeliverWebPushes 送信待ちのブラウザのプッシュ通知を送信する
+func DeliverWebPushes(ctx context.Context, c *firestore.Client) {
+	deliveries, err := store.FindWebPushDeliveriesByStatus(ctx, c, model.NotificationStatusPending)
+	if err != nil {
+		log.Printf("Can not get pending web push deliveries: %v", err)
+		return
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	key, err := cache.FindVAPIDKeyWithCache(ctx, c)
+	if err != nil {
+		log.Printf("Can not get vapid key: %v", err)
+		return
+	}
+
+	subscriptions, err := store.FindWebPushSubscriptions(ctx, c)
+	if err != nil {
+		log.Printf("Can not get web push subscriptions: %v", err)
+		return
+	}
+
+	sender := notify.NewWebPushSender(key, internal.WebPushSubject, &http.Client{
+		Timeout: webPushTimeout,
+	})
+	deliverWebPushesInternal(ctx, sender.Send, subscriptions, deliveries, jst.Now(), func(ctx context.Context, d model.WebPushDelivery) error {
+		return store.SaveWebPushDelivery(ctx, c, d)
+	}, func(ctx context.Context, s model.WebPushSubscription) error {
+		return store.UpdateWebPushSubscriptionFailures(ctx, c, s.ID, s.ConsecutiveFailures)
+	}, func(ctx context.Context, s model.WebPushSubscription) error {
+		return store.DeleteWebPushSubscription(ctx, c, s.ID)
+	})
+}
+
+type sendWebPushFunc func(ctx context.Context, s model.WebPushSubscription, payload []byte) (int, error)
+type saveWebPushDeliveryFunc func(ctx context.Context, d model.WebPushDelivery) error
+type saveWebPushSubscriptionFunc func(ctx context.Context, s model.WebPushSubscription) error
+
+// webPushResult 購読ごとの送信結果
+type webPushResult struct {
+	statusCode int
+	err        error
+}
+
+func deliverWebPushesInternal(ctx context.Context, send sendWebPushFunc, subscriptions []model.WebPushSubscription, deliveries []model.WebPushDelivery, now jst.Time, saveDelivery saveWebPushDeliveryFunc, saveSubscription saveWebPushSubscriptionFunc, deleteSubscription saveWebPushSubscriptionFunc) {
+	for _, d := range deliveries {
+		if d.Status != model.NotificationStatusPending {
+			continue
+		}
+
+		// 古い通知はプッシュサービスでも破棄されるので送信しない
+		if now.After(d.CreatedAt.Add(notificationExpiration)) {
+			d.Status = model.NotificationStatusFailed
+			if err := saveDelivery(ctx, d); err != nil {
+				log.Printf("Can not save web push delivery %v: %v", d.ID, err)
+			}
+			continue
+		}
+
+		var targets []model.WebPushSubscription
+		for _, s := range subscriptions {
+			if s.Match(d.Topics, d.ActorIDs) {
+				targets = append(targets, s)
+			}
+		}
+
+		results := sendWebPushes(ctx, send, targets, []byte(d.Payload))
+
+		// 購読ごとに再送すると重複して通知される可能性があるので、失敗しても再送はしない
+		d.Status = model.NotificationStatusSent
+		if err := saveDelivery(ctx, d); err != nil {
+			log.Printf("Can not save web push delivery %v: %v", d.ID, err)
+		}
+
+		deleted := map[string]bool{}
+		for i, s := range targets {
+			r := results[i]
+			if r.statusCode == http.StatusNotFound || r.statusCode == http.StatusGone || (r.err != nil && s.ConsecutiveFailures+1 >= webPushDeleteThreshold) {
+				// エンドポイントにはブラウザを識別する値が含まれるのでログには含めない
+				log.Printf("Delete web push subscription %v: %v", s.ID, r.err)
+				if err := deleteSubscription(ctx, s); err != nil {
+					log.Printf("Can not delete web push subscription %v: %v", s.ID, err)
+				}
+				deleted[s.ID] = true
+				continue
+			}
+
+			failures := s.ConsecutiveFailures
+			if r.err == nil {
+				s.ConsecutiveFailures = 0
+			} else {
+				log.Printf("Can not send web push %v to %v: %v", d.ID, s.ID, r.err)
+				s.ConsecutiveFailures++
+			}
+
+			if failures != s.ConsecutiveFailures {
+				if err := saveSubscription(ctx, s); err != nil {
+					log.Printf("Can not save web push subscription %v: %v", s.ID, err)
+				}
+				targets[i] = s
+			}
+		}
+
+		subscriptions = updateWebPushSubscriptions(subscriptions, targets, deleted)
+	}
+}
+
+// sendWebPushes 同時に送信する数を制限して購読に送信する
+// 結果は購読と同じ順に返す
+func sendWebPushes(ctx context.Context, send sendWebPushFunc, subscriptions []model.WebPushSubscription, payload []byte) []webPushResult {
+	results := make([]webPushResult, len(subscriptions))
+	sem := make(chan struct{}, webPushConcurrency)
+	var wg sync.WaitGroup
+	for i, s := range subscriptions {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, s model.WebPushSubscription) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			statusCode, err := send(ctx, s, payload)
+			results[i] = webPushResult{statusCode: statusCode, err: err}
+		}(i, s)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// updateWebPushSubscriptions 次の通知の送信のために送信結果を購読に反映する
+func updateWebPushSubscriptions(subscriptions, updated []model.WebPushSubscription, deleted map[string]bool) []model.WebPushSubscription {
+	updatedMap := map[string]model.WebPushSubscription{}
+	for _, s := range updated {
+		updatedMap[s.ID] = s
+	}
+
+	var result []model.WebPushSubscription
+	for _, s := range subscriptions {
+		if deleted[s.ID] {
+			continue
+		}
+
+		if temp, ok := updatedMap[s.ID]; ok {
+			s = temp
+		}
+		result = append(result, s)
+	}
+
+	return result
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestDeliverWebPushesInternal(t *testing.T) {
+	now := jst.Date(2020, 4, 29, 20, 0)
+	subscriptions := []model.WebPushSubscription{
+		{ID: "plan", Topics: []string{"plan"}},
+		{ID: "siro", Actors: []string{"siro"}, ConsecutiveFailures: 2},
+		{ID: "gone", Actors: []string{"siro"}, Topics: []string{"plan"}},
+		{ID: "fail", Topics: []string{"plan"}, ConsecutiveFailures: webPushDeleteThreshold - 2},
+	}
+	deliveries := []model.WebPushDelivery{
+		{ID: "plan", Payload: "plan", Topics: []string{"plan"}, Status: model.NotificationStatusPending, CreatedAt: now},
+		{ID: "stream", Payload: "stream", ActorIDs: []string{"siro"}, Status: model.NotificationStatusPending, CreatedAt: now},
+		{ID: "plan2", Payload: "plan2", Topics: []string{"plan"}, Status: model.NotificationStatusPending, CreatedAt: now},
+		{ID: "sent", Payload: "sent", Topics: []string{"plan"}, Status: model.NotificationStatusSent, CreatedAt: now},
+		{ID: "expired", Payload: "expired", Topics: []string{"plan"}, Status: model.NotificationStatusPending, CreatedAt: now.Add(-3 * time.Hour)},
+	}
+
+	var mu sync.Mutex
+	sent := map[string][]string{}
+	send := func(ctx context.Context, s model.WebPushSubscription, payload []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent[s.ID] = append(sent[s.ID], string(payload))
+
+		switch s.ID {
+		case "gone":
+			return http.StatusGone, errors.New("gone")
+		case "fail":
+			return http.StatusInternalServerError, errors.New("failed")
+		}
+		return http.StatusCreated, nil
+	}
+
+	savedDeliveries := map[string]model.WebPushDelivery{}
+	savedSubscriptions := map[string]model.WebPushSubscription{}
+	var deleted []string
+	deliverWebPushesInternal(context.Background(), send, subscriptions, deliveries, now, func(ctx context.Context, d model.WebPushDelivery) error {
+		savedDeliveries[d.ID] = d
+		return nil
+	}, func(ctx context.Context, s model.WebPushSubscription) error {
+		savedSubscriptions[s.ID] = s
+		return nil
+	}, func(ctx context.Context, s model.WebPushSubscription) error {
+		deleted = append(deleted, s.ID)
+		return nil
+	})
+
+	if len(sent["plan"]) != 2 || sent["plan"][0] != "plan" || sent["plan"][1] != "plan2" {
+		t.Errorf("plan, got: %v", sent["plan"])
+	}
+
+	if len(sent["siro"]) != 1 || sent["siro"][0] != "stream" {
+		t.Errorf("siro, got: %v", sent["siro"])
+	}
+
+	// 無効になった購読と失敗し続けた購読は削除して、それ以降は送信しない
+	if len(sent["gone"]) != 1 || len(sent["fail"]) != 2 {
+		t.Errorf("gone: %v, fail: %v", sent["gone"], sent["fail"])
+	}
+
+	if len(deleted) != 2 || deleted[0] != "gone" || deleted[1] != "fail" {
+		t.Errorf("deleted, got: %v", deleted)
+	}
+
+	if s, ok := savedSubscriptions["siro"]; !ok || s.ConsecutiveFailures != 0 {
+		t.Errorf("failures of siro must be reset: %+v", s)
+	}
+
+	if s, ok := savedSubscriptions["fail"]; !ok || s.ConsecutiveFailures != webPushDeleteThreshold-1 {
+		t.Errorf("failures of fail must be counted: %+v", s)
+	}
+
+	expected := map[string]string{
+		"plan":    model.NotificationStatusSent,
+		"stream":  model.NotificationStatusSent,
+		"plan2":   model.NotificationStatusSent,
+		"expired": model.NotificationStatusFailed,
+	}
+	if len(savedDeliveries) != len(expected) {
+		t.Errorf("len(savedDeliveries), got: %v", len(savedDeliveries))
+	}
+	for id, status := range expected {
+		if savedDeliveries[id].Status != status {
+			t.Errorf("status of %v, got: %v expect: %v", id, savedDeliveries[id].Status, status)
+		}
+	}
+}
+
+func TestSendWebPushesConcurrency(t *testing.T) {
+	var subscriptions []model.WebPushSubscription
+	for i := 0; i < webPushConcurrency*3; i++ {
+		subscriptions = append(subscriptions, model.WebPushSubscription{ID: string(rune('a' + i))})
+	}
+
+	var mu sync.Mutex
+	running := 0
+	maxRunning := 0
+	results := sendWebPushes(context.Background(), func(ctx context.Context, s model.WebPushSubscription, payload []byte) (int, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return http.StatusCreated, nil
+	}, subscriptions, []byte("payload"))
+
+	if len(results) != len(subscriptions) {
+		t.Errorf("len(results), got: %v", len(results))
+	}
+
+	if maxRunning > webPushConcurrency {
+		t.Errorf("concurrency, got: %v", maxRunning)
+	}
+}
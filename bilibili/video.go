@@ -46,7 +46,8 @@ func FindVideo(bilibiliURL string, actor model.Actor, tweetDate jst.Time) (model
 	var roomInfo struct {
 		Data struct {
 			RoomInfo struct {
-				UID uint64 `json:"uid"`
+				UID   uint64 `json:"uid"`
+				Title string `json:"title"`
 			} `json:"room_info"`
 		} `json:"data"`
 	}
@@ -55,22 +56,41 @@ func FindVideo(bilibiliURL string, actor model.Actor, tweetDate jst.Time) (model
 		return model.Video{}, err
 	}
 
-	actorBiibiliID, err := strconv.ParseUint(actor.BilibiliID, 10, 64)
+	channelID, err := findChannelID(actor, roomInfo.Data.RoomInfo.UID)
 	if err != nil {
-		return model.Video{}, fmt.Errorf("invalid actor bilibiliID: %v", actor.BilibiliID)
-	}
-
-	if roomInfo.Data.RoomInfo.UID != actorBiibiliID {
-		return model.Video{}, common.ErrInvalidChannel
+		return model.Video{}, err
 	}
 
 	return model.Video{
 		// bilibiliは放送URL固定なので1日1回しか配信しない前提でツイート日をIDにする
-		ID:      fmt.Sprintf("%v-%v-%v-biibili", tweetDate.Year(), int(tweetDate.Month()), tweetDate.Day()),
-		ActorID: actor.ID,
-		Source:  model.VideoSourceBilibili,
-		URL:     bilibiliURL,
-		IsLive:  true,
-		StartAt: tweetDate,
+		ID:        fmt.Sprintf("%v-%v-%v-biibili", tweetDate.Year(), int(tweetDate.Month()), tweetDate.Day()),
+		ActorID:   actor.ID,
+		Source:    model.VideoSourceBilibili,
+		URL:       bilibiliURL,
+		ChannelID: channelID,
+		Title:     roomInfo.Data.RoomInfo.Title,
+		IsLive:    true,
+		StartAt:   tweetDate,
 	}, nil
 }
+
+// findChannelID 配信者のチャンネルからBilibiliのユーザーIDが一致するものを探す
+func findChannelID(actor model.Actor, uid uint64) (string, error) {
+	channels := actor.Channels(model.VideoSourceBilibili)
+	if len(channels) == 0 {
+		return "", fmt.Errorf("invalid actor bilibiliID: %v", actor.BilibiliID)
+	}
+
+	for _, c := range channels {
+		id, err := strconv.ParseUint(c.ID, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid actor bilibiliID: %v", c.ID)
+		}
+
+		if id == uid {
+			return c.ID, nil
+		}
+	}
+
+	return "", common.ErrInvalidChannel
+}
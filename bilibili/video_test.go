@@ -1,6 +1,11 @@
 package bilibili
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
 
 func TestIsBilibiliURL(t *testing.T) {
 	urls := []string{
@@ -13,3 +18,27 @@ func TestIsBilibiliURL(t *testing.T) {
 		}
 	}
 }
+
+func TestFindChannelID(t *testing.T) {
+	actor := model.Actor{
+		BilibiliID: "100",
+		SubChannels: []model.Channel{
+			{Source: model.VideoSourceBilibili, ID: "200"},
+		},
+	}
+
+	id, err := findChannelID(actor, 200)
+	if err != nil || id != "200" {
+		t.Fatalf("sub channel, got: %v %v", id, err)
+	}
+
+	_, err = findChannelID(actor, 300)
+	if err != common.ErrInvalidChannel {
+		t.Fatalf("other channel, got: %v", err)
+	}
+
+	_, err = findChannelID(model.Actor{}, 100)
+	if err == nil || err == common.ErrInvalidChannel {
+		t.Fatalf("no channel, got: %v", err)
+	}
+}
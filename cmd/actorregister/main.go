@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"log"
+	"os"
 
 	"cloud.google.com/go/firestore"
 	"github.com/yaegaki/dotlive-schedule-server/model"
@@ -14,13 +15,12 @@ import (
 func main() {
 	// 配信者をjsonファイルから登録する
 
-	// args := os.Args
-	// if len(args) != 2 {
-	// 	log.Fatal("usage: actorregister path/to/json")
-	// }
+	args := os.Args
+	if len(args) != 2 {
+		log.Fatal("usage: actorregister path/to/json")
+	}
 
-	// a := args[1]
-	a := "actors/202101.json"
+	a := args[1]
 	bytes, err := ioutil.ReadFile(a)
 	if err != nil {
 		log.Fatalf("Can not open %v", a)
@@ -58,7 +58,7 @@ func main() {
 			Emoji:             a.Emoji,
 			YoutubeChannelID:  a.YoutubeChannelID,
 		}
-		err = store.CreateActor(ctx, client, actor)
+		_, err = store.CreateActor(ctx, client, actor)
 		if err != nil {
 			log.Printf("Can not create actor '%v': %v", actor.Name, err)
 			continue
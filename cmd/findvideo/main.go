@@ -24,7 +24,7 @@ func main() {
 	}
 
 	url := "https://www.youtube.com/watch?v=l8msnfPoPI8"
-	v, err := youtube.FindVideo(ctx, youtubeService, url, model.Actor{}, jst.ShortDate(2020, 1, 1))
+	v, err := youtube.FindVideo(ctx, youtubeService, url, model.Actor{}, model.Organization{}, jst.ShortDate(2020, 1, 1))
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+func main() {
+	// 組織の情報と配信者の属性をjsonファイルから登録する
+
+	args := os.Args
+	if len(args) != 2 {
+		log.Fatal("usage: organizationregister path/to/json")
+	}
+
+	a := args[1]
+	bytes, err := ioutil.ReadFile(a)
+	if err != nil {
+		log.Fatalf("Can not open %v", a)
+	}
+
+	var temp organization
+	err = json.Unmarshal(bytes, &temp)
+	if err != nil {
+		log.Fatalf("Can not parse json")
+	}
+
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		log.Fatalf("Can not create a firestore client: %v", err)
+	}
+	defer client.Close()
+
+	err = store.SaveOrganization(ctx, client, model.Organization{
+		Name:               temp.Name,
+		FallbackIcon:       temp.FallbackIcon,
+		TwitterScreenName:  temp.TwitterScreenName,
+		YoutubeChannelID:   temp.YoutubeChannelID,
+		YoutubeChannelName: temp.YoutubeChannelName,
+	})
+	if err != nil {
+		log.Fatalf("Can not save organization: %v", err)
+	}
+	log.Printf("Save organization: %v", temp.Name)
+
+	actors, err := store.FindActors(ctx, client)
+	if err != nil {
+		log.Fatalf("Can not get actors: %v", err)
+	}
+
+	for _, id := range temp.UploadsArePlannedActorIDs {
+		actor, err := actors.FindActor(id)
+		if err != nil {
+			log.Printf("Unknown actor: %v", id)
+			continue
+		}
+
+		if actor.UploadsArePlanned {
+			continue
+		}
+
+		actor.UploadsArePlanned = true
+		err = store.SaveActor(ctx, client, actor)
+		if err != nil {
+			log.Printf("Can not save actor '%v': %v", actor.Name, err)
+			continue
+		}
+
+		log.Printf("Update actor: %v", actor.Name)
+	}
+}
+
+type organization struct {
+	Name               string `json:"name"`
+	FallbackIcon       string `json:"fallbackIcon"`
+	TwitterScreenName  string `json:"twitterScreenName"`
+	YoutubeChannelID   string `json:"youtubeChannelId"`
+	YoutubeChannelName string `json:"youtubeChannelName"`
+	// UploadsArePlannedActorIDs 生放送ではない動画を常に計画された配信として扱う配信者
+	UploadsArePlannedActorIDs []string `json:"uploadsArePlannedActorIds"`
+}
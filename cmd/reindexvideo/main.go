@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	firebase "firebase.google.com/go"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/store"
+)
+
+// 検索用のトークンが作成される前に保存された動画のトークンを作成する
+func main() {
+	ctx := context.Background()
+	app, err := firebase.NewApp(ctx, nil)
+	if err != nil {
+		log.Fatalf("Can not create firebase app: %v", err)
+	}
+
+	storeCli, err := app.Firestore(ctx)
+	if err != nil {
+		log.Fatalf("Can not create firestore client: %v", err)
+	}
+
+	videos, err := store.FindVideos(ctx, storeCli, jst.Range{
+		Begin: jst.From(time.Unix(0, 0)),
+		End:   jst.Now().AddDay(365),
+	})
+	if err != nil {
+		log.Fatalf("Can not get videos: %v", err)
+	}
+
+	for _, v := range videos {
+		// 保存時に検索用のトークンが作成される
+		_, _, err = store.SaveVideo(ctx, storeCli, v, nil)
+		if err != nil {
+			log.Fatalf("Can not save video: %v %v", v.ID, err)
+		}
+	}
+
+	log.Printf("%v videos reindexed", len(videos))
+}
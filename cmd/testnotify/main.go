@@ -78,8 +78,10 @@ func main() {
 		log.Fatalf("Can not get videos: %v", err)
 	}
 
+	notifier := notify.NewFCMNotifier(msgCli)
+
 	// 計画の通知
-	notify.PushNotifyPlan(ctx, msgCli, plan, actors)
+	notifier.Notify(ctx, notify.NewPlanPublishedEvent(plan, actors))
 
 	// 動画の通知
 	actor, err := actors.FindActor(videos[0].ActorID)
@@ -88,5 +90,5 @@ func main() {
 	}
 	log.Print(actor)
 
-	notify.PushNotifyVideo(ctx, msgCli, videos[0].StartAt, videos[0], []model.Actor{actor})
+	notifier.Notify(ctx, notify.NewStreamStartedEvent(videos[0].StartAt, videos[0], []model.Actor{actor}))
 }
@@ -5,9 +5,9 @@ import (
 	"log"
 
 	firebase "firebase.google.com/go"
+	"github.com/yaegaki/dotlive-schedule-server/model"
 	"github.com/yaegaki/dotlive-schedule-server/store"
-	"golang.org/x/oauth2/google"
-	y "google.golang.org/api/youtube/v3"
+	"github.com/yaegaki/dotlive-schedule-server/youtube"
 )
 
 func main() {
@@ -27,29 +27,35 @@ func main() {
 		log.Fatalf("Can not get actors: %v", err)
 	}
 
-	httpClient, err := google.DefaultClient(ctx, y.YoutubeReadonlyScope)
-	if err != nil {
-		panic(err)
-	}
-
-	youtubeService, err := y.New(httpClient)
+	youtubeService, err := youtube.NewService(ctx)
 	if err != nil {
 		panic(err)
 	}
 
 	for _, actor := range actors {
-		res, err := youtubeService.Channels.List("snippet").Id(actor.YoutubeChannelID).Do()
+		channel, err := youtube.FindChannel(youtubeService, actor.YoutubeChannelID)
 		if err != nil {
 			log.Printf("Can not get channel info: %v %v", actor.Name, err)
 			continue
 		}
+		actor.YoutubeChannelName = channel.Name
 
-		if len(res.Items) == 0 {
-			log.Printf("res.Items is empty: %v", actor.Name)
-			continue
+		// サブチャンネルの名前も更新する
+		channels := append([]model.Channel{}, actor.SubChannels...)
+		for i, c := range channels {
+			if c.Source != model.VideoSourceYoutube {
+				continue
+			}
+
+			channel, err := youtube.FindChannel(youtubeService, c.ID)
+			if err != nil {
+				log.Printf("Can not get sub channel info: %v %v %v", actor.Name, c.ID, err)
+				continue
+			}
+			channels[i].Name = channel.Name
 		}
+		actor.SubChannels = channels
 
-		actor.YoutubeChannelName = res.Items[0].Snippet.Title
 		err = store.SaveActor(ctx, storeCli, actor)
 		if err != nil {
 			log.Fatalf("Can not save actor: %v %v", actor.Name, err)
@@ -7,4 +7,6 @@ var (
 	ErrNotFound = errors.New("Not found")
 	// ErrInvalidChannel 動画が対象配信者の物じゃない
 	ErrInvalidChannel = errors.New("Invalid channel")
+	// ErrVideoUnavailable 動画が削除されたか非公開になっている
+	ErrVideoUnavailable = errors.New("Video unavailable")
 )
@@ -0,0 +1,127 @@
+package event
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+)
+
+const (
+	// TypePlanSaved 計画が保存された
+	TypePlanSaved = "plan"
+	// TypeVideoSaved 動画が保存された
+	TypeVideoSaved = "video"
+	// TypeVideoRescheduled 動画の開始時刻が変更された
+	TypeVideoRescheduled = "videoRescheduled"
+	// TypeNotificationSent プッシュ通知を送信した
+	TypeNotificationSent = "notification"
+	// TypeReset 再開できないので最新の情報を取得し直す必要がある
+	TypeReset = "reset"
+)
+
+// Event スケジュールの変更などのイベント
+type Event struct {
+	// ID イベントID
+	// 再開に使用する
+	ID string
+	// Type イベントの種類
+	Type string
+	// Data JSONにしたイベントの内容
+	Data json.RawMessage
+}
+
+// Subscription イベントの購読
+type Subscription struct {
+	// Missed 再開時に指定したイベント以降に発生したイベント
+	Missed []Event
+	// Reset 指定したイベントから再開できないかどうか
+	Reset bool
+	// Events 新しいイベント
+	// 購読が解除されるか受信が追いつかない場合はcloseされる
+	Events <-chan Event
+	// Close 購読を解除する
+	Close func()
+}
+
+// Broker イベントの配信
+// 1インスタンスの場合はLocalBrokerで十分だが、
+// 複数インスタンスで配信する場合はインスタンス間でイベントを共有するSharedBrokerに差し替える
+type Broker interface {
+	// Publish イベントを発行する
+	Publish(eventType string, data interface{}) error
+	// Subscribe イベントを購読する
+	// lastEventIDが空文字でない場合はそのイベントより後のイベントから再開する
+	Subscribe(lastEventID string) Subscription
+}
+
+var broker Broker = NewLocalBroker(defaultLogSize)
+var brokerMutex sync.RWMutex
+
+// SetBroker 使用するBrokerを差し替える
+func SetBroker(b Broker) {
+	brokerMutex.Lock()
+	defer brokerMutex.Unlock()
+
+	broker = b
+}
+
+// GetBroker 使用しているBrokerを取得する
+func GetBroker() Broker {
+	brokerMutex.RLock()
+	defer brokerMutex.RUnlock()
+
+	return broker
+}
+
+// Publish イベントを発行する
+// イベントの発行に失敗しても本来の処理は続けられるのでログだけ出す
+func Publish(eventType string, data interface{}) {
+	err := GetBroker().Publish(eventType, data)
+	if err != nil {
+		log.Printf("Can not publish event %v: %v", eventType, err)
+	}
+}
+
+// PlanSaved 計画が保存されたイベントの内容
+type PlanSaved struct {
+	// Date 計画の日付
+	Date jst.Time `json:"date"`
+	// TweetID 計画のツイートID
+	TweetID string `json:"tweetId"`
+}
+
+// VideoSaved 動画が保存されたイベントの内容
+type VideoSaved struct {
+	// VideoID 動画ID
+	VideoID string `json:"videoId"`
+	// ActorID 配信者ID
+	ActorID string `json:"actorId"`
+	// URL 動画のURL
+	URL string `json:"url"`
+	// Source 配信サイト
+	Source string `json:"source"`
+	// StartAt 開始時刻
+	StartAt jst.Time `json:"startAt"`
+}
+
+// VideoRescheduled 動画の開始時刻が変更されたイベントの内容
+type VideoRescheduled struct {
+	// VideoID 動画ID
+	VideoID string `json:"videoId"`
+	// OldStartAt 変更前の開始時刻
+	OldStartAt jst.Time `json:"oldStartAt"`
+	// NewStartAt 変更後の開始時刻
+	NewStartAt jst.Time `json:"newStartAt"`
+}
+
+// NotificationSent プッシュ通知を送信したイベントの内容
+type NotificationSent struct {
+	// Kind 通知の種類、'plan'か'planUpdated'か'video'か'remind'か'rescheduled'か'canceled'
+	Kind string `json:"kind"`
+	// Date 計画の通知の場合は計画の日付
+	Date *jst.Time `json:"date,omitempty"`
+	// VideoID 動画の通知の場合は動画ID
+	VideoID string `json:"videoId,omitempty"`
+}
@@ -0,0 +1,132 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultLogSize 再開用に保持するイベントの数
+	defaultLogSize = 256
+	// subscriberBufferSize 購読者ごとのバッファ
+	subscriberBufferSize = 16
+)
+
+// LocalBroker 同じインスタンス内でイベントを配信する
+// 再開用に直近のイベントだけを保持する
+type LocalBroker struct {
+	mu sync.Mutex
+	// epoch インスタンスの起動ごとに異なる値
+	// 再起動前のイベントIDで再開しようとした場合に検知するために使う
+	epoch string
+	seq   uint64
+	size  int
+	log   []Event
+	subs  map[chan Event]struct{}
+}
+
+// NewLocalBroker LocalBrokerを作成する
+// sizeは再開用に保持するイベントの数
+func NewLocalBroker(size int) *LocalBroker {
+	return &LocalBroker{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:  size,
+		subs:  map[chan Event]struct{}{},
+	}
+}
+
+// Publish impl Broker
+func (b *LocalBroker) Publish(eventType string, data interface{}) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e := Event{
+		ID:   fmt.Sprintf("%v-%v", b.epoch, b.seq),
+		Type: eventType,
+		Data: bytes,
+	}
+
+	b.log = append(b.log, e)
+	if len(b.log) > b.size {
+		b.log = b.log[len(b.log)-b.size:]
+	}
+
+	broadcast(b.subs, e)
+	return nil
+}
+
+// broadcast 全ての購読者にイベントを配信する
+// 呼び出し側でロックしておく
+func broadcast(subs map[chan Event]struct{}, e Event) {
+	for ch := range subs {
+		select {
+		case ch <- e:
+		default:
+			// 受信が追いつかない購読者は切断する
+			// クライアントは再接続時にLast-Event-IDで再開できる
+			delete(subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe impl Broker
+func (b *LocalBroker) Subscribe(lastEventID string) Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBufferSize)
+	b.subs[ch] = struct{}{}
+
+	s := Subscription{
+		Events: ch,
+		Close: func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			if _, ok := b.subs[ch]; ok {
+				delete(b.subs, ch)
+				close(ch)
+			}
+		},
+	}
+
+	if lastEventID != "" {
+		s.Missed, s.Reset = b.findEventsAfter(lastEventID)
+	}
+
+	return s
+}
+
+// findEventsAfter 指定したイベントより後のイベントを探す
+// 保持しているイベントから再開できない場合はresetがtrueになる
+func (b *LocalBroker) findEventsAfter(lastEventID string) (events []Event, reset bool) {
+	xs := strings.SplitN(lastEventID, "-", 2)
+	if len(xs) != 2 || xs[0] != b.epoch {
+		return nil, true
+	}
+
+	seq, err := strconv.ParseUint(xs[1], 10, 64)
+	if err != nil || seq > b.seq {
+		return nil, true
+	}
+
+	// 保持しているイベントより前の場合は取りこぼしがある
+	if seq < b.seq-uint64(len(b.log)) {
+		return nil, true
+	}
+
+	// 最後のイベントがseqになるのでそれ以降が未受信
+	missed := b.seq - seq
+	return append([]Event{}, b.log[uint64(len(b.log))-missed:]...), false
+}
@@ -0,0 +1,80 @@
+package event
+
+import (
+	"testing"
+)
+
+func TestLocalBroker(t *testing.T) {
+	b := NewLocalBroker(3)
+
+	s := b.Subscribe("")
+	defer s.Close()
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		err := b.Publish(TypePlanSaved, PlanSaved{TweetID: "x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e := <-s.Events
+		if e.Type != TypePlanSaved {
+			t.Errorf("type, got: %v expect: %v", e.Type, TypePlanSaved)
+		}
+		ids = append(ids, e.ID)
+	}
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		missed      []string
+		reset       bool
+	}{
+		{"latest", ids[4], nil, false},
+		{"in log", ids[2], ids[3:], false},
+		{"oldest in log", ids[1], ids[2:], false},
+		{"too old", ids[0], nil, true},
+		{"other epoch", "xxx-1", nil, true},
+		{"invalid", "invalid", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := b.Subscribe(tt.lastEventID)
+			defer s.Close()
+
+			if s.Reset != tt.reset {
+				t.Errorf("reset, got: %v expect: %v", s.Reset, tt.reset)
+			}
+
+			if len(s.Missed) != len(tt.missed) {
+				t.Fatalf("len(missed), got: %v expect: %v", len(s.Missed), len(tt.missed))
+			}
+
+			for i, id := range tt.missed {
+				if s.Missed[i].ID != id {
+					t.Errorf("missed[%v], got: %v expect: %v", i, s.Missed[i].ID, id)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalBrokerSlowSubscriber(t *testing.T) {
+	b := NewLocalBroker(3)
+	s := b.Subscribe("")
+	defer s.Close()
+
+	for i := 0; i < subscriberBufferSize+1; i++ {
+		b.Publish(TypeVideoSaved, VideoSaved{})
+	}
+
+	count := 0
+	for range s.Events {
+		count++
+	}
+
+	if count != subscriberBufferSize {
+		t.Errorf("count, got: %v expect: %v", count, subscriberBufferSize)
+	}
+}
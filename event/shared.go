@@ -0,0 +1,278 @@
+package event
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sharedPollInterval 保存先から新しいイベントを取得する間隔
+	sharedPollInterval = 2 * time.Second
+	// sharedPollOverlap インスタンス間の時刻のずれで取りこぼさないように重複して取得する期間
+	sharedPollOverlap = 10 * time.Second
+	// sharedTimeout 保存先へのアクセスのタイムアウト
+	sharedTimeout = 10 * time.Second
+)
+
+// Store インスタンス間でイベントを共有するための保存先
+type Store interface {
+	// Append イベントを保存する
+	Append(ctx context.Context, e Event, createdAt time.Time) error
+	// FindSince 指定した時刻以降に保存されたイベントを保存した時刻順に取得する
+	FindSince(ctx context.Context, since time.Time, limit int) ([]Event, error)
+}
+
+// SharedBroker 保存先を経由して全てのインスタンスにイベントを配信する
+// 発行したイベントは保存するだけで、各インスタンスがRunで保存先を定期的に取得して購読者に配信する
+type SharedBroker struct {
+	store Store
+	// size 1回で取得するイベントの数
+	size int
+
+	mu sync.Mutex
+	// last 最後に配信したイベントの時刻
+	last time.Time
+	// seen 重複して取得する期間内に配信したイベント
+	seen map[string]time.Time
+	subs map[chan Event]struct{}
+}
+
+// NewSharedBroker SharedBrokerを作成する
+// 再開時にLocalBrokerと同じ数より多くのイベントを取りこぼしている場合は取得し直す
+func NewSharedBroker(store Store) *SharedBroker {
+	return &SharedBroker{
+		store: store,
+		size:  defaultLogSize,
+		last:  time.Now(),
+		seen:  map[string]time.Time{},
+		subs:  map[chan Event]struct{}{},
+	}
+}
+
+// Publish impl Broker
+func (b *SharedBroker) Publish(eventType string, data interface{}) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	// Firestoreの時刻はマイクロ秒までなのでそろえる
+	now := time.Now().Truncate(time.Microsecond)
+	id, err := newSharedEventID(now)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sharedTimeout)
+	defer cancel()
+
+	return b.store.Append(ctx, Event{
+		ID:   id,
+		Type: eventType,
+		Data: bytes,
+	}, now)
+}
+
+// Subscribe impl Broker
+func (b *SharedBroker) Subscribe(lastEventID string) Subscription {
+	// 未受信のイベントを取得している間に配信されたイベントを取りこぼさないようにロックしたまま取得する
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// 購読者がいない間は取得していないので、取得していない期間のイベントは配信済みとして扱う
+	if len(b.subs) == 0 {
+		b.last = time.Now()
+		b.seen = map[string]time.Time{}
+	}
+
+	ch := make(chan Event, subscriberBufferSize)
+	b.subs[ch] = struct{}{}
+
+	s := Subscription{
+		Events: ch,
+		Close: func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			if _, ok := b.subs[ch]; ok {
+				delete(b.subs, ch)
+				close(ch)
+			}
+		},
+	}
+
+	if lastEventID != "" {
+		s.Missed, s.Reset = b.findEventsAfter(lastEventID)
+	}
+
+	return s
+}
+
+// findEventsAfter 指定したイベントより後の配信済みのイベントを探す
+// まだ配信していないイベントは後でEventsに配信される
+// 指定したイベントが保存されていない場合はresetがtrueになる
+func (b *SharedBroker) findEventsAfter(lastEventID string) (events []Event, reset bool) {
+	t, ok := parseSharedEventID(lastEventID)
+	if !ok {
+		return nil, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sharedTimeout)
+	defer cancel()
+
+	// 指定したイベントとsize個より多いかどうかを判定するために2つ多く取得する
+	temp, err := b.store.FindSince(ctx, t, b.size+2)
+	if err != nil {
+		log.Printf("Can not find events: %v", err)
+		return nil, true
+	}
+
+	// 保存先から削除されているか取りこぼしが多すぎる
+	if len(temp) == 0 || temp[0].ID != lastEventID || len(temp)-1 > b.size {
+		return nil, true
+	}
+
+	for _, e := range temp[1:] {
+		if b.delivered(e) {
+			events = append(events, e)
+		}
+	}
+
+	return events, false
+}
+
+// delivered 購読者に配信済みのイベントかどうか
+func (b *SharedBroker) delivered(e Event) bool {
+	if _, ok := b.seen[e.ID]; ok {
+		return true
+	}
+
+	t, ok := parseSharedEventID(e.ID)
+	return ok && t.Before(b.last.Add(-sharedPollOverlap))
+}
+
+// Run 保存先から新しいイベントを定期的に取得して購読者に配信する
+// 購読者がいない間は保存先から取得しない
+// ctxが終了するまで戻らない
+func (b *SharedBroker) Run(ctx context.Context) {
+	ticker := time.NewTicker(sharedPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := b.pollIfSubscribed(ctx)
+			if err != nil {
+				log.Printf("Can not poll events: %v", err)
+			}
+		}
+	}
+}
+
+// pollIfSubscribed 購読者がいる場合だけ保存先から新しいイベントを取得する
+func (b *SharedBroker) pollIfSubscribed(ctx context.Context) error {
+	b.mu.Lock()
+	subscribed := len(b.subs) > 0
+	b.mu.Unlock()
+
+	if !subscribed {
+		return nil
+	}
+
+	return b.poll(ctx)
+}
+
+// poll 保存先から新しいイベントを取得して購読者に配信する
+func (b *SharedBroker) poll(ctx context.Context) error {
+	b.mu.Lock()
+	since := b.last.Add(-sharedPollOverlap)
+	b.mu.Unlock()
+
+	for {
+		ctx, cancel := context.WithTimeout(ctx, sharedTimeout)
+		events, err := b.store.FindSince(ctx, since, b.size)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		b.deliver(events)
+
+		// 取得しきれなかった場合は続きを取得する
+		if len(events) < b.size {
+			return nil
+		}
+
+		next, ok := parseSharedEventID(events[len(events)-1].ID)
+		if !ok || !next.After(since) {
+			return nil
+		}
+		since = next
+	}
+}
+
+// deliver まだ配信していないイベントを購読者に配信する
+func (b *SharedBroker) deliver(events []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, e := range events {
+		if _, ok := b.seen[e.ID]; ok {
+			continue
+		}
+
+		t, ok := parseSharedEventID(e.ID)
+		if !ok {
+			continue
+		}
+
+		b.seen[e.ID] = t
+		if t.After(b.last) {
+			b.last = t
+		}
+		broadcast(b.subs, e)
+	}
+
+	for id, t := range b.seen {
+		if t.Before(b.last.Add(-sharedPollOverlap)) {
+			delete(b.seen, id)
+		}
+	}
+}
+
+// newSharedEventID 発行した時刻(マイクロ秒)から並べ替えられるイベントIDを作成する
+// 同じ時刻に別のインスタンスで発行しても重複しないように乱数を付ける
+func newSharedEventID(now time.Time) (string, error) {
+	b := make([]byte, 4)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%016d-%v", now.UnixNano()/int64(time.Microsecond), hex.EncodeToString(b)), nil
+}
+
+// parseSharedEventID イベントIDから発行した時刻を取得する
+func parseSharedEventID(id string) (time.Time, bool) {
+	xs := strings.SplitN(id, "-", 2)
+	if len(xs) != 2 {
+		return time.Time{}, false
+	}
+
+	micro, err := strconv.ParseInt(xs[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, micro*int64(time.Microsecond)), true
+}
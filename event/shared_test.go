@@ -0,0 +1,173 @@
+package event
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore メモリ上にイベントを保存するStore
+type memoryStore struct {
+	mu     sync.Mutex
+	events []Event
+	times  []time.Time
+	finds  int
+}
+
+func (s *memoryStore) Append(ctx context.Context, e Event, createdAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, e)
+	s.times = append(s.times, createdAt)
+	return nil
+}
+
+func (s *memoryStore) FindSince(ctx context.Context, since time.Time, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.finds++
+	var result []Event
+	for i, e := range s.events {
+		if !s.times[i].Before(since) {
+			result = append(result, e)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func TestSharedBroker(t *testing.T) {
+	store := &memoryStore{}
+	// 別のインスタンスを想定して発行と購読に別のSharedBrokerを使う
+	publisher := NewSharedBroker(store)
+	b := NewSharedBroker(store)
+	b.size = 3
+
+	s := b.Subscribe("")
+	defer s.Close()
+
+	for i := 0; i < 3; i++ {
+		err := publisher.Publish(TypeVideoSaved, VideoSaved{VideoID: "video"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 同じ時刻にならないようにする
+		time.Sleep(time.Millisecond)
+	}
+
+	err := b.poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 重複して取得しても一度しか配信しない
+	err = b.poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for len(ids) < 3 {
+		select {
+		case e := <-s.Events:
+			if e.Type != TypeVideoSaved {
+				t.Errorf("type, got: %v", e.Type)
+			}
+			ids = append(ids, e.ID)
+		default:
+			t.Fatalf("events must be delivered: %v", ids)
+		}
+	}
+
+	select {
+	case e := <-s.Events:
+		t.Errorf("event must be delivered once: %v", e.ID)
+	default:
+	}
+
+	// まだ配信していないイベントはMissedに含めずに後で配信する
+	publisher.Publish(TypeVideoSaved, VideoSaved{VideoID: "pending"})
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		missed      []string
+		reset       bool
+	}{
+		{"latest", ids[2], nil, false},
+		{"in store", ids[0], ids[1:], false},
+		{"not found", "0000000000000000-00000000", nil, true},
+		{"invalid", "invalid", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := b.Subscribe(tt.lastEventID)
+			defer s.Close()
+
+			if s.Reset != tt.reset {
+				t.Errorf("reset, got: %v expect: %v", s.Reset, tt.reset)
+			}
+
+			if len(s.Missed) != len(tt.missed) {
+				t.Fatalf("len(missed), got: %v expect: %v", len(s.Missed), len(tt.missed))
+			}
+
+			for i, id := range tt.missed {
+				if s.Missed[i].ID != id {
+					t.Errorf("missed[%v], got: %v expect: %v", i, s.Missed[i].ID, id)
+				}
+			}
+		})
+	}
+}
+
+func TestSharedBrokerPollIfSubscribed(t *testing.T) {
+	store := &memoryStore{}
+	b := NewSharedBroker(store)
+
+	// 購読者がいない間は取得しない
+	err := b.pollIfSubscribed(context.Background())
+	if err != nil || store.finds != 0 {
+		t.Errorf("must not poll without subscribers: %v %v", store.finds, err)
+	}
+
+	s := b.Subscribe("")
+	err = b.pollIfSubscribed(context.Background())
+	if err != nil || store.finds != 1 {
+		t.Errorf("must poll with subscribers: %v %v", store.finds, err)
+	}
+
+	s.Close()
+	err = b.pollIfSubscribed(context.Background())
+	if err != nil || store.finds != 1 {
+		t.Errorf("must stop polling after the last subscriber leaves: %v %v", store.finds, err)
+	}
+}
+
+func TestSharedEventID(t *testing.T) {
+	now := time.Date(2020, 4, 29, 20, 0, 0, 123456000, time.UTC)
+	id, err := newSharedEventID(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, ok := parseSharedEventID(id)
+	if !ok || !parsed.Equal(now) {
+		t.Errorf("got: %v expect: %v", parsed, now)
+	}
+
+	later, _ := newSharedEventID(now.Add(time.Microsecond))
+	if !(id < later) {
+		t.Errorf("id must be sortable: %v, %v", id, later)
+	}
+}
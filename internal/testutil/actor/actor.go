@@ -83,6 +83,7 @@ var Siro = model.Actor{
 	Name:              "電脳少女シロ",
 	TwitterScreenName: "test-siro",
 	Emoji:             "🐬",
+	UploadsArePlanned: true,
 }
 
 // Milk .
@@ -121,6 +122,15 @@ var Rikumu = model.Actor{
 	Emoji:             "🌃🎩",
 }
 
+// Organization .
+var Organization = model.Organization{
+	Name:               "どっとライブ",
+	FallbackIcon:       "https://example.com/dotlive.jpg",
+	TwitterScreenName:  "test-dotlive",
+	YoutubeChannelID:   "test-dotlive-channel",
+	YoutubeChannelName: "どっとライブ",
+}
+
 // All .
 var All = []model.Actor{
 	Iori,
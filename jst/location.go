@@ -0,0 +1,36 @@
+package jst
+
+import (
+	"time"
+
+	// App Engineの実行環境にタイムゾーン情報がない場合に備えて埋め込む
+	_ "time/tzdata"
+)
+
+// Location JSTのタイムゾーンを取得する
+func Location() *time.Location {
+	return jstLocation
+}
+
+// IsJST JSTのタイムゾーンかどうか
+func IsJST(loc *time.Location) bool {
+	return loc == jstLocation
+}
+
+// LoadLocation タイムゾーン名からタイムゾーンを取得する
+// 空文字もしくはAsia/Tokyoの場合はJSTのタイムゾーンを返す
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" || name == "Asia/Tokyo" || name == "JST" {
+		return jstLocation, nil
+	}
+
+	return time.LoadLocation(name)
+}
+
+// ShortDateIn タイムゾーンと日付を指定してTimeを作成する
+// 夏時間があるタイムゾーンでも日付の始まりになるようにAddDayではなくこちらを使用する
+func ShortDateIn(year int, month time.Month, day int, loc *time.Location) Time {
+	return Time{
+		t: time.Date(year, month, day, 0, 0, 0, 0, loc),
+	}
+}
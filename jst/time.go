@@ -29,9 +29,10 @@ func (t Time) Time() time.Time {
 }
 
 // FloorToDay 時間を切り捨てる
+// Inでタイムゾーンを変更している場合はそのタイムゾーンの日付で切り捨てる
 func (t Time) FloorToDay() Time {
 	return Time{
-		t: time.Date(t.t.Year(), t.t.Month(), t.t.Day(), 0, 0, 0, 0, jstLocation),
+		t: time.Date(t.t.Year(), t.t.Month(), t.t.Day(), 0, 0, 0, 0, t.t.Location()),
 	}
 }
 
@@ -49,6 +50,25 @@ func Date(year int, month time.Month, day int, hour int, min int) Time {
 	}
 }
 
+// In 指定したタイムゾーンのTimeに変換する
+// 変換後のYearやDayなどは指定したタイムゾーンのものになる
+// 表示用に使用するもので計画などの日付の計算はJSTのまま行う
+func (t Time) In(loc *time.Location) Time {
+	return Time{
+		t: t.t.In(loc),
+	}
+}
+
+// JST JSTのTimeに変換する
+func (t Time) JST() Time {
+	return t.In(jstLocation)
+}
+
+// Location タイムゾーンを取得する
+func (t Time) Location() *time.Location {
+	return t.t.Location()
+}
+
 // Year 年
 func (t Time) Year() int {
 	return t.t.Year()
@@ -74,6 +94,11 @@ func (t Time) Minute() int {
 	return t.t.Minute()
 }
 
+// IsZero ゼロ値かどうか
+func (t Time) IsZero() bool {
+	return t.t.IsZero()
+}
+
 // Equal 比較する
 func (t Time) Equal(other Time) bool {
 	return t.t.Equal(other.t)
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"os"
 
 	"github.com/labstack/echo/v4"
 	"github.com/yaegaki/dotlive-schedule-server/app"
+	"github.com/yaegaki/dotlive-schedule-server/event"
 	"github.com/yaegaki/dotlive-schedule-server/store"
 )
 
@@ -12,6 +14,11 @@ func main() {
 	store.Init()
 	defer store.CloseClient()
 
+	// 複数のインスタンスで動作するのでイベントはFirestoreを経由して全てのインスタンスの購読者に配信する
+	broker := event.NewSharedBroker(store.NewEventStore(store.GetClient()))
+	go broker.Run(context.Background())
+	event.SetBroker(broker)
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
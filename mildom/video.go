@@ -34,17 +34,18 @@ func FindVideo(mildomURL string, actor model.Actor, tweetDate jst.Time) (model.V
 	}
 
 	mildomID := xs[len(xs)-1]
-	if actor.MildomID != mildomID {
+	if !actor.HasChannel(model.VideoSourceMildom, mildomID) {
 		return model.Video{}, common.ErrInvalidChannel
 	}
 
 	return model.Video{
 		// Mildomは放送URL固定なので1日1回しか配信しない前提でツイート日をIDにする
-		ID:      fmt.Sprintf("%v-%v-%v-mildom-%v", tweetDate.Year(), int(tweetDate.Month()), tweetDate.Day(), actor.ID),
-		ActorID: actor.ID,
-		Source:  model.VideoSourceMildom,
-		URL:     mildomURL,
-		IsLive:  true,
-		StartAt: tweetDate,
+		ID:        fmt.Sprintf("%v-%v-%v-mildom-%v", tweetDate.Year(), int(tweetDate.Month()), tweetDate.Day(), actor.ID),
+		ActorID:   actor.ID,
+		Source:    model.VideoSourceMildom,
+		URL:       mildomURL,
+		ChannelID: mildomID,
+		IsLive:    true,
+		StartAt:   tweetDate,
 	}, nil
 }
@@ -46,3 +46,29 @@ func TestFindVideo(t *testing.T) {
 		t.Fatalf("profile page")
 	}
 }
+
+func TestFindVideoSubChannel(t *testing.T) {
+	actor := model.Actor{
+		ID:       "test",
+		MildomID: "1",
+		SubChannels: []model.Channel{
+			{Source: model.VideoSourceYoutube, ID: "10596535"},
+			{Source: model.VideoSourceMildom, ID: "10596535"},
+		},
+	}
+	date := jst.ShortDate(2020, 6, 3)
+	v, err := FindVideo(urls[0], actor, date)
+	if err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+
+	if v.ActorID != actor.ID || v.ChannelID != "10596535" {
+		t.Fatalf("invalid video: %+v", v)
+	}
+
+	actor.SubChannels = actor.SubChannels[:1]
+	_, err = FindVideo(urls[0], actor, date)
+	if err == nil {
+		t.Fatalf("other source channel must not match")
+	}
+}
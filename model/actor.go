@@ -1,12 +1,29 @@
 package model
 
-import "github.com/yaegaki/dotlive-schedule-server/common"
+import (
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+)
 
 const (
 	// ActorIDUnknown コラボの時のID
 	ActorIDUnknown = "UNKNOWN"
 )
 
+const (
+	// ChannelKindMain メインチャンネル
+	ChannelKindMain = "main"
+	// ChannelKindSub サブチャンネル
+	ChannelKindSub = "sub"
+)
+
+const (
+	// ActorStatusActive 活動中
+	ActorStatusActive = "active"
+	// ActorStatusGraduated 卒業済み
+	ActorStatusGraduated = "graduated"
+)
+
 // Actor 配信者
 type Actor struct {
 	// ID 配信者ID
@@ -17,6 +34,10 @@ type Actor struct {
 	Icon string
 	// Hashtag ハッシュタグ
 	Hashtag string
+	// SubHashtags メインのハッシュタグ以外に計画ツイートで使用されるハッシュタグ
+	SubHashtags []string
+	// Aliases 計画ツイートでハッシュタグなしで書かれる場合の別名
+	Aliases []string
 	// TwitterScreenName Twitterのスクリーンネーム
 	TwitterScreenName string
 	// Emoji 推しアイコン
@@ -31,6 +52,174 @@ type Actor struct {
 	MildomID string
 	// LastTweetID 最後に取得したTweetのID
 	LastTweetID string
+	// SubTwitterAccounts メインのアカウント以外のTwitterアカウント
+	SubTwitterAccounts []TwitterAccount
+	// SubChannels メインのチャンネル以外の動画サイトのチャンネル
+	SubChannels []Channel
+	// UploadsArePlanned 生放送ではない動画を常に計画された配信として扱うかどうか
+	UploadsArePlanned bool
+	// Groups 所属するグループのID
+	Groups []string
+	// Status 活動状況
+	// 空文字の場合は活動中とする
+	Status string
+	// ActiveFrom 活動開始日
+	// 分からない場合はゼロ値
+	ActiveFrom jst.Time
+	// ActiveUntil 活動終了日
+	// 活動中の場合はゼロ値
+	ActiveUntil jst.Time
+}
+
+// TwitterAccount 配信者のTwitterアカウント
+type TwitterAccount struct {
+	// ScreenName Twitterのスクリーンネーム
+	ScreenName string
+	// LastTweetID 最後に取得したTweetのID
+	LastTweetID string
+}
+
+// Channel 配信者の動画サイトのチャンネル
+type Channel struct {
+	// Source 動画サイト
+	Source string
+	// ID 動画サイトでのチャンネルID
+	// BilibiliとMildomの場合はユーザーID
+	ID string
+	// Name チャンネル名
+	Name string
+}
+
+// Hashtags 全てのハッシュタグを取得する
+// メインのハッシュタグが先頭になる
+func (a Actor) Hashtags() []string {
+	var hashtags []string
+	if a.Hashtag != "" {
+		hashtags = append(hashtags, a.Hashtag)
+	}
+
+	return append(hashtags, a.SubHashtags...)
+}
+
+// TwitterAccounts 全てのTwitterアカウントを取得する
+// メインのアカウントが先頭になる
+func (a Actor) TwitterAccounts() []TwitterAccount {
+	var accounts []TwitterAccount
+	if a.TwitterScreenName != "" {
+		accounts = append(accounts, TwitterAccount{
+			ScreenName:  a.TwitterScreenName,
+			LastTweetID: a.LastTweetID,
+		})
+	}
+
+	return append(accounts, a.SubTwitterAccounts...)
+}
+
+// WithLastTweetID 指定したアカウントの最後に取得したTweetのIDを更新した配信者を取得する
+func (a Actor) WithLastTweetID(screenName string, tweetID string) Actor {
+	if screenName == a.TwitterScreenName {
+		a.LastTweetID = tweetID
+		return a
+	}
+
+	accounts := append([]TwitterAccount{}, a.SubTwitterAccounts...)
+	for i := range accounts {
+		if accounts[i].ScreenName == screenName {
+			accounts[i].LastTweetID = tweetID
+		}
+	}
+	a.SubTwitterAccounts = accounts
+	return a
+}
+
+// Channels 指定した動画サイトの全てのチャンネルを取得する
+// メインのチャンネルが先頭になる
+func (a Actor) Channels(source string) []Channel {
+	var channels []Channel
+	if id := a.mainChannelID(source); id != "" {
+		main := Channel{Source: source, ID: id}
+		if source == VideoSourceYoutube {
+			main.Name = a.YoutubeChannelName
+		}
+		channels = append(channels, main)
+	}
+
+	for _, c := range a.SubChannels {
+		if c.Source == source {
+			channels = append(channels, c)
+		}
+	}
+
+	return channels
+}
+
+// HasChannel 指定したチャンネルを所有しているかどうか
+func (a Actor) HasChannel(source string, channelID string) bool {
+	return a.ChannelKind(source, channelID) != ""
+}
+
+// ChannelKind 指定したチャンネルがメインかサブかを取得する
+// 所有していないチャンネルの場合は空文字
+func (a Actor) ChannelKind(source string, channelID string) string {
+	if channelID == "" {
+		return ""
+	}
+
+	if channelID == a.mainChannelID(source) {
+		return ChannelKindMain
+	}
+
+	for _, c := range a.SubChannels {
+		if c.Source == source && c.ID == channelID {
+			return ChannelKindSub
+		}
+	}
+
+	return ""
+}
+
+// mainChannelID 指定した動画サイトのメインのチャンネルIDを取得する
+func (a Actor) mainChannelID(source string) string {
+	switch source {
+	case VideoSourceYoutube:
+		return a.YoutubeChannelID
+	case VideoSourceBilibili:
+		return a.BilibiliID
+	case VideoSourceMildom:
+		return a.MildomID
+	}
+
+	return ""
+}
+
+// IsActive 指定した時刻に活動しているかどうか
+// 卒業した配信者も過去のスケジュールなどのために残しておくので
+// 新しい情報を取得するかどうかの判定に使用する
+func (a Actor) IsActive(t jst.Time) bool {
+	if a.Status == ActorStatusGraduated {
+		return false
+	}
+
+	if !a.ActiveFrom.IsZero() && t.Before(a.ActiveFrom) {
+		return false
+	}
+
+	if !a.ActiveUntil.IsZero() && !t.Before(a.ActiveUntil) {
+		return false
+	}
+
+	return true
+}
+
+// InGroup グループに所属しているかどうか
+func (a Actor) InGroup(groupID string) bool {
+	for _, id := range a.Groups {
+		if id == groupID {
+			return true
+		}
+	}
+
+	return false
 }
 
 // ActorSlice Actorのスライス
@@ -47,6 +236,45 @@ func (s ActorSlice) FindActor(id string) (Actor, error) {
 	return Actor{}, common.ErrNotFound
 }
 
+// IsPlannedUpload 計画に関わらず計画された配信として扱う動画かどうか
+// UploadsArePlannedが設定された配信者の生放送ではない動画が対象
+func (s ActorSlice) IsPlannedUpload(v Video) bool {
+	if v.IsLive {
+		return false
+	}
+
+	a, err := s.FindActor(v.ActorID)
+	if err != nil {
+		return false
+	}
+
+	return a.UploadsArePlanned
+}
+
+// FilterByGroup グループに所属する配信者だけにする
+func (s ActorSlice) FilterByGroup(groupID string) ActorSlice {
+	result := ActorSlice{}
+	for _, a := range s {
+		if a.InGroup(groupID) {
+			result = append(result, a)
+		}
+	}
+
+	return result
+}
+
+// FilterActive 指定した時刻に活動している配信者だけにする
+func (s ActorSlice) FilterActive(t jst.Time) ActorSlice {
+	result := ActorSlice{}
+	for _, a := range s {
+		if a.IsActive(t) {
+			result = append(result, a)
+		}
+	}
+
+	return result
+}
+
 // FindActorByName 配信者を探す
 func (s ActorSlice) FindActorByName(name string) (Actor, error) {
 	for _, a := range s {
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+)
+
+func TestActorIsActive(t *testing.T) {
+	now := jst.Date(2021, 4, 1, 12, 0)
+	tests := []struct {
+		name     string
+		actor    Actor
+		expected bool
+	}{
+		{"default", Actor{}, true},
+		{"active", Actor{Status: ActorStatusActive, ActiveFrom: jst.ShortDate(2020, 4, 1)}, true},
+		{"graduated", Actor{Status: ActorStatusGraduated}, false},
+		{"before debut", Actor{ActiveFrom: jst.ShortDate(2021, 4, 2)}, false},
+		{"debut day", Actor{ActiveFrom: jst.ShortDate(2021, 4, 1)}, true},
+		{"after until", Actor{ActiveUntil: jst.ShortDate(2021, 4, 1)}, false},
+		{"before until", Actor{ActiveUntil: jst.ShortDate(2021, 4, 2)}, true},
+	}
+
+	for _, tt := range tests {
+		if tt.actor.IsActive(now) != tt.expected {
+			t.Errorf("%v, got: %v expect: %v", tt.name, !tt.expected, tt.expected)
+		}
+	}
+
+	actors := ActorSlice{
+		{ID: "a"},
+		{ID: "b", Status: ActorStatusGraduated},
+		{ID: "c", ActiveUntil: jst.ShortDate(2021, 3, 31)},
+	}
+	active := actors.FilterActive(now)
+	if len(active) != 1 || active[0].ID != "a" {
+		t.Errorf("FilterActive, got: %v", active)
+	}
+}
+
+func TestActorTwitterAccounts(t *testing.T) {
+	a := Actor{
+		TwitterScreenName: "main",
+		LastTweetID:       "1",
+		SubTwitterAccounts: []TwitterAccount{
+			{ScreenName: "sub", LastTweetID: "2"},
+		},
+	}
+
+	accounts := a.TwitterAccounts()
+	if len(accounts) != 2 || accounts[0].ScreenName != "main" || accounts[0].LastTweetID != "1" || accounts[1].ScreenName != "sub" {
+		t.Fatalf("invalid accounts: %+v", accounts)
+	}
+
+	b := a.WithLastTweetID("sub", "3")
+	if b.LastTweetID != "1" || b.SubTwitterAccounts[0].LastTweetID != "3" {
+		t.Errorf("sub account must be updated: %+v", b)
+	}
+	if a.SubTwitterAccounts[0].LastTweetID != "2" {
+		t.Errorf("original must not be modified: %+v", a)
+	}
+
+	c := b.WithLastTweetID("main", "4")
+	if c.LastTweetID != "4" || c.SubTwitterAccounts[0].LastTweetID != "3" {
+		t.Errorf("main account must be updated: %+v", c)
+	}
+
+	if len((Actor{}).TwitterAccounts()) != 0 {
+		t.Errorf("no accounts")
+	}
+}
+
+func TestActorChannelKind(t *testing.T) {
+	a := Actor{
+		YoutubeChannelID:   "main-youtube",
+		YoutubeChannelName: "main",
+		MildomID:           "main-mildom",
+		SubChannels: []Channel{
+			{Source: VideoSourceYoutube, ID: "sub-youtube", Name: "sub"},
+			{Source: VideoSourceBilibili, ID: "sub-bilibili"},
+		},
+	}
+
+	tests := []struct {
+		source   string
+		id       string
+		expected string
+	}{
+		{VideoSourceYoutube, "main-youtube", ChannelKindMain},
+		{VideoSourceYoutube, "sub-youtube", ChannelKindSub},
+		{VideoSourceYoutube, "other", ""},
+		{VideoSourceYoutube, "", ""},
+		{VideoSourceMildom, "main-mildom", ChannelKindMain},
+		{VideoSourceMildom, "sub-youtube", ""},
+		{VideoSourceBilibili, "sub-bilibili", ChannelKindSub},
+		{VideoSourceBilibili, "", ""},
+	}
+
+	for _, tt := range tests {
+		kind := a.ChannelKind(tt.source, tt.id)
+		if kind != tt.expected {
+			t.Errorf("%v %v, got: %v expect: %v", tt.source, tt.id, kind, tt.expected)
+		}
+	}
+
+	channels := a.Channels(VideoSourceYoutube)
+	if len(channels) != 2 || channels[0].Name != "main" || channels[1].Name != "sub" {
+		t.Errorf("invalid youtube channels: %+v", channels)
+	}
+
+	if len(a.Channels(VideoSourceBilibili)) != 1 {
+		t.Errorf("invalid bilibili channels: %+v", a.Channels(VideoSourceBilibili))
+	}
+}
@@ -0,0 +1,78 @@
+package model
+
+import "github.com/yaegaki/dotlive-schedule-server/jst"
+
+// PlanAdherence 計画のエントリの開始時刻と実際の配信の開始時刻のずれ
+type PlanAdherence struct {
+	// PlanDate 計画の日付
+	PlanDate jst.Time `json:"planDate"`
+	// ActorID 配信者ID
+	ActorID string `json:"actorId"`
+	// HashTag コラボハッシュタグ
+	HashTag string `json:"hashTag"`
+	// Source 配信サイト
+	Source string `json:"source"`
+	// PlannedStartAt 計画の開始時刻
+	PlannedStartAt jst.Time `json:"plannedStartAt"`
+	// VideoID 計画にマッチした動画のID
+	VideoID string `json:"videoId"`
+	// ActualStartAt 実際の開始時刻
+	ActualStartAt jst.Time `json:"actualStartAt"`
+	// Delay 計画の開始時刻からの遅れ(秒)
+	// 計画より早く始まった場合は負の値
+	Delay int64 `json:"delay"`
+}
+
+// AdherenceReport 計画と実際の配信のずれのレポート
+type AdherenceReport struct {
+	// Begin 対象期間の始まり
+	Begin jst.Time `json:"begin"`
+	// End 対象期間の終わり
+	End jst.Time `json:"end"`
+	// Actors 配信者ごとのずれ
+	Actors []ActorAdherence `json:"actors"`
+	// MissedEntries 動画が見つからなかった計画のエントリ
+	MissedEntries []MissedPlanEntry `json:"missedEntries"`
+}
+
+// ActorAdherence 配信者ごとの計画と実際の配信のずれ
+type ActorAdherence struct {
+	// ActorID 配信者ID
+	ActorID string `json:"actorId"`
+	// Count 集計した配信の数
+	Count int `json:"count"`
+	// EarlyCount 計画より早く始まった配信の数
+	EarlyCount int `json:"earlyCount"`
+	// OnTimeCount 計画通りに始まった配信の数
+	OnTimeCount int `json:"onTimeCount"`
+	// LateCount 計画より遅れて始まった配信の数
+	LateCount int `json:"lateCount"`
+	// AverageDelay 平均の遅れ(秒)
+	AverageDelay int64 `json:"averageDelay"`
+	// MinDelay 最も早く始まった配信の遅れ(秒)
+	MinDelay int64 `json:"minDelay"`
+	// MaxDelay 最も遅れて始まった配信の遅れ(秒)
+	MaxDelay int64 `json:"maxDelay"`
+	// Distribution 遅れの分布
+	Distribution []AdherenceBucket `json:"distribution"`
+}
+
+// AdherenceBucket 遅れの分布の区間
+type AdherenceBucket struct {
+	// Label 表示用のラベル
+	Label string `json:"label"`
+	// Count 区間に含まれる配信の数
+	Count int `json:"count"`
+}
+
+// MissedPlanEntry 動画が見つからなかった計画のエントリ
+type MissedPlanEntry struct {
+	// ActorID 配信者ID
+	ActorID string `json:"actorId"`
+	// HashTag コラボハッシュタグ
+	HashTag string `json:"hashTag"`
+	// StartAt 計画の開始時刻
+	StartAt jst.Time `json:"startAt"`
+	// Source 配信サイト
+	Source string `json:"source"`
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// ChangeKindPlan 計画の変更
+	ChangeKindPlan = "plan"
+	// ChangeKindVideo 動画の変更
+	ChangeKindVideo = "video"
+	// ChangeKindActor 配信者の変更
+	ChangeKindActor = "actor"
+)
+
+// Change 変更履歴
+type Change struct {
+	// Cursor 変更の順番
+	// 変更が確定した時刻(マイクロ秒)なので、同じ時刻に確定した変更は同じカーソルになる
+	Cursor int64
+	// Kind 変更されたものの種類
+	Kind string
+	// EntityID 変更されたもののID
+	// 計画の場合はPlanEntityIDで作成したID
+	EntityID string
+	// ChangedAt 変更された時刻
+	ChangedAt jst.Time
+}
+
+// ChangeSet 指定したカーソル以降の変更
+type ChangeSet struct {
+	// Cursor 次回に指定するカーソル
+	Cursor int64
+	// Reset 変更履歴が削除されているので全て取得し直す必要があるかどうか
+	Reset bool
+	// HasMore まだ取得していない変更があるかどうか
+	HasMore bool
+	// Entries 変更されたもの
+	Entries []ChangeEntry
+}
+
+// ChangeEntry 変更されたもの
+// 削除されている場合はDeletedがtrueになり内容は空になる
+type ChangeEntry struct {
+	// Cursor 変更の順番
+	Cursor int64
+	// Kind 変更されたものの種類
+	Kind string
+	// EntityID 変更されたもののID
+	EntityID string
+	// Deleted 削除されたかどうか
+	Deleted bool
+	// Plan Kindが計画の場合の計画
+	Plan *Plan
+	// Video Kindが動画の場合の動画
+	Video *Video
+	// Actor Kindが配信者の場合の配信者
+	Actor *Actor
+}
+
+// PlanEntityID 変更履歴で使用する計画のID
+// 計画のドキュメントIDはクライアントに公開していないので日付をIDにする
+func PlanEntityID(date jst.Time) string {
+	return fmt.Sprintf("%v-%v-%v", date.Year(), int(date.Month()), date.Day())
+}
+
+// ParsePlanEntityID 計画のIDから日付を取得する
+func ParsePlanEntityID(id string) (jst.Time, error) {
+	xs := strings.Split(id, "-")
+	if len(xs) == 3 {
+		year, err1 := strconv.Atoi(xs[0])
+		month, err2 := strconv.Atoi(xs[1])
+		day, err3 := strconv.Atoi(xs[2])
+		if err1 == nil && err2 == nil && err3 == nil {
+			return jst.ShortDate(year, time.Month(month), day), nil
+		}
+	}
+
+	return jst.Time{}, xerrors.Errorf("Invalid plan entity id: %v", id)
+}
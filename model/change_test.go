@@ -0,0 +1,26 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+)
+
+func TestPlanEntityID(t *testing.T) {
+	d := jst.ShortDate(2020, 4, 29)
+	id := PlanEntityID(d)
+	if id != "2020-4-29" {
+		t.Errorf("id, got: %v", id)
+	}
+
+	temp, err := ParsePlanEntityID(id)
+	if err != nil || !temp.Equal(d) {
+		t.Errorf("parse, got: %v %v", temp, err)
+	}
+
+	for _, id := range []string{"", "2020-4", "2020-a-29", "x-y-z"} {
+		if _, err := ParsePlanEntityID(id); err == nil {
+			t.Errorf("%v must be invalid", id)
+		}
+	}
+}
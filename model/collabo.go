@@ -0,0 +1,59 @@
+package model
+
+import "github.com/yaegaki/dotlive-schedule-server/jst"
+
+// CollaboNodeIDExternalPrefix 外部の配信者のノードIDのprefix
+const CollaboNodeIDExternalPrefix = "external:"
+
+// CollaboGraph コラボの関係を表すグラフ
+type CollaboGraph struct {
+	// Begin 対象期間の始まり
+	Begin jst.Time `json:"begin"`
+	// End 対象期間の終わり
+	End jst.Time `json:"end"`
+	// Nodes 配信者
+	Nodes []CollaboNode `json:"nodes"`
+	// Edges コラボした配信者の組
+	Edges []CollaboEdge `json:"edges"`
+}
+
+// CollaboNode コラボした配信者
+type CollaboNode struct {
+	// ID ノードID
+	// どっとライブの配信者の場合は配信者ID
+	// 外部の配信者の場合はCollaboNodeIDExternalPrefix+チャンネル名
+	ID string `json:"id"`
+	// Name 名前
+	Name string `json:"name"`
+	// External 外部の配信者かどうか
+	External bool `json:"external"`
+	// StreamCount コラボ配信の数
+	StreamCount int `json:"streamCount"`
+}
+
+// CollaboEdge コラボした配信者の組
+type CollaboEdge struct {
+	// Source ノードID
+	Source string `json:"source"`
+	// Target ノードID
+	Target string `json:"target"`
+	// Weight 一緒に配信した数
+	Weight int `json:"weight"`
+	// Streams 一緒に配信した配信
+	Streams []CollaboStream `json:"streams"`
+}
+
+// CollaboStream コラボ配信
+type CollaboStream struct {
+	// VideoID 動画ID
+	// 動画が見つかっていない計画だけのコラボの場合は空文字
+	VideoID string `json:"videoId"`
+	// URL 配信URL
+	URL string `json:"url"`
+	// Source 配信サイト
+	Source string `json:"source"`
+	// StartAt 開始時刻
+	StartAt jst.Time `json:"startAt"`
+	// Text 説明
+	Text string `json:"text"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import "github.com/yaegaki/dotlive-schedule-server/common"
+
+// groupTopicPrefix グループのトピック名の接頭辞
+// 配信者のトピック名(Twitterのスクリーンネーム)と被らないようにする
+const groupTopicPrefix = "group-"
+
+// Group 配信者のグループ(ユニット、部活など)
+type Group struct {
+	// ID グループID
+	ID string
+	// Name 名前
+	Name string
+}
+
+// GroupSlice Groupのスライス
+type GroupSlice []Group
+
+// Topic プッシュ通知のトピック名
+func (g Group) Topic() string {
+	return GroupTopicName(g.ID)
+}
+
+// GroupTopicName グループIDからプッシュ通知のトピック名を作成する
+func GroupTopicName(groupID string) string {
+	return groupTopicPrefix + groupID
+}
+
+// FindGroup グループを探す
+func (s GroupSlice) FindGroup(id string) (Group, error) {
+	for _, g := range s {
+		if g.ID == id {
+			return g, nil
+		}
+	}
+
+	return Group{}, common.ErrNotFound
+}
@@ -0,0 +1,39 @@
+package model
+
+import "github.com/yaegaki/dotlive-schedule-server/jst"
+
+const (
+	// NotificationStatusPending 送信待ち
+	NotificationStatusPending = "pending"
+	// NotificationStatusSent 送信済み
+	NotificationStatusSent = "sent"
+	// NotificationStatusFailed 送信に失敗して諦めた
+	NotificationStatusFailed = "failed"
+)
+
+// Notification アウトボックスに保存されたプッシュ通知
+type Notification struct {
+	// ID 冪等性キーとメッセージの内容から作成したID
+	// 同じIDのメッセージは一度しか保存されない
+	ID string
+	// Payload JSONにしたFCMのメッセージ
+	Payload string
+	// Status 送信状況
+	Status string
+	// CreatedAt 保存した時刻
+	CreatedAt jst.Time
+	// NextAttemptAt 次に送信を試みる時刻
+	NextAttemptAt jst.Time
+	// Attempts 送信を試みた記録
+	Attempts []NotificationAttempt
+}
+
+// NotificationAttempt 送信を試みた記録
+type NotificationAttempt struct {
+	// AttemptedAt 送信を試みた時刻
+	AttemptedAt jst.Time
+	// MessageID 送信に成功した場合のFCMのメッセージID
+	MessageID string
+	// Error 送信に失敗した場合のエラー
+	Error string
+}
@@ -0,0 +1,21 @@
+package model
+
+// Organization 配信者が所属する組織
+// 公式アカウントなど配信者以外の情報を持つ
+type Organization struct {
+	// Name 組織名
+	Name string
+	// FallbackIcon 配信者が分からない配信で使用するアイコンURL
+	FallbackIcon string
+	// TwitterScreenName 計画ツイートを投稿する公式アカウントのスクリーンネーム
+	TwitterScreenName string
+	// YoutubeChannelID 公式のYoutubeチャンネルID
+	YoutubeChannelID string
+	// YoutubeChannelName 公式のYoutubeチャンネル名
+	YoutubeChannelName string
+}
+
+// IsOfficialVideo 公式チャンネルの動画かどうか
+func (o Organization) IsOfficialVideo(v Video) bool {
+	return o.YoutubeChannelName != "" && v.OwnerName == o.YoutubeChannelName
+}
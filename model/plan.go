@@ -1,6 +1,7 @@
 package model
 
 import (
+	"sort"
 	"strings"
 	"time"
 
@@ -19,6 +20,12 @@ type Plan struct {
 	Entries []PlanEntry
 	// Notified 通知済みか
 	Notified bool
+	// NotifiedAt 最後に計画を通知した時刻
+	// 通知していない場合と通知済みのエントリを記録する前に通知した場合はゼロ値
+	NotifiedAt jst.Time
+	// NotifiedEntries 最後に通知したときの計画のエントリ
+	// 計画が修正された場合に通知済みの内容との差分を通知するために使用する
+	NotifiedEntries []PlanEntry
 	// Fixed 固定化されているか
 	// 固定化されている場合は定期ジョブによって更新されない
 	Fixed bool
@@ -56,6 +63,9 @@ type PlanEntry struct {
 	// CollaboID コラボの場合に識別するためのID
 	//           1以上の場合が有効な値
 	CollaboID int
+	// RemindedStartAt 配信開始前のリマインダーを送信したときの開始時刻
+	// 送信していない場合はゼロ値
+	RemindedStartAt jst.Time
 }
 
 // IsPlanned 計画配信かどうか
@@ -112,6 +122,11 @@ func (e PlanEntry) IsUnknownActor() bool {
 	return e.ActorID == ActorIDUnknown
 }
 
+// IsReminded 現在の開始時刻でリマインダーを送信済みかどうか
+func (e PlanEntry) IsReminded() bool {
+	return !e.RemindedStartAt.IsZero() && e.RemindedStartAt.Equal(e.StartAt)
+}
+
 func (e PlanEntry) within(videoSource string, t jst.Time) bool {
 	var planRange jst.Range
 	if videoSource == VideoSourceYoutube {
@@ -146,3 +161,87 @@ func (p Plan) Text() string {
 	}
 	return result
 }
+
+const (
+	// PlanEntryChangeKindAdded エントリが追加された
+	PlanEntryChangeKindAdded = "added"
+	// PlanEntryChangeKindRemoved エントリが削除された
+	PlanEntryChangeKindRemoved = "removed"
+	// PlanEntryChangeKindMoved エントリの開始時刻が変更された
+	PlanEntryChangeKindMoved = "moved"
+)
+
+// PlanEntryChange 通知済みの計画からのエントリの変更
+type PlanEntryChange struct {
+	// Kind 変更の種類
+	Kind string
+	// Entry 変更されたエントリ
+	// 削除された場合は通知済みのエントリ
+	Entry PlanEntry
+	// OldStartAt 開始時刻が変更された場合の変更前の開始時刻
+	OldStartAt jst.Time
+}
+
+// NotifiedChanges 最後に通知したときからのエントリの変更を取得する
+// 配信者(ハッシュタグ)と開始時刻が同じエントリは変更されていないものとする
+// 同じ配信者のエントリが残っている場合は開始時刻の順に対応させて時間変更とする
+func (p Plan) NotifiedChanges() []PlanEntryChange {
+	oldEntries := append([]PlanEntry{}, p.NotifiedEntries...)
+	var newEntries []PlanEntry
+OUTER:
+	for _, e := range p.Entries {
+		for i, old := range oldEntries {
+			if e.isSameActor(old) && e.StartAt.Equal(old.StartAt) {
+				oldEntries = append(oldEntries[:i], oldEntries[i+1:]...)
+				continue OUTER
+			}
+		}
+
+		newEntries = append(newEntries, e)
+	}
+
+	var changes []PlanEntryChange
+	for _, e := range newEntries {
+		index := -1
+		for i, old := range oldEntries {
+			if e.isSameActor(old) {
+				index = i
+				break
+			}
+		}
+
+		if index < 0 {
+			changes = append(changes, PlanEntryChange{
+				Kind:  PlanEntryChangeKindAdded,
+				Entry: e,
+			})
+			continue
+		}
+
+		changes = append(changes, PlanEntryChange{
+			Kind:       PlanEntryChangeKindMoved,
+			Entry:      e,
+			OldStartAt: oldEntries[index].StartAt,
+		})
+		oldEntries = append(oldEntries[:index], oldEntries[index+1:]...)
+	}
+
+	for _, old := range oldEntries {
+		changes = append(changes, PlanEntryChange{
+			Kind:  PlanEntryChangeKindRemoved,
+			Entry: old,
+		})
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Entry.StartAt.Before(changes[j].Entry.StartAt)
+	})
+
+	return changes
+}
+
+// isSameActor 同じ配信者のエントリかどうか
+// 配信者が不明な場合はハッシュタグで比較する
+func (e PlanEntry) isSameActor(other PlanEntry) bool {
+	return e.ActorID == other.ActorID && e.HashTag == other.HashTag
+}
@@ -199,6 +199,51 @@ func TestGetEntryIndexUnknownActor(t *testing.T) {
 
 // TODO: テスト用パッケージを使う(import cycleになってエラーになるためそのままは使用できない)
 
+func TestNotifiedChanges(t *testing.T) {
+	d := jst.ShortDate(2020, 6, 14)
+	notified := CreatePlan(d, []EntryPart{
+		CreateEntryPart(Futaba, 20, 0),
+		CreateEntryPart(Suzu, 12, 0),
+		CreateEntryPart(Suzu, 22, 0),
+		CreateEntryPart(Chieri, 23, 0),
+	})
+	p := CreatePlan(d, []EntryPart{
+		CreateEntryPart(Suzu, 12, 0),
+		CreateEntryPart(Futaba, 20, 0),
+		CreateEntryPart(Siro, 21, 0),
+		CreateEntryPart(Suzu, 23, 0),
+	})
+	p.NotifiedEntries = notified.Entries
+
+	expects := []struct {
+		kind       string
+		actorID    string
+		startAt    jst.Time
+		oldStartAt jst.Time
+	}{
+		{PlanEntryChangeKindAdded, Siro.ID, jst.Date(2020, 6, 14, 21, 0), jst.Time{}},
+		{PlanEntryChangeKindMoved, Suzu.ID, jst.Date(2020, 6, 14, 23, 0), jst.Date(2020, 6, 14, 22, 0)},
+		{PlanEntryChangeKindRemoved, Chieri.ID, jst.Date(2020, 6, 14, 23, 0), jst.Time{}},
+	}
+
+	changes := p.NotifiedChanges()
+	if len(changes) != len(expects) {
+		t.Fatalf("len(changes), got: %v expect: %v", len(changes), len(expects))
+	}
+
+	for i, c := range changes {
+		expect := expects[i]
+		if c.Kind != expect.kind || c.Entry.ActorID != expect.actorID || !c.Entry.StartAt.Equal(expect.startAt) || !c.OldStartAt.Equal(expect.oldStartAt) {
+			t.Errorf("changes[%v], got: %v %v %v %v", i, c.Kind, c.Entry.ActorID, c.Entry.StartAt, c.OldStartAt)
+		}
+	}
+
+	p.NotifiedEntries = p.Entries
+	if changes := p.NotifiedChanges(); len(changes) != 0 {
+		t.Errorf("not changed, got: %v", changes)
+	}
+}
+
 // EntryPart .
 type EntryPart struct {
 	Actor     Actor
@@ -22,12 +22,19 @@ type ScheduleEntry struct {
 	Icon string `json:"icon"`
 	// StartAt 配信予定/予定時刻
 	StartAt jst.Time `json:"startAt"`
+	// OriginalStartAt 動画の開始時刻が変更された場合の最初の開始時刻
+	// 変更されていない場合はゼロ値
+	// v1のAPIのレスポンスは変えないのでJSONには含めない
+	OriginalStartAt jst.Time `json:"-"`
 	// VideoID 動画ID
 	VideoID string `json:"videoId"`
 	// URL 配信URL
 	URL string `json:"url"`
 	// Source 配信サイト
 	Source string `json:"source"`
+	// Channel 配信者のメインチャンネルかサブチャンネルか
+	// 分からない場合は空文字
+	Channel string `json:"channel"`
 	// Planned 計画配信かどうか
 	Planned bool `json:"planned"`
 	// IsLive 生放送かどうか
@@ -38,4 +45,8 @@ type ScheduleEntry struct {
 	Text string `json:"text"`
 	// CollaboID コラボID
 	CollaboID int `json:"collaboId"`
+	// ActorIDs 配信に参加する配信者のID
+	// 表示用のActorNameから配信者を特定しなくてもいいようにする
+	// v1のAPIのレスポンスは変えないのでJSONには含めない
+	ActorIDs []string `json:"-"`
 }
@@ -0,0 +1,40 @@
+package model
+
+import "github.com/yaegaki/dotlive-schedule-server/jst"
+
+// MonthlyStats 1ヶ月の配信の統計
+type MonthlyStats struct {
+	// BaseDate 何月か
+	BaseDate jst.Time `json:"baseDate"`
+	// Fixed この統計が今後変更されることがないかどうか
+	// 月が終わってから2日以上経過している場合はtrue
+	Fixed bool `json:"fixed"`
+	// Actors 配信者ごとの統計
+	Actors []ActorStats `json:"actors"`
+}
+
+// ActorStats 配信者ごとの配信の統計
+type ActorStats struct {
+	// ActorID 配信者ID
+	ActorID string `json:"actorId"`
+	// StreamCount 配信数
+	StreamCount int `json:"streamCount"`
+	// TotalDuration 合計配信時間(秒)
+	// 終了時刻が分かっている配信のみが対象
+	TotalDuration int64 `json:"totalDuration"`
+	// AverageDuration 平均配信時間(秒)
+	// 終了時刻が分かっている配信のみが対象
+	AverageDuration int64 `json:"averageDuration"`
+	// DurationCount 配信時間が分かっている配信の数
+	DurationCount int `json:"durationCount"`
+	// PlannedCount 計画配信の数
+	PlannedCount int `json:"plannedCount"`
+	// UnplannedCount ゲリラ配信の数
+	UnplannedCount int `json:"unplannedCount"`
+	// CollaboCount コラボ配信の数
+	CollaboCount int `json:"collaboCount"`
+	// MemberOnlyCount メンバー限定配信の数
+	MemberOnlyCount int `json:"memberOnlyCount"`
+	// Sources 配信サイトごとの配信数
+	Sources map[string]int `json:"sources"`
+}
@@ -0,0 +1,54 @@
+package model
+
+import "github.com/yaegaki/dotlive-schedule-server/jst"
+
+// TopicSubscription クライアントが購読しているトピック
+// FCMからは購読しているトピックを取得できないのでサーバーで記録する
+type TopicSubscription struct {
+	// Token クライアントのFCMのトークン
+	Token string
+	// Topics 購読しているトピック
+	Topics []string
+	// UpdatedAt 最後に購読を変更した時刻
+	UpdatedAt jst.Time
+}
+
+// Update 購読したトピックを追加して、解除したトピックを取り除いたものを返す
+func (s TopicSubscription) Update(subscribed, unsubscribed []string) TopicSubscription {
+	topics := []string{}
+	for _, t := range s.Topics {
+		if !containsString(unsubscribed, t) {
+			topics = append(topics, t)
+		}
+	}
+
+	for _, t := range subscribed {
+		if !containsString(topics, t) {
+			topics = append(topics, t)
+		}
+	}
+
+	s.Topics = topics
+	return s
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsSubscribed トピックを購読しているかどうか
+func (s TopicSubscription) IsSubscribed(topic string) bool {
+	for _, t := range s.Topics {
+		if t == topic {
+			return true
+		}
+	}
+
+	return false
+}
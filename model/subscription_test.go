@@ -0,0 +1,26 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopicSubscriptionUpdate(t *testing.T) {
+	s := TopicSubscription{Token: "token", Topics: []string{"plan", "SIROyoutuber"}}
+
+	result := s.Update([]string{"plan", "group-idol"}, []string{"SIROyoutuber"})
+	expected := []string{"plan", "group-idol"}
+	if !reflect.DeepEqual(result.Topics, expected) {
+		t.Errorf("got: %v expect: %v", result.Topics, expected)
+	}
+
+	// 元の購読は変更しない
+	if len(s.Topics) != 2 || s.Topics[1] != "SIROyoutuber" {
+		t.Errorf("original must not be changed: %v", s.Topics)
+	}
+
+	result = TopicSubscription{}.Update(nil, []string{"plan"})
+	if len(result.Topics) != 0 {
+		t.Errorf("got: %v", result.Topics)
+	}
+}
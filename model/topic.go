@@ -9,3 +9,12 @@ type Topic struct {
 	// Subscribed 購読しているかどうか
 	Subscribed bool `json:"subscribed"`
 }
+
+// remindTopicSuffix リマインダー用のトピック名の接尾辞
+const remindTopicSuffix = "-remind"
+
+// RemindTopicName 配信開始前のリマインダー用のトピック名
+// 通常のトピックとは別に購読できるようにする
+func RemindTopicName(topic string) string {
+	return topic + remindTopicSuffix
+}
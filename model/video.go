@@ -23,8 +23,17 @@ type Video struct {
 	Source string
 	// URL 動画のURL
 	URL string
+	// ChannelID 動画サイトでのチャンネルID
+	// 以前に保存された動画は空文字
+	ChannelID string
 	// Text 動画の説明
 	Text string
+	// Title 動画サイトでのタイトル
+	// 取得できない場合は空文字
+	Title string
+	// Thumbnail サムネイルのURL
+	// Youtubeのみ取得できる、取得できない場合は空文字
+	Thumbnail string
 	// IsLive 生放送かどうか
 	// プレミア公開もTrue
 	IsLive bool
@@ -32,8 +41,20 @@ type Video struct {
 	MemberOnly bool
 	// Notified Push通知送信済みか
 	Notified bool
+	// RemindedStartAt 配信開始前のリマインダーを送信したときの開始時刻
+	// 送信していない場合はゼロ値
+	RemindedStartAt jst.Time
 	// StartAt 配信開始時刻
 	StartAt jst.Time
+	// OriginalStartAt 開始時刻が変更された場合の最初の開始時刻
+	// 変更されていない場合はゼロ値
+	OriginalStartAt jst.Time
+	// ActualStartAt 実際の配信開始時刻
+	// Youtubeの生放送のみ取得できる、取得できない場合はゼロ値
+	ActualStartAt jst.Time
+	// EndAt 配信終了時刻
+	// 終了時刻が分からない場合はゼロ値
+	EndAt jst.Time
 	// RelatedActorID 関連する配信者のID
 	RelatedActorID string
 	// RelatedActorIDs 関連する配信者のIDの配列
@@ -44,9 +65,20 @@ type Video struct {
 	OwnerName string
 	// HashTags 配信の関連するハッシュタグ
 	HashTags []string
+	// Unavailable 配信前に動画が削除されたか非公開になったかどうか
+	Unavailable bool
+	// UnavailableCount 配信前の動画を続けて取得できなかった回数
+	// 一時的に取得できないこともあるので何度か続けて取得できなかった場合にUnavailableにする
+	UnavailableCount int
 }
 
 // IsUnknownActor 配信者不明かどうか
 func (v Video) IsUnknownActor() bool {
 	return v.ActorID == ActorIDUnknown
 }
+
+// IsReminded 現在の開始時刻でリマインダーを送信済みかどうか
+// 送信後に開始時刻が変わった場合は新しい開始時刻で再度送信する
+func (v Video) IsReminded() bool {
+	return !v.RemindedStartAt.IsZero() && v.RemindedStartAt.Equal(v.StartAt)
+}
@@ -0,0 +1,113 @@
+package model
+
+import "github.com/yaegaki/dotlive-schedule-server/jst"
+
+const (
+	// WebhookEventPlanCreated 計画が作成された
+	WebhookEventPlanCreated = "plan.created"
+	// WebhookEventPlanUpdated 計画が更新された
+	WebhookEventPlanUpdated = "plan.updated"
+	// WebhookEventVideoCreated 動画が作成された
+	WebhookEventVideoCreated = "video.created"
+	// WebhookEventVideoStarted 配信が始まった
+	WebhookEventVideoStarted = "video.started"
+	// WebhookEventVideoRescheduled 配信の開始時刻が変更された
+	WebhookEventVideoRescheduled = "video.rescheduled"
+)
+
+// WebhookEvents 購読できるWebhookのイベントの種類
+var WebhookEvents = []string{
+	WebhookEventPlanCreated,
+	WebhookEventPlanUpdated,
+	WebhookEventVideoCreated,
+	WebhookEventVideoStarted,
+	WebhookEventVideoRescheduled,
+}
+
+// WebhookSubscription 外部のサービスへのWebhookの購読
+type WebhookSubscription struct {
+	// ID 購読ID
+	ID string
+	// URL 送信先のURL
+	URL string
+	// Secret 署名に使用する秘密鍵
+	Secret string
+	// Events 購読するイベントの種類
+	Events []string
+	// Actors 対象の配信者ID
+	// 空の場合は全ての配信者
+	Actors []string
+	// Disabled 無効かどうか
+	// 送信に失敗し続けた場合は自動的に無効になる
+	Disabled bool
+	// ConsecutiveFailures 連続で送信に失敗した回数
+	ConsecutiveFailures int
+	// CreatedAt 作成した時刻
+	CreatedAt jst.Time
+}
+
+// Match イベントが購読の対象かどうか
+// actorIDsはイベントに関連する配信者ID
+func (s WebhookSubscription) Match(eventType string, actorIDs []string) bool {
+	if s.Disabled {
+		return false
+	}
+
+	found := false
+	for _, e := range s.Events {
+		if e == eventType {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+
+	if len(s.Actors) == 0 {
+		return true
+	}
+
+	for _, a := range s.Actors {
+		for _, id := range actorIDs {
+			if a == id {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// WebhookDelivery 送信するWebhook
+type WebhookDelivery struct {
+	// ID 購読IDとイベントの内容から作成したID
+	// 同じIDのWebhookは一度しか保存されない
+	ID string
+	// SubscriptionID 購読ID
+	SubscriptionID string
+	// Event イベントの種類
+	Event string
+	// Payload 送信するJSON
+	Payload string
+	// Status 送信状況
+	// NotificationStatusと同じ値を使用する
+	Status string
+	// CreatedAt 保存した時刻
+	CreatedAt jst.Time
+	// NextAttemptAt 次に送信を試みる時刻
+	NextAttemptAt jst.Time
+	// Attempts 送信を試みた記録
+	Attempts []WebhookAttempt
+}
+
+// WebhookAttempt Webhookの送信を試みた記録
+type WebhookAttempt struct {
+	// AttemptedAt 送信を試みた時刻
+	AttemptedAt jst.Time
+	// StatusCode レスポンスのステータスコード
+	// レスポンスがない場合は0
+	StatusCode int
+	// Error 送信に失敗した場合のエラー
+	Error string
+}
@@ -0,0 +1,24 @@
+package model
+
+import "testing"
+
+func TestWebhookSubscriptionMatch(t *testing.T) {
+	tests := []struct {
+		s         WebhookSubscription
+		eventType string
+		actorIDs  []string
+		expected  bool
+	}{
+		{WebhookSubscription{Events: []string{WebhookEventPlanCreated}}, WebhookEventPlanCreated, nil, true},
+		{WebhookSubscription{Events: []string{WebhookEventPlanCreated}}, WebhookEventPlanUpdated, nil, false},
+		{WebhookSubscription{Events: []string{WebhookEventVideoStarted}, Actors: []string{"siro"}}, WebhookEventVideoStarted, []string{"iori", "siro"}, true},
+		{WebhookSubscription{Events: []string{WebhookEventVideoStarted}, Actors: []string{"siro"}}, WebhookEventVideoStarted, []string{"iori"}, false},
+		{WebhookSubscription{Events: []string{WebhookEventVideoStarted}, Disabled: true}, WebhookEventVideoStarted, nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.s.Match(tt.eventType, tt.actorIDs); got != tt.expected {
+			t.Errorf("%v %v %v, got: %v expect: %v", tt.s, tt.eventType, tt.actorIDs, got, tt.expected)
+		}
+	}
+}
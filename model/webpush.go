@@ -0,0 +1,85 @@
+package model
+
+import (
+	"crypto/sha1"
+	"fmt"
+
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+)
+
+// VAPIDKey ブラウザのプッシュ通知でサーバーを識別するための鍵(P-256)
+type VAPIDKey struct {
+	// PublicKey 非圧縮形式の公開鍵(base64url)
+	PublicKey string
+	// PrivateKey 秘密鍵のスカラー値(base64url)
+	PrivateKey string
+}
+
+// WebPushSubscription ブラウザのプッシュ通知の購読
+type WebPushSubscription struct {
+	// ID 購読ID
+	// エンドポイントから作成する
+	ID string
+	// Endpoint プッシュサービスのエンドポイント
+	Endpoint string
+	// P256dh ブラウザの公開鍵(base64url)
+	P256dh string
+	// Auth 認証用の秘密(base64url)
+	Auth string
+	// Actors 配信の通知を受け取る配信者ID
+	Actors []string
+	// Topics 購読するトピック
+	// 計画のトピックとグループのトピックを指定できる
+	Topics []string
+	// ConsecutiveFailures 連続で送信に失敗した回数
+	// 失敗し続けた購読は削除する
+	ConsecutiveFailures int
+	// CreatedAt 作成した時刻
+	CreatedAt jst.Time
+}
+
+// WebPushDelivery 送信するブラウザのプッシュ通知
+// 購読ごとではなく通知ごとに保存して、送信するときに対象の購読を探す
+type WebPushDelivery struct {
+	// ID 冪等性キーと通知の内容から作成したID
+	// 同じIDの通知は一度しか保存されない
+	ID string
+	// Payload Service Workerに渡すJSON
+	Payload string
+	// Topics 通知するトピック
+	Topics []string
+	// ActorIDs 通知に関連する配信者ID
+	ActorIDs []string
+	// Status 送信状況
+	Status string
+	// CreatedAt 保存した時刻
+	CreatedAt jst.Time
+}
+
+// WebPushSubscriptionID エンドポイントから購読IDを作成する
+// 同じブラウザから再度購読した場合は上書きされる
+func WebPushSubscriptionID(endpoint string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(endpoint)))
+}
+
+// Match 通知が購読の対象かどうか
+// topicsは通知するトピック、actorIDsは通知に関連する配信者ID
+func (s WebPushSubscription) Match(topics []string, actorIDs []string) bool {
+	for _, t := range topics {
+		for _, temp := range s.Topics {
+			if t == temp {
+				return true
+			}
+		}
+	}
+
+	for _, id := range actorIDs {
+		for _, temp := range s.Actors {
+			if id == temp {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,28 @@
+package model
+
+import "testing"
+
+func TestWebPushSubscriptionMatch(t *testing.T) {
+	s := WebPushSubscription{Actors: []string{"siro"}, Topics: []string{"plan"}}
+	tests := []struct {
+		topics   []string
+		actorIDs []string
+		expected bool
+	}{
+		{[]string{"plan"}, nil, true},
+		{[]string{"SIROyoutuber"}, []string{"siro"}, true},
+		{[]string{"SIROyoutuber", "group-idol"}, []string{"iori", "siro"}, true},
+		{[]string{"group-idol"}, []string{"iori"}, false},
+		{nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := s.Match(tt.topics, tt.actorIDs); got != tt.expected {
+			t.Errorf("%v %v, got: %v expect: %v", tt.topics, tt.actorIDs, got, tt.expected)
+		}
+	}
+
+	if WebPushSubscriptionID("https://example.com/a") == WebPushSubscriptionID("https://example.com/b") {
+		t.Errorf("different endpoint must have different id")
+	}
+}
@@ -3,6 +3,7 @@ package notify
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,6 +11,8 @@ import (
 
 	firebase "firebase.google.com/go"
 	"firebase.google.com/go/messaging"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"golang.org/x/xerrors"
 	"google.golang.org/api/option"
 	"google.golang.org/api/transport/cert"
 	ghttp "google.golang.org/api/transport/http"
@@ -20,19 +23,41 @@ type Client interface {
 	Send(ctx context.Context, message *messaging.Message) (string, error)
 }
 
+// ErrServerError FCMのサーバーエラーで送信できなかった
+// FCMが復旧するまでは他のメッセージも送信できない可能性が高い
+var ErrServerError = errors.New("notify: server error")
+
+// IsServerError FCMのサーバーエラーで送信できなかったかどうか
+func IsServerError(err error) bool {
+	return xerrors.Is(err, ErrServerError)
+}
+
 type client struct {
-	c     *messaging.Client
-	reset func()
+	c  *messaging.Client
+	rt *rt
 }
 
 func (c *client) Send(ctx context.Context, message *messaging.Message) (string, error) {
-	c.reset()
-	return c.c.Send(ctx, message)
+	if c.rt != nil {
+		c.rt.reset()
+	}
+
+	id, err := c.c.Send(ctx, setAndroidTTL(message, jst.Now()))
+	if err == nil {
+		return id, nil
+	}
+
+	// firebaseのクライアントはエラーをラップしないのでrtのエラーを確認する
+	if (c.rt != nil && c.rt.err != nil) || messaging.IsInternal(err) || messaging.IsServerUnavailable(err) {
+		return "", xerrors.Errorf("%v: %w", err, ErrServerError)
+	}
+
+	return "", err
 }
 
 // NewClient クライアントを作成する
 func NewClient(ctx context.Context, enableLog bool) (Client, error) {
-	opts, reset, err := createClientOptions(ctx, enableLog)
+	opts, rt, err := createClientOptions(ctx, enableLog)
 	if err != nil {
 		return nil, err
 	}
@@ -47,12 +72,12 @@ func NewClient(ctx context.Context, enableLog bool) (Client, error) {
 	}
 
 	return &client{
-		c:     cli,
-		reset: reset,
+		c:  cli,
+		rt: rt,
 	}, nil
 }
 
-func createClientOptions(ctx context.Context, enableLog bool) ([]option.ClientOption, func(), error) {
+func createClientOptions(ctx context.Context, enableLog bool) ([]option.ClientOption, *rt, error) {
 	if !enableLog {
 		return nil, nil, nil
 	}
@@ -92,7 +117,7 @@ func createClientOptions(ctx context.Context, enableLog bool) ([]option.ClientOp
 		Transport: rt,
 	}
 	opt := option.WithHTTPClient(hc)
-	return []option.ClientOption{opt}, rt.reset, nil
+	return []option.ClientOption{opt}, rt, nil
 }
 
 type rt struct {
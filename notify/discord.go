@@ -0,0 +1,433 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// discordMaxAttempts レート制限された場合に送信を試みる最大回数
+	discordMaxAttempts = 3
+	// discordMaxWait レート制限で待つ最大の時間
+	// これより長く待つ必要がある場合は諦める
+	discordMaxWait = 10 * time.Second
+)
+
+// Discordの埋め込みの色
+const (
+	discordColorPlan        = 0x00a0e9
+	discordColorStream      = 0xe60012
+	discordColorUpcoming    = 0xf39800
+	discordColorRescheduled = 0x8f8f8f
+)
+
+// DiscordRoute 通知を送信するDiscordのWebhookと対象
+// 配信者とグループを両方とも指定しない場合は全ての通知を送信する
+type DiscordRoute struct {
+	// URL WebhookのURL
+	URL string `json:"url"`
+	// Actors 対象の配信者ID
+	Actors []string `json:"actors"`
+	// Groups 対象のグループID
+	Groups []string `json:"groups"`
+	// Events 対象の出来事の種類
+	// 空の場合は全ての出来事
+	Events []string `json:"events"`
+}
+
+// ParseDiscordRoutes JSONの配列からDiscordのWebhookの設定を読み込む
+func ParseDiscordRoutes(s string) ([]DiscordRoute, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var routes []DiscordRoute
+	err := json.Unmarshal([]byte(s), &routes)
+	if err != nil {
+		return nil, xerrors.Errorf("Can not unmarshal discord routes: %w", err)
+	}
+
+	for _, r := range routes {
+		if !strings.HasPrefix(r.URL, "https://") {
+			return nil, xerrors.Errorf("Invalid discord webhook url '%v'", r.URL)
+		}
+	}
+
+	return routes, nil
+}
+
+// match 出来事が送信の対象かどうか
+func (r DiscordRoute) match(e Event) bool {
+	if len(r.Events) > 0 && !containsString(r.Events, e.Kind) {
+		return false
+	}
+
+	if len(r.Actors) == 0 && len(r.Groups) == 0 {
+		return true
+	}
+
+	for _, a := range e.Actors {
+		if containsString(r.Actors, a.ID) {
+			return true
+		}
+
+		for _, g := range a.Groups {
+			if containsString(r.Groups, g) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DiscordPostStore 投稿済みのDiscordの通知を記録する保存先
+// DiscordのWebhookには冪等性キーがないので、主な送信先に通知できずに同じ出来事を再度通知したときに二重に投稿しないために使用する
+type DiscordPostStore interface {
+	// IsPosted 投稿済みかどうか
+	IsPosted(ctx context.Context, id string) (bool, error)
+	// MarkAsPosted 投稿済みとして記録する
+	MarkAsPosted(ctx context.Context, id string) error
+}
+
+// DiscordNotifier DiscordのWebhookに通知するNotifier
+type DiscordNotifier struct {
+	routes     []DiscordRoute
+	httpClient *http.Client
+	posts      DiscordPostStore
+
+	mu sync.Mutex
+	// blockedUntil Webhookごとのレート制限が解除される時刻
+	blockedUntil map[string]time.Time
+}
+
+// NewDiscordNotifier DiscordのWebhookに通知するNotifierを作成する
+// postsがnilの場合は投稿済みかどうかを記録しない
+func NewDiscordNotifier(routes []DiscordRoute, httpClient *http.Client, posts DiscordPostStore) *DiscordNotifier {
+	return &DiscordNotifier{
+		routes:       routes,
+		httpClient:   httpClient,
+		posts:        posts,
+		blockedUntil: map[string]time.Time{},
+	}
+}
+
+// Notify 対象のWebhookに通知する
+// 同じWebhookが複数の設定で対象になっている場合も一度だけ送信する
+func (n *DiscordNotifier) Notify(ctx context.Context, e Event) error {
+	var urls []string
+	for _, r := range n.routes {
+		if r.match(e) && !containsString(urls, r.URL) {
+			urls = append(urls, r.URL)
+		}
+	}
+
+	if len(urls) == 0 {
+		return nil
+	}
+
+	payload, err := renderDiscord(e)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, url := range urls {
+		// WebhookのURLにはトークンが含まれるのでエラーには含めない
+		err := n.postOnce(ctx, e.Key, url, body)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return xerrors.Errorf("Can not post to discord: %v", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// postOnce 投稿済みでない場合だけWebhookに送信して投稿済みとして記録する
+// 冪等性キーがない出来事は記録しない
+func (n *DiscordNotifier) postOnce(ctx context.Context, key, url string, body []byte) error {
+	if n.posts == nil || key == "" {
+		return n.post(ctx, url, body)
+	}
+
+	// 同じ出来事でも送信先や内容が異なる場合は別の投稿にする
+	id := fmt.Sprintf("%x", sha1.Sum([]byte(key+"\n"+url+"\n"+string(body))))
+	posted, err := n.posts.IsPosted(ctx, id)
+	if err != nil {
+		return xerrors.Errorf("Can not find discord post: %w", err)
+	}
+	if posted {
+		return nil
+	}
+
+	err = n.post(ctx, url, body)
+	if err != nil {
+		return err
+	}
+
+	err = n.posts.MarkAsPosted(ctx, id)
+	if err != nil {
+		return xerrors.Errorf("Can not mark discord post: %w", err)
+	}
+
+	return nil
+}
+
+// post Webhookに送信する
+// レート制限されている場合は解除されるまで待ってから送信する
+func (n *DiscordNotifier) post(ctx context.Context, url string, body []byte) error {
+	for i := 0; i < discordMaxAttempts; i++ {
+		err := n.waitRateLimit(ctx, url)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := n.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resBody, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		n.updateRateLimit(url, res, resBody)
+
+		if res.StatusCode == http.StatusTooManyRequests {
+			continue
+		}
+
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			return xerrors.Errorf("discord: %v", res.Status)
+		}
+
+		return nil
+	}
+
+	return xerrors.Errorf("discord: rate limited")
+}
+
+// waitRateLimit レート制限が解除されるまで待つ
+func (n *DiscordNotifier) waitRateLimit(ctx context.Context, url string) error {
+	n.mu.Lock()
+	wait := time.Until(n.blockedUntil[url])
+	n.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	if wait > discordMaxWait {
+		return xerrors.Errorf("discord: rate limited for %v", wait)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// updateRateLimit レスポンスのヘッダからレート制限が解除される時刻を記録する
+func (n *DiscordNotifier) updateRateLimit(url string, res *http.Response, body []byte) {
+	var wait time.Duration
+	if res.StatusCode == http.StatusTooManyRequests {
+		wait = parseDiscordSeconds(res.Header.Get("Retry-After"))
+		if wait == 0 {
+			// ヘッダがない場合はレスポンスのretry_afterを使用する
+			var temp struct {
+				RetryAfter float64 `json:"retry_after"`
+			}
+			if json.Unmarshal(body, &temp) == nil {
+				wait = time.Duration(temp.RetryAfter * float64(time.Second))
+			}
+		}
+	} else if res.Header.Get("X-RateLimit-Remaining") == "0" {
+		wait = parseDiscordSeconds(res.Header.Get("X-RateLimit-Reset-After"))
+	}
+
+	if wait <= 0 {
+		return
+	}
+
+	n.mu.Lock()
+	n.blockedUntil[url] = time.Now().Add(wait)
+	n.mu.Unlock()
+}
+
+// parseDiscordSeconds 秒数(小数を含む)のヘッダを読み込む
+func parseDiscordSeconds(s string) time.Duration {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
+
+type discordWebhookPayload struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string              `json:"title,omitempty"`
+	Description string              `json:"description,omitempty"`
+	URL         string              `json:"url,omitempty"`
+	Color       int                 `json:"color,omitempty"`
+	Timestamp   string              `json:"timestamp,omitempty"`
+	Author      *discordEmbedAuthor `json:"author,omitempty"`
+	Thumbnail   *discordEmbedImage  `json:"thumbnail,omitempty"`
+	Fields      []discordEmbedField `json:"fields,omitempty"`
+}
+
+type discordEmbedAuthor struct {
+	Name    string `json:"name"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+type discordEmbedImage struct {
+	URL string `json:"url"`
+}
+
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// renderDiscord 出来事からDiscordの埋め込みを作成する
+func renderDiscord(e Event) (discordWebhookPayload, error) {
+	m, err := Render(e)
+	if err != nil {
+		return discordWebhookPayload{}, err
+	}
+
+	embed := discordEmbed{
+		Title:       m.Title,
+		Description: m.Body,
+	}
+
+	if e.Kind == EventKindPlanPublished {
+		embed.Description = createBody(decoratePlanText(e.Plan.Text(), e.Actors))
+		embed.Color = discordColorPlan
+		return discordWebhookPayload{Embeds: []discordEmbed{embed}}, nil
+	}
+
+	if e.Kind == EventKindPlanUpdated {
+		embed.Color = discordColorPlan
+		return discordWebhookPayload{Embeds: []discordEmbed{embed}}, nil
+	}
+
+	switch e.Kind {
+	case EventKindStreamUpcoming:
+		embed.Color = discordColorUpcoming
+	case EventKindStreamRescheduled, EventKindStreamCanceled:
+		embed.Color = discordColorRescheduled
+	default:
+		embed.Color = discordColorStream
+	}
+
+	v := e.Video
+	embed.URL = v.URL
+	if !e.StartAt.IsZero() {
+		embed.Timestamp = e.StartAt.Time().Format(time.RFC3339)
+	}
+
+	names := []string{}
+	for _, a := range e.Actors {
+		names = append(names, a.Name)
+	}
+	embed.Author = &discordEmbedAuthor{
+		Name:    strings.Join(names, " x "),
+		IconURL: e.Actors[0].Icon,
+	}
+	if e.Actors[0].Icon != "" {
+		embed.Thumbnail = &discordEmbedImage{URL: e.Actors[0].Icon}
+	}
+
+	if v.Source != "" {
+		embed.Fields = append(embed.Fields, discordEmbedField{
+			Name:   "配信サイト",
+			Value:  v.Source,
+			Inline: true,
+		})
+	}
+
+	if v.MemberOnly {
+		embed.Fields = append(embed.Fields, discordEmbedField{
+			Name:   "メンバー限定",
+			Value:  "はい",
+			Inline: true,
+		})
+	}
+
+	return discordWebhookPayload{Embeds: []discordEmbed{embed}}, nil
+}
+
+// decoratePlanText 計画のテキストの各行の先頭に配信者の推しアイコンを付ける
+func decoratePlanText(text string, actors []model.Actor) string {
+	if text == "" {
+		return ""
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		emojis := ""
+		for _, a := range actors {
+			for _, hashtag := range a.Hashtags() {
+				if hashtag == "" {
+					continue
+				}
+				if !strings.HasPrefix(hashtag, "#") {
+					hashtag = "#" + hashtag
+				}
+				if strings.Contains(line, hashtag) {
+					emojis += a.Emoji
+					break
+				}
+			}
+		}
+
+		if emojis != "" {
+			lines[i] = fmt.Sprintf("%v %v", emojis, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
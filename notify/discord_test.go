@@ -0,0 +1,265 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/plan"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+// discordTestServer 受け取ったリクエストをパスごとに記録するDiscordの代わり
+type discordTestServer struct {
+	mu       sync.Mutex
+	payloads map[string][]discordWebhookPayload
+	handler  func(w http.ResponseWriter, r *http.Request) bool
+}
+
+func newDiscordTestServer(t *testing.T) (*discordTestServer, *httptest.Server) {
+	s := &discordTestServer{payloads: map[string][]discordWebhookPayload{}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// handlerがtrueを返した場合は受け取らなかったことにする
+		if s.handler != nil && s.handler(w, r) {
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		var p discordWebhookPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("Can not unmarshal payload: %v", err)
+		}
+
+		s.mu.Lock()
+		s.payloads[r.URL.Path] = append(s.payloads[r.URL.Path], p)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return s, ts
+}
+
+func TestDiscordNotifierRoute(t *testing.T) {
+	s, ts := newDiscordTestServer(t)
+	defer ts.Close()
+
+	iori := Iori
+	iori.Groups = []string{"idol"}
+
+	n := NewDiscordNotifier([]DiscordRoute{
+		{URL: ts.URL + "/all"},
+		{URL: ts.URL + "/siro", Actors: []string{Siro.ID}},
+		{URL: ts.URL + "/idol", Groups: []string{"idol"}},
+		{URL: ts.URL + "/plan", Events: []string{EventKindPlanPublished}},
+		// 同じWebhookは一度だけ送信する
+		{URL: ts.URL + "/all", Actors: []string{Siro.ID}},
+	}, ts.Client(), nil)
+
+	ctx := context.Background()
+	d := jst.ShortDate(2020, 5, 11)
+	events := []Event{
+		NewStreamStartedEvent(d, model.Video{ID: "1", Text: "siro"}, []model.Actor{Siro}),
+		NewStreamStartedEvent(d, model.Video{ID: "2", Text: "collabo"}, []model.Actor{iori, Suzu}),
+		NewPlanPublishedEvent(CreatePlan(d, []EntryPart{CreateEntryPart(Suzu, 20, 0)}), All),
+	}
+	for _, e := range events {
+		if err := n.Notify(ctx, e); err != nil {
+			t.Fatalf("Can not notify: %v", err)
+		}
+	}
+
+	expected := map[string]int{
+		"/all":  3,
+		"/siro": 1,
+		"/idol": 1,
+		"/plan": 1,
+	}
+	for path, count := range expected {
+		if len(s.payloads[path]) != count {
+			t.Errorf("%v, got: %v expect: %v", path, len(s.payloads[path]), count)
+		}
+	}
+}
+
+func TestDiscordNotifierEmbed(t *testing.T) {
+	s, ts := newDiscordTestServer(t)
+	defer ts.Close()
+
+	siro := Siro
+	siro.Icon = "https://icon"
+
+	n := NewDiscordNotifier([]DiscordRoute{{URL: ts.URL + "/all"}}, ts.Client(), nil)
+	v := model.Video{
+		ID:         "video-id",
+		Text:       "video-text",
+		URL:        "https://video",
+		Source:     model.VideoSourceYoutube,
+		MemberOnly: true,
+		StartAt:    jst.Date(2020, 5, 11, 21, 0),
+	}
+	err := n.Notify(context.Background(), NewStreamStartedEvent(jst.ShortDate(2020, 5, 11), v, []model.Actor{siro}))
+	if err != nil {
+		t.Fatalf("Can not notify: %v", err)
+	}
+
+	if len(s.payloads["/all"]) != 1 || len(s.payloads["/all"][0].Embeds) != 1 {
+		t.Fatalf("invalid payloads: %v", s.payloads)
+	}
+
+	embed := s.payloads["/all"][0].Embeds[0]
+	if embed.Title != "配信:電脳少女シロ" || embed.Description != "video-text" || embed.URL != "https://video" {
+		t.Errorf("invalid embed: %v", embed)
+	}
+
+	if embed.Author == nil || embed.Author.IconURL != "https://icon" || embed.Thumbnail == nil {
+		t.Errorf("invalid author: %v", embed.Author)
+	}
+
+	if embed.Timestamp != "2020-05-11T21:00:00+09:00" {
+		t.Errorf("timestamp, got: %v", embed.Timestamp)
+	}
+
+	fields := map[string]string{}
+	for _, f := range embed.Fields {
+		fields[f.Name] = f.Value
+	}
+	if fields["配信サイト"] != model.VideoSourceYoutube || fields["メンバー限定"] != "はい" {
+		t.Errorf("invalid fields: %v", embed.Fields)
+	}
+}
+
+func TestDiscordNotifierRateLimit(t *testing.T) {
+	s, ts := newDiscordTestServer(t)
+	defer ts.Close()
+
+	count := 0
+	var lastAt time.Time
+	s.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		count++
+		switch count {
+		case 1:
+			// レート制限された場合は待ってから再送する
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"message":"You are being rate limited.","retry_after":0.05,"global":false}`))
+			return true
+		case 2:
+			// 残りの回数がない場合は次の送信を遅らせる
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset-After", "0.05")
+			lastAt = time.Now()
+		case 3:
+			if time.Since(lastAt) < 40*time.Millisecond {
+				t.Errorf("request must wait for rate limit reset")
+			}
+		}
+		return false
+	}
+
+	n := NewDiscordNotifier([]DiscordRoute{{URL: ts.URL + "/all"}}, ts.Client(), nil)
+	e := NewStreamStartedEvent(jst.ShortDate(2020, 5, 11), model.Video{ID: "video-id"}, []model.Actor{Siro})
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := n.Notify(ctx, e); err != nil {
+			t.Fatalf("Can not notify: %v", err)
+		}
+	}
+
+	if count != 3 || len(s.payloads["/all"]) != 2 {
+		t.Errorf("count, got: %v payloads: %v", count, len(s.payloads["/all"]))
+	}
+}
+
+func TestDiscordNotifierRateLimitTooLong(t *testing.T) {
+	s, ts := newDiscordTestServer(t)
+	defer ts.Close()
+
+	s.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+		return true
+	}
+
+	n := NewDiscordNotifier([]DiscordRoute{{URL: ts.URL + "/all"}}, ts.Client(), nil)
+	e := NewStreamStartedEvent(jst.ShortDate(2020, 5, 11), model.Video{ID: "video-id"}, []model.Actor{Siro})
+	if err := n.Notify(context.Background(), e); err == nil {
+		t.Errorf("error must be returned")
+	}
+}
+
+// memoryDiscordPostStore メモリ上に投稿済みのIDを記録するDiscordPostStore
+type memoryDiscordPostStore struct {
+	posted map[string]bool
+}
+
+func (s *memoryDiscordPostStore) IsPosted(ctx context.Context, id string) (bool, error) {
+	return s.posted[id], nil
+}
+
+func (s *memoryDiscordPostStore) MarkAsPosted(ctx context.Context, id string) error {
+	s.posted[id] = true
+	return nil
+}
+
+func TestDiscordNotifierPostOnce(t *testing.T) {
+	s, ts := newDiscordTestServer(t)
+	defer ts.Close()
+
+	posts := &memoryDiscordPostStore{posted: map[string]bool{}}
+	n := NewDiscordNotifier([]DiscordRoute{
+		{URL: ts.URL + "/all"},
+		{URL: ts.URL + "/siro", Actors: []string{Siro.ID}},
+	}, ts.Client(), posts)
+
+	// 他の送信先の失敗で同じ出来事を再度通知しても一度だけ投稿する
+	ctx := context.Background()
+	d := jst.ShortDate(2020, 5, 11)
+	e := NewStreamStartedEvent(d, model.Video{ID: "video-id"}, []model.Actor{Siro})
+	for i := 0; i < 2; i++ {
+		if err := n.Notify(ctx, e); err != nil {
+			t.Fatalf("Can not notify: %v", err)
+		}
+	}
+
+	if len(s.payloads["/all"]) != 1 || len(s.payloads["/siro"]) != 1 || len(posts.posted) != 2 {
+		t.Errorf("all: %v, siro: %v, posted: %v", len(s.payloads["/all"]), len(s.payloads["/siro"]), len(posts.posted))
+	}
+
+	// 別の出来事は投稿する
+	err := n.Notify(ctx, NewStreamStartedEvent(d, model.Video{ID: "other"}, []model.Actor{Siro}))
+	if err != nil {
+		t.Fatalf("Can not notify: %v", err)
+	}
+
+	if len(s.payloads["/all"]) != 2 {
+		t.Errorf("all, got: %v", len(s.payloads["/all"]))
+	}
+}
+
+func TestDecoratePlanText(t *testing.T) {
+	text := "20:00~:#ヤマトイオリ x #神楽すず\n22:00~:#シロ生放送\n23:00~:#unknown"
+	expected := "🍄🍋 20:00~:#ヤマトイオリ x #神楽すず\n🐬 22:00~:#シロ生放送\n23:00~:#unknown"
+	got := decoratePlanText(text, []model.Actor{Iori, Suzu, Siro})
+	if got != expected {
+		t.Errorf("got: %v expect: %v", got, expected)
+	}
+}
+
+func TestParseDiscordRoutes(t *testing.T) {
+	routes, err := ParseDiscordRoutes(`[{"url":"https://discord.com/api/webhooks/1/a","groups":["idol"]}]`)
+	if err != nil || len(routes) != 1 || routes[0].Groups[0] != "idol" {
+		t.Errorf("invalid routes: %v %v", routes, err)
+	}
+
+	for _, s := range []string{`{`, `[{"url":"http://example.com"}]`} {
+		if _, err := ParseDiscordRoutes(s); err == nil {
+			t.Errorf("error must be returned: %v", s)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+const (
+	// EventKindPlanPublished 計画が公開された
+	EventKindPlanPublished = "planPublished"
+	// EventKindPlanUpdated 通知済みの計画が修正された
+	EventKindPlanUpdated = "planUpdated"
+	// EventKindStreamStarted 配信が始まった
+	EventKindStreamStarted = "streamStarted"
+	// EventKindCollaboStarted コラボ配信が始まった
+	EventKindCollaboStarted = "collaboStarted"
+	// EventKindStreamUpcoming 配信がまもなく始まる
+	EventKindStreamUpcoming = "streamUpcoming"
+	// EventKindStreamRescheduled 配信の開始時刻が変更された
+	EventKindStreamRescheduled = "streamRescheduled"
+	// EventKindStreamCanceled 配信前に動画が削除されたか非公開になった
+	EventKindStreamCanceled = "streamCanceled"
+)
+
+// Event 通知する出来事
+// 送信先ごとの内容はNotifierの実装が作成する
+type Event struct {
+	// Kind 出来事の種類
+	Kind string
+	// Key 冪等性キー
+	// 同じ出来事は同じキーになる
+	Key string
+	// Date アプリで表示するスケジュールの日付
+	Date jst.Time
+	// Plan 計画が公開または修正された場合の計画
+	Plan model.Plan
+	// Changes 計画が修正された場合の通知済みの計画からの変更
+	Changes []model.PlanEntryChange
+	// Video 配信の動画
+	// リマインダーで動画が見つからない場合は空
+	Video model.Video
+	// Actors 関連する配信者
+	// 計画の場合は計画に含まれる配信者
+	Actors []model.Actor
+	// StartAt リマインダーと開始時刻の変更の場合の開始時刻
+	StartAt jst.Time
+	// OldStartAt 開始時刻の変更の場合の変更前の開始時刻
+	OldStartAt jst.Time
+}
+
+// NewPlanPublishedEvent 計画が公開された出来事を作成する
+func NewPlanPublishedEvent(p model.Plan, actors model.ActorSlice) Event {
+	var planActors []model.Actor
+	found := map[string]bool{}
+	for _, e := range p.Entries {
+		actor, err := actors.FindActor(e.ActorID)
+		if err != nil || found[actor.ID] {
+			continue
+		}
+
+		found[actor.ID] = true
+		planActors = append(planActors, actor)
+	}
+
+	return Event{
+		Kind:   EventKindPlanPublished,
+		Key:    fmt.Sprintf("plan/%v/%v", p.Date.Time().Unix(), p.SourceID),
+		Date:   p.Date,
+		Plan:   p,
+		Actors: planActors,
+	}
+}
+
+// NewPlanUpdatedEvent 通知済みの計画が修正された出来事を作成する
+// pは通知済みのエントリを更新する前の計画
+func NewPlanUpdatedEvent(p model.Plan, changes []model.PlanEntryChange, actors model.ActorSlice) Event {
+	var changedActors []model.Actor
+	found := map[string]bool{}
+	for _, c := range changes {
+		actor, err := actors.FindActor(c.Entry.ActorID)
+		if err != nil || found[actor.ID] {
+			continue
+		}
+
+		found[actor.ID] = true
+		changedActors = append(changedActors, actor)
+	}
+
+	return Event{
+		Kind:    EventKindPlanUpdated,
+		Key:     fmt.Sprintf("planUpdated/%v/%v", p.Date.Time().Unix(), p.NotifiedAt.Time().Unix()),
+		Date:    p.Date,
+		Plan:    p,
+		Changes: changes,
+		Actors:  changedActors,
+	}
+}
+
+// NewStreamStartedEvent 配信が始まった出来事を作成する
+// 配信者が複数の場合はコラボ配信になる
+func NewStreamStartedEvent(date jst.Time, v model.Video, actors []model.Actor) Event {
+	kind := EventKindStreamStarted
+	if len(actors) > 1 {
+		kind = EventKindCollaboStarted
+	}
+
+	return Event{
+		Kind:    kind,
+		Key:     fmt.Sprintf("video/%v", v.ID),
+		Date:    date,
+		Video:   v,
+		Actors:  actors,
+		StartAt: v.StartAt,
+	}
+}
+
+// NewStreamUpcomingEvent 配信がまもなく始まる出来事を作成する
+// 動画が見つからない場合はvを空にする
+func NewStreamUpcomingEvent(date jst.Time, startAt jst.Time, v model.Video, actors []model.Actor) Event {
+	return Event{
+		Kind:    EventKindStreamUpcoming,
+		Key:     fmt.Sprintf("remind/%v/%v", startAt.Time().Unix(), actorIDs(actors)),
+		Date:    date,
+		Video:   v,
+		Actors:  actors,
+		StartAt: startAt,
+	}
+}
+
+// NewStreamRescheduledEvent 配信の開始時刻が変更された出来事を作成する
+func NewStreamRescheduledEvent(date jst.Time, v model.Video, oldStartAt jst.Time, actors []model.Actor) Event {
+	return Event{
+		Kind:       EventKindStreamRescheduled,
+		Key:        fmt.Sprintf("rescheduled/%v/%v", v.ID, v.StartAt.Time().Unix()),
+		Date:       date,
+		Video:      v,
+		Actors:     actors,
+		StartAt:    v.StartAt,
+		OldStartAt: oldStartAt,
+	}
+}
+
+// NewStreamCanceledEvent 配信前に動画が削除されたか非公開になった出来事を作成する
+func NewStreamCanceledEvent(date jst.Time, v model.Video, actors []model.Actor) Event {
+	return Event{
+		Kind:    EventKindStreamCanceled,
+		Key:     fmt.Sprintf("canceled/%v", v.ID),
+		Date:    date,
+		Video:   v,
+		Actors:  actors,
+		StartAt: v.StartAt,
+	}
+}
+
+func actorIDs(actors []model.Actor) string {
+	ids := []string{}
+	for _, a := range actors {
+		ids = append(ids, a.ID)
+	}
+
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const maxTopicCount = 5
+
+// FCMNotifier FCMでプッシュ通知するNotifier
+type FCMNotifier struct {
+	cli Client
+}
+
+// NewFCMNotifier FCMでプッシュ通知するNotifierを作成する
+func NewFCMNotifier(cli Client) *FCMNotifier {
+	return &FCMNotifier{cli: cli}
+}
+
+// Notify 出来事をプッシュ通知する
+func (n *FCMNotifier) Notify(ctx context.Context, e Event) error {
+	m, err := Render(e)
+	if err != nil {
+		return err
+	}
+
+	if e.Key != "" {
+		ctx = WithIdempotencyKey(ctx, e.Key)
+	}
+
+	// 計画はトピックが1つだけなので条件を使用しない
+	if e.Kind == EventKindPlanPublished || e.Kind == EventKindPlanUpdated {
+		_, err := n.cli.Send(ctx, createMessage(m.Topics[0], m))
+		return err
+	}
+
+	conditions := []string{}
+	for _, t := range m.Topics {
+		conditions = append(conditions, fmt.Sprintf("'%v' in topics", t))
+	}
+
+	return sendWithConditions(ctx, n.cli, conditions, m)
+}
+
+// sendWithConditions トピックの条件を分けて送信する
+func sendWithConditions(ctx context.Context, cli Client, conditions []string, m Message) error {
+	// 一度に指定できるトピックは5つまでなのでそれ以上の場合は分ける
+	// トピックを全て購読している人には通知が二回行くが仕方ない
+	// (多分5人以上のコラボはほとんどないので気にしない)
+	var firstErr error
+	for i := 0; i < len(conditions); i += maxTopicCount {
+		end := i + maxTopicCount
+		if end >= len(conditions) {
+			end = len(conditions)
+		}
+
+		condition := strings.Join(conditions[i:end], " || ")
+		// 途中でエラーになっても送信済みのものは取り消せないので残りも送信する
+		// アウトボックスを使用する場合は送信に失敗したものだけが再送される
+		_, err := cli.Send(ctx, createMessageWithCondition(condition, m))
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
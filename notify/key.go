@@ -0,0 +1,18 @@
+package notify
+
+import "context"
+
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey 送信するメッセージの冪等性キーを設定したコンテキストを作成する
+// アウトボックスは冪等性キーとメッセージの内容が同じメッセージを一度しか保存しない
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// IdempotencyKey コンテキストに設定された冪等性キーを取得する
+// 設定されていない場合は空文字を返す
+func IdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyContextKey{}).(string)
+	return key
+}
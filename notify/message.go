@@ -1,21 +1,45 @@
 package notify
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
 	"firebase.google.com/go/messaging"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
 )
 
-func createMessage(topic, title, body string, data map[string]string) *messaging.Message {
-	return &messaging.Message{
-		Topic: topic,
+// apnsExpirationHeader APNsで通知の有効期限を指定するヘッダー
+const apnsExpirationHeader = "apns-expiration"
+
+func createMessage(topic string, m Message) *messaging.Message {
+	message := createBaseMessage(m)
+	message.Topic = topic
+	return message
+}
+
+func createMessageWithCondition(condition string, m Message) *messaging.Message {
+	message := createBaseMessage(m)
+	message.Condition = condition
+	return message
+}
+
+// createBaseMessage 送信先以外のメッセージの内容を作成する
+// 画像はiOSではNotification Service Extensionで表示するのでmutable-contentを指定する
+// アウトボックスで同じメッセージを判定できるように現在時刻に依存する値は含めない
+func createBaseMessage(m Message) *messaging.Message {
+	message := &messaging.Message{
 		Notification: &messaging.Notification{
-			Title: title,
-			Body:  body,
+			Title:    m.Title,
+			Body:     m.Body,
+			ImageURL: m.ImageURL,
 		},
-		Data: data,
+		Data: m.Data,
 		APNS: &messaging.APNSConfig{
 			Payload: &messaging.APNSPayload{
 				Aps: &messaging.Aps{
-					Sound: "default",
+					Sound:          "default",
+					MutableContent: m.ImageURL != "",
 				},
 			},
 		},
@@ -26,28 +50,53 @@ func createMessage(topic, title, body string, data map[string]string) *messaging
 			},
 		},
 	}
+
+	headers := map[string]string{}
+	if m.CollapseKey != "" {
+		message.Android.CollapseKey = m.CollapseKey
+		// 表示済みの通知もタグで置き換える
+		message.Android.Notification.Tag = m.CollapseKey
+		headers["apns-collapse-id"] = m.CollapseKey
+	}
+
+	// AndroidのTTLは送信する直前にsetAndroidTTLで設定する
+	if !m.ExpiresAt.IsZero() {
+		headers[apnsExpirationHeader] = fmt.Sprint(m.ExpiresAt.Time().Unix())
+	}
+
+	if len(headers) > 0 {
+		message.APNS.Headers = headers
+	}
+
+	return message
 }
 
-func createMessageWithCondition(condition, title, body string, data map[string]string) *messaging.Message {
-	return &messaging.Message{
-		Condition: condition,
-		Notification: &messaging.Notification{
-			Title: title,
-			Body:  body,
-		},
-		Data: data,
-		APNS: &messaging.APNSConfig{
-			Payload: &messaging.APNSPayload{
-				Aps: &messaging.Aps{
-					Sound: "default",
-				},
-			},
-		},
-		Android: &messaging.AndroidConfig{
-			Priority: "high",
-			Notification: &messaging.AndroidNotification{
-				ClickAction: "FLUTTER_NOTIFICATION_CLICK",
-			},
-		},
+// setAndroidTTL APNsの有効期限からAndroidのTTLを設定したメッセージを返す
+// TTLは送信した時刻からの期間なのでアウトボックスから再送する場合も正しくなるように送信する直前に設定する
+// 期限を過ぎている場合はTTLを0にしてすぐに届けられない場合は破棄させる
+func setAndroidTTL(message *messaging.Message, now jst.Time) *messaging.Message {
+	if message.APNS == nil || message.Android == nil {
+		return message
+	}
+
+	expiration, ok := message.APNS.Headers[apnsExpirationHeader]
+	if !ok {
+		return message
+	}
+
+	unix, err := strconv.ParseInt(expiration, 10, 64)
+	if err != nil {
+		return message
+	}
+
+	ttl := time.Unix(unix, 0).Sub(now.Time()).Truncate(time.Second)
+	if ttl < 0 {
+		ttl = 0
 	}
+
+	temp := *message
+	android := *message.Android
+	android.TTL = &ttl
+	temp.Android = &android
+	return &temp
 }
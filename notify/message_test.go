@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/messaging"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/notify"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestNotifyVideoPayload(t *testing.T) {
+	startAt := jst.Date(2020, 5, 11, 20, 0)
+	v := model.Video{
+		ID:        "abc-Youtube",
+		URL:       "https://www.youtube.com/watch?v=abc",
+		Source:    model.VideoSourceYoutube,
+		Text:      "video-text",
+		Thumbnail: "https://i.ytimg.com/vi/abc/hqdefault.jpg",
+		StartAt:   startAt,
+	}
+
+	cli := &TestNotifyClient{}
+	err := NewFCMNotifier(cli).Notify(context.Background(), NewStreamStartedEvent(jst.ShortDate(2020, 5, 11), v, []model.Actor{Iori, Suzu}))
+	if err != nil {
+		t.Fatalf("Can not notify: %v", err)
+	}
+
+	if len(cli.Messages) != 1 {
+		t.Fatalf("len(messages), got: %v", len(cli.Messages))
+	}
+
+	// アウトボックスに保存したものと同じ内容で送信されることを確認する
+	bytes, err := json.Marshal(cli.Messages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m messaging.Message
+	err = json.Unmarshal(bytes, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectData := map[string]string{
+		"date":     "2020-5-11",
+		"url":      v.URL,
+		"videoId":  v.ID,
+		"source":   v.Source,
+		"actorIds": "iori,suzu",
+	}
+	for key, expect := range expectData {
+		if m.Data[key] != expect {
+			t.Errorf("data[%v], got: %v expect: %v", key, m.Data[key], expect)
+		}
+	}
+
+	if m.Notification.ImageURL != v.Thumbnail {
+		t.Errorf("image, got: %v", m.Notification.ImageURL)
+	}
+
+	if !m.APNS.Payload.Aps.MutableContent {
+		t.Errorf("mutable-content must be set")
+	}
+
+	if m.Android.CollapseKey != "video-abc-Youtube" || m.Android.Notification.Tag != "video-abc-Youtube" || m.APNS.Headers["apns-collapse-id"] != "video-abc-Youtube" {
+		t.Errorf("collapse key, got: %v %v %v", m.Android.CollapseKey, m.Android.Notification.Tag, m.APNS.Headers["apns-collapse-id"])
+	}
+
+	expiration := startAt.Add(streamNotificationLifetime)
+	if m.APNS.Headers["apns-expiration"] != "1589202000" || !time.Unix(1589202000, 0).Equal(expiration.Time()) {
+		t.Errorf("apns-expiration, got: %v", m.APNS.Headers["apns-expiration"])
+	}
+
+	if m.Android.TTL != nil {
+		t.Errorf("ttl must be set when sending")
+	}
+}
+
+func TestSetAndroidTTL(t *testing.T) {
+	expiresAt := jst.Date(2020, 5, 11, 22, 0)
+	message := createMessage("plan", Message{
+		Title:     "title",
+		ExpiresAt: expiresAt,
+	})
+
+	tests := []struct {
+		now jst.Time
+		ttl time.Duration
+	}{
+		{jst.Date(2020, 5, 11, 20, 0), 2 * time.Hour},
+		{jst.Date(2020, 5, 11, 21, 30), 30 * time.Minute},
+		{jst.Date(2020, 5, 11, 23, 0), 0},
+	}
+
+	for _, tt := range tests {
+		got := setAndroidTTL(message, tt.now)
+		if got.Android.TTL == nil || *got.Android.TTL != tt.ttl {
+			t.Errorf("ttl, now: %v got: %v expect: %v", tt.now, got.Android.TTL, tt.ttl)
+		}
+	}
+
+	if message.Android.TTL != nil {
+		t.Errorf("original must not be modified")
+	}
+
+	plan := createMessage("plan", Message{Title: "title"})
+	if setAndroidTTL(plan, jst.Date(2020, 5, 11, 20, 0)).Android.TTL != nil {
+		t.Errorf("ttl must not be set without expiration")
+	}
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"log"
+
+	"golang.org/x/xerrors"
+)
+
+// Notifier 出来事を通知する
+// FCMなどの送信先ごとに実装する
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// MultiNotifier 全ての送信先に通知するNotifier
+// 最初の送信先を主な送信先(FCM)として扱う
+type MultiNotifier []Notifier
+
+// Notify 全ての送信先に通知する
+// 送信先のどれかで失敗しても他の送信先には通知する
+// 主な送信先以外の失敗はここでログに出力するだけにして、主な送信先のエラーだけを返す
+// DiscordなどのエラーでFCMの通知が止まらないようにするため
+func (m MultiNotifier) Notify(ctx context.Context, e Event) error {
+	var primaryErr error
+	for i, n := range m {
+		err := n.Notify(ctx, e)
+		if err == nil {
+			continue
+		}
+
+		if i == 0 {
+			primaryErr = xerrors.Errorf("Can not notify %v: %T: %w", e.Kind, n, err)
+			continue
+		}
+
+		log.Printf("Can not notify %v: %T: %v", e.Kind, n, err)
+	}
+
+	return primaryErr
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"firebase.google.com/go/messaging"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/notify"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+type failNotifier struct{}
+
+func (failNotifier) Notify(ctx context.Context, e Event) error {
+	return errors.New("failed")
+}
+
+func TestMultiNotifier(t *testing.T) {
+	cli1 := &TestNotifyClient{}
+	cli2 := &TestNotifyClient{}
+	n := MultiNotifier{
+		NewFCMNotifier(cli1),
+		failNotifier{},
+		NewFCMNotifier(cli2),
+	}
+
+	e := NewStreamStartedEvent(jst.ShortDate(2020, 5, 11), model.Video{ID: "video-id", Text: "video-text"}, []model.Actor{Siro})
+	err := n.Notify(context.Background(), e)
+	// 主な送信先以外の失敗はエラーにしない
+	if err != nil {
+		t.Errorf("error must not be returned: %v", err)
+	}
+
+	// 失敗した送信先があっても他の送信先には通知する
+	if len(cli1.Messages) != 1 || len(cli2.Messages) != 1 {
+		t.Errorf("len(messages), got: %v, %v", len(cli1.Messages), len(cli2.Messages))
+	}
+
+	cli3 := &TestNotifyClient{}
+	n = MultiNotifier{
+		failNotifier{},
+		NewFCMNotifier(cli3),
+	}
+	err = n.Notify(context.Background(), e)
+	if err == nil {
+		t.Errorf("error of primary notifier must be returned")
+	}
+	if len(cli3.Messages) != 1 {
+		t.Errorf("len(messages), got: %v", len(cli3.Messages))
+	}
+}
+
+func TestFCMNotifierIdempotencyKey(t *testing.T) {
+	var key string
+	cli := clientFunc(func(ctx context.Context) {
+		key = IdempotencyKey(ctx)
+	})
+
+	e := NewStreamStartedEvent(jst.ShortDate(2020, 5, 11), model.Video{ID: "video-id"}, []model.Actor{Siro})
+	err := NewFCMNotifier(cli).Notify(context.Background(), e)
+	if err != nil {
+		t.Fatalf("Can not notify: %v", err)
+	}
+
+	if key != "video/video-id" {
+		t.Errorf("key, got: %v", key)
+	}
+}
+
+// clientFunc 送信時のコンテキストを確認するクライアント
+type clientFunc func(ctx context.Context)
+
+func (f clientFunc) Send(ctx context.Context, message *messaging.Message) (string, error) {
+	f(ctx)
+	return "", nil
+}
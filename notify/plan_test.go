@@ -125,7 +125,7 @@ func TestNotifyPlan(t *testing.T) {
 					Text:    tt.body,
 				},
 			}
-			PushNotifyPlan(ctx, cli, p, All)
+			NewFCMNotifier(cli).Notify(ctx, NewPlanPublishedEvent(p, All))
 			if len(cli.Messages) != 1 {
 				t.Errorf("inavalid len(cli.Messages), got: %v", len(cli.Messages))
 				return
@@ -136,8 +136,12 @@ func TestNotifyPlan(t *testing.T) {
 				body = "なし"
 			}
 
-			expect := createMessage("plan", tt.title, body, map[string]string{
-				"date": fmt.Sprintf("%v-%v-%v", tt.date.Year(), int(tt.date.Month()), tt.date.Day()),
+			expect := createMessage("plan", Message{
+				Title: tt.title,
+				Body:  body,
+				Data: map[string]string{
+					"date": fmt.Sprintf("%v-%v-%v", tt.date.Year(), int(tt.date.Month()), tt.date.Day()),
+				},
 			})
 			comparePlanMessage(t, cli.Messages[0], expect)
 		})
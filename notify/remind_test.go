@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/notify"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestNotifyRemind(t *testing.T) {
+	tests := []struct {
+		conditions []string
+		title      string
+		body       string
+		text       string
+		actors     []model.Actor
+	}{
+		{
+			[]string{
+				"'test-siro-remind' in topics",
+			},
+			"まもなく配信:電脳少女シロ",
+			"21:05~ video-text",
+			"video-text",
+			[]model.Actor{
+				Siro,
+			},
+		},
+		{
+			[]string{
+				"'test-iori-remind' in topics",
+				"'test-suzu-remind' in topics",
+			},
+			"まもなくコラボ配信:🍄🍋",
+			"21:05~",
+			"",
+			[]model.Actor{
+				Iori,
+				Suzu,
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			cli := &TestNotifyClient{}
+
+			err := NewFCMNotifier(cli).Notify(ctx, NewStreamUpcomingEvent(jst.ShortDate(2020, 5, 11), jst.Date(2020, 5, 11, 21, 5), model.Video{Text: tt.text}, tt.actors))
+			if err != nil {
+				t.Fatalf("Can not send: %v", err)
+			}
+
+			testNotifyVideoMessages(t, cli.Messages, tt.title, tt.body, tt.conditions, "2020-5-11")
+		})
+	}
+
+	err := NewFCMNotifier(&TestNotifyClient{}).Notify(ctx, NewStreamUpcomingEvent(jst.ShortDate(2020, 5, 11), jst.Date(2020, 5, 11, 21, 5), model.Video{}, nil))
+	if err == nil {
+		t.Errorf("actors are empty")
+	}
+}
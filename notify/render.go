@@ -0,0 +1,293 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"golang.org/x/xerrors"
+)
+
+// planTopic 計画を通知するトピック
+const planTopic = "plan"
+
+// streamNotificationLifetime 配信開始の通知に意味がある期間
+// 配信開始から2時間以上経っている場合は通知しないのに合わせる
+const streamNotificationLifetime = 2 * time.Hour
+
+// Message 送信先に依存しない通知の内容
+type Message struct {
+	// Title タイトル
+	Title string
+	// Body 本文
+	Body string
+	// Topics 通知するトピック
+	// いずれかのトピックを購読している人に通知する
+	Topics []string
+	// Data アプリに渡すデータ
+	Data map[string]string
+	// ImageURL 通知に表示する画像のURL
+	// 表示しない場合は空文字
+	ImageURL string
+	// CollapseKey 同じ対象の通知を置き換えるためのキー
+	// 置き換えない場合は空文字
+	CollapseKey string
+	// ExpiresAt この時刻を過ぎたら届けても意味がない
+	// 期限がない場合はゼロ値
+	ExpiresAt jst.Time
+}
+
+// Render 出来事から通知の内容を作成する
+func Render(e Event) (Message, error) {
+	switch e.Kind {
+	case EventKindPlanPublished:
+		return renderPlan(e), nil
+	case EventKindPlanUpdated:
+		if len(e.Changes) == 0 {
+			return Message{}, xerrors.Errorf("Changes are empty. plan '%v'", e.Date)
+		}
+		return Message{
+			Title:  createTitle("スケジュール更新", e.Date, model.Plan{Entries: changedEntries(e.Changes)}, e.Actors),
+			Body:   createChangesBody(e.Changes, e.Actors),
+			Topics: []string{planTopic},
+			Data:   createData(e.Date),
+		}, nil
+	case EventKindStreamStarted, EventKindCollaboStarted:
+		if len(e.Actors) == 0 {
+			return Message{}, xerrors.Errorf("Actors are empty. video '%v'", e.Video.URL)
+		}
+		return Message{
+			Title:       createActorsTitle("", e.Actors),
+			Body:        e.Video.Text,
+			Topics:      createVideoTopics(e.Actors),
+			Data:        createVideoData(e.Date, e.Video, e.Actors),
+			ImageURL:    e.Video.Thumbnail,
+			CollapseKey: createCollapseKey(e.Video),
+			ExpiresAt:   e.StartAt.Add(streamNotificationLifetime),
+		}, nil
+	case EventKindStreamUpcoming:
+		if len(e.Actors) == 0 {
+			return Message{}, xerrors.Errorf("Actors are empty. startAt '%v'", e.StartAt)
+		}
+		return Message{
+			Title:       createActorsTitle("まもなく", e.Actors),
+			Body:        joinText(formatStartAt(e.StartAt), e.Video.Text),
+			Topics:      createRemindTopics(e.Actors),
+			Data:        createData(e.Date),
+			CollapseKey: createCollapseKey(e.Video),
+		}, nil
+	case EventKindStreamRescheduled:
+		if len(e.Actors) == 0 {
+			return Message{}, xerrors.Errorf("Actors are empty. video '%v'", e.Video.URL)
+		}
+		return Message{
+			Title:       createActorsTitle("時間変更:", e.Actors),
+			Body:        joinText(fmt.Sprintf("%v → %v", formatStartAt(e.OldStartAt), formatStartAt(e.StartAt)), e.Video.Text),
+			Topics:      createVideoTopics(e.Actors),
+			Data:        createData(e.Date),
+			CollapseKey: createCollapseKey(e.Video),
+		}, nil
+	case EventKindStreamCanceled:
+		if len(e.Actors) == 0 {
+			return Message{}, xerrors.Errorf("Actors are empty. video '%v'", e.Video.URL)
+		}
+		return Message{
+			Title:       createActorsTitle("中止:", e.Actors),
+			Body:        joinText(formatStartAt(e.StartAt), e.Video.Text),
+			Topics:      createVideoTopics(e.Actors),
+			Data:        createData(e.Date),
+			CollapseKey: createCollapseKey(e.Video),
+		}, nil
+	}
+
+	return Message{}, xerrors.Errorf("Unknown event kind '%v'", e.Kind)
+}
+
+func renderPlan(e Event) Message {
+	return Message{
+		Title:  createTitle("生放送スケジュール", e.Date, e.Plan, e.Actors),
+		Body:   createBody(e.Plan.Text()),
+		Topics: []string{planTopic},
+		Data:   createData(e.Date),
+	}
+}
+
+// createActorsTitle 配信の通知のタイトルを作成する
+// ソロの場合は配信者の名前、コラボの場合は推しアイコンを並べる
+func createActorsTitle(prefix string, actors []model.Actor) string {
+	if len(actors) == 1 {
+		return fmt.Sprintf("%v配信:%v", prefix, actors[0].Name)
+	}
+
+	emojis := []string{}
+	for _, a := range actors {
+		emojis = append(emojis, a.Emoji)
+	}
+	return fmt.Sprintf("%vコラボ配信:%v", prefix, strings.Join(emojis, ""))
+}
+
+func createTitle(prefix string, d jst.Time, p model.Plan, actors model.ActorSlice) string {
+	emojis := []string{}
+OUTER:
+	for _, e := range p.Entries {
+		actor, err := actors.FindActor(e.ActorID)
+		if err != nil {
+			continue
+		}
+
+		for _, emoji := range emojis {
+			if emoji == actor.Emoji {
+				continue OUTER
+			}
+		}
+		emojis = append(emojis, actor.Emoji)
+	}
+
+	var emojiStr string
+	if len(emojis) > 0 {
+		emojiStr = "(" + strings.Join(emojis, "") + ")"
+	} else {
+		emojiStr = ""
+	}
+
+	return fmt.Sprintf("%v%v月%v日%v", prefix, int(d.Month()), d.Day(), emojiStr)
+}
+
+func changedEntries(changes []model.PlanEntryChange) []model.PlanEntry {
+	var entries []model.PlanEntry
+	for _, c := range changes {
+		entries = append(entries, c.Entry)
+	}
+	return entries
+}
+
+// createChangesBody 計画の変更を1行ずつ並べた本文を作成する
+// 同じコラボの同じ変更は1行にまとめる
+func createChangesBody(changes []model.PlanEntryChange, actors model.ActorSlice) string {
+	lines := []string{}
+	for i := 0; i < len(changes); {
+		c := changes[i]
+		names := []string{entryName(c.Entry, actors)}
+		j := i + 1
+		for ; j < len(changes); j++ {
+			other := changes[j]
+			if c.Entry.CollaboID <= 0 || other.Entry.CollaboID != c.Entry.CollaboID || other.Kind != c.Kind ||
+				!other.Entry.StartAt.Equal(c.Entry.StartAt) || !other.OldStartAt.Equal(c.OldStartAt) {
+				break
+			}
+			names = append(names, entryName(other.Entry, actors))
+		}
+		i = j
+
+		var head string
+		switch c.Kind {
+		case model.PlanEntryChangeKindAdded:
+			head = "追加 " + formatStartAt(c.Entry.StartAt)
+		case model.PlanEntryChangeKindRemoved:
+			head = "取消 " + formatStartAt(c.Entry.StartAt)
+		default:
+			head = fmt.Sprintf("変更 %v → %v", formatStartAt(c.OldStartAt), formatStartAt(c.Entry.StartAt))
+		}
+		lines = append(lines, joinText(head, strings.Join(names, " x ")))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// entryName エントリの配信者の名前を取得する
+// 配信者が不明な場合はハッシュタグにする
+func entryName(e model.PlanEntry, actors model.ActorSlice) string {
+	actor, err := actors.FindActor(e.ActorID)
+	if err == nil {
+		return actor.Name
+	}
+	return e.HashTag
+}
+
+func createBody(text string) string {
+	if text == "" {
+		return "なし"
+	}
+	return text
+}
+
+func createData(d jst.Time) map[string]string {
+	return map[string]string{
+		"date": fmt.Sprintf("%v-%v-%v", d.Year(), int(d.Month()), d.Day()),
+	}
+}
+
+// createVideoData 配信開始の通知でアプリに渡すデータを作成する
+// アプリから直接配信を開けるように動画と配信者の情報を含める
+func createVideoData(d jst.Time, v model.Video, actors []model.Actor) map[string]string {
+	data := createData(d)
+	data["url"] = v.URL
+	data["videoId"] = v.ID
+	data["source"] = v.Source
+	data["actorIds"] = actorIDs(actors)
+	return data
+}
+
+// createCollapseKey 同じ動画の通知を置き換えるためのキーを作成する
+// リマインダーの後に配信開始の通知が届いた場合などは新しい方だけが表示される
+// 動画が見つからない場合は置き換えない
+func createCollapseKey(v model.Video) string {
+	if v.ID == "" {
+		return ""
+	}
+	return "video-" + v.ID
+}
+
+func formatStartAt(t jst.Time) string {
+	return fmt.Sprintf("%02d:%02d~", t.Hour(), t.Minute())
+}
+
+func joinText(head, text string) string {
+	if text == "" {
+		return head
+	}
+	return head + " " + text
+}
+
+// createVideoTopics 配信を通知するトピックを作成する
+// 配信者のトピックの後に所属するグループのトピックを重複しないように追加する
+// 一度に指定できるトピックの数を超える場合は分けて送信すると二重に通知されるので、グループのトピックは入る分だけにする
+func createVideoTopics(actors []model.Actor) []string {
+	topics := []string{}
+	add := func(topic string) {
+		for _, t := range topics {
+			if t == topic {
+				return
+			}
+		}
+		topics = append(topics, topic)
+	}
+
+	for _, a := range actors {
+		add(a.TwitterScreenName)
+	}
+
+	for _, a := range actors {
+		for _, groupID := range a.Groups {
+			if len(topics) >= maxTopicCount {
+				return topics
+			}
+			add(model.GroupTopicName(groupID))
+		}
+	}
+
+	return topics
+}
+
+// createRemindTopics リマインダーを通知するトピックを作成する
+// グループのリマインダー用のトピックはない
+func createRemindTopics(actors []model.Actor) []string {
+	topics := []string{}
+	for _, a := range actors {
+		topics = append(topics, model.RemindTopicName(a.TwitterScreenName))
+	}
+
+	return topics
+}
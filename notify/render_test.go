@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"testing"
+
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/plan"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestRenderRescheduled(t *testing.T) {
+	v := model.Video{
+		ID:      "video-id",
+		Text:    "video-text",
+		StartAt: jst.Date(2020, 5, 11, 22, 0),
+	}
+
+	tests := []struct {
+		actors []model.Actor
+		title  string
+		topics []string
+	}{
+		{
+			[]model.Actor{Siro},
+			"時間変更:配信:電脳少女シロ",
+			[]string{"test-siro"},
+		},
+		{
+			[]model.Actor{Iori, Suzu},
+			"時間変更:コラボ配信:🍄🍋",
+			[]string{"test-iori", "test-suzu"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			m, err := Render(NewStreamRescheduledEvent(jst.ShortDate(2020, 5, 11), v, jst.Date(2020, 5, 11, 21, 0), tt.actors))
+			if err != nil {
+				t.Fatalf("Can not render: %v", err)
+			}
+
+			if m.Title != tt.title {
+				t.Errorf("title, got: %v expect: %v", m.Title, tt.title)
+			}
+
+			if m.Body != "21:00~ → 22:00~ video-text" {
+				t.Errorf("body, got: %v", m.Body)
+			}
+
+			if len(m.Topics) != len(tt.topics) {
+				t.Fatalf("topics, got: %v expect: %v", m.Topics, tt.topics)
+			}
+			for i, topic := range tt.topics {
+				if m.Topics[i] != topic {
+					t.Errorf("topics[%v], got: %v expect: %v", i, m.Topics[i], topic)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderPlanUpdated(t *testing.T) {
+	d := jst.ShortDate(2020, 5, 11)
+	p := CreatePlan(d, []EntryPart{
+		CreateEntryPart(Siro, 20, 0),
+		CreateEntryPartCollabo(Iori, 22, 0, 1),
+		CreateEntryPartCollabo(Suzu, 22, 0, 1),
+		CreateEntryPartHashTag("#tag", 23, 0),
+	})
+	p.NotifiedAt = jst.Date(2020, 5, 11, 9, 0)
+	p.NotifiedEntries = CreatePlan(d, []EntryPart{
+		CreateEntryPart(Siro, 21, 0),
+		CreateEntryPart(Pino, 22, 0),
+	}).Entries
+
+	e := NewPlanUpdatedEvent(p, p.NotifiedChanges(), All)
+	m, err := Render(e)
+	if err != nil {
+		t.Fatalf("Can not render: %v", err)
+	}
+
+	if m.Title != "スケジュール更新5月11日(🐬🍄🍋🐜)" {
+		t.Errorf("title, got: %v", m.Title)
+	}
+
+	expect := "変更 21:00~ → 20:00~ 電脳少女シロ\n追加 22:00~ ヤマトイオリ x 神楽すず\n取消 22:00~ カルロピノ\n追加 23:00~ #tag"
+	if m.Body != expect {
+		t.Errorf("body, got: %v expect: %v", m.Body, expect)
+	}
+
+	if len(m.Topics) != 1 || m.Topics[0] != "plan" {
+		t.Errorf("topics, got: %v", m.Topics)
+	}
+
+	if e.Key != NewPlanUpdatedEvent(p, p.NotifiedChanges(), All).Key {
+		t.Errorf("key is not stable: %v", e.Key)
+	}
+
+	_, err = Render(NewPlanUpdatedEvent(p, nil, All))
+	if err == nil {
+		t.Errorf("empty changes must be error")
+	}
+}
+
+func TestRenderCanceled(t *testing.T) {
+	v := model.Video{
+		ID:      "video-id",
+		Text:    "video-text",
+		StartAt: jst.Date(2020, 5, 11, 22, 0),
+	}
+
+	m, err := Render(NewStreamCanceledEvent(jst.ShortDate(2020, 5, 11), v, []model.Actor{Siro}))
+	if err != nil {
+		t.Fatalf("Can not render: %v", err)
+	}
+
+	if m.Title != "中止:配信:電脳少女シロ" {
+		t.Errorf("title, got: %v", m.Title)
+	}
+
+	if m.Body != "22:00~ video-text" {
+		t.Errorf("body, got: %v", m.Body)
+	}
+
+	if len(m.Topics) != 1 || m.Topics[0] != "test-siro" {
+		t.Errorf("topics, got: %v", m.Topics)
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	tests := []Event{
+		{Kind: "unknown"},
+		NewStreamStartedEvent(jst.ShortDate(2020, 5, 11), model.Video{}, nil),
+		NewStreamRescheduledEvent(jst.ShortDate(2020, 5, 11), model.Video{}, jst.Date(2020, 5, 11, 21, 0), nil),
+	}
+
+	for _, e := range tests {
+		_, err := Render(e)
+		if err == nil {
+			t.Errorf("error must be returned: %v", e.Kind)
+		}
+	}
+}
+
+func TestNewStreamStartedEventKind(t *testing.T) {
+	d := jst.ShortDate(2020, 5, 11)
+	if e := NewStreamStartedEvent(d, model.Video{ID: "a"}, []model.Actor{Siro}); e.Kind != EventKindStreamStarted || e.Key != "video/a" {
+		t.Errorf("invalid event: %v %v", e.Kind, e.Key)
+	}
+
+	if e := NewStreamStartedEvent(d, model.Video{ID: "a"}, []model.Actor{Iori, Suzu}); e.Kind != EventKindCollaboStarted {
+		t.Errorf("invalid kind: %v", e.Kind)
+	}
+}
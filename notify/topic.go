@@ -1,25 +1,37 @@
 package notify
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
+	"strings"
 
+	firebase "firebase.google.com/go"
+	"firebase.google.com/go/messaging"
 	"golang.org/x/xerrors"
 )
 
-// GetTopics 指定したクライアントが購読しているトピックの一覧を取得する
-func GetTopics(clientToken string) ([]string, error) {
+// ErrInvalidToken クライアントのトークンが無効になっている
+// アプリが削除された場合などはFCMに登録されていないトークンになる
+var ErrInvalidToken = errors.New("notify: invalid token")
+
+// GetTopics 指定したクライアントが購読しているトピックの一覧をIIDのAPIから取得する
+// サーバーで購読を管理する前に購読したクライアントのために、移行が終わるまでは残しておく
+// IIDに登録されていないトークンは何も購読していないものとする
+func GetTopics(ctx context.Context, clientToken string) ([]string, error) {
 	serverKey := os.Getenv("FIREBASE_SERVER_KEY")
 	if serverKey == "" {
 		return nil, xerrors.Errorf("Missing env 'FIREBASE_SERVER_KEY'")
 	}
 
 	url := fmt.Sprintf("https://iid.googleapis.com/iid/info/%v?details=true", url.PathEscape(clientToken))
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -30,6 +42,11 @@ func GetTopics(clientToken string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusNotFound {
+		return []string{}, nil
+	}
 
 	if res.StatusCode != http.StatusOK {
 		return nil, xerrors.Errorf("Can not get topics")
@@ -50,10 +67,64 @@ func GetTopics(clientToken string) ([]string, error) {
 		return nil, xerrors.Errorf("Can not unmarshl json: %w", err)
 	}
 
-	var topics []string
+	topics := []string{}
 	for t := range d.Rel.Topics {
 		topics = append(topics, t)
 	}
+	sort.Strings(topics)
 
 	return topics, nil
 }
+
+// TopicClient トピックの購読を管理するクライアント
+type TopicClient interface {
+	SubscribeToTopic(ctx context.Context, tokens []string, topic string) (*messaging.TopicManagementResponse, error)
+	UnsubscribeFromTopic(ctx context.Context, tokens []string, topic string) (*messaging.TopicManagementResponse, error)
+}
+
+// NewTopicClient トピックの購読を管理するクライアントを作成する
+func NewTopicClient(ctx context.Context) (TopicClient, error) {
+	app, err := firebase.NewApp(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.Messaging(ctx)
+}
+
+// SubscribeToTopic クライアントにトピックを購読させる
+// トークンが無効な場合はErrInvalidTokenを返す
+func SubscribeToTopic(ctx context.Context, cli TopicClient, token, topic string) error {
+	res, err := cli.SubscribeToTopic(ctx, []string{token}, topic)
+	return topicManagementError(res, err)
+}
+
+// UnsubscribeFromTopic クライアントのトピックの購読を解除する
+// トークンが無効な場合はErrInvalidTokenを返す
+func UnsubscribeFromTopic(ctx context.Context, cli TopicClient, token, topic string) error {
+	res, err := cli.UnsubscribeFromTopic(ctx, []string{token}, topic)
+	return topicManagementError(res, err)
+}
+
+// topicManagementError トークンごとの結果をエラーにする
+// トークンは1つだけなので最初のエラーだけを確認する
+func topicManagementError(res *messaging.TopicManagementResponse, err error) error {
+	if err != nil {
+		if messaging.IsRegistrationTokenNotRegistered(err) {
+			return xerrors.Errorf("%v: %w", err, ErrInvalidToken)
+		}
+		return err
+	}
+
+	if res.FailureCount == 0 || len(res.Errors) == 0 {
+		return nil
+	}
+
+	// トピック名は事前に確認しているのでinvalid-argumentはトークンの形式が正しくない場合
+	reason := res.Errors[0].Reason
+	if strings.Contains(reason, "registration-token-not-registered") || strings.Contains(reason, "invalid-argument") {
+		return xerrors.Errorf("%v: %w", reason, ErrInvalidToken)
+	}
+
+	return xerrors.Errorf("Can not manage topic: %v", reason)
+}
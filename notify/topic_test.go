@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"firebase.google.com/go/messaging"
+	"golang.org/x/xerrors"
+)
+
+// topicTestClient 指定した結果を返すクライアント
+type topicTestClient struct {
+	res *messaging.TopicManagementResponse
+	err error
+}
+
+func (c *topicTestClient) SubscribeToTopic(ctx context.Context, tokens []string, topic string) (*messaging.TopicManagementResponse, error) {
+	return c.res, c.err
+}
+
+func (c *topicTestClient) UnsubscribeFromTopic(ctx context.Context, tokens []string, topic string) (*messaging.TopicManagementResponse, error) {
+	return c.res, c.err
+}
+
+func TestSubscribeToTopic(t *testing.T) {
+	failure := func(reason string) *messaging.TopicManagementResponse {
+		return &messaging.TopicManagementResponse{
+			FailureCount: 1,
+			Errors:       []*messaging.ErrorInfo{{Index: 0, Reason: reason}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		cli     *topicTestClient
+		err     bool
+		invalid bool
+	}{
+		{"success", &topicTestClient{res: &messaging.TopicManagementResponse{SuccessCount: 1}}, false, false},
+		{"not registered", &topicTestClient{res: failure("request contains an invalid argument; code: registration-token-not-registered")}, true, true},
+		{"invalid token", &topicTestClient{res: failure("request contains an invalid argument; code: invalid-argument")}, true, true},
+		{"too many topics", &topicTestClient{res: failure("client exceeded the number of allowed topics; code: too-many-topics")}, true, false},
+		{"request error", &topicTestClient{err: errors.New("error")}, true, false},
+	}
+
+	for _, tt := range tests {
+		err := SubscribeToTopic(context.Background(), tt.cli, "token", "plan")
+		if (err != nil) != tt.err {
+			t.Errorf("%v: error, got: %v expect: %v", tt.name, err, tt.err)
+		}
+
+		if xerrors.Is(err, ErrInvalidToken) != tt.invalid {
+			t.Errorf("%v: invalid token, got: %v expect: %v", tt.name, err, tt.invalid)
+		}
+	}
+}
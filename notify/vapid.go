@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"golang.org/x/xerrors"
+)
+
+// vapidExpiration VAPIDのJWTの有効期限
+// 24時間より長くするとプッシュサービスに拒否される
+const vapidExpiration = 12 * time.Hour
+
+// GenerateVAPIDKey VAPIDの鍵を作成する
+func GenerateVAPIDKey() (model.VAPIDKey, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return model.VAPIDKey{}, err
+	}
+
+	return model.VAPIDKey{
+		PublicKey:  base64.RawURLEncoding.EncodeToString(elliptic.Marshal(elliptic.P256(), priv.X, priv.Y)),
+		PrivateKey: base64.RawURLEncoding.EncodeToString(padScalar(priv.D.Bytes())),
+	}, nil
+}
+
+// parseVAPIDPrivateKey 保存されたVAPIDの秘密鍵を読み込む
+func parseVAPIDPrivateKey(k model.VAPIDKey) (*ecdsa.PrivateKey, error) {
+	d, err := base64.RawURLEncoding.DecodeString(k.PrivateKey)
+	if err != nil || len(d) != 32 {
+		return nil, xerrors.Errorf("Invalid vapid private key")
+	}
+
+	curve := elliptic.P256()
+	priv := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	priv.Curve = curve
+	priv.X, priv.Y = curve.ScalarBaseMult(d)
+	return priv, nil
+}
+
+// vapidAuthorization プッシュサービスに送信するAuthorizationヘッダを作成する(RFC 8292)
+// subjectは連絡先のmailto:かhttps:のURL
+func vapidAuthorization(endpoint, subject string, k model.VAPIDKey, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	priv, err := parseVAPIDPrivateKey(k)
+	if err != nil {
+		return "", err
+	}
+
+	header, _ := json.Marshal(map[string]string{
+		"typ": "JWT",
+		"alg": "ES256",
+	})
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(vapidExpiration).Unix(),
+		"sub": subject,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, priv, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	// ES256の署名はrとsをそれぞれ32バイトにしてつなげたもの
+	sig := append(padScalar(r.Bytes()), padScalar(s.Bytes())...)
+	jwt := signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+	return fmt.Sprintf("vapid t=%v, k=%v", jwt, k.PublicKey), nil
+}
+
+// padScalar P-256のスカラー値を32バイトにする
+func padScalar(b []byte) []byte {
+	if len(b) >= 32 {
+		return b
+	}
+
+	return append(make([]byte, 32-len(b)), b...)
+}
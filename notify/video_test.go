@@ -2,6 +2,8 @@ package notify
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -124,11 +126,111 @@ func TestNotifyVideo(t *testing.T) {
 		t.Run(tt.title, func(t *testing.T) {
 			cli := &TestNotifyClient{}
 
-			PushNotifyVideo(ctx, cli, jst.ShortDate(2020, 5, 11), model.Video{
+			NewFCMNotifier(cli).Notify(ctx, NewStreamStartedEvent(jst.ShortDate(2020, 5, 11), model.Video{
 				Text: tt.body,
-			}, tt.actors)
+			}, tt.actors))
 
 			testNotifyVideoMessages(t, cli.Messages, tt.title, tt.body, tt.conditions, "2020-5-11")
 		})
 	}
 }
+
+func TestNotifyVideoGroup(t *testing.T) {
+	iori := Iori
+	iori.Groups = []string{"idol"}
+	suzu := Suzu
+	suzu.Groups = []string{"idol", "appare"}
+	pino := Pino
+	pino.Groups = []string{"appare"}
+	chieri := Chieri
+	chieri.Groups = []string{"idol"}
+
+	tests := []struct {
+		conditions []string
+		title      string
+		actors     []model.Actor
+	}{
+		{
+			[]string{
+				"'test-iori' in topics",
+				"'group-idol' in topics",
+			},
+			"配信:ヤマトイオリ",
+			[]model.Actor{iori},
+		},
+		{
+			// 同じグループのトピックは1回だけ
+			[]string{
+				"'test-iori' in topics",
+				"'test-suzu' in topics",
+				"'group-idol' in topics",
+				"'group-appare' in topics",
+			},
+			"コラボ配信:🍄🍋",
+			[]model.Actor{iori, suzu},
+		},
+		{
+			// 5つを超える場合は二重に通知しないようにグループのトピックを入る分だけにする
+			[]string{
+				"'test-iori' in topics",
+				"'test-suzu' in topics",
+				"'test-pino' in topics",
+				"'test-chieri' in topics",
+				"'group-idol' in topics",
+			},
+			"コラボ配信:🍄🍋🐜🍒",
+			[]model.Actor{iori, suzu, pino, chieri},
+		},
+	}
+
+	ctx := context.Background()
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			cli := &TestNotifyClient{}
+
+			NewFCMNotifier(cli).Notify(ctx, NewStreamStartedEvent(jst.ShortDate(2020, 5, 11), model.Video{
+				Text: "video-text",
+			}, tt.actors))
+
+			testNotifyVideoMessages(t, cli.Messages, tt.title, "video-text", tt.conditions, "2020-5-11")
+
+			if len(cli.Messages) != 1 {
+				t.Errorf("len(messages), got: %v", len(cli.Messages))
+			}
+		})
+	}
+}
+
+// failFirstClient 最初の送信だけ失敗するクライアント
+type failFirstClient struct {
+	TestNotifyClient
+	failed bool
+}
+
+func (c *failFirstClient) Send(ctx context.Context, message *messaging.Message) (string, error) {
+	if !c.failed {
+		c.failed = true
+		return "", errors.New("failed")
+	}
+
+	return c.TestNotifyClient.Send(ctx, message)
+}
+
+func TestSendWithConditionsError(t *testing.T) {
+	conditions := []string{}
+	for i := 0; i < maxTopicCount+1; i++ {
+		conditions = append(conditions, fmt.Sprintf("'test-%v' in topics", i))
+	}
+
+	cli := &failFirstClient{}
+	err := sendWithConditions(context.Background(), cli, conditions, Message{Title: "title", Body: "body"})
+	if err == nil {
+		t.Errorf("error must be returned")
+	}
+
+	// 最初の送信に失敗しても残りは送信する
+	if len(cli.Messages) != 1 || cli.Messages[0].Condition != "'test-5' in topics" {
+		t.Errorf("invalid messages: %v", cli.Messages)
+	}
+}
@@ -0,0 +1,254 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// webPushTTL プッシュサービスが通知を保持する秒数
+	// 配信の通知は時間が経つと意味がないので短めにする
+	webPushTTL = 2 * 60 * 60
+	// webPushRecordSize aes128gcmのレコードサイズ
+	webPushRecordSize = 4096
+)
+
+// EnqueueWebPushDeliveryFunc 送信するブラウザのプッシュ通知を保存する
+type EnqueueWebPushDeliveryFunc func(ctx context.Context, d model.WebPushDelivery) error
+
+// WebPushNotifier ブラウザにプッシュ通知するNotifier
+// 計画と配信の開始だけを通知する
+// 購読ごとの送信には時間がかかるので通知を保存するだけにして、送信はWebPushSenderで後から行う
+type WebPushNotifier struct {
+	enqueue EnqueueWebPushDeliveryFunc
+}
+
+// NewWebPushNotifier ブラウザにプッシュ通知するNotifierを作成する
+func NewWebPushNotifier(enqueue EnqueueWebPushDeliveryFunc) *WebPushNotifier {
+	return &WebPushNotifier{
+		enqueue: enqueue,
+	}
+}
+
+// webPushPayload Service Workerに渡す通知の内容
+type webPushPayload struct {
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	URL   string            `json:"url"`
+	Tag   string            `json:"tag"`
+	Data  map[string]string `json:"data"`
+}
+
+// Notify 通知を保存する
+// 購読ごとの送信の失敗はここでは分からないのでエラーは保存に失敗した場合だけ返す
+func (n *WebPushNotifier) Notify(ctx context.Context, e Event) error {
+	isPlan := e.Kind == EventKindPlanPublished || e.Kind == EventKindPlanUpdated
+	if !isPlan && e.Kind != EventKindStreamStarted && e.Kind != EventKindCollaboStarted {
+		return nil
+	}
+
+	m, err := Render(e)
+	if err != nil {
+		return err
+	}
+
+	// 計画は配信者ではなく計画のトピックを購読している場合だけ通知する
+	actorIDs := []string{}
+	url := "/"
+	if !isPlan {
+		for _, a := range e.Actors {
+			actorIDs = append(actorIDs, a.ID)
+		}
+		url = e.Video.URL
+	}
+	payload, err := json.Marshal(webPushPayload{
+		Title: m.Title,
+		Body:  m.Body,
+		URL:   url,
+		Tag:   e.Key,
+		Data:  m.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := jst.Now()
+	err = n.enqueue(ctx, model.WebPushDelivery{
+		// 同じイベントを何度通知しても一度しか送信されないようにイベントのキーと内容から作成する
+		ID:        fmt.Sprintf("%x", sha1.Sum([]byte(e.Key+"\n"+string(payload)))),
+		Payload:   string(payload),
+		Topics:    m.Topics,
+		ActorIDs:  actorIDs,
+		Status:    model.NotificationStatusPending,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return xerrors.Errorf("Can not enqueue web push: %w", err)
+	}
+
+	return nil
+}
+
+// WebPushSender ブラウザのプッシュ通知を購読に送信する
+type WebPushSender struct {
+	key        model.VAPIDKey
+	subject    string
+	httpClient *http.Client
+}
+
+// NewWebPushSender ブラウザのプッシュ通知を送信するWebPushSenderを作成する
+// subjectはプッシュサービスに伝える連絡先のmailto:かhttps:のURL
+func NewWebPushSender(key model.VAPIDKey, subject string, httpClient *http.Client) *WebPushSender {
+	return &WebPushSender{
+		key:        key,
+		subject:    subject,
+		httpClient: httpClient,
+	}
+}
+
+// Send 暗号化した通知をプッシュサービスに送信する
+// 購読が無効になっている場合は404か410のステータスコードを返す
+func (n *WebPushSender) Send(ctx context.Context, s model.WebPushSubscription, payload []byte) (int, error) {
+	body, err := encryptWebPush(payload, s)
+	if err != nil {
+		return 0, err
+	}
+
+	auth, err := vapidAuthorization(s.Endpoint, n.subject, n.key, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(webPushTTL))
+	req.Header.Set("Urgency", "high")
+
+	res, err := n.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, xerrors.Errorf("webpush: %v", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
+
+// encryptWebPush 通知の内容を購読の鍵で暗号化する
+func encryptWebPush(plaintext []byte, s model.WebPushSubscription) ([]byte, error) {
+	uaPublic, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s.P256dh, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	authSecret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s.Auth, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	// 通知ごとに使い捨ての鍵とソルトを使用する
+	asPrivate, _, _, err := elliptic.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryptWebPushInternal(plaintext, uaPublic, authSecret, asPrivate, salt)
+}
+
+// encryptWebPushInternal RFC 8291の方式で暗号化する
+// レコードは1つだけで、パディングはしない
+func encryptWebPushInternal(plaintext, uaPublic, authSecret, asPrivate, salt []byte) ([]byte, error) {
+	curve := elliptic.P256()
+	uaX, uaY := elliptic.Unmarshal(curve, uaPublic)
+	if uaX == nil {
+		return nil, xerrors.Errorf("Invalid p256dh")
+	}
+
+	if len(authSecret) != 16 {
+		return nil, xerrors.Errorf("Invalid auth")
+	}
+
+	asX, asY := curve.ScalarBaseMult(asPrivate)
+	asPublic := elliptic.Marshal(curve, asX, asY)
+
+	sharedX, _ := curve.ScalarMult(uaX, uaY, asPrivate)
+	ecdhSecret := padScalar(sharedX.Bytes())
+
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(authSecret, ecdhSecret, keyInfo, 32)
+
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	// 最後のレコードの区切りは0x02
+	record := append(append([]byte{}, plaintext...), 0x02)
+	if len(record)+16 > webPushRecordSize {
+		return nil, xerrors.Errorf("Payload is too large: %v", len(plaintext))
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = append(header, make([]byte, 4)...)
+	binary.BigEndian.PutUint32(header[16:20], webPushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+// hkdf HKDF-SHA256で鍵を導出する(RFC 5869)
+// 32バイトまでしか導出しないのでExpandは1ブロックだけ計算する
+func hkdf(salt, ikm, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{0x01})
+	return expand.Sum(nil)[:length]
+}
@@ -0,0 +1,239 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/actor"
+	. "github.com/yaegaki/dotlive-schedule-server/internal/testutil/plan"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func decodeBase64URL(t *testing.T, s string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Can not decode %v: %v", s, err)
+	}
+	return b
+}
+
+// RFC 8291 Appendix A
+func TestEncryptWebPushInternal(t *testing.T) {
+	plaintext := []byte("When I grow up, I want to be a watermelon")
+	asPrivate := decodeBase64URL(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw")
+	uaPublic := decodeBase64URL(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4")
+	authSecret := decodeBase64URL(t, "BTBZMqHH6r4Tts7J_aSIgg")
+	salt := decodeBase64URL(t, "DGv6ra1nlYgDCS1FRnbzlw")
+	expected := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+
+	body, err := encryptWebPushInternal(plaintext, uaPublic, authSecret, asPrivate, salt)
+	if err != nil {
+		t.Fatalf("Can not encrypt: %v", err)
+	}
+
+	if got := base64.RawURLEncoding.EncodeToString(body); got != expected {
+		t.Errorf("got: %v expect: %v", got, expected)
+	}
+
+	_, err = encryptWebPushInternal(plaintext, uaPublic[1:], authSecret, asPrivate, salt)
+	if err == nil {
+		t.Errorf("invalid p256dh must be error")
+	}
+}
+
+// decryptWebPush ブラウザの代わりに通知を復号する
+func decryptWebPush(t *testing.T, body []byte, uaPrivate *ecdsa.PrivateKey, authSecret []byte) []byte {
+	curve := elliptic.P256()
+	salt := body[:16]
+	idLen := int(body[20])
+	asPublic := body[21 : 21+idLen]
+	ciphertext := body[21+idLen:]
+
+	asX, asY := elliptic.Unmarshal(curve, asPublic)
+	sharedX, _ := curve.ScalarMult(asX, asY, uaPrivate.D.Bytes())
+	uaPublic := elliptic.Marshal(curve, uaPrivate.X, uaPrivate.Y)
+
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(authSecret, padScalar(sharedX.Bytes()), keyInfo, 32)
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	record, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("Can not decrypt: %v", err)
+	}
+
+	return bytes.TrimSuffix(record, []byte{0x02})
+}
+
+func TestVAPIDAuthorization(t *testing.T) {
+	key, err := GenerateVAPIDKey()
+	if err != nil {
+		t.Fatalf("Can not generate key: %v", err)
+	}
+
+	now := time.Date(2020, 4, 29, 20, 0, 0, 0, time.UTC)
+	auth, err := vapidAuthorization("https://push.example.com/send/abc?x=1", "mailto:test@example.com", key, now)
+	if err != nil {
+		t.Fatalf("Can not create authorization: %v", err)
+	}
+
+	var jwt, k string
+	for _, p := range strings.Split(strings.TrimPrefix(auth, "vapid "), ", ") {
+		if strings.HasPrefix(p, "t=") {
+			jwt = p[2:]
+		} else if strings.HasPrefix(p, "k=") {
+			k = p[2:]
+		}
+	}
+	if k != key.PublicKey {
+		t.Errorf("invalid key: %v", k)
+	}
+
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("invalid jwt: %v", jwt)
+	}
+
+	var claims struct {
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Sub string `json:"sub"`
+	}
+	json.Unmarshal(decodeBase64URL(t, parts[1]), &claims)
+	if claims.Aud != "https://push.example.com" || claims.Sub != "mailto:test@example.com" || claims.Exp != now.Add(vapidExpiration).Unix() {
+		t.Errorf("invalid claims: %+v", claims)
+	}
+
+	x, y := elliptic.Unmarshal(elliptic.P256(), decodeBase64URL(t, key.PublicKey))
+	sig := decodeBase64URL(t, parts[2])
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	if len(sig) != 64 || !ecdsa.Verify(pub, hash[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		t.Errorf("invalid signature")
+	}
+}
+
+func TestWebPushNotifier(t *testing.T) {
+	var deliveries []model.WebPushDelivery
+	n := NewWebPushNotifier(func(ctx context.Context, d model.WebPushDelivery) error {
+		deliveries = append(deliveries, d)
+		return nil
+	})
+
+	date := jst.ShortDate(2020, 4, 29)
+	p := CreatePlan(date, []EntryPart{CreateEntryPart(Siro, 20, 0)})
+	v := model.Video{ID: "video", ActorID: Siro.ID, URL: "https://www.youtube.com/watch?v=video", Text: "text"}
+	events := []Event{
+		NewPlanPublishedEvent(p, All),
+		NewStreamStartedEvent(date, v, []model.Actor{Siro}),
+		// リマインダーはブラウザには通知しない
+		NewStreamUpcomingEvent(date, date, v, []model.Actor{Siro}),
+		// 同じイベントは同じIDになる
+		NewStreamStartedEvent(date, v, []model.Actor{Siro}),
+	}
+	for _, e := range events {
+		err := n.Notify(context.Background(), e)
+		if err != nil {
+			t.Errorf("Can not notify %v: %v", e.Kind, err)
+		}
+	}
+
+	if len(deliveries) != 3 {
+		t.Fatalf("len(deliveries), got: %v", len(deliveries))
+	}
+
+	if deliveries[1].ID != deliveries[2].ID || deliveries[0].ID == deliveries[1].ID {
+		t.Errorf("invalid ids: %v, %v, %v", deliveries[0].ID, deliveries[1].ID, deliveries[2].ID)
+	}
+
+	var plan webPushPayload
+	json.Unmarshal([]byte(deliveries[0].Payload), &plan)
+	if plan.URL != "/" || plan.Tag != events[0].Key || len(deliveries[0].ActorIDs) != 0 {
+		t.Errorf("invalid plan delivery: %+v", deliveries[0])
+	}
+
+	var stream webPushPayload
+	json.Unmarshal([]byte(deliveries[1].Payload), &stream)
+	if stream.URL != v.URL || stream.Title != "配信:"+Siro.Name || len(deliveries[1].ActorIDs) != 1 || deliveries[1].ActorIDs[0] != Siro.ID {
+		t.Errorf("invalid stream delivery: %+v", deliveries[1])
+	}
+
+	if deliveries[0].Status != model.NotificationStatusPending {
+		t.Errorf("status, got: %v", deliveries[0].Status)
+	}
+}
+
+func TestWebPushSender(t *testing.T) {
+	uaPrivate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	authSecret := make([]byte, 16)
+	rand.Read(authSecret)
+
+	var received []webPushPayload
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+
+		if r.Header.Get("Content-Encoding") != "aes128gcm" || !strings.HasPrefix(r.Header.Get("Authorization"), "vapid t=") {
+			t.Errorf("invalid headers: %v", r.Header)
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		var p webPushPayload
+		err := json.Unmarshal(decryptWebPush(t, body, uaPrivate, authSecret), &p)
+		if err != nil {
+			t.Errorf("Can not unmarshal payload: %v", err)
+		}
+		received = append(received, p)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	newTestSubscription := func(path string) model.WebPushSubscription {
+		return model.WebPushSubscription{
+			ID:       path,
+			Endpoint: ts.URL + path,
+			P256dh:   base64.RawURLEncoding.EncodeToString(elliptic.Marshal(elliptic.P256(), uaPrivate.X, uaPrivate.Y)),
+			Auth:     base64.RawURLEncoding.EncodeToString(authSecret),
+		}
+	}
+
+	key, _ := GenerateVAPIDKey()
+	sender := NewWebPushSender(key, "mailto:test@example.com", ts.Client())
+	payload, _ := json.Marshal(webPushPayload{Title: "title", URL: "/"})
+
+	statusCode, err := sender.Send(context.Background(), newTestSubscription("/siro"), payload)
+	if err != nil || statusCode != http.StatusCreated {
+		t.Errorf("Can not send: %v, %v", statusCode, err)
+	}
+
+	if len(received) != 1 || received[0].Title != "title" {
+		t.Errorf("invalid notification: %+v", received)
+	}
+
+	statusCode, err = sender.Send(context.Background(), newTestSubscription("/gone"), payload)
+	if err == nil || statusCode != http.StatusGone {
+		t.Errorf("gone subscription must fail: %v, %v", statusCode, err)
+	}
+}
@@ -0,0 +1,153 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize 検索用に文字列を正規化する
+// 全角英数字や半角カナの表記ゆれをなくすためにNFKCで正規化して小文字にする
+func Normalize(s string) string {
+	return strings.ToLower(norm.NFKC.String(s))
+}
+
+// splitWords 正規化した文字列を文字と数字の連続で区切る
+// 日本語は単語の区切りが分からないので区切り文字以外の連続を1つの単語として扱う
+func splitWords(s string) [][]rune {
+	var words [][]rune
+	var word []rune
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r) {
+			word = append(word, r)
+			continue
+		}
+
+		if len(word) > 0 {
+			words = append(words, word)
+			word = nil
+		}
+	}
+
+	if len(word) > 0 {
+		words = append(words, word)
+	}
+
+	return words
+}
+
+// Tokenize 文字列をインデックス用のトークンに分割する
+// 1文字の検索にも対応するためにunigramとbigramの両方を作成する
+func Tokenize(texts ...string) []string {
+	var tokens []string
+	added := map[string]bool{}
+	add := func(token string) {
+		if added[token] {
+			return
+		}
+		added[token] = true
+		tokens = append(tokens, token)
+	}
+
+	for _, text := range texts {
+		for _, word := range splitWords(Normalize(text)) {
+			for i := range word {
+				add(string(word[i : i+1]))
+				if i+1 < len(word) {
+					add(string(word[i : i+2]))
+				}
+			}
+		}
+	}
+
+	return tokens
+}
+
+// Query 検索クエリ
+type Query struct {
+	// words 正規化した検索語
+	words []string
+	// tokens インデックスの検索に使用するトークン
+	tokens []string
+}
+
+// ParseQuery 検索クエリをパースする
+// 空白などで区切られた検索語は全て含む場合にマッチする
+func ParseQuery(q string) Query {
+	var query Query
+	added := map[string]bool{}
+	for _, word := range splitWords(Normalize(q)) {
+		query.words = append(query.words, string(word))
+
+		// 2文字以上の場合はbigramだけで十分絞り込める
+		var tokens []string
+		if len(word) == 1 {
+			tokens = []string{string(word)}
+		} else {
+			for i := 0; i+1 < len(word); i++ {
+				tokens = append(tokens, string(word[i:i+2]))
+			}
+		}
+
+		for _, token := range tokens {
+			if added[token] {
+				continue
+			}
+			added[token] = true
+			query.tokens = append(query.tokens, token)
+		}
+	}
+
+	return query
+}
+
+// IsEmpty 検索語が存在しないかどうか
+func (q Query) IsEmpty() bool {
+	return len(q.words) == 0
+}
+
+// Tokens インデックスの検索に使用するトークン
+func (q Query) Tokens() []string {
+	return q.tokens
+}
+
+// Match 文字列が検索語を全て含むかどうか
+// bigramのインデックスでは語順まで分からないので候補をこれで絞り込む
+func (q Query) Match(texts ...string) bool {
+	if q.IsEmpty() {
+		return false
+	}
+
+	var normalized []string
+	for _, text := range texts {
+		normalized = append(normalized, string(joinWords(splitWords(Normalize(text)))))
+	}
+
+OUTER:
+	for _, word := range q.words {
+		for _, text := range normalized {
+			if strings.Contains(text, word) {
+				continue OUTER
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// joinWords 単語を区切り文字でつなげる
+// 記号の違いで検索にマッチしなくならないように区切り文字は空白に統一する
+func joinWords(words [][]rune) []rune {
+	var result []rune
+	for i, word := range words {
+		if i > 0 {
+			result = append(result, ' ')
+		}
+		result = append(result, word...)
+	}
+
+	return result
+}
@@ -0,0 +1,84 @@
+package search
+
+import (
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("#ＡＰＥＸ 耐久", "ﾋﾟﾉ")
+	expect := []string{"a", "ap", "p", "pe", "e", "ex", "x", "耐", "耐久", "久", "ピ", "ピノ", "ノ"}
+	if len(tokens) != len(expect) {
+		t.Fatalf("len(tokens), got: %v expect: %v", tokens, expect)
+	}
+
+	for i, token := range expect {
+		if tokens[i] != token {
+			t.Errorf("tokens[%v], got: %v expect: %v", i, tokens[i], token)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		q      string
+		texts  []string
+		tokens []string
+		match  bool
+	}{
+		{
+			"マイクラ",
+			[]string{"【Minecraft】マイクラで家を建てる！"},
+			[]string{"マイ", "イク", "クラ"},
+			true,
+		},
+		{
+			"ｍｉｎｅｃｒａｆｔ　家",
+			[]string{"【Minecraft】マイクラで家を建てる！"},
+			[]string{"mi", "in", "ne", "ec", "cr", "ra", "af", "ft", "家"},
+			true,
+		},
+		{
+			"マイクラ APEX",
+			[]string{"【Minecraft】マイクラで家を建てる！"},
+			[]string{"マイ", "イク", "クラ", "ap", "pe", "ex"},
+			false,
+		},
+		{
+			"クラマイ",
+			[]string{"マイクラ"},
+			[]string{"クラ", "ラマ", "マイ"},
+			false,
+		},
+		{
+			"#ヤマトイオリ",
+			[]string{"配信します", "", "#ヤマトイオリ"},
+			[]string{"ヤマ", "マト", "トイ", "イオ", "オリ"},
+			true,
+		},
+		{
+			"!!",
+			[]string{"!!"},
+			nil,
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			q := ParseQuery(tt.q)
+			tokens := q.Tokens()
+			if len(tokens) != len(tt.tokens) {
+				t.Fatalf("len(tokens), got: %v expect: %v", tokens, tt.tokens)
+			}
+			for i, token := range tt.tokens {
+				if tokens[i] != token {
+					t.Errorf("tokens[%v], got: %v expect: %v", i, tokens[i], token)
+				}
+			}
+
+			if q.Match(tt.texts...) != tt.match {
+				t.Errorf("match, got: %v expect: %v", !tt.match, tt.match)
+			}
+		})
+	}
+}
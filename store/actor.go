@@ -3,9 +3,13 @@ package store
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
 	"github.com/yaegaki/dotlive-schedule-server/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // actor 配信者
@@ -16,6 +20,10 @@ type actor struct {
 	Name string `firestore:"name"`
 	// Hashtag ハッシュタグ
 	Hashtag string `firestore:"hashTag"`
+	// SubHashtags メインのハッシュタグ以外のハッシュタグ
+	SubHashtags []string `firestore:"subHashTags"`
+	// Aliases ハッシュタグなしで書かれる場合の別名
+	Aliases []string `firestore:"aliases"`
 	// Icon アイコンのURL
 	Icon string `firestore:"icon"`
 	// TwitterScreenName Twitterのスクリーンネーム
@@ -32,6 +40,38 @@ type actor struct {
 	MildomID string `firestore:"mildomID"`
 	// LastTweetID 最後に取得したTweetのID
 	LastTweetID string `firestore:"lastTweetID"`
+	// SubTwitterAccounts メインのアカウント以外のTwitterアカウント
+	SubTwitterAccounts []twitterAccount `firestore:"subTwitterAccounts"`
+	// SubChannels メインのチャンネル以外の動画サイトのチャンネル
+	SubChannels []channel `firestore:"subChannels"`
+	// UploadsArePlanned 生放送ではない動画を常に計画された配信として扱うかどうか
+	UploadsArePlanned bool `firestore:"uploadsArePlanned"`
+	// Groups 所属するグループのID
+	Groups []string `firestore:"groups"`
+	// Status 活動状況
+	Status string `firestore:"status"`
+	// ActiveFrom 活動開始日
+	ActiveFrom time.Time `firestore:"activeFrom"`
+	// ActiveUntil 活動終了日
+	ActiveUntil time.Time `firestore:"activeUntil"`
+}
+
+// twitterAccount 配信者のTwitterアカウント
+type twitterAccount struct {
+	// ScreenName Twitterのスクリーンネーム
+	ScreenName string `firestore:"screenName"`
+	// LastTweetID 最後に取得したTweetのID
+	LastTweetID string `firestore:"lastTweetID"`
+}
+
+// channel 配信者の動画サイトのチャンネル
+type channel struct {
+	// Source 動画サイト
+	Source string `firestore:"source"`
+	// ID 動画サイトでのチャンネルID
+	ID string `firestore:"id"`
+	// Name チャンネル名
+	Name string `firestore:"name"`
 }
 
 const collectionNameActor = "Actor"
@@ -52,6 +92,8 @@ func FindActors(ctx context.Context, c *firestore.Client) (model.ActorSlice, err
 			ID:                 a.id,
 			Name:               a.Name,
 			Hashtag:            a.Hashtag,
+			SubHashtags:        a.SubHashtags,
+			Aliases:            a.Aliases,
 			Icon:               a.Icon,
 			TwitterScreenName:  a.TwitterScreenName,
 			Emoji:              a.Emoji,
@@ -60,6 +102,13 @@ func FindActors(ctx context.Context, c *firestore.Client) (model.ActorSlice, err
 			BilibiliID:         a.BilibiliID,
 			MildomID:           a.MildomID,
 			LastTweetID:        a.LastTweetID,
+			SubTwitterAccounts: a.subTwitterAccounts(),
+			SubChannels:        a.subChannels(),
+			UploadsArePlanned:  a.UploadsArePlanned,
+			Groups:             a.Groups,
+			Status:             a.Status,
+			ActiveFrom:         jst.From(a.ActiveFrom),
+			ActiveUntil:        jst.From(a.ActiveUntil),
 		})
 	}
 
@@ -67,27 +116,176 @@ func FindActors(ctx context.Context, c *firestore.Client) (model.ActorSlice, err
 }
 
 // SaveActor 配信者を保存する
+// LastTweetIDだけが変わった場合はクライアントに関係がないので変更履歴に追加しない
+// 保存されている内容と同じ場合は書き込まない
 func SaveActor(ctx context.Context, c *firestore.Client, a model.Actor) error {
-	// 常に上書きでいいのでトランザクションにしない
-	_, err := c.Collection(collectionNameActor).Doc(a.ID).Set(ctx, fromActor(a))
-	return err
+	temp := fromActor(a)
+
+	return c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+		docRef := c.Collection(collectionNameActor).Doc(a.ID)
+		doc, err := t.Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		changed := true
+		if err == nil {
+			var oldActor actor
+			doc.DataTo(&oldActor)
+			if oldActor.equal(temp) {
+				return nil
+			}
+			changed = !oldActor.withoutLastTweetID().equal(temp.withoutLastTweetID())
+		}
+
+		if changed {
+			err = appendChange(c, t, model.ChangeKindActor, a.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return t.Set(docRef, temp)
+	})
 }
 
 // CreateActor 配信者を新しく作成する
-func CreateActor(ctx context.Context, c *firestore.Client, a model.Actor) error {
+// 作成した配信者のIDを返す
+func CreateActor(ctx context.Context, c *firestore.Client, a model.Actor) (string, error) {
 	if a.ID != "" {
-		return fmt.Errorf("actorID is not null: %v", a.ID)
+		return "", fmt.Errorf("actorID is not null: %v", a.ID)
 	}
 
 	docRef := c.Collection(collectionNameActor).NewDoc()
-	_, err := docRef.Set(ctx, fromActor(a))
-	return err
+	err := c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+		err := appendChange(c, t, model.ChangeKindActor, docRef.ID)
+		if err != nil {
+			return err
+		}
+		return t.Set(docRef, fromActor(a))
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return docRef.ID, nil
+}
+
+// equal 同じ内容かどうか
+// Firestoreから読み込んだ時刻はタイムゾーンが異なるのでEqualで比較する
+func (a actor) equal(other actor) bool {
+	if !equalStrings(a.Groups, other.Groups) ||
+		!equalStrings(a.SubHashtags, other.SubHashtags) ||
+		!equalStrings(a.Aliases, other.Aliases) {
+		return false
+	}
+
+	if len(a.SubTwitterAccounts) != len(other.SubTwitterAccounts) {
+		return false
+	}
+	for i := range a.SubTwitterAccounts {
+		if a.SubTwitterAccounts[i] != other.SubTwitterAccounts[i] {
+			return false
+		}
+	}
+
+	if len(a.SubChannels) != len(other.SubChannels) {
+		return false
+	}
+	for i := range a.SubChannels {
+		if a.SubChannels[i] != other.SubChannels[i] {
+			return false
+		}
+	}
+
+	return a.Name == other.Name &&
+		a.Hashtag == other.Hashtag &&
+		a.Icon == other.Icon &&
+		a.TwitterScreenName == other.TwitterScreenName &&
+		a.Emoji == other.Emoji &&
+		a.YoutubeChannelID == other.YoutubeChannelID &&
+		a.YoutubeChannelName == other.YoutubeChannelName &&
+		a.BilibiliID == other.BilibiliID &&
+		a.MildomID == other.MildomID &&
+		a.LastTweetID == other.LastTweetID &&
+		a.UploadsArePlanned == other.UploadsArePlanned &&
+		a.Status == other.Status &&
+		a.ActiveFrom.Equal(other.ActiveFrom) &&
+		a.ActiveUntil.Equal(other.ActiveUntil)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withoutLastTweetID 全てのアカウントのLastTweetIDを空にしたものを取得する
+func (a actor) withoutLastTweetID() actor {
+	a.LastTweetID = ""
+	accounts := make([]twitterAccount, len(a.SubTwitterAccounts))
+	for i, account := range a.SubTwitterAccounts {
+		account.LastTweetID = ""
+		accounts[i] = account
+	}
+	a.SubTwitterAccounts = accounts
+	return a
+}
+
+func (a actor) subTwitterAccounts() []model.TwitterAccount {
+	var accounts []model.TwitterAccount
+	for _, account := range a.SubTwitterAccounts {
+		accounts = append(accounts, model.TwitterAccount{
+			ScreenName:  account.ScreenName,
+			LastTweetID: account.LastTweetID,
+		})
+	}
+
+	return accounts
+}
+
+func (a actor) subChannels() []model.Channel {
+	var channels []model.Channel
+	for _, c := range a.SubChannels {
+		channels = append(channels, model.Channel{
+			Source: c.Source,
+			ID:     c.ID,
+			Name:   c.Name,
+		})
+	}
+
+	return channels
 }
 
 func fromActor(a model.Actor) actor {
+	var accounts []twitterAccount
+	for _, account := range a.SubTwitterAccounts {
+		accounts = append(accounts, twitterAccount{
+			ScreenName:  account.ScreenName,
+			LastTweetID: account.LastTweetID,
+		})
+	}
+
+	var channels []channel
+	for _, c := range a.SubChannels {
+		channels = append(channels, channel{
+			Source: c.Source,
+			ID:     c.ID,
+			Name:   c.Name,
+		})
+	}
+
 	return actor{
 		Name:               a.Name,
 		Hashtag:            a.Hashtag,
+		SubHashtags:        a.SubHashtags,
+		Aliases:            a.Aliases,
 		Icon:               a.Icon,
 		TwitterScreenName:  a.TwitterScreenName,
 		Emoji:              a.Emoji,
@@ -96,5 +294,12 @@ func fromActor(a model.Actor) actor {
 		BilibiliID:         a.BilibiliID,
 		MildomID:           a.MildomID,
 		LastTweetID:        a.LastTweetID,
+		SubTwitterAccounts: accounts,
+		SubChannels:        channels,
+		UploadsArePlanned:  a.UploadsArePlanned,
+		Groups:             a.Groups,
+		Status:             a.Status,
+		ActiveFrom:         a.ActiveFrom.Time(),
+		ActiveUntil:        a.ActiveUntil.Time(),
 	}
 }
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActorEqual(t *testing.T) {
+	until := time.Date(2021, 3, 31, 0, 0, 0, 0, time.UTC)
+	a := actor{
+		Name:        "電脳少女シロ",
+		Groups:      []string{"idol"},
+		Status:      "graduated",
+		ActiveUntil: until,
+	}
+
+	// Firestoreから読み込んだ場合はタイムゾーンが異なる
+	b := a
+	b.ActiveUntil = until.In(time.FixedZone("JST", 9*60*60))
+	if !a.equal(b) {
+		t.Errorf("must be equal: %+v %+v", a, b)
+	}
+
+	c := a
+	c.Groups = []string{"idol", "appare"}
+	if a.equal(c) {
+		t.Errorf("groups must be different")
+	}
+
+	d := a
+	d.Status = "active"
+	if a.equal(d) {
+		t.Errorf("status must be different")
+	}
+
+	e := a
+	e.Aliases = []string{"シロ"}
+	if a.equal(e) {
+		t.Errorf("aliases must be different")
+	}
+
+	f := a
+	f.SubHashtags = []string{"#シロ生放送"}
+	if a.equal(f) {
+		t.Errorf("hashtags must be different")
+	}
+}
+
+func TestActorWithoutLastTweetID(t *testing.T) {
+	a := actor{
+		TwitterScreenName: "main",
+		LastTweetID:       "1",
+		SubTwitterAccounts: []twitterAccount{
+			{ScreenName: "sub", LastTweetID: "2"},
+		},
+	}
+
+	b := a
+	b.LastTweetID = "3"
+	b.SubTwitterAccounts = []twitterAccount{
+		{ScreenName: "sub", LastTweetID: "4"},
+	}
+	if a.equal(b) {
+		t.Errorf("lastTweetID must be different")
+	}
+	if !a.withoutLastTweetID().equal(b.withoutLastTweetID()) {
+		t.Errorf("must be equal without lastTweetID: %+v %+v", a, b)
+	}
+	if a.SubTwitterAccounts[0].LastTweetID != "2" {
+		t.Errorf("original must not be modified: %+v", a)
+	}
+
+	c := a
+	c.SubTwitterAccounts = []twitterAccount{
+		{ScreenName: "sub2", LastTweetID: "2"},
+	}
+	if a.withoutLastTweetID().equal(c.withoutLastTweetID()) {
+		t.Errorf("accounts must be different")
+	}
+
+	d := a
+	d.SubChannels = []channel{
+		{Source: "Youtube", ID: "sub-channel"},
+	}
+	if a.equal(d) {
+		t.Errorf("channels must be different")
+	}
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"google.golang.org/api/iterator"
+)
+
+// planAdherence 計画のエントリと実際の配信の開始時刻のずれ
+type planAdherence struct {
+	// PlanDate 計画の日付
+	PlanDate time.Time `firestore:"planDate"`
+	// ActorID 配信者ID
+	ActorID string `firestore:"actorID"`
+	// HashTag コラボハッシュタグ
+	HashTag string `firestore:"hashTag"`
+	// Source 配信サイト
+	Source string `firestore:"source"`
+	// PlannedStartAt 計画の開始時刻
+	PlannedStartAt time.Time `firestore:"plannedStartAt"`
+	// VideoID 動画ID
+	VideoID string `firestore:"videoID"`
+	// ActualStartAt 実際の開始時刻
+	ActualStartAt time.Time `firestore:"actualStartAt"`
+	// Delay 計画の開始時刻からの遅れ(秒)
+	Delay int64 `firestore:"delay"`
+}
+
+const collectionNamePlanAdherence = "PlanAdherence"
+
+// planAdherenceDocID 計画のエントリごとに一意になるIDを作成する
+// 計画はマージされるとエントリの順番が変わるので内容からIDを作る
+func planAdherenceDocID(a model.PlanAdherence) string {
+	key := fmt.Sprintf("%v/%v/%v/%v", a.PlannedStartAt.Time().Unix(), a.ActorID, a.HashTag, a.Source)
+	return fmt.Sprintf("%x", sha1.Sum([]byte(key)))
+}
+
+// FindPlanAdherences 計画の開始時刻の範囲を指定してずれを検索する
+func FindPlanAdherences(ctx context.Context, c *firestore.Client, r jst.Range) ([]model.PlanAdherence, error) {
+	it := c.Collection(collectionNamePlanAdherence).Where("plannedStartAt", ">=", r.Begin.Time()).Where("plannedStartAt", "<=", r.End.Time()).Documents(ctx)
+	var result []model.PlanAdherence
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var a planAdherence
+		doc.DataTo(&a)
+		result = append(result, model.PlanAdherence{
+			PlanDate:       jst.From(a.PlanDate),
+			ActorID:        a.ActorID,
+			HashTag:        a.HashTag,
+			Source:         a.Source,
+			PlannedStartAt: jst.From(a.PlannedStartAt),
+			VideoID:        a.VideoID,
+			ActualStartAt:  jst.From(a.ActualStartAt),
+			Delay:          a.Delay,
+		})
+	}
+
+	return result, nil
+}
+
+// SavePlanAdherence 計画のエントリと実際の配信の開始時刻のずれを保存する
+func SavePlanAdherence(ctx context.Context, c *firestore.Client, a model.PlanAdherence) error {
+	// 常に上書きでいいのでトランザクションにしない
+	_, err := c.Collection(collectionNamePlanAdherence).Doc(planAdherenceDocID(a)).Set(ctx, planAdherence{
+		PlanDate:       a.PlanDate.Time(),
+		ActorID:        a.ActorID,
+		HashTag:        a.HashTag,
+		Source:         a.Source,
+		PlannedStartAt: a.PlannedStartAt.Time(),
+		VideoID:        a.VideoID,
+		ActualStartAt:  a.ActualStartAt.Time(),
+		Delay:          a.Delay,
+	})
+	return err
+}
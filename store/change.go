@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// change 変更履歴
+// カーソルは書き込みが確定した時刻から作成するので、全ての書き込みで同じドキュメントを更新しなくてよい
+type change struct {
+	// Kind 変更されたものの種類
+	Kind string `firestore:"kind"`
+	// EntityID 変更されたもののID
+	EntityID string `firestore:"entityID"`
+	// ChangedAt 書き込みが確定した時刻
+	ChangedAt time.Time `firestore:"changedAt,serverTimestamp"`
+}
+
+// changeCounter 削除済みの変更履歴のカーソル
+// 変更履歴を削除するときだけ更新する
+type changeCounter struct {
+	// CompactedCursor このカーソル以前の変更履歴は削除されている
+	CompactedCursor int64 `firestore:"compactedCursor"`
+}
+
+const collectionNameChange = "Change"
+const collectionNameChangeCounter = "ChangeCounter"
+const docIDChangeCounter = "counter"
+
+// compactBatchSize 1回のバッチで削除する変更履歴の数
+const compactBatchSize = 500
+
+func changeCounterRef(c *firestore.Client) *firestore.DocumentRef {
+	return c.Collection(collectionNameChangeCounter).Doc(docIDChangeCounter)
+}
+
+func getChangeCounter(doc *firestore.DocumentSnapshot, err error) (changeCounter, error) {
+	var counter changeCounter
+	if err != nil {
+		// まだ変更履歴が削除されていない
+		if status.Code(err) == codes.NotFound {
+			return counter, nil
+		}
+		return counter, err
+	}
+
+	doc.DataTo(&counter)
+	return counter, nil
+}
+
+// changeCursor 変更された時刻からカーソルを作成する
+// Firestoreの時刻はマイクロ秒までなのでマイクロ秒にする
+func changeCursor(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Microsecond)
+}
+
+// appendChange トランザクション内で変更履歴を追加する
+// 変更された時刻は書き込みが確定した時刻になるので、確定した順にカーソルが大きくなる
+// 別のトランザクションと同じ時刻になる場合もある
+func appendChange(c *firestore.Client, t *firestore.Transaction, kind string, entityID string) error {
+	return t.Set(c.Collection(collectionNameChange).NewDoc(), change{
+		Kind:     kind,
+		EntityID: entityID,
+	})
+}
+
+// FindChanges 指定したカーソルより後の変更履歴をカーソル順に取得する
+// 削除済みの変更履歴の最後のカーソルも返す
+func FindChanges(ctx context.Context, c *firestore.Client, since int64, limit int) ([]model.Change, int64, error) {
+	counter, err := getChangeCounter(changeCounterRef(c).Get(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	it := c.Collection(collectionNameChange).
+		Where("changedAt", ">", time.Unix(0, since*int64(time.Microsecond))).
+		OrderBy("changedAt", firestore.Asc).
+		OrderBy(firestore.DocumentID, firestore.Asc).
+		Limit(limit).
+		Documents(ctx)
+
+	var changes []model.Change
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var temp change
+		doc.DataTo(&temp)
+		changes = append(changes, model.Change{
+			Cursor:    changeCursor(temp.ChangedAt),
+			Kind:      temp.Kind,
+			EntityID:  temp.EntityID,
+			ChangedAt: jst.From(temp.ChangedAt),
+		})
+	}
+
+	return changes, counter.CompactedCursor, nil
+}
+
+// CompactChanges 指定した時刻より前の変更履歴を削除する
+// 削除された数を返す
+func CompactChanges(ctx context.Context, c *firestore.Client, before jst.Time) (int, error) {
+	count := 0
+	for {
+		docs, err := c.Collection(collectionNameChange).
+			Where("changedAt", "<", before.Time()).
+			OrderBy("changedAt", firestore.Asc).
+			Limit(compactBatchSize).
+			Documents(ctx).
+			GetAll()
+		if err != nil {
+			return count, err
+		}
+
+		if len(docs) == 0 {
+			return count, nil
+		}
+
+		var maxCursor int64
+		batch := c.Batch()
+		for _, doc := range docs {
+			var temp change
+			doc.DataTo(&temp)
+			if cursor := changeCursor(temp.ChangedAt); cursor > maxCursor {
+				maxCursor = cursor
+			}
+			batch.Delete(doc.Ref)
+		}
+
+		// 削除したカーソルを先に記録しておかないと取りこぼしが起きる可能性がある
+		err = c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+			counter, err := getChangeCounter(t.Get(changeCounterRef(c)))
+			if err != nil {
+				return err
+			}
+
+			if counter.CompactedCursor >= maxCursor {
+				return nil
+			}
+
+			counter.CompactedCursor = maxCursor
+			return t.Set(changeCounterRef(c), counter)
+		})
+		if err != nil {
+			return count, err
+		}
+
+		_, err = batch.Commit(ctx)
+		if err != nil {
+			return count, err
+		}
+		count += len(docs)
+	}
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// discordPost 投稿済みのDiscordの通知
+// IDは出来事の冪等性キーと送信先と内容から作成する
+type discordPost struct {
+	// CreatedAt 投稿した時刻
+	CreatedAt time.Time `firestore:"createdAt"`
+}
+
+const collectionNameDiscordPost = "DiscordPost"
+
+// IsDiscordPosted Discordの通知を投稿済みかどうか
+func IsDiscordPosted(ctx context.Context, c *firestore.Client, id string) (bool, error) {
+	_, err := c.Collection(collectionNameDiscordPost).Doc(id).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// MarkDiscordAsPosted Discordの通知を投稿済みとして記録する
+func MarkDiscordAsPosted(ctx context.Context, c *firestore.Client, id string, now jst.Time) error {
+	_, err := c.Collection(collectionNameDiscordPost).Doc(id).Set(ctx, discordPost{
+		CreatedAt: now.Time(),
+	})
+	return err
+}
+
+// CompactDiscordPosts 指定した時刻より前に投稿したDiscordの通知の記録を削除する
+// 削除された数を返す
+func CompactDiscordPosts(ctx context.Context, c *firestore.Client, before jst.Time) (int, error) {
+	count := 0
+	for {
+		docs, err := c.Collection(collectionNameDiscordPost).
+			Where("createdAt", "<", before.Time()).
+			Limit(compactBatchSize).
+			Documents(ctx).
+			GetAll()
+		if err != nil {
+			return count, err
+		}
+
+		if len(docs) == 0 {
+			return count, nil
+		}
+
+		batch := c.Batch()
+		for _, doc := range docs {
+			batch.Delete(doc.Ref)
+		}
+
+		_, err = batch.Commit(ctx)
+		if err != nil {
+			return count, err
+		}
+		count += len(docs)
+	}
+}
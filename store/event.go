@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/event"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+)
+
+// streamEvent インスタンス間で共有するイベント
+type streamEvent struct {
+	// Type イベントの種類
+	Type string `firestore:"type"`
+	// Data JSONにしたイベントの内容
+	Data string `firestore:"data"`
+	// CreatedAt 発行した時刻
+	CreatedAt time.Time `firestore:"createdAt"`
+}
+
+const collectionNameEvent = "Event"
+
+// eventStore Firestoreにイベントを保存するevent.Store
+type eventStore struct {
+	c *firestore.Client
+}
+
+// NewEventStore インスタンス間でイベントを共有するためのevent.Storeを作成する
+func NewEventStore(c *firestore.Client) event.Store {
+	return &eventStore{c: c}
+}
+
+// Append impl event.Store
+func (s *eventStore) Append(ctx context.Context, e event.Event, createdAt time.Time) error {
+	_, err := s.c.Collection(collectionNameEvent).Doc(e.ID).Create(ctx, streamEvent{
+		Type:      e.Type,
+		Data:      string(e.Data),
+		CreatedAt: createdAt,
+	})
+	return err
+}
+
+// FindSince impl event.Store
+func (s *eventStore) FindSince(ctx context.Context, since time.Time, limit int) ([]event.Event, error) {
+	docs, err := s.c.Collection(collectionNameEvent).
+		Where("createdAt", ">=", since).
+		OrderBy("createdAt", firestore.Asc).
+		Limit(limit).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []event.Event
+	for _, doc := range docs {
+		var temp streamEvent
+		doc.DataTo(&temp)
+		result = append(result, event.Event{
+			ID:   doc.Ref.ID,
+			Type: temp.Type,
+			Data: []byte(temp.Data),
+		})
+	}
+
+	return result, nil
+}
+
+// CompactEvents 指定した時刻より前に発行されたイベントを削除する
+// 削除された数を返す
+func CompactEvents(ctx context.Context, c *firestore.Client, before jst.Time) (int, error) {
+	count := 0
+	for {
+		docs, err := c.Collection(collectionNameEvent).
+			Where("createdAt", "<", before.Time()).
+			Limit(compactBatchSize).
+			Documents(ctx).
+			GetAll()
+		if err != nil {
+			return count, err
+		}
+
+		if len(docs) == 0 {
+			return count, nil
+		}
+
+		batch := c.Batch()
+		for _, doc := range docs {
+			batch.Delete(doc.Ref)
+		}
+
+		_, err = batch.Commit(ctx)
+		if err != nil {
+			return count, err
+		}
+		count += len(docs)
+	}
+}
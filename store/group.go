@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+// group 配信者のグループ
+type group struct {
+	// Name 名前
+	Name string `firestore:"name"`
+}
+
+const collectionNameGroup = "Group"
+
+// FindGroups グループを取得する
+func FindGroups(ctx context.Context, c *firestore.Client) (model.GroupSlice, error) {
+	docs, err := c.Collection(collectionNameGroup).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := model.GroupSlice{}
+	for _, doc := range docs {
+		var g group
+		doc.DataTo(&g)
+		groups = append(groups, model.Group{
+			ID:   doc.Ref.ID,
+			Name: g.Name,
+		})
+	}
+
+	return groups, nil
+}
+
+// SaveGroup グループを保存する
+// グループIDはトピック名に使用するのでドキュメントIDにする
+func SaveGroup(ctx context.Context, c *firestore.Client, g model.Group) error {
+	_, err := c.Collection(collectionNameGroup).Doc(g.ID).Set(ctx, group{
+		Name: g.Name,
+	})
+	return err
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// notification アウトボックスに保存されたプッシュ通知
+type notification struct {
+	// Payload JSONにしたFCMのメッセージ
+	Payload string `firestore:"payload"`
+	// Status 送信状況
+	Status string `firestore:"status"`
+	// CreatedAt 保存した時刻
+	CreatedAt time.Time `firestore:"createdAt"`
+	// NextAttemptAt 次に送信を試みる時刻
+	NextAttemptAt time.Time `firestore:"nextAttemptAt"`
+	// Attempts 送信を試みた記録
+	Attempts []notificationAttempt `firestore:"attempts"`
+}
+
+// notificationAttempt 送信を試みた記録
+type notificationAttempt struct {
+	// AttemptedAt 送信を試みた時刻
+	AttemptedAt time.Time `firestore:"attemptedAt"`
+	// MessageID FCMのメッセージID
+	MessageID string `firestore:"messageID"`
+	// Error 送信に失敗した場合のエラー
+	Error string `firestore:"error"`
+}
+
+const collectionNameNotification = "Notification"
+
+func fromNotification(n model.Notification) notification {
+	var attempts []notificationAttempt
+	for _, a := range n.Attempts {
+		attempts = append(attempts, notificationAttempt{
+			AttemptedAt: a.AttemptedAt.Time(),
+			MessageID:   a.MessageID,
+			Error:       a.Error,
+		})
+	}
+
+	return notification{
+		Payload:       n.Payload,
+		Status:        n.Status,
+		CreatedAt:     n.CreatedAt.Time(),
+		NextAttemptAt: n.NextAttemptAt.Time(),
+		Attempts:      attempts,
+	}
+}
+
+func (n notification) Notification(id string) model.Notification {
+	var attempts []model.NotificationAttempt
+	for _, a := range n.Attempts {
+		attempts = append(attempts, model.NotificationAttempt{
+			AttemptedAt: jst.From(a.AttemptedAt),
+			MessageID:   a.MessageID,
+			Error:       a.Error,
+		})
+	}
+
+	return model.Notification{
+		ID:            id,
+		Payload:       n.Payload,
+		Status:        n.Status,
+		CreatedAt:     jst.From(n.CreatedAt),
+		NextAttemptAt: jst.From(n.NextAttemptAt),
+		Attempts:      attempts,
+	}
+}
+
+// EnqueueNotification プッシュ通知をアウトボックスに保存する
+// 同じIDのプッシュ通知が既に保存されている場合は何もせずにfalseを返す
+func EnqueueNotification(ctx context.Context, c *firestore.Client, n model.Notification) (bool, error) {
+	_, err := c.Collection(collectionNameNotification).Doc(n.ID).Create(ctx, fromNotification(n))
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// FindNotificationsByStatus 送信状況を指定してアウトボックスのプッシュ通知を保存した順に取得する
+func FindNotificationsByStatus(ctx context.Context, c *firestore.Client, notificationStatus string) ([]model.Notification, error) {
+	it := c.Collection(collectionNameNotification).Where("status", "==", notificationStatus).Documents(ctx)
+	var result []model.Notification
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var n notification
+		doc.DataTo(&n)
+		result = append(result, n.Notification(doc.Ref.ID))
+	}
+
+	// 複合インデックスを作らなくていいようにメモリ上で並べ替える
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+// SaveNotification アウトボックスのプッシュ通知の送信状況を保存する
+func SaveNotification(ctx context.Context, c *firestore.Client, n model.Notification) error {
+	// 同じプッシュ通知を同時に送信することはないのでトランザクションにしない
+	_, err := c.Collection(collectionNameNotification).Doc(n.ID).Set(ctx, fromNotification(n))
+	return err
+}
+
+// CompactNotifications 指定した時刻より前に保存されたアウトボックスのプッシュ通知を削除する
+// 削除された数を返す
+func CompactNotifications(ctx context.Context, c *firestore.Client, before jst.Time) (int, error) {
+	count := 0
+	for {
+		docs, err := c.Collection(collectionNameNotification).
+			Where("createdAt", "<", before.Time()).
+			Limit(compactBatchSize).
+			Documents(ctx).
+			GetAll()
+		if err != nil {
+			return count, err
+		}
+
+		if len(docs) == 0 {
+			return count, nil
+		}
+
+		batch := c.Batch()
+		for _, doc := range docs {
+			batch.Delete(doc.Ref)
+		}
+
+		_, err = batch.Commit(ctx)
+		if err != nil {
+			return count, err
+		}
+		count += len(docs)
+	}
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// organization 配信者が所属する組織
+type organization struct {
+	// Name 組織名
+	Name string `firestore:"name"`
+	// FallbackIcon 配信者が分からない配信で使用するアイコンURL
+	FallbackIcon string `firestore:"fallbackIcon"`
+	// TwitterScreenName 計画ツイートを投稿する公式アカウントのスクリーンネーム
+	TwitterScreenName string `firestore:"twitterScreenName"`
+	// YoutubeChannelID 公式のYoutubeチャンネルID
+	YoutubeChannelID string `firestore:"youtubeChannelID"`
+	// YoutubeChannelName 公式のYoutubeチャンネル名
+	YoutubeChannelName string `firestore:"youtubeChannelName"`
+}
+
+const collectionNameOrganization = "Organization"
+const docIDOrganization = "organization"
+
+// FindOrganization 組織の情報を取得する
+// 登録されていない場合はcommon.ErrNotFoundを返す
+func FindOrganization(ctx context.Context, c *firestore.Client) (model.Organization, error) {
+	doc, err := c.Collection(collectionNameOrganization).Doc(docIDOrganization).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return model.Organization{}, common.ErrNotFound
+		}
+		return model.Organization{}, err
+	}
+
+	var o organization
+	doc.DataTo(&o)
+	return model.Organization{
+		Name:               o.Name,
+		FallbackIcon:       o.FallbackIcon,
+		TwitterScreenName:  o.TwitterScreenName,
+		YoutubeChannelID:   o.YoutubeChannelID,
+		YoutubeChannelName: o.YoutubeChannelName,
+	}, nil
+}
+
+// SaveOrganization 組織の情報を保存する
+func SaveOrganization(ctx context.Context, c *firestore.Client, o model.Organization) error {
+	_, err := c.Collection(collectionNameOrganization).Doc(docIDOrganization).Set(ctx, organization{
+		Name:               o.Name,
+		FallbackIcon:       o.FallbackIcon,
+		TwitterScreenName:  o.TwitterScreenName,
+		YoutubeChannelID:   o.YoutubeChannelID,
+		YoutubeChannelName: o.YoutubeChannelName,
+	})
+	return err
+}
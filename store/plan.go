@@ -26,6 +26,10 @@ type plan struct {
 	SourceID string `firestore:"sourceID"`
 	// Notified 通知を行ったかどうか
 	Notified bool `firestore:"notified"`
+	// NotifiedAt 最後に通知を行った時刻
+	NotifiedAt time.Time `firestore:"notifiedAt"`
+	// NotifiedEntries 最後に通知したときの配信予定エントリ
+	NotifiedEntries planEntrySlice `firestore:"notifiedEntries"`
 	// Fixed 固定化されているかどうか
 	Fixed bool `firestore:"fixed"`
 	// Texts 計画ツイートの内容部分
@@ -59,6 +63,8 @@ type planEntry struct {
 	MemberOnly bool `firestore:"memberOnly"`
 	// CollaboID コラボID
 	CollaboID int `firestore:"collaboID"`
+	// RemindedStartAt リマインダーを送信したときの開始時刻
+	RemindedStartAt time.Time `firestore:"remindedStartAt"`
 }
 
 const collectionNamePlan = "Plan"
@@ -91,6 +97,22 @@ func FindPlans(ctx context.Context, c *firestore.Client, r jst.Range) ([]model.P
 	return plans, nil
 }
 
+// FindPlan 日付を指定して計画を取得する
+func FindPlan(ctx context.Context, c *firestore.Client, date jst.Time) (model.Plan, error) {
+	docs, err := c.Collection(collectionNamePlan).Where("date", "==", date.Time()).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return model.Plan{}, err
+	}
+
+	if len(docs) == 0 {
+		return model.Plan{}, common.ErrNotFound
+	}
+
+	var p plan
+	docs[0].DataTo(&p)
+	return p.Plan(), nil
+}
+
 // FindLatestPlan 最新の計画を取得する
 func FindLatestPlan(ctx context.Context, c *firestore.Client) (model.Plan, error) {
 	it := c.Collection(collectionNamePlan).OrderBy("date", firestore.Desc).Limit(1).Documents(ctx)
@@ -109,13 +131,16 @@ func FindLatestPlan(ctx context.Context, c *firestore.Client) (model.Plan, error
 }
 
 // SavePlan 計画を保存する
+// 既に存在する場合はマージした計画を、新しく作成した場合は2つ目の戻り値がtrueになる
 // Notifiedを更新する場合はMarkPlanAsNotifiedを使用する
-func SavePlan(ctx context.Context, c *firestore.Client, p model.Plan) error {
+func SavePlan(ctx context.Context, c *firestore.Client, p model.Plan) (model.Plan, bool, error) {
 	temp := fromPlan(p)
 	planTag := p.PlanTag
 	fixed := false
+	created := false
 
 	err := c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+		created = false
 		q := c.Collection(collectionNamePlan).Where("date", "==", temp.Date).Limit(1)
 		docs, err := t.Documents(q).GetAll()
 		if err != nil {
@@ -133,21 +158,31 @@ func SavePlan(ctx context.Context, c *firestore.Client, p model.Plan) error {
 			}
 			temp.Notified = oldPlan.Notified
 			temp = oldPlan.Merge(temp, planTag)
+			temp = temp.inheritReminded(oldPlan)
+			err = appendChange(c, t, model.ChangeKindPlan, model.PlanEntityID(p.Date))
+			if err != nil {
+				return err
+			}
 			return t.Set(docs[0].Ref, temp)
 		}
 
+		err = appendChange(c, t, model.ChangeKindPlan, model.PlanEntityID(p.Date))
+		if err != nil {
+			return err
+		}
+		created = true
 		return t.Set(c.Collection(collectionNamePlan).NewDoc(), temp)
 	})
 
 	if err != nil {
-		return err
+		return model.Plan{}, false, err
 	}
 
 	if fixed {
-		return ErrFixedPlan
+		return model.Plan{}, false, ErrFixedPlan
 	}
 
-	return nil
+	return temp.Plan(), created, nil
 }
 
 // SavePlanWithExplicitID 指定したIDで保存する
@@ -155,15 +190,19 @@ func SavePlanWithExplicitID(ctx context.Context, c *firestore.Client, p model.Pl
 	temp := fromPlan(p)
 
 	return c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
-		_, err := c.Collection(collectionNamePlan).Doc(id).Set(ctx, temp)
-		return err
+		err := appendChange(c, t, model.ChangeKindPlan, model.PlanEntityID(p.Date))
+		if err != nil {
+			return err
+		}
+		return t.Set(c.Collection(collectionNamePlan).Doc(id), temp)
 	})
 }
 
 // MarkPlanAsNotified 計画を通知済みとする
+// 通知した内容との差分を後から通知できるように保存されているエントリを通知済みのエントリとして記録する
 // すでに通知済みな場合はなにもしない
 // 更新された場合はtrue、されなかった場合はfalse
-func MarkPlanAsNotified(ctx context.Context, c *firestore.Client, p model.Plan) (model.Plan, bool, error) {
+func MarkPlanAsNotified(ctx context.Context, c *firestore.Client, p model.Plan, now jst.Time) (model.Plan, bool, error) {
 	updated := false
 	var temp model.Plan
 
@@ -191,7 +230,13 @@ func MarkPlanAsNotified(ctx context.Context, c *firestore.Client, p model.Plan)
 
 		updated = true
 		oldPlan.Notified = true
+		oldPlan.NotifiedAt = now.Time()
+		oldPlan.NotifiedEntries = oldPlan.Entries
 		temp = oldPlan.Plan()
+		err = appendChange(c, t, model.ChangeKindPlan, model.PlanEntityID(temp.Date))
+		if err != nil {
+			return err
+		}
 		return t.Set(doc.Ref, oldPlan)
 	})
 
@@ -206,19 +251,241 @@ func MarkPlanAsNotified(ctx context.Context, c *firestore.Client, p model.Plan)
 	return temp, true, nil
 }
 
-func fromPlan(p model.Plan) plan {
-	var entries planEntrySlice
-	for _, e := range p.Entries {
-		entries = append(entries, planEntry{
-			ActorID:    e.ActorID,
-			PlanTag:    e.PlanTag,
-			HashTag:    e.HashTag,
-			StartAt:    e.StartAt.Time(),
-			Source:     e.Source,
-			MemberOnly: e.MemberOnly,
-			CollaboID:  e.CollaboID,
-		})
+// UnmarkPlanAsNotified 通知できなかった計画を通知していない状態に戻す
+// pはMarkPlanAsNotifiedで更新した計画で、その後に他で通知済みのエントリが更新されている場合はなにもしない
+func UnmarkPlanAsNotified(ctx context.Context, c *firestore.Client, p model.Plan) error {
+	return c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+		q := c.Collection(collectionNamePlan).Where("date", "==", p.Date.Time()).Limit(1)
+		docs, err := t.Documents(q).GetAll()
+		if err != nil {
+			return err
+		}
+
+		if len(docs) == 0 {
+			return nil
+		}
+
+		var oldPlan plan
+		docs[0].DataTo(&oldPlan)
+		if !oldPlan.Notified || !oldPlan.NotifiedAt.Equal(p.NotifiedAt.Time()) {
+			return nil
+		}
+
+		oldPlan.Notified = false
+		oldPlan.NotifiedAt = time.Time{}
+		oldPlan.NotifiedEntries = nil
+		err = appendChange(c, t, model.ChangeKindPlan, model.PlanEntityID(p.Date))
+		if err != nil {
+			return err
+		}
+		return t.Set(docs[0].Ref, oldPlan)
+	})
+}
+
+// UpdatePlanNotifiedEntries 計画の通知済みのエントリをpのエントリに更新する
+// 計画の修正を通知した後に使用する
+// pを取得した後に他で通知済みのエントリが更新されている場合はなにもしない
+// 更新された場合はtrue、されなかった場合はfalse
+func UpdatePlanNotifiedEntries(ctx context.Context, c *firestore.Client, p model.Plan, now jst.Time) (model.Plan, bool, error) {
+	updated := false
+	var temp model.Plan
+
+	err := c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+		updated = false
+		q := c.Collection(collectionNamePlan).Where("date", "==", p.Date.Time()).Limit(1)
+		docs, err := t.Documents(q).GetAll()
+		if err != nil {
+			return err
+		}
+
+		// 保存されていない物は更新できない
+		if len(docs) == 0 {
+			return nil
+		}
+
+		var oldPlan plan
+		docs[0].DataTo(&oldPlan)
+		if !oldPlan.Notified || !oldPlan.NotifiedAt.Equal(p.NotifiedAt.Time()) {
+			return nil
+		}
+
+		updated = true
+		oldPlan.NotifiedAt = now.Time()
+		oldPlan.NotifiedEntries = fromPlanEntries(p.Entries)
+		temp = oldPlan.Plan()
+		err = appendChange(c, t, model.ChangeKindPlan, model.PlanEntityID(p.Date))
+		if err != nil {
+			return err
+		}
+		return t.Set(docs[0].Ref, oldPlan)
+	})
+
+	if err != nil {
+		return model.Plan{}, false, err
 	}
+
+	if !updated {
+		return p, false, nil
+	}
+
+	return temp, true, nil
+}
+
+// RestorePlanNotifiedEntries 計画の修正を通知できなかった場合に通知済みのエントリを元に戻す
+// pはUpdatePlanNotifiedEntriesで更新する前の計画、notifiedAtは更新した時刻
+// その後に他で通知済みのエントリが更新されている場合はなにもしない
+func RestorePlanNotifiedEntries(ctx context.Context, c *firestore.Client, p model.Plan, notifiedAt jst.Time) error {
+	return c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+		q := c.Collection(collectionNamePlan).Where("date", "==", p.Date.Time()).Limit(1)
+		docs, err := t.Documents(q).GetAll()
+		if err != nil {
+			return err
+		}
+
+		if len(docs) == 0 {
+			return nil
+		}
+
+		var oldPlan plan
+		docs[0].DataTo(&oldPlan)
+		if !oldPlan.Notified || !oldPlan.NotifiedAt.Equal(notifiedAt.Time()) {
+			return nil
+		}
+
+		oldPlan.NotifiedAt = p.NotifiedAt.Time()
+		oldPlan.NotifiedEntries = fromPlanEntries(p.NotifiedEntries)
+		err = appendChange(c, t, model.ChangeKindPlan, model.PlanEntityID(p.Date))
+		if err != nil {
+			return err
+		}
+		return t.Set(docs[0].Ref, oldPlan)
+	})
+}
+
+// MarkPlanEntriesAsReminded 計画のエントリをリマインダー送信済みとする
+// コラボの場合は同じ通知になるので複数のエントリをまとめて更新する
+// 既に送信済みのエントリがある場合や開始時刻が変わっている場合はなにもしない
+// 更新された場合はtrue、されなかった場合はfalse
+func MarkPlanEntriesAsReminded(ctx context.Context, c *firestore.Client, p model.Plan, entries []model.PlanEntry) (bool, error) {
+	updated := false
+
+	err := c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+		updated = false
+		q := c.Collection(collectionNamePlan).Where("date", "==", p.Date.Time()).Limit(1)
+		docs, err := t.Documents(q).GetAll()
+		if err != nil {
+			return err
+		}
+
+		// 保存されていない物は更新できない
+		if len(docs) == 0 {
+			return nil
+		}
+
+		var oldPlan plan
+		docs[0].DataTo(&oldPlan)
+		oldPlan, ok := oldPlan.markReminded(entries)
+		if !ok {
+			return nil
+		}
+
+		updated = true
+		err = appendChange(c, t, model.ChangeKindPlan, model.PlanEntityID(p.Date))
+		if err != nil {
+			return err
+		}
+		return t.Set(docs[0].Ref, oldPlan)
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return updated, nil
+}
+
+// UnmarkPlanEntriesAsReminded リマインダーを送信できなかった計画のエントリを未送信に戻す
+// 開始時刻が変わっているエントリはそのままにする
+func UnmarkPlanEntriesAsReminded(ctx context.Context, c *firestore.Client, p model.Plan, entries []model.PlanEntry) error {
+	return c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+		q := c.Collection(collectionNamePlan).Where("date", "==", p.Date.Time()).Limit(1)
+		docs, err := t.Documents(q).GetAll()
+		if err != nil {
+			return err
+		}
+
+		if len(docs) == 0 {
+			return nil
+		}
+
+		var oldPlan plan
+		docs[0].DataTo(&oldPlan)
+		oldPlan, ok := oldPlan.unmarkReminded(entries)
+		if !ok {
+			return nil
+		}
+
+		err = appendChange(c, t, model.ChangeKindPlan, model.PlanEntityID(p.Date))
+		if err != nil {
+			return err
+		}
+		return t.Set(docs[0].Ref, oldPlan)
+	})
+}
+
+// markReminded 指定したエントリをリマインダー送信済みにする
+// 全てのエントリが見つかって未送信の場合だけtrueを返す
+func (p plan) markReminded(targets []model.PlanEntry) (plan, bool) {
+	entries := append(planEntrySlice{}, p.Entries...)
+	for _, target := range targets {
+		found := false
+		for i, e := range entries {
+			if e.ActorID != target.ActorID || e.HashTag != target.HashTag || !e.StartAt.Equal(target.StartAt.Time()) {
+				continue
+			}
+
+			if e.PlanEntry().IsReminded() {
+				return p, false
+			}
+
+			entries[i].RemindedStartAt = e.StartAt
+			found = true
+			break
+		}
+
+		if !found {
+			return p, false
+		}
+	}
+
+	p.Entries = entries
+	return p, true
+}
+
+// unmarkReminded 指定したエントリのリマインダーを未送信にする
+// 未送信に戻したエントリがある場合だけtrueを返す
+func (p plan) unmarkReminded(targets []model.PlanEntry) (plan, bool) {
+	entries := append(planEntrySlice{}, p.Entries...)
+	updated := false
+	for _, target := range targets {
+		for i, e := range entries {
+			if e.ActorID != target.ActorID || e.HashTag != target.HashTag || !e.StartAt.Equal(target.StartAt.Time()) {
+				continue
+			}
+
+			if e.PlanEntry().IsReminded() {
+				entries[i].RemindedStartAt = time.Time{}
+				updated = true
+			}
+			break
+		}
+	}
+
+	p.Entries = entries
+	return p, updated
+}
+
+func fromPlan(p model.Plan) plan {
 	var texts planTextSlice
 	for _, t := range p.Texts {
 		texts = append(texts, planText{
@@ -228,23 +495,44 @@ func fromPlan(p model.Plan) plan {
 		})
 	}
 	return plan{
-		Date:     p.Date.Time(),
-		Entries:  entries,
-		Notified: p.Notified,
-		SourceID: p.SourceID,
-		Fixed:    p.Fixed,
-		Texts:    texts,
+		Date:            p.Date.Time(),
+		Entries:         fromPlanEntries(p.Entries),
+		Notified:        p.Notified,
+		NotifiedAt:      p.NotifiedAt.Time(),
+		NotifiedEntries: fromPlanEntries(p.NotifiedEntries),
+		SourceID:        p.SourceID,
+		Fixed:           p.Fixed,
+		Texts:           texts,
 	}
 }
 
+func fromPlanEntries(es []model.PlanEntry) planEntrySlice {
+	var entries planEntrySlice
+	for _, e := range es {
+		entries = append(entries, planEntry{
+			ActorID:         e.ActorID,
+			PlanTag:         e.PlanTag,
+			HashTag:         e.HashTag,
+			StartAt:         e.StartAt.Time(),
+			Source:          e.Source,
+			MemberOnly:      e.MemberOnly,
+			CollaboID:       e.CollaboID,
+			RemindedStartAt: e.RemindedStartAt.Time(),
+		})
+	}
+	return entries
+}
+
 func (p plan) Plan() model.Plan {
 	return model.Plan{
-		Date:     jst.From(p.Date),
-		Entries:  p.Entries.PlanEntries(),
-		Notified: p.Notified,
-		SourceID: p.SourceID,
-		Fixed:    p.Fixed,
-		Texts:    p.Texts.PlanTexts(),
+		Date:            jst.From(p.Date),
+		Entries:         p.Entries.PlanEntries(),
+		Notified:        p.Notified,
+		NotifiedAt:      jst.From(p.NotifiedAt),
+		NotifiedEntries: p.NotifiedEntries.PlanEntries(),
+		SourceID:        p.SourceID,
+		Fixed:           p.Fixed,
+		Texts:           p.Texts.PlanTexts(),
 	}
 }
 
@@ -305,6 +593,24 @@ OUTER:
 	return newPlan
 }
 
+// inheritReminded 計画が再取得された場合に同じ配信のリマインダーの送信状態を引き継ぐ
+// 開始時刻が変わったエントリは引き継がないので新しい開始時刻でリマインダーが送信される
+func (p plan) inheritReminded(oldPlan plan) plan {
+	entries := make(planEntrySlice, len(p.Entries))
+	for i, e := range p.Entries {
+		for _, old := range oldPlan.Entries {
+			if e.ActorID == old.ActorID && e.HashTag == old.HashTag && e.StartAt.Equal(old.StartAt) && e.RemindedStartAt.IsZero() {
+				e.RemindedStartAt = old.RemindedStartAt
+				break
+			}
+		}
+		entries[i] = e
+	}
+
+	p.Entries = entries
+	return p
+}
+
 func (p plan) removeByPlanTag(planTag string) plan {
 	var entries []planEntry
 	for _, e := range p.Entries {
@@ -339,13 +645,14 @@ func (es planEntrySlice) PlanEntries() []model.PlanEntry {
 
 func (e planEntry) PlanEntry() model.PlanEntry {
 	return model.PlanEntry{
-		ActorID:    e.ActorID,
-		PlanTag:    e.PlanTag,
-		HashTag:    e.HashTag,
-		StartAt:    jst.From(e.StartAt),
-		Source:     e.Source,
-		MemberOnly: e.MemberOnly,
-		CollaboID:  e.CollaboID,
+		ActorID:         e.ActorID,
+		PlanTag:         e.PlanTag,
+		HashTag:         e.HashTag,
+		StartAt:         jst.From(e.StartAt),
+		Source:          e.Source,
+		MemberOnly:      e.MemberOnly,
+		CollaboID:       e.CollaboID,
+		RemindedStartAt: jst.From(e.RemindedStartAt),
 	}
 }
 
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
 )
 
 func TestPlan(t *testing.T) {
@@ -113,3 +114,84 @@ func TestPlan(t *testing.T) {
 	// 修正があった場合
 	test(planB.Merge(planA, "②").Merge(modifiedPlanB, "①"), expectIDs, expectText)
 }
+
+func TestPlanInheritReminded(t *testing.T) {
+	d := jst.Date(2020, 9, 23, 20, 0).Time()
+	oldPlan := plan{
+		Entries: planEntrySlice{
+			{ActorID: "A", StartAt: d, RemindedStartAt: d},
+			{ActorID: "B", StartAt: d, RemindedStartAt: d},
+		},
+	}
+
+	newPlan := plan{
+		Entries: planEntrySlice{
+			{ActorID: "A", StartAt: d},
+			// 開始時刻が変わった場合は引き継がない
+			{ActorID: "B", StartAt: d.Add(time.Hour)},
+		},
+	}
+
+	p := newPlan.inheritReminded(oldPlan)
+	if !p.Entries[0].RemindedStartAt.Equal(d) {
+		t.Errorf("must inherit reminded: %+v", p.Entries[0])
+	}
+	if !p.Entries[1].RemindedStartAt.IsZero() {
+		t.Errorf("must not inherit reminded: %+v", p.Entries[1])
+	}
+	if !newPlan.Entries[0].RemindedStartAt.IsZero() {
+		t.Errorf("original must not be modified")
+	}
+}
+
+func TestPlanMarkReminded(t *testing.T) {
+	d := jst.Date(2020, 9, 23, 20, 0)
+	p := plan{
+		Entries: planEntrySlice{
+			{ActorID: "A", StartAt: d.Time(), CollaboID: 1},
+			{ActorID: "B", StartAt: d.Time(), CollaboID: 1},
+			{ActorID: "C", StartAt: d.Add(time.Hour).Time()},
+		},
+	}
+
+	collabo := []model.PlanEntry{
+		{ActorID: "A", StartAt: d},
+		{ActorID: "B", StartAt: d},
+	}
+	marked, ok := p.markReminded(collabo)
+	if !ok {
+		t.Fatalf("must be marked")
+	}
+	if !marked.Entries[0].PlanEntry().IsReminded() || !marked.Entries[1].PlanEntry().IsReminded() || marked.Entries[2].PlanEntry().IsReminded() {
+		t.Errorf("invalid reminded: %+v", marked.Entries)
+	}
+	if p.Entries[0].PlanEntry().IsReminded() {
+		t.Errorf("original must not be modified")
+	}
+
+	// 既に送信済み
+	_, ok = marked.markReminded(collabo)
+	if ok {
+		t.Errorf("already reminded")
+	}
+
+	// 開始時刻が変わっている
+	_, ok = p.markReminded([]model.PlanEntry{{ActorID: "C", StartAt: d}})
+	if ok {
+		t.Errorf("startAt was changed")
+	}
+
+	// 送信できなかった場合は未送信に戻す
+	unmarked, ok := marked.unmarkReminded(collabo)
+	if !ok {
+		t.Fatalf("must be unmarked")
+	}
+	if unmarked.Entries[0].PlanEntry().IsReminded() || unmarked.Entries[1].PlanEntry().IsReminded() {
+		t.Errorf("invalid unmarked: %+v", unmarked.Entries)
+	}
+
+	_, ok = unmarked.unmarkReminded(collabo)
+	if ok {
+		t.Errorf("already unmarked")
+	}
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// monthlyStats 1ヶ月の配信の統計
+// 変更されることがない月の統計のみを保存する
+type monthlyStats struct {
+	// BaseDate 何月か
+	BaseDate time.Time `firestore:"baseDate"`
+	// Actors 配信者ごとの統計
+	Actors []actorStats `firestore:"actors"`
+}
+
+// actorStats 配信者ごとの配信の統計
+type actorStats struct {
+	ActorID         string         `firestore:"actorID"`
+	StreamCount     int            `firestore:"streamCount"`
+	TotalDuration   int64          `firestore:"totalDuration"`
+	AverageDuration int64          `firestore:"averageDuration"`
+	DurationCount   int            `firestore:"durationCount"`
+	PlannedCount    int            `firestore:"plannedCount"`
+	UnplannedCount  int            `firestore:"unplannedCount"`
+	CollaboCount    int            `firestore:"collaboCount"`
+	MemberOnlyCount int            `firestore:"memberOnlyCount"`
+	Sources         map[string]int `firestore:"sources"`
+}
+
+const collectionNameMonthlyStats = "MonthlyStats"
+
+func monthlyStatsDocID(baseDate jst.Time) string {
+	return fmt.Sprintf("%v-%v", baseDate.Year(), int(baseDate.Month()))
+}
+
+// FindMonthlyStats 保存されている月の統計を取得する
+// 保存されていない場合はErrNotFound
+func FindMonthlyStats(ctx context.Context, c *firestore.Client, baseDate jst.Time) (model.MonthlyStats, error) {
+	doc, err := c.Collection(collectionNameMonthlyStats).Doc(monthlyStatsDocID(baseDate)).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return model.MonthlyStats{}, common.ErrNotFound
+		}
+
+		return model.MonthlyStats{}, err
+	}
+
+	var s monthlyStats
+	doc.DataTo(&s)
+
+	result := model.MonthlyStats{
+		BaseDate: jst.From(s.BaseDate),
+		Fixed:    true,
+		Actors:   []model.ActorStats{},
+	}
+	for _, a := range s.Actors {
+		result.Actors = append(result.Actors, model.ActorStats{
+			ActorID:         a.ActorID,
+			StreamCount:     a.StreamCount,
+			TotalDuration:   a.TotalDuration,
+			AverageDuration: a.AverageDuration,
+			DurationCount:   a.DurationCount,
+			PlannedCount:    a.PlannedCount,
+			UnplannedCount:  a.UnplannedCount,
+			CollaboCount:    a.CollaboCount,
+			MemberOnlyCount: a.MemberOnlyCount,
+			Sources:         a.Sources,
+		})
+	}
+
+	return result, nil
+}
+
+// SaveMonthlyStats 月の統計を保存する
+// Fixedではない統計は保存しない
+func SaveMonthlyStats(ctx context.Context, c *firestore.Client, s model.MonthlyStats) error {
+	if !s.Fixed {
+		return fmt.Errorf("stats is not fixed: %v", monthlyStatsDocID(s.BaseDate))
+	}
+
+	temp := monthlyStats{
+		BaseDate: s.BaseDate.Time(),
+	}
+	for _, a := range s.Actors {
+		temp.Actors = append(temp.Actors, actorStats{
+			ActorID:         a.ActorID,
+			StreamCount:     a.StreamCount,
+			TotalDuration:   a.TotalDuration,
+			AverageDuration: a.AverageDuration,
+			DurationCount:   a.DurationCount,
+			PlannedCount:    a.PlannedCount,
+			UnplannedCount:  a.UnplannedCount,
+			CollaboCount:    a.CollaboCount,
+			MemberOnlyCount: a.MemberOnlyCount,
+			Sources:         a.Sources,
+		})
+	}
+
+	// 常に上書きでいいのでトランザクションにしない
+	_, err := c.Collection(collectionNameMonthlyStats).Doc(monthlyStatsDocID(s.BaseDate)).Set(ctx, temp)
+	return err
+}
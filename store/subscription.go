@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// topicSubscription クライアントが購読しているトピック
+type topicSubscription struct {
+	// Token クライアントのFCMのトークン
+	Token string `firestore:"token"`
+	// Topics 購読しているトピック
+	Topics []string `firestore:"topics"`
+	// UpdatedAt 最後に購読を変更した時刻
+	UpdatedAt time.Time `firestore:"updatedAt"`
+}
+
+const collectionNameTopicSubscription = "TopicSubscription"
+
+// topicSubscriptionDocID トークンからドキュメントIDを作成する
+// トークンは長く使用できない文字が含まれる可能性もあるのでハッシュにする
+func topicSubscriptionDocID(token string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(token)))
+}
+
+// FindTopicSubscription クライアントが購読しているトピックを取得する
+// 記録されていない場合はcommon.ErrNotFoundを返す
+func FindTopicSubscription(ctx context.Context, c *firestore.Client, token string) (model.TopicSubscription, error) {
+	doc, err := c.Collection(collectionNameTopicSubscription).Doc(topicSubscriptionDocID(token)).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return model.TopicSubscription{}, common.ErrNotFound
+		}
+		return model.TopicSubscription{}, err
+	}
+
+	var s topicSubscription
+	doc.DataTo(&s)
+	return model.TopicSubscription{
+		Token:     s.Token,
+		Topics:    s.Topics,
+		UpdatedAt: jst.From(s.UpdatedAt),
+	}, nil
+}
+
+// CreateTopicSubscription クライアントが購読しているトピックを記録されていない場合だけ保存する
+// 既に記録されている場合は何もしない
+func CreateTopicSubscription(ctx context.Context, c *firestore.Client, s model.TopicSubscription) error {
+	_, err := c.Collection(collectionNameTopicSubscription).Doc(topicSubscriptionDocID(s.Token)).Create(ctx, fromTopicSubscription(s))
+	if status.Code(err) == codes.AlreadyExists {
+		return nil
+	}
+	return err
+}
+
+// UpdateTopicSubscription クライアントが購読しているトピックを追加または削除して更新後の記録を返す
+// 同時に購読を変更しても他の変更を上書きしないようにトランザクションで更新する
+// 購読しているトピックがなくなった場合も記録を残して、IIDのAPIから取得し直さないようにする
+func UpdateTopicSubscription(ctx context.Context, c *firestore.Client, token string, subscribed, unsubscribed []string, now jst.Time) (model.TopicSubscription, error) {
+	var result model.TopicSubscription
+	docRef := c.Collection(collectionNameTopicSubscription).Doc(topicSubscriptionDocID(token))
+	err := c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		result = model.TopicSubscription{Token: token}
+		doc, err := tx.Get(docRef)
+		if err == nil {
+			var s topicSubscription
+			doc.DataTo(&s)
+			result.Topics = s.Topics
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		result = result.Update(subscribed, unsubscribed)
+		result.UpdatedAt = now
+		return tx.Set(docRef, fromTopicSubscription(result))
+	})
+	if err != nil {
+		return model.TopicSubscription{}, err
+	}
+
+	return result, nil
+}
+
+func fromTopicSubscription(s model.TopicSubscription) topicSubscription {
+	return topicSubscription{
+		Token:     s.Token,
+		Topics:    s.Topics,
+		UpdatedAt: s.UpdatedAt.Time(),
+	}
+}
+
+// DeleteTopicSubscription クライアントが購読しているトピックの記録を削除する
+// 存在しない場合も成功する
+func DeleteTopicSubscription(ctx context.Context, c *firestore.Client, token string) error {
+	_, err := c.Collection(collectionNameTopicSubscription).Doc(topicSubscriptionDocID(token)).Delete(ctx)
+	return err
+}
@@ -2,11 +2,14 @@ package store
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/common"
 	"github.com/yaegaki/dotlive-schedule-server/jst"
 	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/search"
 	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -22,8 +25,14 @@ type video struct {
 	Source string `firestore:"source"`
 	// URL 動画のURL
 	URL string `firestore:"url"`
+	// ChannelID 動画サイトでのチャンネルID
+	ChannelID string `firestore:"channelID"`
 	// Text 動画の説明
 	Text string `firestore:"text"`
+	// Title 動画サイトでのタイトル
+	Title string `firestore:"title"`
+	// Thumbnail サムネイルのURL
+	Thumbnail string `firestore:"thumbnail"`
 	// IsLive 生放送かどうか
 	// プレミア公開もTrue
 	IsLive bool `firestore:"isLive"`
@@ -31,8 +40,16 @@ type video struct {
 	MemberOnly bool
 	// Notified Push通知送信済みか
 	Notified bool `firestore:"notified"`
+	// RemindedStartAt リマインダーを送信したときの開始時刻
+	RemindedStartAt time.Time `firestore:"remindedStartAt"`
 	// StartAt 配信開始時刻
 	StartAt time.Time `firestore:"startAt"`
+	// OriginalStartAt 開始時刻が変更された場合の最初の開始時刻
+	OriginalStartAt time.Time `firestore:"originalStartAt"`
+	// ActualStartAt 実際の配信開始時刻
+	ActualStartAt time.Time `firestore:"actualStartAt"`
+	// EndAt 配信終了時刻
+	EndAt time.Time `firestore:"endAt"`
 	// RelatedActorID 関連する配信者ID
 	RelatedActorID string `firestore:"relatedActorID"`
 	// RelatedActorIDs 関連する配信者IDの配列
@@ -41,6 +58,12 @@ type video struct {
 	OwnerName string `firestore:"ownerName"`
 	// HashTags ハッシュタグ
 	HashTags []string `firestore:"hashTags"`
+	// Unavailable 動画が削除されたか非公開になったかどうか
+	Unavailable bool `firestore:"unavailable"`
+	// UnavailableCount 配信前の動画を続けて取得できなかった回数
+	UnavailableCount int `firestore:"unavailableCount"`
+	// SearchTokens 検索用のトークン
+	SearchTokens []string `firestore:"searchTokens"`
 }
 
 const collectionNameVideo = "Video"
@@ -57,6 +80,76 @@ func FindNotNotifiedVideos(ctx context.Context, c *firestore.Client) ([]model.Vi
 	return getVideos(it)
 }
 
+// FindVideosByActor 配信者に関連する動画を開始時刻の降順で検索する
+// コラボ動画も対象にするためactorID、relatedActorID、relatedActorIDsのそれぞれで検索して結果をまとめる
+// limitはそれぞれのクエリに適用されるので結果はlimitより多くなる場合がある
+func FindVideosByActor(ctx context.Context, c *firestore.Client, actorID string, r jst.Range, limit int) ([]model.Video, error) {
+	col := c.Collection(collectionNameVideo)
+	queries := []firestore.Query{
+		col.Where("actorID", "==", actorID),
+		col.Where("relatedActorID", "==", actorID),
+		col.Where("relatedActorIDs", "array-contains", actorID),
+	}
+
+	var videos []model.Video
+	for _, q := range queries {
+		it := q.Where("startAt", ">=", r.Begin.Time()).
+			Where("startAt", "<=", r.End.Time()).
+			OrderBy("startAt", firestore.Desc).
+			Limit(limit).
+			Documents(ctx)
+		temp, err := getVideos(it)
+		if err != nil {
+			return nil, err
+		}
+
+	OUTER:
+		for _, v := range temp {
+			for _, added := range videos {
+				if added.ID == v.ID {
+					continue OUTER
+				}
+			}
+
+			videos = append(videos, v)
+		}
+	}
+
+	sort.Slice(videos, func(i, j int) bool {
+		return videos[i].StartAt.After(videos[j].StartAt)
+	})
+
+	return videos, nil
+}
+
+// FindVideosByToken 検索用のトークンを含む動画を開始時刻の降順で検索する
+func FindVideosByToken(ctx context.Context, c *firestore.Client, token string, r jst.Range, limit int) ([]model.Video, error) {
+	it := c.Collection(collectionNameVideo).
+		Where("searchTokens", "array-contains", token).
+		Where("startAt", ">=", r.Begin.Time()).
+		Where("startAt", "<=", r.End.Time()).
+		OrderBy("startAt", firestore.Desc).
+		Limit(limit).
+		Documents(ctx)
+	return getVideos(it)
+}
+
+// FindVideo IDを指定して動画を取得する
+func FindVideo(ctx context.Context, c *firestore.Client, id string) (model.Video, error) {
+	doc, err := c.Collection(collectionNameVideo).Doc(id).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return model.Video{}, common.ErrNotFound
+		}
+		return model.Video{}, err
+	}
+
+	var v video
+	doc.DataTo(&v)
+	v.id = doc.Ref.ID
+	return v.Video(), nil
+}
+
 func getVideos(it *firestore.DocumentIterator) ([]model.Video, error) {
 	var videos []model.Video
 	for {
@@ -79,10 +172,14 @@ func getVideos(it *firestore.DocumentIterator) ([]model.Video, error) {
 
 // SaveVideo 動画を保存する
 // 既に存在している場合は通知設定は更新されない
-func SaveVideo(ctx context.Context, c *firestore.Client, v model.Video, overrideOldVideoHandler func(v model.Video) bool) error {
+// 保存した場合はsavedがtrue、さらに新しく作成した場合はcreatedもtrueになる
+// 既存の動画を上書きしないと判断した場合や保存されている内容と同じ場合はどちらもfalseになる
+func SaveVideo(ctx context.Context, c *firestore.Client, v model.Video, overrideOldVideoHandler func(v model.Video) bool) (saved bool, created bool, err error) {
 	temp := fromVideo(v)
 
-	return c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+	err = c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+		saved = false
+		created = false
 		docRef := c.Collection(collectionNameVideo).Doc(v.ID)
 		doc, err := t.Get(docRef)
 
@@ -104,13 +201,55 @@ func SaveVideo(ctx context.Context, c *firestore.Client, v model.Video, override
 			}
 
 			temp.Notified = oldVideo.Notified
+			// 開始時刻が変わった場合はIsRemindedがfalseになるので再度リマインダーが送信される
+			temp.RemindedStartAt = oldVideo.RemindedStartAt
 			temp.RelatedActorIDs = createRelatedActorIDs(temp, oldVideo)
+			temp = temp.inheritOriginalStartAt(oldVideo)
+
+			// 変更がない場合は変更履歴を追加しないように書き込まない
+			if temp.equal(oldVideo) {
+				return nil
+			}
 		} else if status.Code(err) != codes.NotFound {
 			return err
+		} else {
+			created = true
+		}
+
+		err = appendChange(c, t, model.ChangeKindVideo, v.ID)
+		if err != nil {
+			return err
 		}
 
+		saved = true
 		return t.Set(c.Collection(collectionNameVideo).Doc(v.ID), temp)
 	})
+	if err != nil {
+		return false, false, err
+	}
+
+	return saved, created, nil
+}
+
+// inheritOriginalStartAt 最初の開始時刻を引き継ぐ
+// 開始時刻が初めて変わった場合は変更前の開始時刻を最初の開始時刻にする
+// 開始時刻を取得できるのはYoutubeだけなので他のサイトの動画は記録しない
+func (v video) inheritOriginalStartAt(oldVideo video) video {
+	if v.Source != model.VideoSourceYoutube {
+		return v
+	}
+
+	v.OriginalStartAt = oldVideo.OriginalStartAt
+	if v.OriginalStartAt.IsZero() && !oldVideo.StartAt.Equal(v.StartAt) {
+		v.OriginalStartAt = oldVideo.StartAt
+	}
+
+	// 元の開始時刻に戻った場合は変更されていないものとする
+	if v.OriginalStartAt.Equal(v.StartAt) {
+		v.OriginalStartAt = time.Time{}
+	}
+
+	return v
 }
 
 func createRelatedActorIDs(v1 video, v2 video) []string {
@@ -143,6 +282,36 @@ func createRelatedActorIDs(v1 video, v2 video) []string {
 	return result
 }
 
+// equal 同じ内容かどうか
+// Firestoreから読み込んだ時刻はタイムゾーンが異なるのでEqualで比較する
+func (v video) equal(other video) bool {
+	if !equalStrings(v.RelatedActorIDs, other.RelatedActorIDs) ||
+		!equalStrings(v.HashTags, other.HashTags) ||
+		!equalStrings(v.SearchTokens, other.SearchTokens) {
+		return false
+	}
+
+	return v.ActorID == other.ActorID &&
+		v.Source == other.Source &&
+		v.URL == other.URL &&
+		v.ChannelID == other.ChannelID &&
+		v.Text == other.Text &&
+		v.Title == other.Title &&
+		v.Thumbnail == other.Thumbnail &&
+		v.IsLive == other.IsLive &&
+		v.MemberOnly == other.MemberOnly &&
+		v.Notified == other.Notified &&
+		v.RemindedStartAt.Equal(other.RemindedStartAt) &&
+		v.StartAt.Equal(other.StartAt) &&
+		v.OriginalStartAt.Equal(other.OriginalStartAt) &&
+		v.ActualStartAt.Equal(other.ActualStartAt) &&
+		v.EndAt.Equal(other.EndAt) &&
+		v.RelatedActorID == other.RelatedActorID &&
+		v.OwnerName == other.OwnerName &&
+		v.Unavailable == other.Unavailable &&
+		v.UnavailableCount == other.UnavailableCount
+}
+
 // MarkVideoAsNotified 計画を通知済みとする
 // すでに通知済みな場合はなにもしない
 // 更新された場合はtrue、されなかった場合はfalse
@@ -170,6 +339,10 @@ func MarkVideoAsNotified(ctx context.Context, c *firestore.Client, v model.Video
 		oldVideo.Notified = true
 		temp = oldVideo.Video()
 
+		err = appendChange(c, t, model.ChangeKindVideo, v.ID)
+		if err != nil {
+			return err
+		}
 		return t.Set(doc.Ref, oldVideo)
 	})
 
@@ -184,38 +357,172 @@ func MarkVideoAsNotified(ctx context.Context, c *firestore.Client, v model.Video
 	return temp, true, nil
 }
 
+// UnmarkVideoAsNotified 通知できなかった動画を通知していない状態に戻す
+// 存在しない場合や通知済みでない場合はなにもしない
+func UnmarkVideoAsNotified(ctx context.Context, c *firestore.Client, v model.Video) error {
+	return c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+		docRef := c.Collection(collectionNameVideo).Doc(v.ID)
+		doc, err := t.Get(docRef)
+		if err != nil {
+			if status.Code(err) != codes.NotFound {
+				return err
+			}
+			return nil
+		}
+
+		var oldVideo video
+		doc.DataTo(&oldVideo)
+		if !oldVideo.Notified {
+			return nil
+		}
+
+		oldVideo.Notified = false
+		err = appendChange(c, t, model.ChangeKindVideo, v.ID)
+		if err != nil {
+			return err
+		}
+		return t.Set(doc.Ref, oldVideo)
+	})
+}
+
+// MarkVideoAsReminded 動画をリマインダー送信済みとする
+// 既に送信済みの場合や保存されている開始時刻と異なる場合はなにもしない
+// 更新された場合はtrue、されなかった場合はfalse
+func MarkVideoAsReminded(ctx context.Context, c *firestore.Client, v model.Video) (model.Video, bool, error) {
+	updated := false
+	var temp model.Video
+
+	err := c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+		updated = false
+		docRef := c.Collection(collectionNameVideo).Doc(v.ID)
+		doc, err := t.Get(docRef)
+		if err != nil {
+			if status.Code(err) != codes.NotFound {
+				return err
+			}
+
+			// 存在しない場合は何もしない
+			return nil
+		}
+
+		var oldVideo video
+		doc.DataTo(&oldVideo)
+		oldVideo.id = doc.Ref.ID
+		old := oldVideo.Video()
+		if old.IsReminded() || !old.StartAt.Equal(v.StartAt) {
+			return nil
+		}
+
+		updated = true
+		oldVideo.RemindedStartAt = oldVideo.StartAt
+		temp = oldVideo.Video()
+		err = appendChange(c, t, model.ChangeKindVideo, v.ID)
+		if err != nil {
+			return err
+		}
+		return t.Set(doc.Ref, oldVideo)
+	})
+
+	if err != nil {
+		return model.Video{}, false, err
+	}
+
+	if !updated {
+		return v, false, nil
+	}
+
+	return temp, true, nil
+}
+
+// createVideoSearchTokens 動画の検索用のトークンを作成する
+// ツイートの本文、動画のタイトル、ハッシュタグ、動画配信者の名前が対象
+func createVideoSearchTokens(v model.Video) []string {
+	texts := []string{v.Text, v.Title, v.OwnerName}
+	texts = append(texts, v.HashTags...)
+	return search.Tokenize(texts...)
+}
+
 func fromVideo(v model.Video) video {
 	return video{
-		id:              v.ID,
-		ActorID:         v.ActorID,
-		Source:          v.Source,
-		URL:             v.URL,
-		Text:            v.Text,
-		IsLive:          v.IsLive,
-		MemberOnly:      v.MemberOnly,
-		Notified:        v.Notified,
-		StartAt:         v.StartAt.Time(),
-		RelatedActorID:  v.RelatedActorID,
-		RelatedActorIDs: v.RelatedActorIDs,
-		OwnerName:       v.OwnerName,
-		HashTags:        v.HashTags,
+		id:               v.ID,
+		ActorID:          v.ActorID,
+		Source:           v.Source,
+		URL:              v.URL,
+		ChannelID:        v.ChannelID,
+		Text:             v.Text,
+		Title:            v.Title,
+		Thumbnail:        v.Thumbnail,
+		IsLive:           v.IsLive,
+		MemberOnly:       v.MemberOnly,
+		Notified:         v.Notified,
+		RemindedStartAt:  v.RemindedStartAt.Time(),
+		StartAt:          v.StartAt.Time(),
+		OriginalStartAt:  v.OriginalStartAt.Time(),
+		ActualStartAt:    v.ActualStartAt.Time(),
+		EndAt:            v.EndAt.Time(),
+		RelatedActorID:   v.RelatedActorID,
+		RelatedActorIDs:  v.RelatedActorIDs,
+		OwnerName:        v.OwnerName,
+		HashTags:         v.HashTags,
+		Unavailable:      v.Unavailable,
+		UnavailableCount: v.UnavailableCount,
+		SearchTokens:     createVideoSearchTokens(v),
 	}
 }
 
 func (v video) Video() model.Video {
 	return model.Video{
-		ID:              v.id,
-		ActorID:         v.ActorID,
-		Source:          v.Source,
-		URL:             v.URL,
-		Text:            v.Text,
-		IsLive:          v.IsLive,
-		MemberOnly:      v.MemberOnly,
-		Notified:        v.Notified,
-		StartAt:         jst.From(v.StartAt),
-		RelatedActorID:  v.RelatedActorID,
-		RelatedActorIDs: v.RelatedActorIDs,
-		OwnerName:       v.OwnerName,
-		HashTags:        v.HashTags,
+		ID:               v.id,
+		ActorID:          v.ActorID,
+		Source:           v.Source,
+		URL:              v.URL,
+		ChannelID:        v.ChannelID,
+		Text:             v.Text,
+		Title:            v.Title,
+		Thumbnail:        v.Thumbnail,
+		IsLive:           v.IsLive,
+		MemberOnly:       v.MemberOnly,
+		Notified:         v.Notified,
+		RemindedStartAt:  jst.From(v.RemindedStartAt),
+		StartAt:          jst.From(v.StartAt),
+		OriginalStartAt:  jst.From(v.OriginalStartAt),
+		ActualStartAt:    jst.From(v.ActualStartAt),
+		EndAt:            jst.From(v.EndAt),
+		RelatedActorID:   v.RelatedActorID,
+		RelatedActorIDs:  v.RelatedActorIDs,
+		OwnerName:        v.OwnerName,
+		HashTags:         v.HashTags,
+		Unavailable:      v.Unavailable,
+		UnavailableCount: v.UnavailableCount,
 	}
 }
+
+// UnmarkVideoAsReminded リマインダーを送信できなかった動画を未送信に戻す
+// 保存されている開始時刻と異なる場合はなにもしない
+func UnmarkVideoAsReminded(ctx context.Context, c *firestore.Client, v model.Video) error {
+	return c.RunTransaction(ctx, func(ctx context.Context, t *firestore.Transaction) error {
+		docRef := c.Collection(collectionNameVideo).Doc(v.ID)
+		doc, err := t.Get(docRef)
+		if err != nil {
+			if status.Code(err) != codes.NotFound {
+				return err
+			}
+			return nil
+		}
+
+		var oldVideo video
+		doc.DataTo(&oldVideo)
+		oldVideo.id = doc.Ref.ID
+		old := oldVideo.Video()
+		if !old.IsReminded() || !old.StartAt.Equal(v.StartAt) {
+			return nil
+		}
+
+		oldVideo.RemindedStartAt = time.Time{}
+		err = appendChange(c, t, model.ChangeKindVideo, v.ID)
+		if err != nil {
+			return err
+		}
+		return t.Set(doc.Ref, oldVideo)
+	})
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+)
+
+func TestVideoInheritOriginalStartAt(t *testing.T) {
+	d := jst.Date(2020, 9, 23, 20, 0).Time()
+	tests := []struct {
+		name     string
+		source   string
+		old      video
+		startAt  time.Time
+		expected time.Time
+	}{
+		{"not changed", model.VideoSourceYoutube, video{StartAt: d}, d, time.Time{}},
+		{"changed", model.VideoSourceYoutube, video{StartAt: d}, d.Add(time.Hour), d},
+		{"changed again", model.VideoSourceYoutube, video{StartAt: d.Add(time.Hour), OriginalStartAt: d}, d.Add(2 * time.Hour), d},
+		{"returned", model.VideoSourceYoutube, video{StartAt: d.Add(time.Hour), OriginalStartAt: d}, d, time.Time{}},
+		{"not youtube", model.VideoSourceMildom, video{StartAt: d}, d.Add(time.Hour), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := video{Source: tt.source, StartAt: tt.startAt}.inheritOriginalStartAt(tt.old)
+			if !v.OriginalStartAt.Equal(tt.expected) {
+				t.Errorf("got: %v expect: %v", v.OriginalStartAt, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVideoEqual(t *testing.T) {
+	startAt := time.Date(2020, 4, 29, 11, 0, 0, 0, time.UTC)
+	a := video{
+		ActorID:         "siro",
+		Source:          model.VideoSourceYoutube,
+		StartAt:         startAt,
+		RelatedActorIDs: []string{"iori"},
+		SearchTokens:    []string{"siro"},
+	}
+
+	// Firestoreから読み込んだ場合はタイムゾーンが異なる
+	b := a
+	b.StartAt = startAt.In(time.FixedZone("JST", 9*60*60))
+	if !a.equal(b) {
+		t.Errorf("must be equal: %+v %+v", a, b)
+	}
+
+	c := a
+	c.StartAt = startAt.Add(time.Hour)
+	if a.equal(c) {
+		t.Errorf("startAt must be different")
+	}
+
+	d := a
+	d.RelatedActorIDs = []string{"iori", "suzu"}
+	if a.equal(d) {
+		t.Errorf("relatedActorIDs must be different")
+	}
+
+	e := a
+	e.UnavailableCount = 1
+	if a.equal(e) {
+		t.Errorf("unavailableCount must be different")
+	}
+}
@@ -0,0 +1,270 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// webhookSubscription 外部のサービスへのWebhookの購読
+type webhookSubscription struct {
+	// URL 送信先のURL
+	URL string `firestore:"url"`
+	// Secret 署名に使用する秘密鍵
+	Secret string `firestore:"secret"`
+	// Events 購読するイベントの種類
+	Events []string `firestore:"events"`
+	// Actors 対象の配信者ID
+	Actors []string `firestore:"actors"`
+	// Disabled 無効かどうか
+	Disabled bool `firestore:"disabled"`
+	// ConsecutiveFailures 連続で送信に失敗した回数
+	ConsecutiveFailures int `firestore:"consecutiveFailures"`
+	// CreatedAt 作成した時刻
+	CreatedAt time.Time `firestore:"createdAt"`
+}
+
+// webhookDelivery 送信するWebhook
+type webhookDelivery struct {
+	// SubscriptionID 購読ID
+	SubscriptionID string `firestore:"subscriptionID"`
+	// Event イベントの種類
+	Event string `firestore:"event"`
+	// Payload 送信するJSON
+	Payload string `firestore:"payload"`
+	// Status 送信状況
+	Status string `firestore:"status"`
+	// CreatedAt 保存した時刻
+	CreatedAt time.Time `firestore:"createdAt"`
+	// NextAttemptAt 次に送信を試みる時刻
+	NextAttemptAt time.Time `firestore:"nextAttemptAt"`
+	// Attempts 送信を試みた記録
+	Attempts []webhookAttempt `firestore:"attempts"`
+}
+
+// webhookAttempt Webhookの送信を試みた記録
+type webhookAttempt struct {
+	// AttemptedAt 送信を試みた時刻
+	AttemptedAt time.Time `firestore:"attemptedAt"`
+	// StatusCode レスポンスのステータスコード
+	StatusCode int `firestore:"statusCode"`
+	// Error 送信に失敗した場合のエラー
+	Error string `firestore:"error"`
+}
+
+const collectionNameWebhookSubscription = "WebhookSubscription"
+const collectionNameWebhookDelivery = "WebhookDelivery"
+
+func fromWebhookSubscription(s model.WebhookSubscription) webhookSubscription {
+	return webhookSubscription{
+		URL:                 s.URL,
+		Secret:              s.Secret,
+		Events:              s.Events,
+		Actors:              s.Actors,
+		Disabled:            s.Disabled,
+		ConsecutiveFailures: s.ConsecutiveFailures,
+		CreatedAt:           s.CreatedAt.Time(),
+	}
+}
+
+func (s webhookSubscription) WebhookSubscription(id string) model.WebhookSubscription {
+	return model.WebhookSubscription{
+		ID:                  id,
+		URL:                 s.URL,
+		Secret:              s.Secret,
+		Events:              s.Events,
+		Actors:              s.Actors,
+		Disabled:            s.Disabled,
+		ConsecutiveFailures: s.ConsecutiveFailures,
+		CreatedAt:           jst.From(s.CreatedAt),
+	}
+}
+
+func fromWebhookDelivery(d model.WebhookDelivery) webhookDelivery {
+	var attempts []webhookAttempt
+	for _, a := range d.Attempts {
+		attempts = append(attempts, webhookAttempt{
+			AttemptedAt: a.AttemptedAt.Time(),
+			StatusCode:  a.StatusCode,
+			Error:       a.Error,
+		})
+	}
+
+	return webhookDelivery{
+		SubscriptionID: d.SubscriptionID,
+		Event:          d.Event,
+		Payload:        d.Payload,
+		Status:         d.Status,
+		CreatedAt:      d.CreatedAt.Time(),
+		NextAttemptAt:  d.NextAttemptAt.Time(),
+		Attempts:       attempts,
+	}
+}
+
+func (d webhookDelivery) WebhookDelivery(id string) model.WebhookDelivery {
+	var attempts []model.WebhookAttempt
+	for _, a := range d.Attempts {
+		attempts = append(attempts, model.WebhookAttempt{
+			AttemptedAt: jst.From(a.AttemptedAt),
+			StatusCode:  a.StatusCode,
+			Error:       a.Error,
+		})
+	}
+
+	return model.WebhookDelivery{
+		ID:             id,
+		SubscriptionID: d.SubscriptionID,
+		Event:          d.Event,
+		Payload:        d.Payload,
+		Status:         d.Status,
+		CreatedAt:      jst.From(d.CreatedAt),
+		NextAttemptAt:  jst.From(d.NextAttemptAt),
+		Attempts:       attempts,
+	}
+}
+
+// FindWebhookSubscriptions Webhookの購読を作成した順に取得する
+func FindWebhookSubscriptions(ctx context.Context, c *firestore.Client) ([]model.WebhookSubscription, error) {
+	docs, err := c.Collection(collectionNameWebhookSubscription).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []model.WebhookSubscription{}
+	for _, doc := range docs {
+		var s webhookSubscription
+		doc.DataTo(&s)
+		result = append(result, s.WebhookSubscription(doc.Ref.ID))
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+// FindWebhookSubscription Webhookの購読を取得する
+// 存在しない場合はcommon.ErrNotFoundを返す
+func FindWebhookSubscription(ctx context.Context, c *firestore.Client, id string) (model.WebhookSubscription, error) {
+	doc, err := c.Collection(collectionNameWebhookSubscription).Doc(id).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return model.WebhookSubscription{}, common.ErrNotFound
+		}
+		return model.WebhookSubscription{}, err
+	}
+
+	var s webhookSubscription
+	doc.DataTo(&s)
+	return s.WebhookSubscription(doc.Ref.ID), nil
+}
+
+// CreateWebhookSubscription Webhookの購読を作成してIDを返す
+func CreateWebhookSubscription(ctx context.Context, c *firestore.Client, s model.WebhookSubscription) (string, error) {
+	docRef := c.Collection(collectionNameWebhookSubscription).NewDoc()
+	_, err := docRef.Create(ctx, fromWebhookSubscription(s))
+	if err != nil {
+		return "", err
+	}
+
+	return docRef.ID, nil
+}
+
+// SaveWebhookSubscription Webhookの購読を保存する
+func SaveWebhookSubscription(ctx context.Context, c *firestore.Client, s model.WebhookSubscription) error {
+	_, err := c.Collection(collectionNameWebhookSubscription).Doc(s.ID).Set(ctx, fromWebhookSubscription(s))
+	return err
+}
+
+// DeleteWebhookSubscription Webhookの購読を削除する
+// 送信待ちのWebhookは送信時に購読が見つからないので送信されない
+func DeleteWebhookSubscription(ctx context.Context, c *firestore.Client, id string) error {
+	_, err := c.Collection(collectionNameWebhookSubscription).Doc(id).Delete(ctx)
+	return err
+}
+
+// EnqueueWebhookDelivery 送信するWebhookを保存する
+// 同じIDのWebhookが既に保存されている場合は何もせずにfalseを返す
+func EnqueueWebhookDelivery(ctx context.Context, c *firestore.Client, d model.WebhookDelivery) (bool, error) {
+	_, err := c.Collection(collectionNameWebhookDelivery).Doc(d.ID).Create(ctx, fromWebhookDelivery(d))
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// FindWebhookDeliveriesByStatus 送信状況を指定して送信するWebhookを保存した順に取得する
+func FindWebhookDeliveriesByStatus(ctx context.Context, c *firestore.Client, deliveryStatus string) ([]model.WebhookDelivery, error) {
+	it := c.Collection(collectionNameWebhookDelivery).Where("status", "==", deliveryStatus).Documents(ctx)
+	var result []model.WebhookDelivery
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var d webhookDelivery
+		doc.DataTo(&d)
+		result = append(result, d.WebhookDelivery(doc.Ref.ID))
+	}
+
+	// 複合インデックスを作らなくていいようにメモリ上で並べ替える
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+// SaveWebhookDelivery 送信するWebhookの送信状況を保存する
+func SaveWebhookDelivery(ctx context.Context, c *firestore.Client, d model.WebhookDelivery) error {
+	_, err := c.Collection(collectionNameWebhookDelivery).Doc(d.ID).Set(ctx, fromWebhookDelivery(d))
+	return err
+}
+
+// CompactWebhookDeliveries 指定した時刻より前に保存されたWebhookを削除する
+// 削除された数を返す
+func CompactWebhookDeliveries(ctx context.Context, c *firestore.Client, before jst.Time) (int, error) {
+	count := 0
+	for {
+		docs, err := c.Collection(collectionNameWebhookDelivery).
+			Where("createdAt", "<", before.Time()).
+			Limit(compactBatchSize).
+			Documents(ctx).
+			GetAll()
+		if err != nil {
+			return count, err
+		}
+
+		if len(docs) == 0 {
+			return count, nil
+		}
+
+		batch := c.Batch()
+		for _, doc := range docs {
+			batch.Delete(doc.Ref)
+		}
+
+		_, err = batch.Commit(ctx)
+		if err != nil {
+			return count, err
+		}
+		count += len(docs)
+	}
+}
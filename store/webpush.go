@@ -0,0 +1,256 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/yaegaki/dotlive-schedule-server/jst"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// vapidKey ブラウザのプッシュ通知でサーバーを識別するための鍵
+type vapidKey struct {
+	// PublicKey 非圧縮形式の公開鍵(base64url)
+	PublicKey string `firestore:"publicKey"`
+	// PrivateKey 秘密鍵のスカラー値(base64url)
+	PrivateKey string `firestore:"privateKey"`
+}
+
+// webPushSubscription ブラウザのプッシュ通知の購読
+type webPushSubscription struct {
+	// Endpoint プッシュサービスのエンドポイント
+	Endpoint string `firestore:"endpoint"`
+	// P256dh ブラウザの公開鍵(base64url)
+	P256dh string `firestore:"p256dh"`
+	// Auth 認証用の秘密(base64url)
+	Auth string `firestore:"auth"`
+	// Actors 配信の通知を受け取る配信者ID
+	Actors []string `firestore:"actors"`
+	// Topics 購読するトピック
+	Topics []string `firestore:"topics"`
+	// ConsecutiveFailures 連続で送信に失敗した回数
+	ConsecutiveFailures int `firestore:"consecutiveFailures"`
+	// CreatedAt 作成した時刻
+	CreatedAt time.Time `firestore:"createdAt"`
+}
+
+// webPushDelivery 送信するブラウザのプッシュ通知
+type webPushDelivery struct {
+	// Payload Service Workerに渡すJSON
+	Payload string `firestore:"payload"`
+	// Topics 通知するトピック
+	Topics []string `firestore:"topics"`
+	// ActorIDs 通知に関連する配信者ID
+	ActorIDs []string `firestore:"actorIDs"`
+	// Status 送信状況
+	Status string `firestore:"status"`
+	// CreatedAt 保存した時刻
+	CreatedAt time.Time `firestore:"createdAt"`
+}
+
+const collectionNameVAPIDKey = "VAPIDKey"
+const docIDVAPIDKey = "vapid"
+const collectionNameWebPushSubscription = "WebPushSubscription"
+const collectionNameWebPushDelivery = "WebPushDelivery"
+
+func fromWebPushDelivery(d model.WebPushDelivery) webPushDelivery {
+	return webPushDelivery{
+		Payload:   d.Payload,
+		Topics:    d.Topics,
+		ActorIDs:  d.ActorIDs,
+		Status:    d.Status,
+		CreatedAt: d.CreatedAt.Time(),
+	}
+}
+
+func (d webPushDelivery) WebPushDelivery(id string) model.WebPushDelivery {
+	return model.WebPushDelivery{
+		ID:        id,
+		Payload:   d.Payload,
+		Topics:    d.Topics,
+		ActorIDs:  d.ActorIDs,
+		Status:    d.Status,
+		CreatedAt: jst.From(d.CreatedAt),
+	}
+}
+
+// FindOrCreateVAPIDKey VAPIDの鍵を取得する
+// 保存されていない場合はgenerateで作成して保存する
+// 複数のインスタンスで同時に作成しても同じ鍵になるようにトランザクションで保存する
+func FindOrCreateVAPIDKey(ctx context.Context, c *firestore.Client, generate func() (model.VAPIDKey, error)) (model.VAPIDKey, error) {
+	var result model.VAPIDKey
+	docRef := c.Collection(collectionNameVAPIDKey).Doc(docIDVAPIDKey)
+	err := c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err == nil {
+			var k vapidKey
+			doc.DataTo(&k)
+			result = model.VAPIDKey{
+				PublicKey:  k.PublicKey,
+				PrivateKey: k.PrivateKey,
+			}
+			return nil
+		}
+
+		if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		result, err = generate()
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(docRef, vapidKey{
+			PublicKey:  result.PublicKey,
+			PrivateKey: result.PrivateKey,
+		})
+	})
+	if err != nil {
+		return model.VAPIDKey{}, err
+	}
+
+	return result, nil
+}
+
+// FindWebPushSubscriptions ブラウザのプッシュ通知の購読を全て取得する
+func FindWebPushSubscriptions(ctx context.Context, c *firestore.Client) ([]model.WebPushSubscription, error) {
+	docs, err := c.Collection(collectionNameWebPushSubscription).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []model.WebPushSubscription{}
+	for _, doc := range docs {
+		var s webPushSubscription
+		doc.DataTo(&s)
+		result = append(result, model.WebPushSubscription{
+			ID:                  doc.Ref.ID,
+			Endpoint:            s.Endpoint,
+			P256dh:              s.P256dh,
+			Auth:                s.Auth,
+			Actors:              s.Actors,
+			Topics:              s.Topics,
+			ConsecutiveFailures: s.ConsecutiveFailures,
+			CreatedAt:           jst.From(s.CreatedAt),
+		})
+	}
+
+	return result, nil
+}
+
+// SaveWebPushSubscription ブラウザのプッシュ通知の購読を保存する
+// 再度購読した場合は失敗した回数もリセットされる
+func SaveWebPushSubscription(ctx context.Context, c *firestore.Client, s model.WebPushSubscription) error {
+	_, err := c.Collection(collectionNameWebPushSubscription).Doc(s.ID).Set(ctx, webPushSubscription{
+		Endpoint:  s.Endpoint,
+		P256dh:    s.P256dh,
+		Auth:      s.Auth,
+		Actors:    s.Actors,
+		Topics:    s.Topics,
+		CreatedAt: s.CreatedAt.Time(),
+	})
+	return err
+}
+
+// UpdateWebPushSubscriptionFailures ブラウザのプッシュ通知の購読の連続で失敗した回数を更新する
+// 送信中に購読し直された場合に購読する配信者とトピックを戻さないように回数だけ更新する
+func UpdateWebPushSubscriptionFailures(ctx context.Context, c *firestore.Client, id string, failures int) error {
+	_, err := c.Collection(collectionNameWebPushSubscription).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "consecutiveFailures", Value: failures},
+	})
+	if status.Code(err) == codes.NotFound {
+		// 送信中に購読が解除された
+		return nil
+	}
+	return err
+}
+
+// DeleteWebPushSubscription ブラウザのプッシュ通知の購読を削除する
+// 存在しない場合も成功する
+func DeleteWebPushSubscription(ctx context.Context, c *firestore.Client, id string) error {
+	_, err := c.Collection(collectionNameWebPushSubscription).Doc(id).Delete(ctx)
+	return err
+}
+
+// EnqueueWebPushDelivery 送信するブラウザのプッシュ通知を保存する
+// 同じIDの通知が既に保存されている場合は何もせずにfalseを返す
+func EnqueueWebPushDelivery(ctx context.Context, c *firestore.Client, d model.WebPushDelivery) (bool, error) {
+	_, err := c.Collection(collectionNameWebPushDelivery).Doc(d.ID).Create(ctx, fromWebPushDelivery(d))
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// FindWebPushDeliveriesByStatus 送信状況を指定して送信するブラウザのプッシュ通知を保存した順に取得する
+func FindWebPushDeliveriesByStatus(ctx context.Context, c *firestore.Client, deliveryStatus string) ([]model.WebPushDelivery, error) {
+	it := c.Collection(collectionNameWebPushDelivery).Where("status", "==", deliveryStatus).Documents(ctx)
+	var result []model.WebPushDelivery
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var d webPushDelivery
+		doc.DataTo(&d)
+		result = append(result, d.WebPushDelivery(doc.Ref.ID))
+	}
+
+	// 複合インデックスを作らなくていいようにメモリ上で並べ替える
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+// SaveWebPushDelivery 送信するブラウザのプッシュ通知の送信状況を保存する
+func SaveWebPushDelivery(ctx context.Context, c *firestore.Client, d model.WebPushDelivery) error {
+	_, err := c.Collection(collectionNameWebPushDelivery).Doc(d.ID).Set(ctx, fromWebPushDelivery(d))
+	return err
+}
+
+// CompactWebPushDeliveries 指定した時刻より前に保存されたブラウザのプッシュ通知を削除する
+// 削除された数を返す
+func CompactWebPushDeliveries(ctx context.Context, c *firestore.Client, before jst.Time) (int, error) {
+	count := 0
+	for {
+		docs, err := c.Collection(collectionNameWebPushDelivery).
+			Where("createdAt", "<", before.Time()).
+			Limit(compactBatchSize).
+			Documents(ctx).
+			GetAll()
+		if err != nil {
+			return count, err
+		}
+
+		if len(docs) == 0 {
+			return count, nil
+		}
+
+		batch := c.Batch()
+		for _, doc := range docs {
+			batch.Delete(doc.Ref)
+		}
+
+		_, err = batch.Commit(ctx)
+		if err != nil {
+			return count, err
+		}
+		count += len(docs)
+	}
+}
@@ -0,0 +1,138 @@
+package tweet
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"github.com/yaegaki/dotlive-schedule-server/search"
+)
+
+// actorTerm 配信者を特定するための文字列
+type actorTerm struct {
+	// text 正規化したハッシュタグか別名
+	text string
+	// isHashtag ハッシュタグかどうか
+	isHashtag bool
+	actor     model.Actor
+}
+
+// actorMatch 行の中で見つかった配信者
+type actorMatch struct {
+	actor model.Actor
+	// index 正規化した行での位置
+	index int
+}
+
+// actorMatcher 計画ツイートの行から配信者を探す
+type actorMatcher struct {
+	// terms 長いものから順に並べる
+	terms []actorTerm
+}
+
+// newActorMatcher 配信者の全てのハッシュタグと別名からactorMatcherを作成する
+func newActorMatcher(actors []model.Actor) actorMatcher {
+	var terms []actorTerm
+	for _, a := range actors {
+		for _, hashtag := range a.Hashtags() {
+			text := normalizeLine(hashtag)
+			if !strings.HasPrefix(text, "#") {
+				text = "#" + text
+			}
+			if text == "#" {
+				continue
+			}
+
+			terms = append(terms, actorTerm{text: text, isHashtag: true, actor: a})
+		}
+
+		for _, alias := range a.Aliases {
+			text := normalizeLine(alias)
+			if text == "" {
+				continue
+			}
+
+			terms = append(terms, actorTerm{text: text, actor: a})
+		}
+	}
+
+	// 他のハッシュタグの前方一致になっている場合があるので長いものを優先する
+	sort.SliceStable(terms, func(i, j int) bool {
+		return len(terms[i].text) > len(terms[j].text)
+	})
+
+	return actorMatcher{terms: terms}
+}
+
+// normalizeLine 表記ゆれをなくすために正規化する
+// 全角の'＃'もNFKCで'#'になる
+func normalizeLine(line string) string {
+	return search.Normalize(line)
+}
+
+// match 正規化した行から配信者を探す
+// 同じ位置では最も長く一致するものを使用して、単語の途中で終わるものは一致とみなさない
+// 同じ配信者が複数回出てきた場合は最初のものだけを返す
+// 2つ目の戻り値は配信者のハッシュタグとして一致した数(重複を含む)
+func (m actorMatcher) match(line string) ([]actorMatch, int) {
+	var matches []actorMatch
+	hashtagCount := 0
+	found := map[string]bool{}
+
+	for i := 0; i < len(line); {
+		term, ok := m.matchAt(line, i)
+		if !ok {
+			_, size := utf8.DecodeRuneInString(line[i:])
+			i += size
+			continue
+		}
+
+		if term.isHashtag {
+			hashtagCount++
+		}
+
+		if !found[term.actor.ID] {
+			found[term.actor.ID] = true
+			matches = append(matches, actorMatch{
+				actor: term.actor,
+				index: i,
+			})
+		}
+		i += len(term.text)
+	}
+
+	return matches, hashtagCount
+}
+
+func (m actorMatcher) matchAt(line string, i int) (actorTerm, bool) {
+	prev, _ := utf8.DecodeLastRuneInString(line[:i])
+	for _, term := range m.terms {
+		if !strings.HasPrefix(line[i:], term.text) {
+			continue
+		}
+
+		// 別名は他の単語やハッシュタグの途中から始まる場合は対象外
+		if !term.isHashtag && i > 0 && (isWordRune(prev) || prev == '#') {
+			continue
+		}
+
+		end := i + len(term.text)
+		if end < len(line) {
+			next, _ := utf8.DecodeRuneInString(line[end:])
+			if isWordRune(next) {
+				continue
+			}
+		}
+
+		return term, true
+	}
+
+	return actorTerm{}, false
+}
+
+// isWordRune ハッシュタグや単語の一部になる文字かどうか
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r) || r == '_'
+}
@@ -2,8 +2,6 @@ package tweet
 
 // ScreenName
 const (
-	// ScreenNameDotLive どっとライブ公式アカウント
-	ScreenNameDotlive = "dotLIVEyoutuber"
 	// ScreenNameAwaiSensei 竜崎あわい先生のスケジュール投稿用アカウント
 	ScreenNameAwaiSensei = "dorayoteihyou"
 )
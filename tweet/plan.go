@@ -16,6 +16,7 @@ const liveScheduleStr = "生放送スケジュール"
 const liveScheduleLayout = "【生放送スケジュール1月2日】"
 
 // ParsePlanTweet TweetからPlanを作成する
+// 配信者は全てのハッシュタグと別名から探す
 func ParsePlanTweet(t Tweet, actors model.ActorSlice, strict bool) (model.Plan, error) {
 	lines := strings.Split(t.Text, "\n")
 	state := 0
@@ -29,6 +30,7 @@ func ParsePlanTweet(t Tweet, actors model.ActorSlice, strict bool) (model.Plan,
 
 	collaboID := 1
 	notifyText := ""
+	matcher := newActorMatcher(actors)
 
 	for _, line := range lines {
 		switch state {
@@ -66,13 +68,23 @@ func ParsePlanTweet(t Tweet, actors model.ActorSlice, strict bool) (model.Plan,
 			state = 1
 
 		case 1:
-			line = strings.Replace(line, "＃", "#", 1)
-			l := strings.Split(line, "#")
-			if len(l) == 1 {
+			// 表示用の行は'＃'だけを置き換えて元の表記を残す
+			line = strings.ReplaceAll(line, "＃", "#")
+			normalized := normalizeLine(line)
+			matches, actorHashTagCount := matcher.match(normalized)
+			hashTagCount := strings.Count(normalized, "#")
+			if hashTagCount == 0 && len(matches) == 0 {
 				continue
 			}
 
-			timeStr := strings.TrimSpace(strings.Split(l[0], "~:")[0])
+			prefix := normalized
+			if i := strings.Index(prefix, "#"); i >= 0 {
+				prefix = prefix[:i]
+			}
+			if len(matches) > 0 && matches[0].index < len(prefix) {
+				prefix = prefix[:matches[0].index]
+			}
+			timeStr := strings.TrimSpace(strings.Split(prefix, "~:")[0])
 			startAt, err := parseEntryTime(p.Date, timeStr)
 			if err != nil {
 				continue
@@ -81,18 +93,12 @@ func ParsePlanTweet(t Tweet, actors model.ActorSlice, strict bool) (model.Plan,
 			actorCount := 0
 			prevEntryCount := len(p.Entries)
 
-			for _, actor := range actors {
-				actorIndex := strings.Index(line, actor.Hashtag)
-				if actorIndex < 0 {
-					continue
-				}
-
-				targetStr := line[actorIndex:]
+			for _, m := range matches {
+				targetStr := normalized[m.index:]
 				collaboIndex := strings.Index(targetStr, "×")
 				if collaboIndex >= 0 {
 					targetStr = targetStr[:collaboIndex]
 				}
-				targetStr = strings.ToLower(targetStr)
 
 				var source string
 				memberOnly := false
@@ -106,7 +112,7 @@ func ParsePlanTweet(t Tweet, actors model.ActorSlice, strict bool) (model.Plan,
 				}
 
 				p.Entries = append(p.Entries, model.PlanEntry{
-					ActorID:    actor.ID,
+					ActorID:    m.actor.ID,
 					PlanTag:    p.PlanTag,
 					StartAt:    startAt,
 					Source:     source,
@@ -117,16 +123,16 @@ func ParsePlanTweet(t Tweet, actors model.ActorSlice, strict bool) (model.Plan,
 			}
 
 			// strictの場合は知らないハッシュタグがあるとエラー扱い
-			if strict && actorCount != (len(l)-1) {
+			if strict && actorHashTagCount != hashTagCount {
 				return model.Plan{}, xerrors.Errorf("invalid line: %v", line)
 			}
 
 			if actorCount == 0 {
-				hashTagIndex := strings.Index(line, "#")
-				if hashTagIndex < 0 {
-					panic("hashTagIndex")
+				// '＃'以外の記号が正規化で'#'になった場合は正規化した行を使う
+				hashTag := normalized[strings.Index(normalized, "#"):]
+				if hashTagIndex := strings.Index(line, "#"); hashTagIndex >= 0 {
+					hashTag = line[hashTagIndex:]
 				}
-				hashTag := string([]rune(line)[hashTagIndex:])
 				// コラボやイベントなどの特殊なハッシュタグ
 				p.Entries = append(p.Entries, model.PlanEntry{
 					ActorID: model.ActorIDUnknown,
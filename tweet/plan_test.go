@@ -488,8 +488,104 @@ http://vrlive.party/member/
 	})
 }
 
+func TestParsePlanTextAmbiguous(t *testing.T) {
+	siro := Siro
+	siro.SubHashtags = []string{"#シロ"}
+	siro.Aliases = []string{"電脳少女シロ"}
+	// メインのハッシュタグの前方一致になっている別の配信者
+	siroChannel := model.Actor{
+		ID:      "siro-channel",
+		Name:    "シロちゃんねる",
+		Hashtag: "#シロ生放送ちゃんねる",
+	}
+	pino := Pino
+	pino.SubHashtags = []string{"＃ＰＩＮＯ"}
+	actors := model.ActorSlice{siro, siroChannel, pino, Suzu, Iori}
+
+	tests := []struct {
+		name  string
+		line  string
+		parts []EntryPart
+	}{
+		{
+			"longest match",
+			"20:00~: #シロ生放送ちゃんねる",
+			[]EntryPart{CreateEntryPart(siroChannel, 20, 00)},
+		},
+		{
+			"main hashtag",
+			"20:00~: #シロ生放送 (bilibili)",
+			[]EntryPart{CreateEntryPartBilibili(siro, 20, 00)},
+		},
+		{
+			"sub hashtag",
+			"20:00~: #シロ",
+			[]EntryPart{CreateEntryPart(siro, 20, 00)},
+		},
+		{
+			"token boundary",
+			"20:00~: #シロクマ",
+			[]EntryPart{CreateEntryPartCollaboHashTag(20, 00, "#シロクマ")},
+		},
+		{
+			"full-width hash mid-line",
+			"21:00~: ＃神楽すず × ＃ヤマトイオリ",
+			[]EntryPart{
+				CreateEntryPartCollabo(Suzu, 21, 00, 1),
+				CreateEntryPartCollabo(Iori, 21, 00, 1),
+			},
+		},
+		{
+			"nfkc",
+			"２１:００~: #pino (Ｍｉｌｄｏｍ)",
+			[]EntryPart{CreateEntryPartMildom(pino, 21, 00)},
+		},
+		{
+			"alias",
+			"22:00~: 電脳少女シロ × #神楽すず",
+			[]EntryPart{
+				CreateEntryPartCollabo(siro, 22, 00, 1),
+				CreateEntryPartCollabo(Suzu, 22, 00, 1),
+			},
+		},
+		{
+			"alias in other hashtag",
+			"22:00~: #電脳少女シロちゃん",
+			[]EntryPart{CreateEntryPartCollaboHashTag(22, 00, "#電脳少女シロちゃん")},
+		},
+		{
+			"same actor",
+			"23:00~: #シロ生放送 #シロ",
+			[]EntryPart{CreateEntryPart(siro, 23, 00)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tweetDate := jst.ShortDate(2021, 4, 18)
+			tweet := Tweet{
+				ID:   "temp",
+				Date: tweetDate,
+				Text: "【生放送スケジュール4月19日】\n\n" + tt.line + "\n\n#アイドル部　#どっとライブ",
+			}
+			comparePlanWithActors(t, tweet, actors, CreatePlan(tweetDate.AddOneDay(), tt.parts), false)
+
+			// 知らないハッシュタグが無ければstrictでも成功する
+			_, err := ParsePlanTweet(tweet, actors, true)
+			unknown := len(tt.parts) == 1 && tt.parts[0].Actor.ID == model.ActorIDUnknown
+			if (err != nil) != unknown {
+				t.Errorf("invalid strict mode: %v", err)
+			}
+		})
+	}
+}
+
 func comparePlan(t *testing.T, tweet Tweet, expect model.Plan, testText bool) {
-	p, err := ParsePlanTweet(tweet, All, false)
+	comparePlanWithActors(t, tweet, All, expect, testText)
+}
+
+func comparePlanWithActors(t *testing.T, tweet Tweet, actors model.ActorSlice, expect model.Plan, testText bool) {
+	p, err := ParsePlanTweet(tweet, actors, false)
 	if err != nil {
 		t.Errorf("Can not parse tweet: %v", err)
 		return
@@ -554,6 +650,10 @@ func comparePlan(t *testing.T, tweet Tweet, expect model.Plan, testText bool) {
 		if e.MemberOnly != expectEntry.MemberOnly {
 			t.Errorf("invalid MemberOnly, got: %v expect: %v", e.MemberOnly, expectEntry.MemberOnly)
 		}
+
+		if e.HashTag != expectEntry.HashTag {
+			t.Errorf("invalid HashTag, got: %v expect: %v", e.HashTag, expectEntry.HashTag)
+		}
 	}
 
 	if testText {
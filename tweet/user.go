@@ -1,12 +1,22 @@
 package tweet
 
 import (
+	"errors"
+	"net/http"
 	"net/url"
 
 	"github.com/ChimeraCoder/anaconda"
+	"github.com/yaegaki/dotlive-schedule-server/common"
 	"github.com/yaegaki/dotlive-schedule-server/model"
 )
 
+const (
+	// twitterErrorUserNotFound ユーザーが存在しない場合のTwitterのエラーコード
+	twitterErrorUserNotFound = 50
+	// twitterErrorUserSuspended ユーザーが凍結されている場合のTwitterのエラーコード
+	twitterErrorUserSuspended = 63
+)
+
 // GetProfileImageURL Twitterのアイコン画像のURLを取得する
 func GetProfileImageURL(api *anaconda.TwitterApi, actor model.Actor) (string, error) {
 	u, err := api.GetUsersShow(actor.TwitterScreenName, url.Values{})
@@ -16,3 +26,38 @@ func GetProfileImageURL(api *anaconda.TwitterApi, actor model.Actor) (string, er
 
 	return u.ProfileImageUrlHttps, nil
 }
+
+// FindProfileImageURL スクリーンネームからTwitterのアイコン画像のURLを取得する
+// GetProfileImageURLと異なりエラーを返し、ユーザーが見つからない場合はcommon.ErrNotFound
+func FindProfileImageURL(api *anaconda.TwitterApi, screenName string) (string, error) {
+	u, err := api.GetUsersShow(screenName, url.Values{})
+	if err != nil {
+		if isUserNotFound(err) {
+			return "", common.ErrNotFound
+		}
+		return "", err
+	}
+
+	return u.ProfileImageUrlHttps, nil
+}
+
+// isUserNotFound ユーザーが存在しないか凍結されているためのエラーかどうか
+// レート制限や通信のエラーはfalse
+func isUserNotFound(err error) bool {
+	var apiErr *anaconda.ApiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	if apiErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+
+	for _, e := range apiErr.Decoded.Errors {
+		if e.Code == twitterErrorUserNotFound || e.Code == twitterErrorUserSuspended {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,32 @@
+package tweet
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+func TestIsUserNotFound(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		expect bool
+	}{
+		{"not found", &anaconda.ApiError{StatusCode: http.StatusNotFound}, true},
+		{"suspended", &anaconda.ApiError{StatusCode: http.StatusForbidden, Decoded: anaconda.TwitterErrorResponse{Errors: []anaconda.TwitterError{{Code: twitterErrorUserSuspended}}}}, true},
+		{"wrapped", fmt.Errorf("wrapped: %w", &anaconda.ApiError{StatusCode: http.StatusNotFound}), true},
+		{"rate limit", &anaconda.ApiError{StatusCode: http.StatusTooManyRequests}, false},
+		{"network", errors.New("connection refused"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUserNotFound(tt.err); got != tt.expect {
+				t.Errorf("got: %v expect: %v", got, tt.expect)
+			}
+		})
+	}
+}
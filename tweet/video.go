@@ -13,57 +13,65 @@ type VideoResolver interface {
 	Except(url string) bool
 	// Resolve URLから動画情報を取得して保存する
 	Resolve(tweet Tweet, url string, actor model.Actor) error
-	// Mark 読み取った最後のTweetIDを保存する
-	Mark(tweetID string, actor model.Actor) error
+	// Mark 読み取った最後のTweetIDを反映した配信者を保存する
+	Mark(actor model.Actor) error
 }
 
 // ResolveVideos Twitterから動画情報を取得する
+// 配信者の全てのTwitterアカウントをそれぞれのLastTweetIDから読み取る
 func ResolveVideos(api *anaconda.TwitterApi, actors []model.Actor, r VideoResolver) {
 	for _, actor := range actors {
-		tl, err := getTimeline(api, actor.TwitterScreenName, actor.LastTweetID, "")
-		if err != nil {
-			log.Printf("Can not get tweet for %v: %v", actor.Name, err)
-			continue
-		}
-
-		hasError := false
-		lastTweetID := ""
-
-		for _, tweet := range tl {
-			if lastTweetID == "" {
-				lastTweetID = tweet.ID
+		for _, account := range actor.TwitterAccounts() {
+			lastTweetID, ok := resolveVideosForAccount(api, actor, account, r)
+			if !ok {
+				continue
 			}
 
-			err := resolveVideoForTweet(r, actor, tweet)
+			// 同じ配信者の他のアカウントのLastTweetIDを上書きしないように更新した配信者を使い続ける
+			actor = actor.WithLastTweetID(account.ScreenName, lastTweetID)
+			err := r.Mark(actor)
 			if err != nil {
-				log.Printf("Can not resolve video for %v: %v", actor.Name, err)
-				hasError = true
-				break
-			}
-
-			if tweet.QuotedTweet != nil {
-				err = resolveVideoForTweet(r, actor, *tweet.QuotedTweet)
-				if err != nil {
-					log.Printf("(QuatedTweet)Can not resolve video for %v: %v", actor.Name, err)
-					hasError = true
-					break
-				}
+				log.Printf("Can not mark last tweetID for %v(@%v): %v", actor.Name, account.ScreenName, err)
 			}
 		}
+	}
+}
 
-		if hasError {
-			continue
-		}
+// resolveVideosForAccount アカウントのタイムラインから動画情報を取得する
+// 最後に読み取ったTweetIDを保存するべき場合はそのIDとtrueを返す
+func resolveVideosForAccount(api *anaconda.TwitterApi, actor model.Actor, account model.TwitterAccount, r VideoResolver) (string, bool) {
+	tl, err := getTimeline(api, account.ScreenName, account.LastTweetID, "")
+	if err != nil {
+		log.Printf("Can not get tweet for %v(@%v): %v", actor.Name, account.ScreenName, err)
+		return "", false
+	}
 
+	lastTweetID := ""
+	for _, tweet := range tl {
 		if lastTweetID == "" {
-			continue
+			lastTweetID = tweet.ID
 		}
 
-		err = r.Mark(lastTweetID, actor)
+		err := resolveVideoForTweet(r, actor, tweet)
 		if err != nil {
-			log.Printf("Can not mark last tweetID for %v: %v", actor.Name, err)
+			log.Printf("Can not resolve video for %v: %v", actor.Name, err)
+			return "", false
+		}
+
+		if tweet.QuotedTweet != nil {
+			err = resolveVideoForTweet(r, actor, *tweet.QuotedTweet)
+			if err != nil {
+				log.Printf("(QuatedTweet)Can not resolve video for %v: %v", actor.Name, err)
+				return "", false
+			}
 		}
 	}
+
+	if lastTweetID == "" {
+		return "", false
+	}
+
+	return lastTweetID, true
 }
 
 func resolveVideoForTweet(r VideoResolver, actor model.Actor, tweet Tweet) error {
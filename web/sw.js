@@ -0,0 +1,20 @@
+// ブラウザのプッシュ通知を表示するService Worker
+self.addEventListener('push', function (event) {
+    if (!event.data) {
+        return;
+    }
+
+    var payload = event.data.json();
+    event.waitUntil(self.registration.showNotification(payload.title, {
+        body: payload.body,
+        tag: payload.tag,
+        icon: '/favicon.ico',
+        data: { url: payload.url },
+    }));
+});
+
+self.addEventListener('notificationclick', function (event) {
+    event.notification.close();
+    var url = (event.notification.data && event.notification.data.url) || '/';
+    event.waitUntil(clients.openWindow(url));
+});
@@ -0,0 +1,94 @@
+// ブラウザのプッシュ通知の購読
+(function () {
+    var form = document.getElementById('webpush');
+    if (!form) {
+        return;
+    }
+
+    if (!('serviceWorker' in navigator) || !('PushManager' in window)) {
+        form.textContent = 'このブラウザは通知に対応していません。';
+        return;
+    }
+
+    var status = document.getElementById('webpush-status');
+    var options = document.getElementById('webpush-options');
+
+    function decodeKey(s) {
+        var padding = '='.repeat((4 - s.length % 4) % 4);
+        var raw = atob((s + padding).replace(/-/g, '+').replace(/_/g, '/'));
+        var result = new Uint8Array(raw.length);
+        for (var i = 0; i < raw.length; i++) {
+            result[i] = raw.charCodeAt(i);
+        }
+        return result;
+    }
+
+    function addOption(kind, value, label) {
+        var l = document.createElement('label');
+        var input = document.createElement('input');
+        input.type = 'checkbox';
+        input.name = kind;
+        input.value = value;
+        l.appendChild(input);
+        l.appendChild(document.createTextNode(label));
+        options.appendChild(l);
+    }
+
+    function checkedValues(kind) {
+        var result = [];
+        form.querySelectorAll('input[name="' + kind + '"]:checked').forEach(function (input) {
+            result.push(input.value);
+        });
+        return result;
+    }
+
+    Promise.all([
+        fetch('/api/webpush').then(function (res) { return res.json(); }),
+        navigator.serviceWorker.register('/sw.js'),
+    ]).then(function (results) {
+        var info = results[0];
+        var registration = results[1];
+
+        info.topics.forEach(function (t) { addOption('topics', t.name, t.displayName); });
+        info.actors.forEach(function (a) { addOption('actors', a.id, a.name); });
+
+        form.addEventListener('submit', function (e) {
+            e.preventDefault();
+            registration.pushManager.subscribe({
+                userVisibleOnly: true,
+                applicationServerKey: decodeKey(info.publicKey),
+            }).then(function (subscription) {
+                return fetch('/api/webpush/subscriptions', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({
+                        subscription: subscription.toJSON(),
+                        actors: checkedValues('actors'),
+                        topics: checkedValues('topics'),
+                    }),
+                });
+            }).then(function (res) {
+                status.textContent = res.ok ? '通知を登録しました。' : '通知を登録できませんでした。';
+            }).catch(function () {
+                status.textContent = '通知が許可されていません。';
+            });
+        });
+
+        document.getElementById('webpush-unsubscribe').addEventListener('click', function () {
+            registration.pushManager.getSubscription().then(function (subscription) {
+                if (!subscription) {
+                    return;
+                }
+                return fetch('/api/webpush/subscriptions', {
+                    method: 'DELETE',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ endpoint: subscription.endpoint }),
+                }).then(function () {
+                    return subscription.unsubscribe();
+                });
+            }).then(function () {
+                status.textContent = '通知を解除しました。';
+            });
+        });
+    });
+})();
@@ -0,0 +1,39 @@
+package youtube
+
+import (
+	"context"
+
+	"github.com/yaegaki/dotlive-schedule-server/common"
+	"github.com/yaegaki/dotlive-schedule-server/model"
+	"golang.org/x/oauth2/google"
+	y "google.golang.org/api/youtube/v3"
+)
+
+// NewService 読み取り専用のYoutubeのサービスを作成する
+func NewService(ctx context.Context) (*y.Service, error) {
+	httpClient, err := google.DefaultClient(ctx, y.YoutubeReadonlyScope)
+	if err != nil {
+		return nil, err
+	}
+
+	return y.New(httpClient)
+}
+
+// FindChannel チャンネルIDからチャンネルの情報を取得する
+// チャンネルが存在しない場合はcommon.ErrNotFound
+func FindChannel(s *y.Service, channelID string) (model.Channel, error) {
+	res, err := s.Channels.List("snippet").Id(channelID).Do()
+	if err != nil {
+		return model.Channel{}, err
+	}
+
+	if len(res.Items) == 0 {
+		return model.Channel{}, common.ErrNotFound
+	}
+
+	return model.Channel{
+		Source: model.VideoSourceYoutube,
+		ID:     channelID,
+		Name:   res.Items[0].Snippet.Title,
+	}, nil
+}
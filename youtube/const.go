@@ -1,8 +0,0 @@
-package youtube
-
-const (
-	// ChannelIDDotLive どっとライブのチャンネルID
-	ChannelIDDotLive = "UCAZ_LA7f0sjuZ1Ni8L2uITw"
-	// ChannelNameDotLive どっとライブのチャンネル名
-	ChannelNameDotLive = "どっとライブ"
-)
@@ -31,7 +31,9 @@ func IsYoutubeURL(url string) bool {
 }
 
 // FindVideo youtubeのURLから動画情報を取得する
-func FindVideo(ctx context.Context, s *y.Service, youtubeURL string, relatedActor model.Actor, tweetDate jst.Time) (model.Video, error) {
+// 配信者のメインチャンネルとサブチャンネルのどちらの動画も配信者の動画とする
+// 組織の公式チャンネルの動画の場合は配信者不明の動画とする
+func FindVideo(ctx context.Context, s *y.Service, youtubeURL string, relatedActor model.Actor, org model.Organization, tweetDate jst.Time) (model.Video, error) {
 	u, err := url.Parse(youtubeURL)
 	if err != nil {
 		return model.Video{}, err
@@ -52,7 +54,7 @@ func FindVideo(ctx context.Context, s *y.Service, youtubeURL string, relatedActo
 	var item *y.Video
 	retry := 0
 	videoOwnerName := relatedActor.Name
-	isDotLiveChannel := false
+	isOfficialChannel := false
 	for {
 		res, err := s.Videos.List("snippet,contentDetails,liveStreamingDetails").Id(videoID).Do()
 		if err != nil {
@@ -62,18 +64,19 @@ func FindVideo(ctx context.Context, s *y.Service, youtubeURL string, relatedActo
 		if len(res.Items) == 0 {
 			retry++
 			log.Printf("Can not get video info %v. retry after 5 sec. retry(%v)", videoID, retry)
+			// 削除された動画や非公開の動画は取得できない
 			if retry >= 5 {
-				return model.Video{}, fmt.Errorf("Can not get video info %v", videoID)
+				return model.Video{}, fmt.Errorf("Can not get video info %v: %w", videoID, common.ErrVideoUnavailable)
 			}
 			<-time.After(5 * time.Second)
 			continue
 		}
 
 		item = res.Items[0]
-		if item.Snippet.ChannelId != relatedActor.YoutubeChannelID {
-			if item.Snippet.ChannelId == ChannelIDDotLive {
-				isDotLiveChannel = true
-				videoOwnerName = ChannelNameDotLive
+		if !relatedActor.HasChannel(model.VideoSourceYoutube, item.Snippet.ChannelId) {
+			if org.YoutubeChannelID != "" && item.Snippet.ChannelId == org.YoutubeChannelID {
+				isOfficialChannel = true
+				videoOwnerName = org.YoutubeChannelName
 			} else if isActorRelatedVideo(item.Snippet.Description, relatedActor) {
 				isCollaboVideo = true
 				videoOwnerName = item.Snippet.ChannelTitle
@@ -89,13 +92,16 @@ func FindVideo(ctx context.Context, s *y.Service, youtubeURL string, relatedActo
 		ID:        videoID + "-Youtube",
 		Source:    model.VideoSourceYoutube,
 		URL:       youtubeURL,
+		ChannelID: item.Snippet.ChannelId,
+		Title:     item.Snippet.Title,
+		Thumbnail: thumbnailURL(item.Snippet.Thumbnails),
 		OwnerName: videoOwnerName,
 		// TODO: 動画からメン限かどうか取得する
 		//       (無理そう, status.privacyStatusがunlistedだったら大体メン限だが限定公開の可能性もある)
 		MemberOnly: false,
 	}
 
-	if isDotLiveChannel {
+	if isOfficialChannel {
 		v.ActorID = model.ActorIDUnknown
 	} else if isCollaboVideo {
 		v.ActorID = model.ActorIDUnknown
@@ -129,6 +135,7 @@ func FindVideo(ctx context.Context, s *y.Service, youtubeURL string, relatedActo
 			if !hasScheduledStartTime || actualStartAt.Before(startAt) {
 				startAt = actualStartAt
 			}
+			v.ActualStartAt = jst.From(actualStartAt)
 			hasActualStartTime = true
 		}
 
@@ -138,6 +145,15 @@ func FindVideo(ctx context.Context, s *y.Service, youtubeURL string, relatedActo
 			startAt = tweetDate.Time()
 			log.Printf("warning: not found startTime for id: %v", videoID)
 		}
+
+		// 配信が終わっている場合
+		if item.LiveStreamingDetails.ActualEndTime != "" {
+			endAt, err := time.Parse(time.RFC3339, item.LiveStreamingDetails.ActualEndTime)
+			if err != nil {
+				return model.Video{}, err
+			}
+			v.EndAt = jst.From(endAt)
+		}
 	} else {
 		startAt, err = time.Parse(time.RFC3339, item.Snippet.PublishedAt)
 		if err != nil {
@@ -150,6 +166,22 @@ func FindVideo(ctx context.Context, s *y.Service, youtubeURL string, relatedActo
 	return v, nil
 }
 
+// thumbnailURL 通知に表示するサムネイルのURLを取得する
+// 通知の画像はサイズに制限があるので一番大きいものではなく高画質のものを使用する
+func thumbnailURL(t *y.ThumbnailDetails) string {
+	if t == nil {
+		return ""
+	}
+
+	for _, thumbnail := range []*y.Thumbnail{t.High, t.Medium, t.Default} {
+		if thumbnail != nil && thumbnail.Url != "" {
+			return thumbnail.Url
+		}
+	}
+
+	return ""
+}
+
 // hasYoutubeChannelLink 文字列中にyoutubeのチャンネルIDへのリンクが含まれているかどうか
 func hasYoutubeChannelLink(text string, channelID string) bool {
 	if channelID == "" {
@@ -172,13 +204,16 @@ func hasYoutubeChannelMention(text string, channelName string) bool {
 }
 
 // isActorRelatedVideo アクターに関連する動画かどうか
+// サブチャンネルへのリンクやメンションも対象にする
 func isActorRelatedVideo(desc string, actor model.Actor) bool {
-	if hasYoutubeChannelLink(desc, actor.YoutubeChannelID) {
-		return true
-	}
+	for _, c := range actor.Channels(model.VideoSourceYoutube) {
+		if hasYoutubeChannelLink(desc, c.ID) {
+			return true
+		}
 
-	if hasYoutubeChannelMention(desc, actor.YoutubeChannelName) {
-		return true
+		if hasYoutubeChannelMention(desc, c.Name) {
+			return true
+		}
 	}
 
 	return false
@@ -1,6 +1,10 @@
 package youtube
 
-import "testing"
+import (
+	"testing"
+
+	y "google.golang.org/api/youtube/v3"
+)
 
 func TestIsYoutubeChannelURL(t *testing.T) {
 	if !IsYoutubeChannelURL("https://www.youtube.com/channel/UCP9ZgeIJ3Ri9En69R0kJc9Q") {
@@ -24,3 +28,25 @@ func TestIsYoutubeURL(t *testing.T) {
 		}
 	}
 }
+
+func TestThumbnailURL(t *testing.T) {
+	if thumbnailURL(nil) != "" {
+		t.Errorf("nil thumbnails")
+	}
+
+	u := thumbnailURL(&y.ThumbnailDetails{
+		Default: &y.Thumbnail{Url: "https://i.ytimg.com/vi/id/default.jpg"},
+		High:    &y.Thumbnail{Url: "https://i.ytimg.com/vi/id/hqdefault.jpg"},
+		Maxres:  &y.Thumbnail{Url: "https://i.ytimg.com/vi/id/maxresdefault.jpg"},
+	})
+	if u != "https://i.ytimg.com/vi/id/hqdefault.jpg" {
+		t.Errorf("got: %v", u)
+	}
+
+	u = thumbnailURL(&y.ThumbnailDetails{
+		Default: &y.Thumbnail{Url: "https://i.ytimg.com/vi/id/default.jpg"},
+	})
+	if u != "https://i.ytimg.com/vi/id/default.jpg" {
+		t.Errorf("fallback, got: %v", u)
+	}
+}